@@ -67,6 +67,32 @@ func (bt *BTree) Get(key Item) (Item, bool) {
 	return nil, false
 }
 
+// Seek returns the iterator which returns the items in ascending order from the smallest item
+// which is not less than the given key. When the key is nil, the iteration starts from the smallest item.
+// The tree must not be modified during the iteration.
+func (bt *BTree) Seek(key Item) *Iterator {
+	it := &Iterator{}
+	if bt.Empty() {
+		return it
+	}
+
+	if key == nil {
+		it.descend(bt.Root)
+		return it
+	}
+
+	node := bt.Root
+	for {
+		index, found := bt.search(node, key)
+		it.stack = append(it.stack, &cursor{node: node, index: index})
+		if found || bt.isLeaf(node) {
+			return it
+		}
+
+		node = node.Children[index]
+	}
+}
+
 // TODO: change to Remove
 func (bt *BTree) remove(key Item) {
 	// TODO: support deletion
@@ -250,6 +276,58 @@ func (bt *BTree) splitNonRoot(node *Node) {
 	bt.split(parent)
 }
 
+/*
+ * --------
+ * Iterator
+ * --------
+ */
+
+// Iterator iterates the items of the tree in ascending order.
+type Iterator struct {
+	// stack is the path from the root to the current node.
+	stack []*cursor
+}
+
+// cursor points to the item of the node to be returned next.
+// When the node is internal, the child on the right of the item is visited after the item.
+type cursor struct {
+	node  *Node
+	index int
+}
+
+// Next returns the next item. false is returned when no more items are found.
+func (it *Iterator) Next() (Item, bool) {
+	for len(it.stack) > 0 {
+		top := it.stack[len(it.stack)-1]
+		if top.index >= len(top.node.Items) {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+
+		item := top.node.Items[top.index]
+		top.index++
+		if top.index < len(top.node.Children) {
+			it.descend(top.node.Children[top.index])
+		}
+
+		return item, true
+	}
+
+	return nil, false
+}
+
+// descend pushes the leftmost path from the node.
+func (it *Iterator) descend(node *Node) {
+	for {
+		it.stack = append(it.stack, &cursor{node: node})
+		if len(node.Children) == 0 {
+			return
+		}
+
+		node = node.Children[0]
+	}
+}
+
 /*
  * -------
  * helpers
@@ -262,23 +340,67 @@ func setParent(nodes []*Node, parent *Node) {
 	}
 }
 
+// serializedBTree is the serialization format of BTree. Only the items are encoded in the order
+// because the nodes have the pointers to their parents, which gob cannot encode.
+type serializedBTree struct {
+	M     int
+	Items []Item
+}
+
 func (bt *BTree) Serialize() ([]byte, error) {
 	var buff bytes.Buffer
-	if err := gob.NewEncoder(&buff).Encode(&bt); err != nil {
+	if err := gob.NewEncoder(&buff).Encode(&serializedBTree{M: bt.M, Items: bt.items()}); err != nil {
 		return nil, fmt.Errorf("serialize btree: %w", err)
 	}
 
 	return buff.Bytes(), nil
 }
 
+// Deserialize decodes the items and rebuilds the tree.
 func (bt *BTree) Deserialize(r io.Reader) error {
-	if err := gob.NewDecoder(r).Decode(bt); err != nil {
+	var sbt serializedBTree
+	if err := gob.NewDecoder(r).Decode(&sbt); err != nil {
 		return fmt.Errorf("deserialize btree: %w", err)
 	}
 
+	bt.Root = nil
+	bt.Size = 0
+	if sbt.M > 0 {
+		bt.M = sbt.M
+	}
+
+	for _, item := range sbt.Items {
+		bt.Put(item)
+	}
+
 	return nil
 }
 
+// items returns all the items in the order.
+func (bt *BTree) items() []Item {
+	items := make([]Item, 0, bt.Size)
+	if bt.Empty() {
+		return items
+	}
+
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for i, item := range node.Items {
+			if i < len(node.Children) {
+				walk(node.Children[i])
+			}
+			items = append(items, item)
+		}
+
+		if len(node.Children) > len(node.Items) {
+			walk(node.Children[len(node.Items)])
+		}
+	}
+	walk(bt.Root)
+
+	return items
+}
+
 // String returns a string representation of container (for debugging purposes)
 func (bt *BTree) String() string {
 	var buffer bytes.Buffer
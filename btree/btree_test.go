@@ -1,6 +1,7 @@
 package btree
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/dty1er/sdb/testutil"
@@ -203,3 +204,66 @@ func TestBTreePut4(t *testing.T) {
 	assertValidTreeNode(t, tree.Root.Children[2].Children[0], 1, 0, []int{4}, true)
 	assertValidTreeNode(t, tree.Root.Children[2].Children[1], 1, 0, []int{6}, true)
 }
+
+func TestBTree_Serialize(t *testing.T) {
+	RegisterSerializationTarget(IntItem(0))
+	tree := New()
+	for _, i := range []int{7, 9, 10, 6, 3, 4, 5, 8, 2, 1} {
+		tree.Put(IntItem(i))
+	}
+
+	serialized, err := tree.Serialize()
+	testutil.MustBeNil(t, err)
+
+	restored := New()
+	testutil.MustBeNil(t, restored.Deserialize(bytes.NewReader(serialized)))
+	testutil.MustEqual(t, restored.Size, 10)
+	testutil.MustEqual(t, restored.items(), []Item{IntItem(1), IntItem(2), IntItem(3), IntItem(4), IntItem(5), IntItem(6), IntItem(7), IntItem(8), IntItem(9), IntItem(10)})
+	for i := 1; i <= 10; i++ {
+		_, found := restored.Get(IntItem(i))
+		testutil.MustEqual(t, found, true)
+	}
+}
+
+func TestBTree_Seek(t *testing.T) {
+	RegisterSerializationTarget(IntItem(0))
+	tree := New()
+	for i := 1; i <= 20; i++ {
+		tree.Put(IntItem(i * 2))
+	}
+
+	collect := func(it *Iterator) []Item {
+		items := []Item{}
+		for {
+			item, ok := it.Next()
+			if !ok {
+				return items
+			}
+			items = append(items, item)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		key      Item
+		expected []Item
+	}{
+		{name: "from the smallest", key: nil, expected: tree.items()},
+		{name: "key is smaller than every item", key: IntItem(0), expected: tree.items()},
+		{name: "key is found", key: IntItem(8), expected: tree.items()[3:]},
+		{name: "key is in the internal node", key: tree.Root.Items[0], expected: tree.items()[int(tree.Root.Items[0].(IntItem))/2-1:]},
+		{name: "key is not found", key: IntItem(9), expected: tree.items()[4:]},
+		{name: "last", key: IntItem(40), expected: []Item{IntItem(40)}},
+		{name: "key is larger than every item", key: IntItem(41), expected: []Item{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			testutil.MustEqual(t, collect(tree.Seek(test.key)), test.expected)
+		})
+	}
+
+	// empty tree
+	testutil.MustEqual(t, collect(New().Seek(nil)), []Item{})
+}
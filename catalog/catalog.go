@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 
+	"github.com/dty1er/sdb/header"
 	"github.com/dty1er/sdb/schema"
 	"github.com/dty1er/sdb/sdb"
 )
@@ -31,6 +33,11 @@ func New(dm sdb.DiskManager) (*Catalog, error) {
 		return nil, err
 	}
 
+	// make sure the catalog is written in the format which this sdb can read
+	if _, err := header.Verify(dm, len(c.Tables) != 0); err != nil {
+		return nil, err
+	}
+
 	if len(c.Tables) == 0 {
 		c = Catalog{
 			Tables: map[string]*schema.Table{},
@@ -83,6 +90,33 @@ func (c *Catalog) FindTable(table string) bool {
 	return ok
 }
 
+// ListTables returns all the tables sorted by the name.
+func (c *Catalog) ListTables() []*schema.Table {
+	c.latch.RLock()
+	defer c.latch.RUnlock()
+
+	tables := make([]*schema.Table, 0, len(c.Tables))
+	for _, table := range c.Tables {
+		tables = append(tables, table)
+	}
+
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables
+}
+
+// SetStatistics replaces the statistics of the table.
+func (c *Catalog) SetStatistics(table string, stats *schema.TableStatistics) error {
+	c.latch.Lock()
+	defer c.latch.Unlock()
+
+	if !c.FindTable(table) {
+		return fmt.Errorf("table %s is not found", table)
+	}
+
+	c.Tables[table].Statistics = stats
+	return nil
+}
+
 func (c *Catalog) ListIndices() []*schema.Index {
 	indices := []*schema.Index{}
 	for _, table := range c.Tables {
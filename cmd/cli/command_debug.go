@@ -6,11 +6,16 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/dty1er/sdb/btree"
 	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/config"
 	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/header"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/tablewriter"
 )
 
 type DebugCommand struct {
@@ -22,6 +27,9 @@ type DebugCommand struct {
 
 	// for showPage
 	pageDescriptorID string
+
+	// for showStatistics
+	table string
 }
 
 func NewDebugCommand() *DebugCommand {
@@ -32,6 +40,7 @@ func NewDebugCommand() *DebugCommand {
 	dc.fs.StringVar(&dc.target, "target", "pd", "debug target")
 	dc.fs.StringVar(&dc.idxName, "idxName", "", "index name")
 	dc.fs.StringVar(&dc.pageDescriptorID, "pdid", "", "page descriptor id")
+	dc.fs.StringVar(&dc.table, "table", "", "table name (every table if empty)")
 
 	return dc
 }
@@ -54,28 +63,45 @@ func (dc *DebugCommand) Run() error {
 		return dc.showPage()
 	case "ct", "catalog":
 		return dc.showCatalog()
+	case "st", "stats":
+		return dc.showStatistics()
 	default:
 		return nil
 	}
 }
 
-func (dc *DebugCommand) showPageDirectory() error {
-	filename := path.Join("./db", "__page_directory.db")
+// load reads the db file through the disk manager so that encrypted files can be read as well.
+func (dc *DebugCommand) load(name string, offset int, d sdb.Deserializer) (string, error) {
+	conf, err := config.Process()
+	if err != nil {
+		return "", fmt.Errorf("process configuration: %w", err)
+	}
+
+	filename := path.Join(conf.Server.DBFilesDirectory, name)
 	if _, err := os.Stat(filename); err != nil {
-		return fmt.Errorf("page directory file does not exist")
+		return "", fmt.Errorf("file %s does not exist", filename)
 	}
 
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0755)
+	diskManager, err := newDiskManager(conf.Server)
 	if err != nil {
-		return fmt.Errorf("open file %s, %w", filename, err)
+		return "", fmt.Errorf("initialize disk manager: %w", err)
 	}
 
-	var pd engine.PageDirectory
-	if err := json.NewDecoder(file).Decode(&pd); err != nil {
-		return fmt.Errorf("deserialize json file %s, %w", filename, err)
+	if err := diskManager.Load(name, offset, d); err != nil {
+		return "", err
 	}
 
-	j, err := json.MarshalIndent(&pd, "", "  ")
+	return filename, nil
+}
+
+func (dc *DebugCommand) showPageDirectory() error {
+	pd := engine.NewPageDirectory(0)
+	filename, err := dc.load("__page_directory.db", 0, pd)
+	if err != nil {
+		return err
+	}
+
+	j, err := json.MarshalIndent(pd, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal %s, %w", filename, err)
 	}
@@ -87,19 +113,10 @@ func (dc *DebugCommand) showPageDirectory() error {
 }
 
 func (dc *DebugCommand) showCatalog() error {
-	filename := path.Join("./db", "__catalog.db")
-	if _, err := os.Stat(filename); err != nil {
-		return fmt.Errorf("catalog file does not exist")
-	}
-
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0755)
-	if err != nil {
-		return fmt.Errorf("open file %s, %w", filename, err)
-	}
-
 	var c catalog.Catalog
-	if err := json.NewDecoder(file).Decode(&c); err != nil {
-		return fmt.Errorf("deserialize json file %s, %w", filename, err)
+	filename, err := dc.load("__catalog.db", 0, &c)
+	if err != nil {
+		return err
 	}
 
 	j, err := json.MarshalIndent(&c, "", "  ")
@@ -113,23 +130,60 @@ func (dc *DebugCommand) showCatalog() error {
 	return nil
 }
 
-func (dc *DebugCommand) showIndex() error {
-	if dc.idxName == "" {
-		return fmt.Errorf("idxName must be specified")
+// showStatistics shows the statistics collected by ANALYZE for each column.
+func (dc *DebugCommand) showStatistics() error {
+	var c catalog.Catalog
+	filename, err := dc.load("__catalog.db", 0, &c)
+	if err != nil {
+		return err
 	}
-	filename := path.Join("./db", fmt.Sprintf("%s.idx", dc.idxName))
-	if _, err := os.Stat(filename); err != nil {
-		return fmt.Errorf("index file does not exist")
+
+	fmt.Printf("=======Debug: Statistics (%s)\n", filename)
+	for _, table := range c.ListTables() {
+		if dc.table != "" && table.Name != dc.table {
+			continue
+		}
+
+		stats := table.Statistics
+		if stats == nil {
+			fmt.Printf("%s: not analyzed\n", table.Name)
+			continue
+		}
+
+		fmt.Printf("%s: rows=%d pages=%d sampled_pages=%d\n", table.Name, stats.RowCount, stats.PageCount, stats.SampledPages)
+		tw := tablewriter.New(os.Stdout)
+		tw.SetHeader([]string{"column", "null_frac", "n_distinct", "min", "max", "most_common_values", "most_common_freqs", "histogram"})
+		for i, cs := range stats.Columns {
+			freqs := make([]string, len(cs.MostCommonFreqs))
+			for j, f := range cs.MostCommonFreqs {
+				freqs[j] = strconv.FormatFloat(f, 'f', 4, 64)
+			}
+			tw.Append([]string{
+				table.Columns[i].Name,
+				strconv.FormatFloat(cs.NullFraction, 'f', 4, 64),
+				strconv.FormatFloat(cs.DistinctCount, 'f', 0, 64),
+				cs.Min,
+				cs.Max,
+				"{" + strings.Join(cs.MostCommonValues, ",") + "}",
+				"{" + strings.Join(freqs, ",") + "}",
+				"{" + strings.Join(cs.Histogram, ",") + "}",
+			})
+		}
+		tw.Render()
 	}
+	fmt.Printf("=======\n")
+	return nil
+}
 
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0755)
-	if err != nil {
-		return fmt.Errorf("open file %s, %w", filename, err)
+func (dc *DebugCommand) showIndex() error {
+	if dc.idxName == "" {
+		return fmt.Errorf("idxName must be specified")
 	}
 
 	bt := btree.New()
-	if err := bt.Deserialize(file); err != nil {
-		return fmt.Errorf("deserialize index %s, %w", filename, err)
+	filename, err := dc.load(fmt.Sprintf("%s.idx", dc.idxName), 0, bt)
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("=======Debug: Index (%s)\n", filename)
@@ -145,43 +199,34 @@ func (dc *DebugCommand) showPage() error {
 
 	table := strings.Split(dc.pageDescriptorID, "__")[0]
 
-	// first, read page directory to know how many pages are in the file
-	pdFilename := path.Join("./db", "__page_directory.db")
-	if _, err := os.Stat(pdFilename); err != nil {
-		return fmt.Errorf("page directory file does not exist")
+	// first, read page directory to know which pages are in the file
+	pd := engine.NewPageDirectory(0)
+	if _, err := dc.load("__page_directory.db", 0, pd); err != nil {
+		return err
 	}
 
-	file, err := os.OpenFile(pdFilename, os.O_RDONLY, 0755)
-	if err != nil {
-		return fmt.Errorf("open file %s, %w", pdFilename, err)
-	}
-
-	var pd engine.PageDirectory
-	if err := json.NewDecoder(file).Decode(&pd); err != nil {
-		return fmt.Errorf("deserialize json file %s, %w", pdFilename, err)
-	}
-
-	// then, read page file
-	pgFilename := path.Join("./db", fmt.Sprintf("%s.db", dc.pageDescriptorID))
-	if _, err := os.Stat(pgFilename); err != nil {
-		return fmt.Errorf("page file does not exist")
-	}
-
-	pgFile, err := os.OpenFile(pgFilename, os.O_RDONLY, 0755)
-	if err != nil {
-		return fmt.Errorf("open file %s, %w", pgFilename, err)
+	// page size is decided per database
+	hdr := &header.Header{}
+	if _, err := dc.load(header.Filename, 0, hdr); err != nil {
+		return err
 	}
 
-	pagesCount := len(pd.GetPageIDs(table))
-
-	for i := 0; i < pagesCount; i++ {
-		bs := [engine.PageSize]byte{}
-		_, err = pgFile.ReadAt(bs[:], int64(i*engine.PageSize))
+	// then, read pages in the page file
+	name := fmt.Sprintf("%s.db", dc.pageDescriptorID)
+	for _, pageID := range pd.GetPageIDs(table) {
+		loc, err := pd.GetPageLocation(table, pageID)
 		if err != nil {
-			return fmt.Errorf("read file %s, %w", pgFilename, err)
+			return err
+		}
+		if loc.Filename != name {
+			continue
 		}
 
-		p := engine.NewPage(bs)
+		p := engine.NewPage(make([]byte, hdr.PageSize))
+		pgFilename, err := dc.load(name, int(loc.Offset), p)
+		if err != nil {
+			return err
+		}
 
 		fmt.Printf("=======Debug: Page (%s)\n", pgFilename)
 		fmt.Println(p)
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/planner"
+)
+
+// EncryptCommand encrypts the db files which were initialized without encryption.
+// It must be run while sdb server is stopped. Taking a backup of the db files in advance is recommended.
+type EncryptCommand struct {
+	fs *flag.FlagSet
+
+	keyFile string
+}
+
+func NewEncryptCommand() *EncryptCommand {
+	ec := &EncryptCommand{
+		fs: flag.NewFlagSet("encrypt", flag.ExitOnError),
+	}
+
+	ec.fs.StringVar(&ec.keyFile, "keyFile", "", "path to the encryption key file")
+
+	return ec
+}
+
+func (ec *EncryptCommand) Name() string {
+	return ec.fs.Name()
+}
+
+func (ec *EncryptCommand) Init(args []string) error {
+	return ec.fs.Parse(args)
+}
+
+func (ec *EncryptCommand) Run() error {
+	if ec.keyFile == "" {
+		return fmt.Errorf("keyFile must be specified")
+	}
+
+	conf, err := config.Process()
+	if err != nil {
+		return fmt.Errorf("process configuration: %w", err)
+	}
+
+	if conf.Server.EncryptionKeyFile != "" {
+		return fmt.Errorf("encryption_key_file is already configured")
+	}
+
+	key, err := diskmanager.ReadKeyFile(ec.keyFile)
+	if err != nil {
+		return err
+	}
+
+	diskManager, err := newDiskManager(conf.Server)
+	if err != nil {
+		return fmt.Errorf("initialize disk manager: %w", err)
+	}
+
+	// the spill files left by a crash are not re-encrypted
+	if err := diskManager.RemoveFiles(planner.SpillFilePrefix); err != nil {
+		return err
+	}
+
+	// the encryption interrupted before is finished instead
+	if errors.Is(diskManager.CheckInterrupted(), diskmanager.ErrInterrupted) {
+		if err := diskManager.Resume(key); err != nil {
+			return fmt.Errorf("resume encryption: %w", err)
+		}
+	} else {
+		files, err := engine.PageFiles(diskManager)
+		if err != nil {
+			return err
+		}
+
+		if err := diskManager.Encrypt(key, files); err != nil {
+			return fmt.Errorf("encrypt: %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "db files are encrypted. set encryption_key_file to %s before starting sdb server\n", ec.keyFile)
+	return nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/planner"
+)
+
+// RekeyCommand re-encrypts the db files by the new key.
+// It must be run while sdb server is stopped.
+type RekeyCommand struct {
+	fs *flag.FlagSet
+
+	newKeyFile string
+}
+
+func NewRekeyCommand() *RekeyCommand {
+	rc := &RekeyCommand{
+		fs: flag.NewFlagSet("rekey", flag.ExitOnError),
+	}
+
+	rc.fs.StringVar(&rc.newKeyFile, "newKeyFile", "", "path to the new encryption key file")
+
+	return rc
+}
+
+func (rc *RekeyCommand) Name() string {
+	return rc.fs.Name()
+}
+
+func (rc *RekeyCommand) Init(args []string) error {
+	return rc.fs.Parse(args)
+}
+
+func (rc *RekeyCommand) Run() error {
+	if rc.newKeyFile == "" {
+		return fmt.Errorf("newKeyFile must be specified")
+	}
+
+	conf, err := config.Process()
+	if err != nil {
+		return fmt.Errorf("process configuration: %w", err)
+	}
+
+	if conf.Server.EncryptionKeyFile == "" {
+		return fmt.Errorf("encryption_key_file is not configured")
+	}
+
+	newKey, err := diskmanager.ReadKeyFile(rc.newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	diskManager, err := newDiskManager(conf.Server)
+	if err != nil {
+		return fmt.Errorf("initialize disk manager: %w", err)
+	}
+
+	// the spill files left by a crash are not re-encrypted
+	if err := diskManager.RemoveFiles(planner.SpillFilePrefix); err != nil {
+		return err
+	}
+
+	// the rekey interrupted before is finished instead
+	if errors.Is(diskManager.CheckInterrupted(), diskmanager.ErrInterrupted) {
+		if err := diskManager.Resume(newKey); err != nil {
+			return fmt.Errorf("resume rekey: %w", err)
+		}
+	} else if err := diskManager.Rekey(newKey); err != nil {
+		return fmt.Errorf("rekey: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "db files are re-encrypted. update encryption_key_file to %s before starting sdb server\n", rc.newKeyFile)
+	return nil
+}
@@ -14,6 +14,9 @@ func Run(args []string) error {
 	cmds := []Runner{
 		NewDebugCommand(),
 		NewServerCommand(),
+		NewRekeyCommand(),
+		NewEncryptCommand(),
+		NewUpgradeCommand(),
 	}
 
 	if len(os.Args) < 2 {
@@ -55,22 +55,7 @@ func runCli() error {
 		for _, val := range resp.RS.Values {
 			vals := []string{}
 			for _, v := range val.Data {
-				fmt.Println(v)
-				switch v.Typ {
-				case engine.Bool:
-					vals = append(vals, fmt.Sprintf("%v", v.BoolVal))
-				case engine.Int64:
-					vals = append(vals, fmt.Sprintf("%v", v.Int64Val))
-				case engine.Float64:
-					vals = append(vals, fmt.Sprintf("%v", v.Float64Val))
-				case engine.Bytes:
-					vals = append(vals, fmt.Sprintf("%v", v.BytesVal))
-				case engine.String:
-					vals = append(vals, fmt.Sprintf("%v", v.StringVal))
-				case engine.Timestamp:
-					fmt.Println(v.TimestampVal)
-					vals = append(vals, fmt.Sprintf("%v", time.Unix(v.TimestampVal, 0).Format("2006-01-02 15:04:05")))
-				}
+				vals = append(vals, formatTupleData(v))
 			}
 			tw.Append(vals)
 		}
@@ -104,7 +89,28 @@ func ExecQuery(address, query string) (*server.Response, error) {
 		return nil, err
 	}
 
-	fmt.Printf("%#v\n", sdbResp)
-
 	return &sdbResp, nil
 }
+
+func formatTupleData(v *engine.TupleData) string {
+	if v.Null {
+		return "NULL"
+	}
+
+	switch v.Typ {
+	case engine.Bool:
+		return fmt.Sprintf("%v", v.BoolVal)
+	case engine.Int64:
+		return fmt.Sprintf("%v", v.Int64Val)
+	case engine.Float64:
+		return fmt.Sprintf("%v", v.Float64Val)
+	case engine.Bytes:
+		return fmt.Sprintf("%v", v.BytesVal)
+	case engine.String:
+		return fmt.Sprintf("%v", v.StringVal)
+	case engine.Timestamp:
+		return fmt.Sprintf("%v", time.Unix(v.TimestampVal, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	return ""
+}
@@ -43,7 +43,19 @@ func (sc *ServerCommand) Run() error {
 		return fmt.Errorf("process configuration: %w", err)
 	}
 
-	diskManager := diskmanager.New(conf.Server.DBFilesDirectory)
+	diskManager, err := newDiskManager(conf.Server)
+	if err != nil {
+		return fmt.Errorf("initialize disk manager: %w", err)
+	}
+
+	if err := diskManager.CheckInterrupted(); err != nil {
+		return fmt.Errorf("%w. run rekey or encrypt again with the same new key to finish it", err)
+	}
+
+	// the spill files are left when sdb stopped during a query
+	if err := diskManager.RemoveFiles(planner.SpillFilePrefix); err != nil {
+		return err
+	}
 
 	catalog, err := catalog.New(diskManager)
 	if err != nil {
@@ -57,9 +69,9 @@ func (sc *ServerCommand) Run() error {
 		return fmt.Errorf("initialize storage engine: %w", err)
 	}
 
-	executor := executor.New(engine, catalog)
+	executor := executor.New(conf.Server, engine, catalog, diskManager)
 
-	planner := planner.New(catalog)
+	planner := planner.New(catalog, planner.WithWorkMem(conf.Server.WorkMem))
 
 	sdb := sdb.New(parser, planner, catalog, executor, engine, diskManager)
 
@@ -85,3 +97,17 @@ func (sc *ServerCommand) Run() error {
 
 	return err
 }
+
+// newDiskManager initializes the disk manager by the server configuration.
+func newDiskManager(conf *config.Server) (*diskmanager.DiskManager, error) {
+	opts := []diskmanager.Option{}
+	if conf.EncryptionKeyFile != "" {
+		key, err := diskmanager.ReadKeyFile(conf.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, diskmanager.WithEncryptionKey(key))
+	}
+
+	return diskmanager.New(conf.DBFilesDirectory, opts...)
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/header"
+)
+
+// UpgradeCommand migrates the db files written in the older format to the current format in place.
+// It must be run while sdb server is stopped. Taking a backup of the db files in advance is recommended.
+type UpgradeCommand struct {
+	fs *flag.FlagSet
+}
+
+func NewUpgradeCommand() *UpgradeCommand {
+	return &UpgradeCommand{fs: flag.NewFlagSet("upgrade", flag.ExitOnError)}
+}
+
+func (uc *UpgradeCommand) Name() string {
+	return uc.fs.Name()
+}
+
+func (uc *UpgradeCommand) Init(args []string) error {
+	return uc.fs.Parse(args)
+}
+
+func (uc *UpgradeCommand) Run() error {
+	conf, err := config.Process()
+	if err != nil {
+		return fmt.Errorf("process configuration: %w", err)
+	}
+
+	diskManager, err := newDiskManager(conf.Server)
+	if err != nil {
+		return fmt.Errorf("initialize disk manager: %w", err)
+	}
+
+	if err := diskManager.CheckInterrupted(); err != nil {
+		return fmt.Errorf("%w. run rekey or encrypt again with the same new key to finish it", err)
+	}
+
+	hdr, err := header.Load(diskManager)
+	if err != nil {
+		return err
+	}
+
+	version := header.FormatVersion1
+	if hdr != nil {
+		version = hdr.FormatVersion
+	} else if !uc.initialized(conf.Server.DBFilesDirectory) {
+		fmt.Fprintf(os.Stdout, "database is not initialized yet. nothing to upgrade\n")
+		return nil
+	}
+
+	if version == header.CurrentFormatVersion {
+		fmt.Fprintf(os.Stdout, "db files are already in the current format version %d\n", version)
+		return nil
+	}
+
+	if err := engine.Upgrade(diskManager, version); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "db files are upgraded from format version %d to %d\n", version, header.CurrentFormatVersion)
+	return nil
+}
+
+// initialized returns if the database has any data. The database written in FormatVersion1
+// does not have the header file, so the other files are checked.
+func (uc *UpgradeCommand) initialized(directory string) bool {
+	for _, name := range []string{"__catalog.db", "__page_directory.db"} {
+		if _, err := os.Stat(path.Join(directory, name)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -20,6 +20,8 @@ var defaultConfig = &Config{
 		BufferPoolEntryCount: 1000,
 		DBFilesDirectory:     "./db/",
 		Port:                 5525,
+		PageSize:             16 * 1024,
+		WorkMem:              4 * 1024 * 1024,
 	},
 	Client: &Client{},
 }
@@ -33,6 +35,17 @@ type Server struct {
 	BufferPoolEntryCount int
 	DBFilesDirectory     string
 	Port                 int
+	// EncryptionKeyFile is a path to the key file to encrypt db files.
+	// When it is empty, db files are not encrypted. The db files created without encryption
+	// must be encrypted by the encrypt command before it is set.
+	EncryptionKeyFile string
+	// PageSize is used only when the database is initialized. After that, the page size
+	// recorded in the database header is used.
+	PageSize int
+	// WorkMem is the memory in bytes which an operator like sort or aggregation can use for a query.
+	// When the operator needs more memory, the data is spilled to the temporary files.
+	// The planner avoids hash join when its hash table is estimated to exceed it.
+	WorkMem int
 }
 
 type Client struct{}
@@ -115,6 +128,23 @@ func readServerConfig(line string, conf *Config) error {
 			return err
 		}
 		conf.Server.Port = v
+
+	case isLine(line, "page_size"):
+		v, err := readIntVal(line, "page_size")
+		if err != nil {
+			return err
+		}
+		conf.Server.PageSize = v
+
+	case isLine(line, "work_mem"):
+		v, err := readIntVal(line, "work_mem")
+		if err != nil {
+			return err
+		}
+		conf.Server.WorkMem = v
+
+	case isLine(line, "encryption_key_file"):
+		conf.Server.EncryptionKeyFile = readStringVal(line, "encryption_key_file")
 	}
 
 	return nil
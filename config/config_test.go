@@ -11,12 +11,15 @@ func Test_read(t *testing.T) {
 	const config = `# comment
 [server]
 buffer_pool_entry_count = 500
+page_size = 8192
+work_mem = 65536
 
 # comment
 [client]
 
 [server]
 db_files_directory = ./test/
+encryption_key_file = ./test.key
 `
 	conf := bytes.NewBufferString(config)
 
@@ -26,7 +29,7 @@ db_files_directory = ./test/
 	testutil.MustBeNil(t, err)
 
 	testutil.MustEqual(t, c, &Config{
-		Server: &Server{BufferPoolEntryCount: 500, DBFilesDirectory: "./test/", Port: 5525},
+		Server: &Server{BufferPoolEntryCount: 500, DBFilesDirectory: "./test/", Port: 5525, EncryptionKeyFile: "./test.key", PageSize: 8192, WorkMem: 65536},
 		Client: &Client{},
 	})
 }
@@ -1,23 +1,67 @@
 package diskmanager
 
 import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/dty1er/sdb/sdb"
 )
 
 type DiskManager struct {
 	directory string
+
+	// aead encrypts/decrypts the files. It is nil when the encryption is disabled.
+	aead cipher.AEAD
+}
+
+type Config struct {
+	encryptionKey []byte
 }
 
-func New(directory string) *DiskManager {
-	return &DiskManager{
-		directory: directory,
+type Option func(c *Config)
+
+// WithEncryptionKey enables the encryption at rest by the given key.
+// The key must be 16, 24 or 32 byte to use AES-128, AES-192 or AES-256.
+func WithEncryptionKey(key []byte) Option {
+	return func(c *Config) {
+		c.encryptionKey = key
 	}
 }
 
+func New(directory string, opts ...Option) (*DiskManager, error) {
+	conf := &Config{}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	dm := &DiskManager{directory: directory}
+
+	if conf.encryptionKey != nil {
+		aead, err := newAEAD(conf.encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		dm.aead = aead
+	}
+
+	return dm, nil
+}
+
+// fixedSizer is implemented by the object whose serialized form always has the same length, like a page.
+// Such objects are placed side by side in a file, so the disk manager uses the size to locate them.
+// Other objects are supposed to occupy the whole file.
+type fixedSizer interface {
+	Size() int
+}
+
 func (dm *DiskManager) Load(name string, offset int, d sdb.Deserializer) error {
 	filename := path.Join(dm.directory, name)
 	if _, err := os.Stat(filename); err != nil {
@@ -30,7 +74,18 @@ func (dm *DiskManager) Load(name string, offset int, d sdb.Deserializer) error {
 	}
 	defer file.Close()
 
-	if err := d.Deserialize(file); err != nil {
+	var r io.Reader
+	if dm.aead == nil {
+		r = io.NewSectionReader(file, int64(offset), math.MaxInt64-int64(offset))
+	} else {
+		plain, err := dm.readFrame(file, name, offset, d)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(plain)
+	}
+
+	if err := d.Deserialize(r); err != nil {
 		return fmt.Errorf("deserialize file %s: %w", filename, err)
 	}
 
@@ -52,10 +107,101 @@ func (dm *DiskManager) Persist(name string, offset int, page sdb.Serializer) err
 		return fmt.Errorf("serialize %s: %w", filename, err)
 	}
 
+	physicalOffset := int64(offset)
+	if dm.aead != nil {
+		physicalOffset = int64(frameOffset(offset, len(serialized)))
+		if serialized, err = dm.seal(name, offset, serialized); err != nil {
+			return err
+		}
+	}
+
 	// 写入页
-	if _, err = file.WriteAt(serialized, int64(offset)); err != nil {
+	if _, err = file.WriteAt(serialized, physicalOffset); err != nil {
 		return fmt.Errorf("write page on the file %s at %d: %w", filename, offset, err)
 	}
 
+	// When the object occupies the whole file, drop the remaining bytes written by the older and longer one.
+	if _, ok := page.(fixedSizer); !ok {
+		if err := file.Truncate(physicalOffset + int64(len(serialized))); err != nil {
+			return fmt.Errorf("truncate file %s: %w", filename, err)
+		}
+	}
+
 	return nil
 }
+
+// Remove deletes the file. It is not an error when the file does not exist.
+func (dm *DiskManager) Remove(name string) error {
+	filename := path.Join(dm.directory, name)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// RemoveFiles deletes every file whose name starts with the prefix. It is used to clean up
+// the temporary files left when sdb stopped unexpectedly.
+func (dm *DiskManager) RemoveFiles(prefix string) error {
+	entries, err := os.ReadDir(dm.directory)
+	if err != nil {
+		return fmt.Errorf("read directory %s: %w", dm.directory, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+
+		if err := dm.Remove(entry.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readFrame reads the encrypted frame at the offset from the file then returns decrypted bytes.
+// The frame length stored in the file is validated before reading the frame so that
+// a truncated or tampered file is reported as ErrCorrupted.
+func (dm *DiskManager) readFrame(file *os.File, name string, offset int, d sdb.Deserializer) ([]byte, error) {
+	fs, fixed := d.(fixedSizer)
+	physicalOffset := 0
+	if offset != 0 {
+		if !fixed {
+			return nil, fmt.Errorf("load %s at %d: the object must have fixed size to be loaded at non-zero offset", name, offset)
+		}
+		physicalOffset = frameOffset(offset, fs.Size())
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", name, err)
+	}
+
+	length := make([]byte, frameLengthSize)
+	if _, err := file.ReadAt(length, int64(physicalOffset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: frame length of %s at %d is truncated", ErrCorrupted, name, offset)
+		}
+		return nil, fmt.Errorf("read frame length of %s at %d: %w", name, offset, err)
+	}
+
+	l := int64(byteOrder.Uint32(length))
+	if fixed && l != int64(fs.Size()) {
+		return nil, fmt.Errorf("%w: frame of %s at %d has length %d, expected %d", ErrCorrupted, name, offset, l, fs.Size())
+	}
+	if int64(physicalOffset)+int64(frameSize(int(l))) > stat.Size() {
+		return nil, fmt.Errorf("%w: frame of %s at %d exceeds the file size", ErrCorrupted, name, offset)
+	}
+
+	frame := make([]byte, frameSize(int(l)))
+	if _, err := file.ReadAt(frame, int64(physicalOffset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: frame of %s at %d is truncated", ErrCorrupted, name, offset)
+		}
+		return nil, fmt.Errorf("read frame of %s at %d: %w", name, offset, err)
+	}
+
+	return dm.open(name, offset, frame)
+}
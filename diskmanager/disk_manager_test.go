@@ -3,7 +3,11 @@ package diskmanager
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
+	"math"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/dty1er/sdb/testutil"
@@ -36,11 +40,310 @@ func TestDiskManager_Load_Persist(t *testing.T) {
 
 	tempDir := t.TempDir()
 
-	dm := New(tempDir)
-	err := dm.Persist("test_kv", 0, kv)
+	dm, err := New(tempDir)
+	testutil.MustBeNil(t, err)
+	err = dm.Persist("test_kv", 0, kv)
 	testutil.MustBeNil(t, err)
 
 	newKV := &KeyValue{}
 	dm.Load("test_kv", 0, newKV)
 	testutil.MustEqual(t, kv, newKV)
 }
+
+func TestDiskManager_Remove(t *testing.T) {
+	tempDir := t.TempDir()
+
+	dm, err := New(tempDir)
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, dm.Persist("test_kv", 0, &KeyValue{map[string]string{"A": "a"}}))
+
+	testutil.MustBeNil(t, dm.Remove("test_kv"))
+	_, err = os.Stat(path.Join(tempDir, "test_kv"))
+	testutil.MustEqual(t, os.IsNotExist(err), true)
+
+	// removing the file which does not exist is not an error
+	testutil.MustBeNil(t, dm.Remove("test_kv"))
+}
+
+func TestDiskManager_RemoveFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	dm, err := New(tempDir)
+	testutil.MustBeNil(t, err)
+	for _, name := range []string{"__tmp_1", "__tmp_2", "test_kv"} {
+		testutil.MustBeNil(t, dm.Persist(name, 0, &KeyValue{map[string]string{"A": "a"}}))
+	}
+
+	testutil.MustBeNil(t, dm.RemoveFiles("__tmp_"))
+	entries, err := os.ReadDir(tempDir)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, len(entries), 1)
+	testutil.MustEqual(t, entries[0].Name(), "test_kv")
+}
+
+// for test
+type Block struct {
+	bs [8]byte
+}
+
+func (b *Block) Size() int {
+	return len(b.bs)
+}
+
+func (b *Block) Serialize() ([]byte, error) {
+	return b.bs[:], nil
+}
+
+func (b *Block) Deserialize(r io.Reader) error {
+	_, err := io.ReadFull(r, b.bs[:])
+	return err
+}
+
+func TestDiskManager_Load_Persist_Offset(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	for _, opts := range [][]Option{nil, {WithEncryptionKey(key)}} {
+		dm, err := New(t.TempDir(), opts...)
+		testutil.MustBeNil(t, err)
+
+		blocks := []*Block{{bs: [8]byte{1, 1}}, {bs: [8]byte{2, 2}}, {bs: [8]byte{3, 3}}}
+		// persist in random order
+		for _, i := range []int{2, 0, 1} {
+			err = dm.Persist("test_blocks", i*8, blocks[i])
+			testutil.MustBeNil(t, err)
+		}
+
+		for i, block := range blocks {
+			var b Block
+			err = dm.Load("test_blocks", i*8, &b)
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, b.bs, block.bs)
+		}
+	}
+}
+
+func TestDiskManager_Encryption(t *testing.T) {
+	tempDir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	kv := &KeyValue{map[string]string{"A": "a", "B": "b"}}
+
+	dm, err := New(tempDir, WithEncryptionKey(key))
+	testutil.MustBeNil(t, err)
+	err = dm.Persist("test_kv", 0, kv)
+	testutil.MustBeNil(t, err)
+	err = dm.Persist("test_blocks", 8, &Block{bs: [8]byte{'s', 'e', 'c', 'r', 'e', 't'}})
+	testutil.MustBeNil(t, err)
+
+	// make sure plaintext is not on the disk
+	raw, err := os.ReadFile(path.Join(tempDir, "test_kv"))
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, bytes.Contains(raw, []byte(`"KV"`)), false)
+	raw, err = os.ReadFile(path.Join(tempDir, "test_blocks"))
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, bytes.Contains(raw, []byte("secret")), false)
+
+	newKV := &KeyValue{}
+	err = dm.Load("test_kv", 0, newKV)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, kv, newKV)
+
+	// shorter object must overwrite the file entirely
+	kv = &KeyValue{map[string]string{"A": "a"}}
+	err = dm.Persist("test_kv", 0, kv)
+	testutil.MustBeNil(t, err)
+	newKV = &KeyValue{}
+	err = dm.Load("test_kv", 0, newKV)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, kv, newKV)
+
+	// wrong key
+	wrongDM, err := New(tempDir, WithEncryptionKey(bytes.Repeat([]byte{2}, 32)))
+	testutil.MustBeNil(t, err)
+	err = wrongDM.Load("test_kv", 0, &KeyValue{})
+	testutil.MustEqual(t, errors.Is(err, ErrCorrupted), true)
+
+	// tampered file
+	raw, err = os.ReadFile(path.Join(tempDir, "test_kv"))
+	testutil.MustBeNil(t, err)
+	raw[len(raw)-1] ^= 0xff
+	err = os.WriteFile(path.Join(tempDir, "test_kv"), raw, 0755)
+	testutil.MustBeNil(t, err)
+	err = dm.Load("test_kv", 0, &KeyValue{})
+	testutil.MustEqual(t, errors.Is(err, ErrCorrupted), true)
+}
+
+func TestDiskManager_Load_BrokenFrame(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	tests := []struct {
+		name   string
+		modify func(raw []byte) []byte
+	}{
+		{
+			name:   "huge length",
+			modify: func(raw []byte) []byte { byteOrder.PutUint32(raw[frameSize(8):], math.MaxUint32); return raw },
+		},
+		{
+			name:   "unexpected length",
+			modify: func(raw []byte) []byte { byteOrder.PutUint32(raw[frameSize(8):], 4); return raw },
+		},
+		{
+			name:   "truncated frame",
+			modify: func(raw []byte) []byte { return raw[:len(raw)-1] },
+		},
+		{
+			name:   "truncated length",
+			modify: func(raw []byte) []byte { return raw[:frameSize(8)+2] },
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			dm, err := New(tempDir, WithEncryptionKey(key))
+			testutil.MustBeNil(t, err)
+			for i := 0; i < 2; i++ {
+				err = dm.Persist("test_blocks", i*8, &Block{bs: [8]byte{byte(i)}})
+				testutil.MustBeNil(t, err)
+			}
+
+			raw, err := os.ReadFile(path.Join(tempDir, "test_blocks"))
+			testutil.MustBeNil(t, err)
+			err = os.WriteFile(path.Join(tempDir, "test_blocks"), test.modify(raw), 0755)
+			testutil.MustBeNil(t, err)
+
+			err = dm.Load("test_blocks", 8, &Block{})
+			testutil.MustEqual(t, errors.Is(err, ErrCorrupted), true)
+		})
+	}
+}
+
+func TestDiskManager_Rekey(t *testing.T) {
+	tempDir := t.TempDir()
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	kv := &KeyValue{map[string]string{"A": "a", "B": "b"}}
+	blocks := []*Block{{bs: [8]byte{1, 1}}, {bs: [8]byte{2, 2}}, {bs: [8]byte{3, 3}}}
+
+	dm, err := New(tempDir, WithEncryptionKey(oldKey))
+	testutil.MustBeNil(t, err)
+	err = dm.Persist("test_kv", 0, kv)
+	testutil.MustBeNil(t, err)
+	for i, block := range blocks {
+		err = dm.Persist("test_blocks", i*8, block)
+		testutil.MustBeNil(t, err)
+	}
+
+	err = dm.Rekey(newKey)
+	testutil.MustBeNil(t, err)
+
+	oldDM, err := New(tempDir, WithEncryptionKey(oldKey))
+	testutil.MustBeNil(t, err)
+	err = oldDM.Load("test_kv", 0, &KeyValue{})
+	testutil.MustEqual(t, errors.Is(err, ErrCorrupted), true)
+
+	newDM, err := New(tempDir, WithEncryptionKey(newKey))
+	testutil.MustBeNil(t, err)
+	newKV := &KeyValue{}
+	err = newDM.Load("test_kv", 0, newKV)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, kv, newKV)
+	for i, block := range blocks {
+		var b Block
+		err = newDM.Load("test_blocks", i*8, &b)
+		testutil.MustBeNil(t, err)
+		testutil.MustEqual(t, b.bs, block.bs)
+	}
+}
+
+func TestDiskManager_Rekey_Interrupted(t *testing.T) {
+	tempDir := t.TempDir()
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	kv := &KeyValue{map[string]string{"A": "a"}}
+	block := &Block{bs: [8]byte{1, 1}}
+
+	dm, err := New(tempDir, WithEncryptionKey(oldKey))
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, dm.Persist("test_kv", 0, kv))
+	testutil.MustBeNil(t, dm.Persist("test_blocks", 0, block))
+
+	// rekey is interrupted after the manifest is written and the first file is replaced
+	newAead, err := newAEAD(newKey)
+	testutil.MustBeNil(t, err)
+	newDM := &DiskManager{directory: tempDir, aead: newAead}
+	names := []string{"test_blocks", "test_kv"}
+	for _, name := range names {
+		bs, err := dm.rekeyFile(newDM, name)
+		testutil.MustBeNil(t, err)
+		testutil.MustBeNil(t, os.WriteFile(path.Join(tempDir, name+rekeySuffix), bs, 0755))
+	}
+	testutil.MustBeNil(t, newDM.writeManifest(names))
+	testutil.MustBeNil(t, os.Rename(path.Join(tempDir, "test_blocks"+rekeySuffix), path.Join(tempDir, "test_blocks")))
+
+	testutil.MustEqual(t, dm.CheckInterrupted(), ErrInterrupted)
+	testutil.MustEqual(t, dm.Rekey(newKey), ErrInterrupted)
+
+	// the manifest makes sure the same key is given
+	err = dm.Resume(bytes.Repeat([]byte{3}, 32))
+	testutil.MustEqual(t, errors.Is(err, ErrCorrupted), true)
+
+	testutil.MustBeNil(t, dm.Resume(newKey))
+	testutil.MustBeNil(t, dm.CheckInterrupted())
+
+	newKV := &KeyValue{}
+	testutil.MustBeNil(t, dm.Load("test_kv", 0, newKV))
+	testutil.MustEqual(t, newKV, kv)
+	var b Block
+	testutil.MustBeNil(t, dm.Load("test_blocks", 0, &b))
+	testutil.MustEqual(t, b.bs, block.bs)
+
+	entries, err := os.ReadDir(tempDir)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, len(entries), 2)
+}
+
+func TestDiskManager_Encrypt(t *testing.T) {
+	tempDir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	kv := &KeyValue{map[string]string{"A": "a", "B": "b"}}
+	blocks := []*Block{{bs: [8]byte{1, 1}}, {bs: [8]byte{}}, {bs: [8]byte{3, 3}}}
+
+	dm, err := New(tempDir)
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, dm.Persist("test_kv", 0, kv))
+	// the second block is never written
+	testutil.MustBeNil(t, dm.Persist("test_blocks", 0, blocks[0]))
+	testutil.MustBeNil(t, dm.Persist("test_blocks", 16, blocks[2]))
+
+	testutil.MustBeNil(t, dm.Encrypt(key, map[string]int{"test_blocks": 8}))
+	testutil.MustEqual(t, dm.Encrypt(key, nil).Error(), "encryption is already enabled")
+
+	// the plaintext is not readable anymore
+	raw, err := os.ReadFile(path.Join(tempDir, "test_kv"))
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, bytes.Contains(raw, []byte(`"A"`)), false)
+
+	for _, d := range []*DiskManager{dm, mustNew(t, tempDir, WithEncryptionKey(key))} {
+		newKV := &KeyValue{}
+		testutil.MustBeNil(t, d.Load("test_kv", 0, newKV))
+		testutil.MustEqual(t, newKV, kv)
+		for i, block := range blocks {
+			var b Block
+			testutil.MustBeNil(t, d.Load("test_blocks", i*8, &b))
+			testutil.MustEqual(t, b.bs, block.bs)
+		}
+	}
+
+	// the encrypted files can be rekeyed
+	testutil.MustBeNil(t, dm.Rekey(bytes.Repeat([]byte{2}, 32)))
+	var b Block
+	testutil.MustBeNil(t, dm.Load("test_blocks", 16, &b))
+	testutil.MustEqual(t, b.bs, blocks[2].bs)
+}
+
+func mustNew(t *testing.T, directory string, opts ...Option) *DiskManager {
+	t.Helper()
+	dm, err := New(directory, opts...)
+	testutil.MustBeNil(t, err)
+	return dm
+}
@@ -0,0 +1,399 @@
+package diskmanager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// When the encryption is enabled, every persisted object is encrypted by AES-GCM and stored as a frame.
+// The frame layout looks like below:
+// |length(4byte)|nonce(12byte)|ciphertext(Nbyte)|tag(16byte)|
+// The N is the same as length, which is the length of the plaintext.
+//
+// Nonce is randomly generated every time the object is persisted, so each page has its own nonce.
+// The file name and the offset are used as the additional authenticated data, so a frame which is
+// copied to another place fails the authentication as well as a tampered frame.
+//
+// Because a frame is larger than its plaintext, fixed size objects (e.g. pages) are shifted
+// on the file. The frame for the object at the offset `o` is placed at `o / size * (size + frameOverhead)`.
+const (
+	frameLengthSize = 4
+	nonceSize       = 12
+	tagSize         = 16
+	frameOverhead   = frameLengthSize + nonceSize + tagSize
+)
+
+// sdb uses BigEndian as its byteOrder in their byte representation
+var byteOrder = binary.BigEndian
+
+// ErrCorrupted is returned when the encrypted file fails the authentication.
+// It means the file is tampered, broken, or encrypted by another key.
+var ErrCorrupted = errors.New("data corruption detected")
+
+// ReadKeyFile reads the encryption key from the given file.
+// The file content must be the raw key or hex-encoded key.
+func ReadKeyFile(filename string) ([]byte, error) {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read key file %s: %w", filename, err)
+	}
+
+	key := bs
+	if decoded, err := hex.DecodeString(strings.TrimSpace(string(bs))); err == nil {
+		key = decoded
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key file %s must contain 16, 24 or 32 byte key but got %d byte", filename, len(key))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("initialize cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("initialize gcm: %w", err)
+	}
+
+	return aead, nil
+}
+
+func frameSize(length int) int {
+	return length + frameOverhead
+}
+
+// frameOffset converts the offset of the fixed size object to the offset of its frame on the file.
+func frameOffset(offset, size int) int {
+	if size == 0 {
+		return offset
+	}
+	return offset / size * frameSize(size)
+}
+
+func additionalData(name string, offset int) []byte {
+	ad := make([]byte, len(name)+8)
+	copy(ad, name)
+	byteOrder.PutUint64(ad[len(name):], uint64(offset))
+	return ad
+}
+
+// seal encrypts the plaintext into a frame.
+func (dm *DiskManager) seal(name string, offset int, plaintext []byte) ([]byte, error) {
+	frame := make([]byte, frameLengthSize+nonceSize, frameSize(len(plaintext)))
+	byteOrder.PutUint32(frame[0:], uint32(len(plaintext)))
+
+	nonce := frame[frameLengthSize : frameLengthSize+nonceSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce for %s: %w", name, err)
+	}
+
+	return dm.aead.Seal(frame, nonce, plaintext, additionalData(name, offset)), nil
+}
+
+// open decrypts the frame then returns the plaintext.
+func (dm *DiskManager) open(name string, offset int, frame []byte) ([]byte, error) {
+	if len(frame) < frameOverhead {
+		return nil, fmt.Errorf("%w: frame of %s at %d is too short", ErrCorrupted, name, offset)
+	}
+
+	nonce := frame[frameLengthSize : frameLengthSize+nonceSize]
+	plaintext, err := dm.aead.Open(nil, nonce, frame[frameLengthSize+nonceSize:], additionalData(name, offset))
+	if err != nil {
+		return nil, fmt.Errorf("%w: authenticate %s at %d: %s", ErrCorrupted, name, offset, err)
+	}
+
+	return plaintext, nil
+}
+
+// ErrInterrupted is returned when a rekey or an encryption was interrupted while replacing the files.
+// Some files may be encrypted by the new key and the others are not, so it must be finished by Resume.
+var ErrInterrupted = errors.New("rekey or encryption was interrupted")
+
+// rekeyManifest lists the files being replaced by rekey or encryption. It is sealed by the new key,
+// so Resume can make sure it is given the same key.
+const rekeyManifest = "__rekey_manifest"
+
+const rekeySuffix = ".rekey"
+
+// Rekey re-encrypts every file in the directory by the new key.
+// sdb must not be running while rekeying. After Rekey, the disk manager uses the new key.
+func (dm *DiskManager) Rekey(newKey []byte) error {
+	if dm.aead == nil {
+		return fmt.Errorf("encryption is not enabled")
+	}
+
+	newAead, err := newAEAD(newKey)
+	if err != nil {
+		return err
+	}
+
+	newDM := &DiskManager{directory: dm.directory, aead: newAead}
+	rekey := func(name string) ([]byte, error) { return dm.rekeyFile(newDM, name) }
+	if err := dm.replaceFiles(newDM, rekey); err != nil {
+		return err
+	}
+
+	dm.aead = newAead
+	return nil
+}
+
+// Encrypt encrypts every file in the directory by the key. It enables the encryption on the database
+// which was initialized without encryption. objectSizes maps the files of the fixed size objects (e.g. pages)
+// to the size of the objects. The other files are encrypted as one object.
+// sdb must not be running while encrypting. After Encrypt, the disk manager uses the key.
+func (dm *DiskManager) Encrypt(key []byte, objectSizes map[string]int) error {
+	if dm.aead != nil {
+		return fmt.Errorf("encryption is already enabled")
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	newDM := &DiskManager{directory: dm.directory, aead: aead}
+	encrypt := func(name string) ([]byte, error) { return newDM.encryptFile(name, objectSizes[name]) }
+	if err := dm.replaceFiles(newDM, encrypt); err != nil {
+		return err
+	}
+
+	dm.aead = aead
+	return nil
+}
+
+// CheckInterrupted returns ErrInterrupted when an interrupted rekey or encryption is found.
+func (dm *DiskManager) CheckInterrupted() error {
+	if _, err := os.Stat(path.Join(dm.directory, rekeyManifest)); err == nil {
+		return ErrInterrupted
+	}
+
+	return nil
+}
+
+// Resume finishes the interrupted rekey or encryption. newKey must be the key the files were being
+// encrypted by. After Resume, the disk manager uses the key.
+func (dm *DiskManager) Resume(newKey []byte) error {
+	newAead, err := newAEAD(newKey)
+	if err != nil {
+		return err
+	}
+
+	newDM := &DiskManager{directory: dm.directory, aead: newAead}
+	names, err := newDM.readManifest()
+	if err != nil {
+		return err
+	}
+
+	if err := newDM.finishReplace(names); err != nil {
+		return err
+	}
+
+	dm.aead = newAead
+	return nil
+}
+
+// replaceFiles rewrites every file in the directory by rewrite. The new content is written to a temporary
+// file first, and the original files are replaced only after all of them succeeded. The manifest of the
+// files is written before replacing, so that an interrupted replacement is detected and resumed.
+func (dm *DiskManager) replaceFiles(newDM *DiskManager, rewrite func(name string) ([]byte, error)) error {
+	if err := dm.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dm.directory)
+	if err != nil {
+		return fmt.Errorf("read directory %s: %w", dm.directory, err)
+	}
+
+	names := []string{}
+	removeTemporaryFiles := func() {
+		for _, name := range names {
+			os.Remove(path.Join(dm.directory, name+rekeySuffix))
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), rekeySuffix) {
+			continue
+		}
+
+		filename := path.Join(dm.directory, entry.Name())
+		bs, err := rewrite(entry.Name())
+		if err != nil {
+			removeTemporaryFiles()
+			return err
+		}
+
+		if err := os.WriteFile(filename+rekeySuffix, bs, 0755); err != nil {
+			removeTemporaryFiles()
+			os.Remove(filename + rekeySuffix)
+			return fmt.Errorf("write file %s: %w", filename+rekeySuffix, err)
+		}
+		names = append(names, entry.Name())
+	}
+
+	if err := newDM.writeManifest(names); err != nil {
+		removeTemporaryFiles()
+		return err
+	}
+
+	return newDM.finishReplace(names)
+}
+
+// finishReplace replaces the files by the temporary files, then removes the manifest.
+// The file without the temporary file has already been replaced before the interruption.
+func (dm *DiskManager) finishReplace(names []string) error {
+	for _, name := range names {
+		filename := path.Join(dm.directory, name)
+		if err := os.Rename(filename+rekeySuffix, filename); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rename file %s: %w", filename+rekeySuffix, err)
+		}
+	}
+
+	return dm.Remove(rekeyManifest)
+}
+
+// writeManifest seals the file names into the manifest. It is written to the temporary file
+// then renamed, so a broken manifest is never left.
+func (dm *DiskManager) writeManifest(names []string) error {
+	frame, err := dm.seal(rekeyManifest, 0, []byte(strings.Join(names, "\n")))
+	if err != nil {
+		return err
+	}
+
+	filename := path.Join(dm.directory, rekeyManifest)
+	if err := os.WriteFile(filename+rekeySuffix, frame, 0755); err != nil {
+		return fmt.Errorf("write file %s: %w", filename+rekeySuffix, err)
+	}
+
+	if err := os.Rename(filename+rekeySuffix, filename); err != nil {
+		os.Remove(filename + rekeySuffix)
+		return fmt.Errorf("rename file %s: %w", filename+rekeySuffix, err)
+	}
+
+	return nil
+}
+
+// readManifest returns the file names in the manifest. It fails with ErrCorrupted when
+// the manifest was sealed by another key.
+func (dm *DiskManager) readManifest() ([]string, error) {
+	filename := path.Join(dm.directory, rekeyManifest)
+	frame, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no interrupted rekey or encryption is found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	plaintext, err := dm.open(rekeyManifest, 0, frame)
+	if err != nil {
+		return nil, fmt.Errorf("%w (the key must be the new key of the interrupted rekey or encryption)", err)
+	}
+
+	if len(plaintext) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(string(plaintext), "\n"), nil
+}
+
+// encryptFile seals the plaintext file into the frames. size is the size of the objects in the file,
+// or 0 when the file is one object.
+func (dm *DiskManager) encryptFile(name string, size int) ([]byte, error) {
+	filename := path.Join(dm.directory, name)
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	if size == 0 {
+		return dm.seal(name, 0, bs)
+	}
+
+	if len(bs)%size != 0 {
+		return nil, fmt.Errorf("size of %s is not a multiple of %d", filename, size)
+	}
+
+	out := make([]byte, 0, len(bs)/size*frameSize(size))
+	for offset := 0; offset < len(bs); offset += size {
+		frame, err := dm.seal(name, offset, bs[offset:offset+size])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, frame...)
+	}
+
+	return out, nil
+}
+
+// rekeyFile re-encrypts the frames in the file by newDM and returns them.
+func (dm *DiskManager) rekeyFile(newDM *DiskManager, name string) ([]byte, error) {
+	filename := path.Join(dm.directory, name)
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	out := make([]byte, 0, len(bs))
+	// size is the plaintext size of the frames in the file. Every frame in a file has the same size
+	// unless the file has only one frame.
+	size := 0
+	for pos := 0; pos < len(bs); {
+		if len(bs)-pos < frameLengthSize {
+			return nil, fmt.Errorf("%w: %s has broken frame at %d", ErrCorrupted, filename, pos)
+		}
+
+		length := int(byteOrder.Uint32(bs[pos:]))
+		if length == 0 {
+			// The frame has never been written. It happens when the page after this is persisted first.
+			if size == 0 {
+				return nil, fmt.Errorf("%w: %s has an empty frame at %d", ErrCorrupted, filename, pos)
+			}
+			out = append(out, make([]byte, frameSize(size))...)
+			pos += frameSize(size)
+			continue
+		}
+
+		if size == 0 {
+			size = length
+		}
+
+		end := pos + frameSize(length)
+		if len(bs) < end {
+			return nil, fmt.Errorf("%w: %s has broken frame at %d", ErrCorrupted, filename, pos)
+		}
+
+		// Physical position on the file is converted to the offset which the frame was sealed with.
+		offset := pos / frameSize(length) * length
+		plaintext, err := dm.open(name, offset, bs[pos:end])
+		if err != nil {
+			return nil, err
+		}
+
+		frame, err := newDM.seal(name, offset, plaintext)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, frame...)
+		pos = end
+	}
+
+	return out, nil
+}
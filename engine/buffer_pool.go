@@ -66,33 +66,44 @@ func (bp *BufferPool) GetPage(tableName string, pageID PageID) *Page {
 }
 
 // InsertPage inserts page in the cache.
-// When non-nil page is returned, it must be persisted on the disk.
-func (bp *BufferPool) InsertPage(tableName string, page *Page) *Page {
+// When non-nil page is returned, it must be persisted on the disk. The returned string is
+// the table of the returned page, which can be different from the given table.
+func (bp *BufferPool) InsertPage(tableName string, page *Page) (string, *Page) {
+	// when inserting a new page, it is not persisted so dirty must be true
+	// 新插入的页一定是脏页
+	return bp.setPage(tableName, page, true)
+}
+
+// CachePage puts the page loaded from the disk in the cache.
+// Because the page is the same as the one on the disk, it is not marked dirty.
+// The returned values are the same as InsertPage.
+func (bp *BufferPool) CachePage(tableName string, page *Page) (string, *Page) {
+	return bp.setPage(tableName, page, false)
+}
+
+func (bp *BufferPool) setPage(tableName string, page *Page, dirty bool) (string, *Page) {
 	// 缓存键
 	key := bp.cacheKey(tableName, page.GetID())
 
-	// when inserting a new page, it is not persisted so dirty must be true
-	// 新插入的页一定是脏页
 	pd := &pageDescriptor{
 		table: tableName,
-		page: page,
-		dirty: true,
+		page:  page,
+		dirty: dirty,
 	}
 
 	// 插入新页，返回被淘汰页
 	evicted := bp.frames.Set(key, pd)
 	if evicted == nil {
-		return nil
+		return "", nil
 	}
 
 	// 如果被淘汰的是脏页，需要返回，调用者会执行刷盘，否则返回 nil
 	evictedPageDescriptor := evicted.(*pageDescriptor)
 	if !evictedPageDescriptor.dirty {
-		return nil
+		return "", nil
 	}
 
-	return evictedPageDescriptor.page
-
+	return evictedPageDescriptor.table, evictedPageDescriptor.page
 }
 
 // AppendTuple finds the page from page directory then puts tuple in it.
@@ -118,3 +129,20 @@ func (bp *BufferPool) AppendTuple(tableName string, pageID PageID, tuple sdb.Tup
 	pageDescriptor.dirty = true // when new tuple is appended to the page, it is marked dirty
 	return true
 }
+
+// ReplaceTuples replaces the tuples on the page in the cache.
+// If the page is not found or the tuples do not fit in the page, false will be responded.
+func (bp *BufferPool) ReplaceTuples(tableName string, pageID PageID, tuples []sdb.Tuple) bool {
+	elem := bp.frames.Get(bp.cacheKey(tableName, pageID))
+	if elem == nil {
+		return false
+	}
+
+	pageDescriptor := elem.(*pageDescriptor)
+	if err := pageDescriptor.page.ReplaceTuples(tuples); err != nil {
+		return false
+	}
+
+	pageDescriptor.dirty = true
+	return true
+}
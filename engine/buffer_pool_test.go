@@ -10,21 +10,22 @@ func TestBufferPool_InsertPage(t *testing.T) {
 	table := "users"
 	bp := NewBufferPool(2, nil)
 
-	page1 := InitPage(1)
-	page2 := InitPage(2)
-	page3 := InitPage(3)
+	page1 := InitPage(1, DefaultPageSize)
+	page2 := InitPage(2, DefaultPageSize)
+	page3 := InitPage(3, DefaultPageSize)
 
 	nilPage := (*Page)(nil)
-	evicted := bp.InsertPage(table, page1)
+	_, evicted := bp.InsertPage(table, page1)
 	testutil.MustEqual(t, evicted, nilPage)
 	testutil.MustEqual(t, bp.frames.Get(bp.cacheKey(table, 1)).(*pageDescriptor), &pageDescriptor{table: table, page: page1, dirty: true})
 
-	evicted = bp.InsertPage(table, page2)
+	_, evicted = bp.InsertPage(table, page2)
 	testutil.MustEqual(t, evicted, nilPage)
 	testutil.MustEqual(t, bp.frames.Get(bp.cacheKey(table, 2)).(*pageDescriptor), &pageDescriptor{table: table, page: page2, dirty: true})
 
 	// because lru capacity is 2, 1st page is evicted when the 3rd page is inserted
-	evicted = bp.InsertPage(table, page3)
+	evictedTable, evicted := bp.InsertPage(table, page3)
+	testutil.MustEqual(t, evictedTable, table)
 	testutil.MustEqual(t, evicted, page1)
 	testutil.MustEqual(t, bp.frames.Get(bp.cacheKey(table, 3)).(*pageDescriptor), &pageDescriptor{table: table, page: page3, dirty: true})
 	testutil.MustEqual(t, bp.frames.Get(bp.cacheKey(table, 1)), nil) // make sure 1st page is evicted
@@ -36,8 +37,34 @@ func TestBufferPool_InsertPage(t *testing.T) {
 	bp.frames.Set(bp.cacheKey(table, 2), &pageDescriptor{table: table, page: page2, dirty: false})
 
 	// page1 is purged but because it's not dirty, it won't be returned.
-	evicted = bp.InsertPage(table, page3)
+	_, evicted = bp.InsertPage(table, page3)
 	testutil.MustEqual(t, evicted, nilPage)
+
+	bp = NewBufferPool(1, nil)
+
+	// the evicted page belongs to the other table
+	bp.InsertPage("items", page1)
+	evictedTable, evicted = bp.InsertPage(table, page2)
+	testutil.MustEqual(t, evictedTable, "items")
+	testutil.MustEqual(t, evicted, page1)
+}
+
+func TestBufferPool_CachePage(t *testing.T) {
+	table := "users"
+	bp := NewBufferPool(1, nil)
+
+	page1 := InitPage(1, DefaultPageSize)
+	page2 := InitPage(2, DefaultPageSize)
+
+	// the page loaded from the disk is not dirty
+	_, evicted := bp.CachePage(table, page1)
+	testutil.MustEqual(t, evicted, (*Page)(nil))
+	testutil.MustEqual(t, bp.frames.Get(bp.cacheKey(table, 1)).(*pageDescriptor), &pageDescriptor{table: table, page: page1, dirty: false})
+
+	// so it is not returned when evicted
+	_, evicted = bp.CachePage(table, page2)
+	testutil.MustEqual(t, evicted, (*Page)(nil))
+	testutil.MustEqual(t, bp.GetPage(table, 2), page2)
 }
 
 func TestBufferPool_AppendTuple(t *testing.T) {
@@ -51,7 +78,7 @@ func TestBufferPool_AppendTuple(t *testing.T) {
 	// make sure true is responded when the page is found on cache
 	dummyTuple := NewTuple([]interface{}{int64(96)}, 0)
 
-	page1 := InitPage(1)
+	page1 := InitPage(1, DefaultPageSize)
 	bp.frames.Set(bp.cacheKey(table, 1), &pageDescriptor{table: table, page: page1, dirty: false})
 	appended = bp.AppendTuple(table, 1, &Tuple{})
 	testutil.MustEqual(t, appended, true)
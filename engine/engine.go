@@ -1,16 +1,29 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
-	"sort"
 
 	"github.com/dty1er/sdb/btree"
 	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/header"
 	"github.com/dty1er/sdb/sdb"
 )
 
 func init() {
 	btree.RegisterSerializationTarget(&Tuple{})
+	btree.RegisterSerializationTarget(&IndexEntry{})
+}
+
+// IndexEntry is an entry of the btree index. The entries are ordered by the key column of the tuple.
+// PageID is the page which has the tuple. It is 0 when unknown, as in the index persisted before it was recorded.
+type IndexEntry struct {
+	Tuple  *Tuple
+	PageID PageID
+}
+
+func (ie *IndexEntry) Less(than btree.Item) bool {
+	return ie.Tuple.Less(than.(*IndexEntry).Tuple)
 }
 
 // Engine is sdb core storage engine.
@@ -18,12 +31,38 @@ func init() {
 type Engine struct {
 	bufferPool    *BufferPool
 	pageDirectory *PageDirectory
+	pageSize      int
 
 	catalog     sdb.Catalog
 	diskManager sdb.DiskManager
 }
 
 func New(conf *config.Server, catalog sdb.Catalog, diskManager sdb.DiskManager) (*Engine, error) {
+	// Load Page directory and the header first. The older db files are rejected before reading the indices.
+	pageDirectory := NewPageDirectory(0)
+	if err := diskManager.Load("__page_directory.db", 0, pageDirectory); err != nil {
+		return nil, err
+	}
+
+	// Load database header to know the page size
+	hdr, err := loadHeader(conf, pageDirectory, diskManager)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int(hdr.PageSize)
+	if pageDirectory.PageSize == 0 {
+		pageDirectory.PageSize = pageSize
+	}
+	if pageDirectory.PageSize != pageSize {
+		return nil, fmt.Errorf("page size %d in page directory does not match %d in header", pageDirectory.PageSize, pageSize)
+	}
+
+	// The progress is left when the upgrade was interrupted after the header was written.
+	if err := diskManager.Remove(upgradeProgressFile); err != nil {
+		return nil, err
+	}
+
 	// Load index
 	indices := make(map[IndexKey]*btree.BTree)
 	indexCatalog := catalog.ListIndices()
@@ -40,20 +79,104 @@ func New(conf *config.Server, catalog sdb.Catalog, diskManager sdb.DiskManager)
 		indices = map[IndexKey]*btree.BTree{}
 	}
 
-	// Load Page directory
-	pageDirectory := NewPageDirectory()
-	if err := diskManager.Load("__page_directory.db", 0, pageDirectory); err != nil {
-		return nil, err
-	}
-
 	bufferPool := NewBufferPool(conf.BufferPoolEntryCount, indices)
 
-	return &Engine{
+	e := &Engine{
 		bufferPool:    bufferPool,
 		pageDirectory: pageDirectory,
+		pageSize:      pageSize,
 		catalog:       catalog,
 		diskManager:   diskManager,
-	}, nil
+	}
+
+	// The indices used not to be populated on insert. They are built from the table once.
+	for _, index := range indexCatalog {
+		if err := e.buildIndex(index.Table, index.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// buildIndex puts every tuple of the table to the index when the index is empty but the table is not.
+func (e *Engine) buildIndex(table, idxName string) error {
+	index := e.bufferPool.readIndex(table, idxName)
+	if !index.Empty() {
+		return nil
+	}
+
+	for n, pageID := range e.pageDirectory.GetPageIDs(table) {
+		tuples, err := e.ReadPage(table, n)
+		if err != nil {
+			return fmt.Errorf("build index %s: %w", idxName, err)
+		}
+
+		for _, t := range tuples {
+			index.Put(&IndexEntry{Tuple: t.(*Tuple), PageID: pageID})
+		}
+	}
+
+	return nil
+}
+
+// PageFiles returns the files which hold the pages, mapped to the page size. It is used to encrypt
+// the existing db files, where each page is encrypted separately.
+func PageFiles(diskManager sdb.DiskManager) (map[string]int, error) {
+	pageDirectory := NewPageDirectory(0)
+	if err := diskManager.Load("__page_directory.db", 0, pageDirectory); err != nil {
+		return nil, err
+	}
+
+	// the db files in the older format must be upgraded first
+	hdr, err := header.Verify(diskManager, len(pageDirectory.PageIDs) != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]int{}
+	if hdr == nil {
+		return files, nil
+	}
+
+	for _, loc := range pageDirectory.PageLocation {
+		files[loc.Filename] = int(hdr.PageSize)
+	}
+
+	return files, nil
+}
+
+// loadHeader loads the database header and validates it.
+// When the database is new, the header is initialized by the configuration.
+func loadHeader(conf *config.Server, pageDirectory *PageDirectory, diskManager sdb.DiskManager) (*header.Header, error) {
+	hdr, err := header.Verify(diskManager, len(pageDirectory.PageIDs) != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr == nil {
+		if err := ValidatePageSize(conf.PageSize); err != nil {
+			return nil, fmt.Errorf("invalid page_size configuration: %w", err)
+		}
+
+		hdr = header.New(conf.PageSize)
+		if err := hdr.Persist(diskManager); err != nil {
+			return nil, err
+		}
+
+		return hdr, nil
+	}
+
+	if err := ValidatePageSize(int(hdr.PageSize)); err != nil {
+		return nil, fmt.Errorf("invalid database header: %w", err)
+	}
+
+	return hdr, nil
+}
+
+// newPage returns an empty page to load the page from the disk.
+func (e *Engine) newPage() *Page {
+	return NewPage(make([]byte, e.pageSize))
 }
 
 // CreateIndex initializes the btree index.
@@ -64,25 +187,79 @@ func (e *Engine) CreateIndex(table, idxName string) {
 	e.bufferPool.indices[key] = bt
 }
 
-// InsertIndex inserts a record to the index
-func (e *Engine) InsertIndex(table, idxName string, k sdb.IndexKey, t sdb.Tuple) error {
-	// key := toIndexKey(table, idxName)
-	// index := e.bufferPool.indices[key]
-	// index.Put(t) // TODO: change btree interface to do Put(k, t)
+// InsertIndex inserts a record to the index. page is the page number of the tuple returned by InsertTuple
+// or UpdateTuple. The entries are ordered by the key column of the tuple, which is the column of the primary key index.
+func (e *Engine) InsertIndex(table, idxName string, k sdb.IndexKey, t sdb.Tuple, page int) error {
+	index := e.bufferPool.readIndex(table, idxName)
+	if index == nil {
+		return fmt.Errorf("index %s of table %s does not exist", idxName, table)
+	}
+
+	pageIDs := e.pageDirectory.GetPageIDs(table)
+	if page < 0 || len(pageIDs) <= page {
+		return fmt.Errorf("page %d of table %s is out of range", page, table)
+	}
 
+	index.Put(&IndexEntry{Tuple: t.(*Tuple), PageID: pageIDs[page]})
 	return nil
 }
 
-// InsertTuple inserts a record to the given table.
-func (e *Engine) InsertTuple(table string, t sdb.Tuple) error {
+// LookupIndex returns the tuple whose key is the given value in the index. nil is returned when not found.
+func (e *Engine) LookupIndex(table, idxName string, key interface{}) (sdb.Tuple, error) {
+	index := e.bufferPool.readIndex(table, idxName)
+	if index == nil {
+		return nil, fmt.Errorf("index %s of table %s does not exist", idxName, table)
+	}
+
+	item, found := index.Get(&IndexEntry{Tuple: NewTuple([]interface{}{key}, 0)})
+	if !found {
+		return nil, nil
+	}
+
+	return item.(*IndexEntry).Tuple, nil
+}
+
+// SeekIndex returns the iterator of the tuples in the index in the order of the key, starting from
+// the smallest key which is not less than the given key. When the key is nil, it starts from the smallest key.
+func (e *Engine) SeekIndex(table, idxName string, key interface{}) (sdb.IndexIterator, error) {
+	index := e.bufferPool.readIndex(table, idxName)
+	if index == nil {
+		return nil, fmt.Errorf("index %s of table %s does not exist", idxName, table)
+	}
+
+	if key == nil {
+		return &indexIterator{it: index.Seek(nil)}, nil
+	}
+
+	return &indexIterator{it: index.Seek(&IndexEntry{Tuple: NewTuple([]interface{}{key}, 0)})}, nil
+}
+
+// indexIterator returns the tuples of the index entries.
+type indexIterator struct {
+	it *btree.Iterator
+}
+
+func (ii *indexIterator) Next() sdb.Tuple {
+	item, ok := ii.it.Next()
+	if !ok {
+		return nil
+	}
+
+	return item.(*IndexEntry).Tuple
+}
+
+// InsertTuple inserts a record to the given table. It returns the page number of the tuple.
+func (e *Engine) InsertTuple(table string, t sdb.Tuple) (int, error) {
 	var pageID PageID
 
 	//
 	pageIDs := e.pageDirectory.GetPageIDs(table)
 	if len(pageIDs) == 0 {
 		// First record for the table. Insert a page
-		page := InitPage(1)
-		e.insertPage(table, page)
+		page := InitPage(1, e.pageSize)
+		if err := e.insertPage(table, page); err != nil {
+			return 0, err
+		}
 		pageID = PageID(1)
 	} else {
 		// use the last page
@@ -92,37 +269,8 @@ func (e *Engine) InsertTuple(table string, t sdb.Tuple) error {
 	for {
 
 		// first, make sure the page is on the buffer pool
-		// 查询页缓存
-		pageFound := e.bufferPool.FindPage(table, pageID)
-		// 缓存不存在
-		if !pageFound {
-			// if not found, put the page on the cache
-			// 查询页信息
-			loc, err := e.pageDirectory.GetPageLocation(table, pageID)
-			if err != nil {
-				// this must not happen
-				panic(fmt.Sprintf("page is not found in the page directory: %s", err))
-			}
-
-			// 从磁盘加载页
-			var p Page
-			if err := e.diskManager.Load(loc.Filename, int(loc.Offset), &p); err != nil {
-				return err
-			}
-
-			// 插入到缓存
-			evicted := e.bufferPool.InsertPage(table, &p)
-
-			// 将被淘汰页落盘
-			if evicted != nil {
-				loc, err := e.pageDirectory.GetPageLocation(table, evicted.GetID())
-				if err != nil {
-					return err
-				}
-				if err = e.diskManager.Persist(loc.Filename, int(loc.Offset), evicted); err != nil {
-					return err
-				}
-			}
+		if _, err := e.fetchPage(table, pageID); err != nil {
+			return 0, err
 		}
 
 		// try to append the tuple on the page
@@ -138,16 +286,94 @@ func (e *Engine) InsertTuple(table string, t sdb.Tuple) error {
 		// 插入失败，创建新页并放入缓存
 
 		// if fail, init new page then try to use it
-		page := InitPage(uint32(pageID) + 1)
+		page := InitPage(uint32(pageID)+1, e.pageSize)
 		if err := e.insertPage(table, page); err != nil {
-			return err
+			return 0, err
 		}
 
 		// 在下一次循环中，尝试插入到新页
 		pageID = page.GetID()
 	}
 
-	return nil
+	// the tuple is on the last page
+	return e.PageCount(table) - 1, nil
+}
+
+// UpdateTuple replaces the tuple which has the same key as t with t. The page of the old tuple is found
+// by the index, which must be one of the indices of the table. When t does not fit in the page, t is moved
+// to the last page. It returns the page number of t, which the index entries must be updated with.
+func (e *Engine) UpdateTuple(table, idxName string, t sdb.Tuple) (int, error) {
+	index := e.bufferPool.readIndex(table, idxName)
+	if index == nil {
+		return 0, fmt.Errorf("index %s of table %s does not exist", idxName, table)
+	}
+
+	item, found := index.Get(&IndexEntry{Tuple: t.(*Tuple)})
+	if !found {
+		return 0, fmt.Errorf("tuple to be updated is not found in table %s", table)
+	}
+
+	pageIDs := e.pageDirectory.GetPageIDs(table)
+	if pageID := item.(*IndexEntry).PageID; pageID != 0 {
+		for n, id := range pageIDs {
+			if id == pageID {
+				return e.updateTupleOnPage(table, n, t)
+			}
+		}
+	}
+
+	// the page is unknown for the index persisted before the page was recorded
+	for n := range pageIDs {
+		page, err := e.updateTupleOnPage(table, n, t)
+		if err != errTupleNotFound {
+			return page, err
+		}
+	}
+
+	return 0, fmt.Errorf("tuple to be updated is not found in table %s", table)
+}
+
+var errTupleNotFound = errors.New("tuple is not found")
+
+// updateTupleOnPage replaces the tuple which has the same key as t on the n-th page of the table.
+// errTupleNotFound is returned when the page does not have it.
+func (e *Engine) updateTupleOnPage(table string, n int, t sdb.Tuple) (int, error) {
+	pageID := e.pageDirectory.GetPageIDs(table)[n]
+	page, err := e.fetchPage(table, pageID)
+	if err != nil {
+		return 0, err
+	}
+
+	ts, err := page.GetTuples()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, old := range ts {
+		if old.Less(t) || t.Less(old) {
+			continue
+		}
+
+		tuples := make([]sdb.Tuple, len(ts))
+		for j, tuple := range ts {
+			tuples[j] = tuple
+		}
+
+		tuples[i] = t
+		if e.bufferPool.ReplaceTuples(table, pageID, tuples) {
+			return n, nil
+		}
+
+		// the old tuple is removed from the page, which always fits, then t is appended
+		tuples = append(tuples[:i], tuples[i+1:]...)
+		if !e.bufferPool.ReplaceTuples(table, pageID, tuples) {
+			return 0, fmt.Errorf("failed to remove the tuple from page %d of table %s", pageID, table)
+		}
+
+		return e.InsertTuple(table, t)
+	}
+
+	return 0, errTupleNotFound
 }
 
 func (e *Engine) ReadIndex(table, idxName string) *btree.BTree {
@@ -157,36 +383,89 @@ func (e *Engine) ReadIndex(table, idxName string) *btree.BTree {
 	return e.bufferPool.readIndex(table, idxName)
 }
 
-func (e *Engine) ReadTable(table string) ([]sdb.Tuple, error) {
-	tuples := []sdb.Tuple{}
+// PageSize returns the page size of the database.
+func (e *Engine) PageSize() int {
+	return e.pageSize
+}
+
+// PageCount returns the number of the pages of the table.
+func (e *Engine) PageCount(table string) int {
+	return len(e.pageDirectory.GetPageIDs(table))
+}
+
+// ReadPage returns the tuples in the n-th page of the table. n starts from 0.
+// The page is read through the buffer pool, so the scan reads only one page at a time on memory.
+func (e *Engine) ReadPage(table string, n int) ([]sdb.Tuple, error) {
 	pageIDs := e.pageDirectory.GetPageIDs(table)
-	for _, pageID := range pageIDs {
-		page := e.bufferPool.GetPage(table, pageID)
-		if page == nil {
-			loc, err := e.pageDirectory.GetPageLocation(table, pageID)
-			if err != nil {
-				panic(err) // this must not happen
-			}
-			var p Page
-			if err := e.diskManager.Load(loc.Filename, int(loc.Offset), &p); err != nil {
-				return nil, err
-			}
-			page = &p
-		}
+	if n < 0 || len(pageIDs) <= n {
+		return nil, fmt.Errorf("page %d of table %s is out of range", n, table)
+	}
 
-		ts, err := page.GetTuples()
-		if err != nil {
+	page, err := e.fetchPage(table, pageIDs[n])
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := page.GetTuples()
+	if err != nil {
+		return nil, err
+	}
+
+	tuples := make([]sdb.Tuple, len(ts))
+	for i, t := range ts {
+		tuples[i] = t
+	}
+
+	return tuples, nil
+}
+
+// PageCached reports whether the n-th page of the table is on the buffer pool, so that it is read without disk access.
+func (e *Engine) PageCached(table string, n int) bool {
+	pageIDs := e.pageDirectory.GetPageIDs(table)
+	if n < 0 || len(pageIDs) <= n {
+		return false
+	}
+
+	return e.bufferPool.FindPage(table, pageIDs[n])
+}
+
+// fetchPage returns the page from the buffer pool.
+// When the page is not on the buffer pool, it is loaded from the disk and put on the buffer pool.
+func (e *Engine) fetchPage(table string, pageID PageID) (*Page, error) {
+	if page := e.bufferPool.GetPage(table, pageID); page != nil {
+		return page, nil
+	}
+
+	loc, err := e.pageDirectory.GetPageLocation(table, pageID)
+	if err != nil {
+		// this must not happen
+		panic(fmt.Sprintf("page is not found in the page directory: %s", err))
+	}
+
+	// 从磁盘加载页
+	page := e.newPage()
+	if err := e.diskManager.Load(loc.Filename, int(loc.Offset), page); err != nil {
+		return nil, err
+	}
+
+	// 插入到缓存，将被淘汰页落盘
+	if evictedTable, evicted := e.bufferPool.CachePage(table, page); evicted != nil {
+		if err := e.persistPage(evictedTable, evicted); err != nil {
 			return nil, err
 		}
-		for _, t := range ts {
-			tuples = append(tuples, t)
-		}
 	}
 
-	// default sort by key
-	sort.Slice(tuples, func(i, j int) bool { return tuples[i].Less(tuples[j]) })
+	return page, nil
+}
 
-	return tuples, nil
+// persistPage writes the page on the disk.
+func (e *Engine) persistPage(table string, page *Page) error {
+	loc, err := e.pageDirectory.GetPageLocation(table, page.GetID())
+	if err != nil {
+		return err
+	}
+
+	return e.diskManager.Persist(loc.Filename, int(loc.Offset), page)
 }
 
 // insertPage inserts a given page in pageDirectory and buffer pool.
@@ -194,16 +473,11 @@ func (e *Engine) insertPage(table string, page *Page) error {
 	e.pageDirectory.RegisterPage(table, page)
 
 	// 插入 LRU 缓存，返回被淘汰的页面
-	evicted := e.bufferPool.InsertPage(table, page)
+	evictedTable, evicted := e.bufferPool.InsertPage(table, page)
 
 	if evicted != nil {
-		// 查询被淘汰页的位置
-		loc, err := e.pageDirectory.GetPageLocation(table, evicted.GetID())
-		if err != nil {
-			return err
-		}
-		// 将淘汰页刷盘，传入文件名、块偏移、页数据
-		if err = e.diskManager.Persist(loc.Filename, int(loc.Offset), evicted); err != nil {
+		// 将淘汰页刷盘. The evicted page can belong to another table.
+		if err := e.persistPage(evictedTable, evicted); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func newTestEngine(t *testing.T, dir string) (*Engine, *catalog.Catalog) {
+	t.Helper()
+	dm, err := diskmanager.New(dir)
+	testutil.MustBeNil(t, err)
+
+	c, err := catalog.New(dm)
+	testutil.MustBeNil(t, err)
+
+	e, err := New(&config.Server{BufferPoolEntryCount: 2, PageSize: 4096}, c, dm)
+	testutil.MustBeNil(t, err)
+
+	return e, c
+}
+
+func createUsers(t *testing.T, e *Engine, c *catalog.Catalog) {
+	t.Helper()
+	columns := []*schema.ColumnDef{
+		{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+		{Name: "name", Type: schema.ColumnTypeString},
+	}
+	indices := []*schema.Index{{Table: "users", Name: "users_pkey_id", ColumnIndex: 0}}
+	testutil.MustBeNil(t, c.AddTable("users", columns, indices))
+	e.CreateIndex("users", "users_pkey_id")
+}
+
+// insertUser inserts the user to the table and the primary key index.
+func insertUser(t *testing.T, e *Engine, id int64, name string) {
+	t.Helper()
+	tuple := NewTuple([]interface{}{id, name}, 0)
+	page, err := e.InsertTuple("users", tuple)
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, e.InsertIndex("users", "users_pkey_id", sdb.NewInt64IndexKey(id), tuple, page))
+}
+
+func TestEngine_LookupIndex(t *testing.T) {
+	dir := t.TempDir()
+	e, c := newTestEngine(t, dir)
+	createUsers(t, e, c)
+
+	for i := 0; i < 300; i++ {
+		insertUser(t, e, int64(i), "name")
+	}
+
+	assertIndex := func(e *Engine) {
+		t.Helper()
+		for _, i := range []int64{0, 1, 150, 299} {
+			tuple, err := e.LookupIndex("users", "users_pkey_id", i)
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, tuple.Value(0), i)
+		}
+
+		tuple, err := e.LookupIndex("users", "users_pkey_id", int64(300))
+		testutil.MustBeNil(t, err)
+		testutil.MustEqual(t, tuple, nil)
+	}
+	assertIndex(e)
+
+	_, err := e.LookupIndex("users", "unknown", int64(1))
+	testutil.MustEqual(t, err != nil, true)
+
+	// the index is persisted on shutdown
+	testutil.MustBeNil(t, c.Persist())
+	testutil.MustBeNil(t, e.Shutdown())
+	e, _ = newTestEngine(t, dir)
+	assertIndex(e)
+}
+
+func TestEngine_SeekIndex(t *testing.T) {
+	e, c := newTestEngine(t, t.TempDir())
+	createUsers(t, e, c)
+
+	// inserted in the different order from the key
+	for _, i := range rand.New(rand.NewSource(1)).Perm(100) {
+		insertUser(t, e, int64(i), "name")
+	}
+
+	keys := func(key interface{}) []int64 {
+		t.Helper()
+		it, err := e.SeekIndex("users", "users_pkey_id", key)
+		testutil.MustBeNil(t, err)
+
+		keys := []int64{}
+		for tuple := it.Next(); tuple != nil; tuple = it.Next() {
+			keys = append(keys, tuple.Value(0).(int64))
+		}
+		return keys
+	}
+
+	all := make([]int64, 100)
+	for i := range all {
+		all[i] = int64(i)
+	}
+	testutil.MustEqual(t, keys(nil), all)
+	testutil.MustEqual(t, keys(int64(95)), all[95:])
+	testutil.MustEqual(t, keys(int64(100)), []int64{})
+
+	_, err := e.SeekIndex("users", "unknown", nil)
+	testutil.MustEqual(t, err != nil, true)
+}
+
+func TestEngine_BuildIndex(t *testing.T) {
+	dir := t.TempDir()
+	e, c := newTestEngine(t, dir)
+	createUsers(t, e, c)
+
+	// the tuples which are not in the index
+	for i := 0; i < 100; i++ {
+		_, err := e.InsertTuple("users", NewTuple([]interface{}{int64(i), "name"}, 0))
+		testutil.MustBeNil(t, err)
+	}
+	testutil.MustBeNil(t, c.Persist())
+	testutil.MustBeNil(t, e.Shutdown())
+
+	// the index is built from the table on start
+	e, _ = newTestEngine(t, dir)
+	for i := 0; i < 100; i++ {
+		tuple, err := e.LookupIndex("users", "users_pkey_id", int64(i))
+		testutil.MustBeNil(t, err)
+		testutil.MustEqual(t, tuple.Value(0), int64(i))
+	}
+}
+
+func TestEngine_UpdateTuple(t *testing.T) {
+	dir := t.TempDir()
+	e, c := newTestEngine(t, dir)
+	createUsers(t, e, c)
+
+	for i := 0; i < 300; i++ {
+		insertUser(t, e, int64(i), "name")
+	}
+
+	expected := map[int64]string{}
+	for i := 0; i < 300; i++ {
+		expected[int64(i)] = "name"
+	}
+
+	// the index persisted before the page was recorded does not know the page
+	old := e.bufferPool.readIndex("users", "users_pkey_id")
+	item, _ := old.Get(&IndexEntry{Tuple: NewTuple([]interface{}{int64(200)}, 0)})
+	old.Put(&IndexEntry{Tuple: item.(*IndexEntry).Tuple})
+
+	// the full pages cannot hold the longer names, so the tuples are moved to the last page
+	updates := map[int64]string{0: "eman", 1: strings.Repeat("long name", 10), 150: "", 200: "x", 299: strings.Repeat("long name", 10)}
+	for id, name := range updates {
+		tuple := NewTuple([]interface{}{id, name}, 0)
+		page, err := e.UpdateTuple("users", "users_pkey_id", tuple)
+		testutil.MustBeNil(t, err)
+		testutil.MustBeNil(t, e.InsertIndex("users", "users_pkey_id", sdb.NewInt64IndexKey(id), tuple, page))
+		expected[id] = name
+
+		// the tuple is on the returned page
+		tuples, err := e.ReadPage("users", page)
+		testutil.MustBeNil(t, err)
+		found := false
+		for _, tp := range tuples {
+			found = found || tp.Value(0) == id
+		}
+		testutil.MustEqual(t, found, true)
+	}
+
+	_, err := e.UpdateTuple("users", "users_pkey_id", NewTuple([]interface{}{int64(300), "name"}, 0))
+	testutil.MustEqual(t, err != nil, true)
+
+	assertTable := func(e *Engine) {
+		t.Helper()
+		actual := map[int64]string{}
+		for n := 0; n < e.PageCount("users"); n++ {
+			tuples, err := e.ReadPage("users", n)
+			testutil.MustBeNil(t, err)
+			for _, tuple := range tuples {
+				id := tuple.Value(0).(int64)
+				if _, ok := actual[id]; ok {
+					t.Fatalf("tuple %d is duplicated", id)
+				}
+				actual[id] = tuple.Value(1).(string)
+			}
+		}
+		testutil.MustEqual(t, actual, expected)
+	}
+	assertTable(e)
+
+	// the updated pages are persisted on shutdown
+	testutil.MustBeNil(t, c.Persist())
+	testutil.MustBeNil(t, e.Shutdown())
+	e, _ = newTestEngine(t, dir)
+	assertTable(e)
+
+	// the pages in the index are persisted too
+	item, _ = e.bufferPool.readIndex("users", "users_pkey_id").Get(&IndexEntry{Tuple: NewTuple([]interface{}{int64(1)}, 0)})
+	testutil.MustEqual(t, item.(*IndexEntry).PageID, e.pageDirectory.GetPageIDs("users")[e.PageCount("users")-1])
+}
+
+func TestEngine_Encrypt(t *testing.T) {
+	dir := t.TempDir()
+	e, c := newTestEngine(t, dir)
+	createUsers(t, e, c)
+	for i := 0; i < 300; i++ {
+		insertUser(t, e, int64(i), strings.Repeat("a", 50))
+	}
+	testutil.MustBeNil(t, c.Persist())
+	testutil.MustBeNil(t, e.Shutdown())
+
+	// the database initialized without encryption is encrypted
+	dm, err := diskmanager.New(dir)
+	testutil.MustBeNil(t, err)
+	files, err := PageFiles(dm)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, files, map[string]int{"users__1.db": 4096})
+
+	key := []byte(strings.Repeat("k", 32))
+	testutil.MustBeNil(t, dm.Encrypt(key, files))
+
+	dm, err = diskmanager.New(dir, diskmanager.WithEncryptionKey(key))
+	testutil.MustBeNil(t, err)
+	c, err = catalog.New(dm)
+	testutil.MustBeNil(t, err)
+	e, err = New(&config.Server{BufferPoolEntryCount: 2, PageSize: 4096}, c, dm)
+	testutil.MustBeNil(t, err)
+
+	count := 0
+	for n := 0; n < e.PageCount("users"); n++ {
+		tuples, err := e.ReadPage("users", n)
+		testutil.MustBeNil(t, err)
+		count += len(tuples)
+	}
+	testutil.MustEqual(t, count, 300)
+
+	tuple, err := e.LookupIndex("users", "users_pkey_id", int64(299))
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, tuple.Value(0), int64(299))
+}
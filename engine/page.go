@@ -11,7 +11,21 @@ import (
 
 type PageID uint32
 
-const PageSize = 16 * 1024 // 16KB
+const (
+	DefaultPageSize = 16 * 1024 // 16KB
+	MinPageSize     = 4 * 1024  // 4KB
+	MaxPageSize     = 64 * 1024 // 64KB
+)
+
+// ValidatePageSize checks if the given size can be used as the page size.
+// Page size must be power of 2 between MinPageSize and MaxPageSize.
+func ValidatePageSize(size int) error {
+	if size < MinPageSize || MaxPageSize < size || size&(size-1) != 0 {
+		return fmt.Errorf("page size must be power of 2 between %d and %d but got %d", MinPageSize, MaxPageSize, size)
+	}
+
+	return nil
+}
 
 // Page manages multiple tuples as slotted page.
 // The layout looks like below:
@@ -24,11 +38,13 @@ const PageSize = 16 * 1024 // 16KB
 // -----------------------------
 //
 // header layout:
-// |page_id(4byte)|tuples_count(2byte)|slot1(2byte)|slot2(2byte)|slot3(2byte)|...|slotN(2byte)|
+// |page_id(4byte)|tuples_count(2byte)|slot1(8byte)|slot2(8byte)|slot3(8byte)|...|slotN(8byte)|
 // note: N is the same as tuples_count
 //
 // slot layout:
-// |offset(2byte)|length(2byte)|
+// |offset(4byte)|length(4byte)|
+//
+// The page size is decided per database when it is initialized. See ValidatePageSize for the available size.
 //
 // The first slot represents of the first tuple. Because the tuples are placed from bottom to head,
 // the first slot's offset is the starting point of the last section of the byte stream.
@@ -37,16 +53,22 @@ const PageSize = 16 * 1024 // 16KB
 //
 // tuple layout: see engine/ssdb/tuple.go
 type Page struct {
-	bs [PageSize]byte
+	bs []byte
 }
 
-func NewPage(bs [PageSize]byte) *Page {
+// NewPage returns a page which holds bs. The length of bs is the page size.
+func NewPage(bs []byte) *Page {
 	return &Page{bs: bs}
 }
 
+const (
+	pageHeaderSize = 4 + 2
+	slotSize       = 4 + 4
+)
+
 type slot struct {
-	offset uint16 // [2]byte
-	length uint16 // [2]byte
+	offset uint32 // [4]byte
+	length uint32 // [4]byte
 }
 
 type pageHeader struct {
@@ -56,21 +78,21 @@ type pageHeader struct {
 }
 
 // InitPage 创建并初始化内存页
-func InitPage(id uint32) *Page {
-	bs := [PageSize]byte{}
+func InitPage(id uint32, pageSize int) *Page {
+	bs := make([]byte, pageSize)
 	putUint32OnBytes(bs[0:], id)
 	putUint16OnBytes(bs[4:], 0) // tuple count is initially 0
 	return &Page{bs: bs}
 }
 
 func (h *pageHeader) encode() []byte {
-	length := 4 + 2 + len(h.slots)*4
+	length := pageHeaderSize + len(h.slots)*slotSize
 	bs := make([]byte, length)
 	putUint32OnBytes(bs[0:], uint32(h.id))
 	putUint16OnBytes(bs[4:], h.tuplesCount)
 	for i := 0; i < len(h.slots); i++ {
-		putUint16OnBytes(bs[6+i*4:], h.slots[i].offset)
-		putUint16OnBytes(bs[8+i*4:], h.slots[i].length)
+		putUint32OnBytes(bs[pageHeaderSize+i*slotSize:], h.slots[i].offset)
+		putUint32OnBytes(bs[pageHeaderSize+i*slotSize+4:], h.slots[i].length)
 	}
 
 	return bs
@@ -84,9 +106,9 @@ func (p *Page) decodeHeader() pageHeader {
 
 	for i := 0; i < int(h.tuplesCount); i++ {
 		s := &slot{}
-		o := i * 4 // offset
-		s.offset = bytesToUint16(p.bs[6+o:])
-		s.length = bytesToUint16(p.bs[8+o:])
+		o := pageHeaderSize + i*slotSize // offset
+		s.offset = bytesToUint32(p.bs[o:])
+		s.length = bytesToUint32(p.bs[o+4:])
 		h.slots[i] = s
 	}
 
@@ -116,45 +138,66 @@ func (p *Page) AppendTuple(t sdb.Tuple) error {
 	}
 
 	header := p.decodeHeader()
-	// type + length + is_key + spare + slots
-	headerLength := 2 + 2 + 1 + 3 + len(header.slots)*4
+	headerLength := pageHeaderSize + len(header.slots)*slotSize
 
-	last := uint16(PageSize)
+	last := len(p.bs)
 	if header.tuplesCount != 0 {
-		last = header.slots[header.tuplesCount-1].offset
+		last = int(header.slots[header.tuplesCount-1].offset)
 	}
 
-	availableSpace := last - uint16(headerLength) - 4 // make sure tuple and its slot can be placed
-	if int(availableSpace) < len(tb) {
+	availableSpace := last - headerLength - slotSize // make sure tuple and its slot can be placed
+	if availableSpace < len(tb) {
 		return fmt.Errorf("no enough space on the page")
 	}
 
 	// place tuple
-	start := int(last) - len(tb)
+	start := last - len(tb)
 	copy(p.bs[start:last], tb)
 
 	header.tuplesCount++
-	header.slots = append(header.slots, &slot{offset: uint16(start), length: uint16(len(tb))})
+	header.slots = append(header.slots, &slot{offset: uint32(start), length: uint32(len(tb))})
 	copy(p.bs[0:], header.encode())
 
 	return nil
 }
 
+// ReplaceTuples replaces the tuples on the page with the given tuples. When they do not fit in the page,
+// an error is returned and the page is not changed.
+func (p *Page) ReplaceTuples(ts []sdb.Tuple) error {
+	page := InitPage(uint32(p.GetID()), len(p.bs))
+	for _, t := range ts {
+		if err := page.AppendTuple(t); err != nil {
+			return err
+		}
+	}
+
+	copy(p.bs, page.bs)
+	return nil
+}
+
 func (p *Page) GetID() PageID {
 	return p.decodeHeader().id
 }
 
+// Size returns the byte length of the page. Every page in a database has the same size.
+func (p *Page) Size() int {
+	return len(p.bs)
+}
+
 func (p *Page) Serialize() ([]byte, error) {
 	return p.bs[:], nil
 }
 
+// Deserialize reads the page from r. The page must be initialized by NewPage in advance to decide the size.
 func (p *Page) Deserialize(r io.Reader) error {
-	b := [PageSize]byte{}
-	if _, err := r.Read(b[:]); err != nil {
+	if len(p.bs) == 0 {
+		return fmt.Errorf("page size is unknown")
+	}
+
+	if _, err := io.ReadFull(r, p.bs); err != nil {
 		return err
 	}
 
-	p.bs = b
 	return nil
 }
 
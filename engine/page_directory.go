@@ -21,7 +21,7 @@ func EncodePageDirectoryID(table string, pageID PageID) string {
 type pageLocation struct {
 	Filename string
 	Offset   uint32
-	// length is always PageSize
+	// length is always the page size
 }
 
 // PageDirectory manages page location by table name and page id.
@@ -30,13 +30,15 @@ type PageDirectory struct {
 	PageIDs             map[string][]PageID // table name and PageID
 	PageLocation        map[string]*pageLocation
 	MaxPageCountPerFile int
+	PageSize            int
 }
 
-func NewPageDirectory() *PageDirectory {
+func NewPageDirectory(pageSize int) *PageDirectory {
 	return &PageDirectory{
 		PageIDs:             map[string][]PageID{},
 		PageLocation:        map[string]*pageLocation{},
 		MaxPageCountPerFile: MaxPageCountPerFile,
+		PageSize:            pageSize,
 	}
 }
 
@@ -76,7 +78,7 @@ func (pd *PageDirectory) RegisterPage(table string, page *Page) {
 	// when the latest file has enough space to store a page,
 	// use the file
 	if pageCount < pd.MaxPageCountPerFile {
-		newPageLoc := &pageLocation{Filename: latestFilename, Offset: uint32(pageCount * PageSize)}
+		newPageLoc := &pageLocation{Filename: latestFilename, Offset: uint32(pageCount * pd.PageSize)}
 		pd.PageLocation[pdid] = newPageLoc
 		return
 	}
@@ -119,6 +121,7 @@ func (pd *PageDirectory) String() string {
 	sb.WriteString("  },\n")
 
 	sb.WriteString(fmt.Sprintf("  MaxPageCountPerFile: %d,\n", pd.MaxPageCountPerFile))
+	sb.WriteString(fmt.Sprintf("  PageSize: %d,\n", pd.PageSize))
 	sb.WriteString("}\n")
 
 	return sb.String()
@@ -47,7 +47,7 @@ func TestPageDirectory_RegisterPage(t *testing.T) {
 			},
 			maxPageCountPerFile: 50,
 			table:               "users",
-			page:                InitPage(1),
+			page:                InitPage(1, DefaultPageSize),
 
 			wantPageIDs: map[string][]PageID{
 				"items": {PageID(1)},
@@ -65,21 +65,21 @@ func TestPageDirectory_RegisterPage(t *testing.T) {
 			},
 			pageLocation: map[string]*pageLocation{
 				"items#1": {Filename: "items__1.db", Offset: 0},
-				"items#2": {Filename: "items__1.db", Offset: PageSize},
-				"items#3": {Filename: "items__1.db", Offset: PageSize * 2},
+				"items#2": {Filename: "items__1.db", Offset: DefaultPageSize},
+				"items#3": {Filename: "items__1.db", Offset: DefaultPageSize * 2},
 			},
 			maxPageCountPerFile: 10,
 			table:               "items",
-			page:                InitPage(4),
+			page:                InitPage(4, DefaultPageSize),
 
 			wantPageIDs: map[string][]PageID{
 				"items": {PageID(1), PageID(2), PageID(3), PageID(4)},
 			},
 			wantPageLocation: map[string]*pageLocation{
 				"items#1": {Filename: "items__1.db", Offset: 0},
-				"items#2": {Filename: "items__1.db", Offset: PageSize},
-				"items#3": {Filename: "items__1.db", Offset: PageSize * 2},
-				"items#4": {Filename: "items__1.db", Offset: PageSize * 3},
+				"items#2": {Filename: "items__1.db", Offset: DefaultPageSize},
+				"items#3": {Filename: "items__1.db", Offset: DefaultPageSize * 2},
+				"items#4": {Filename: "items__1.db", Offset: DefaultPageSize * 3},
 			},
 		},
 		{
@@ -89,20 +89,20 @@ func TestPageDirectory_RegisterPage(t *testing.T) {
 			},
 			pageLocation: map[string]*pageLocation{
 				"items#1": {Filename: "items__1.db", Offset: 0},
-				"items#2": {Filename: "items__1.db", Offset: PageSize},
-				"items#3": {Filename: "items__1.db", Offset: PageSize * 2},
+				"items#2": {Filename: "items__1.db", Offset: DefaultPageSize},
+				"items#3": {Filename: "items__1.db", Offset: DefaultPageSize * 2},
 			},
 			maxPageCountPerFile: 3, // because 1 page should have 3 pages, new file will be added
 			table:               "items",
-			page:                InitPage(4),
+			page:                InitPage(4, DefaultPageSize),
 
 			wantPageIDs: map[string][]PageID{
 				"items": {PageID(1), PageID(2), PageID(3), PageID(4)},
 			},
 			wantPageLocation: map[string]*pageLocation{
 				"items#1": {Filename: "items__1.db", Offset: 0},
-				"items#2": {Filename: "items__1.db", Offset: PageSize},
-				"items#3": {Filename: "items__1.db", Offset: PageSize * 2},
+				"items#2": {Filename: "items__1.db", Offset: DefaultPageSize},
+				"items#3": {Filename: "items__1.db", Offset: DefaultPageSize * 2},
 				"items#4": {Filename: "items__2.db", Offset: 0},
 			},
 		},
@@ -115,6 +115,7 @@ func TestPageDirectory_RegisterPage(t *testing.T) {
 				PageIDs:             test.pageIDs,
 				PageLocation:        test.pageLocation,
 				MaxPageCountPerFile: test.maxPageCountPerFile,
+				PageSize:            DefaultPageSize,
 			}
 
 			pd.RegisterPage(test.table, test.page)
@@ -127,7 +128,7 @@ func TestPageDirectory_RegisterPage(t *testing.T) {
 func TestPageDirectory_GetPageLocation(t *testing.T) {
 	locations := []*pageLocation{
 		{Filename: "/tmp/users__1.db", Offset: 0},
-		{Filename: "/tmp/users__1.db", Offset: PageSize},
+		{Filename: "/tmp/users__1.db", Offset: DefaultPageSize},
 		{Filename: "/tmp/users__2.db", Offset: 0},
 	}
 
@@ -2,8 +2,10 @@ package engine
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/dty1er/sdb/sdb"
 	"github.com/dty1er/sdb/testutil"
 )
 
@@ -26,21 +28,34 @@ func TestPageHeader_encode(t *testing.T) {
 		[]byte{
 			0, 0, 0, 42, // page id (4 byte)
 			0, 3, // tuples count (2 byte)
-			0, 0, 0, 10, // slot[0]: offset (2 byte), length (2 byte),
-			0, 10, 0, 25, // slot[1]
-			0, 35, 0, 50, // slot[2]
+			0, 0, 0, 0, 0, 0, 0, 10, // slot[0]: offset (4 byte), length (4 byte),
+			0, 0, 0, 10, 0, 0, 0, 25, // slot[1]
+			0, 0, 0, 35, 0, 0, 0, 50, // slot[2]
 		},
 	)
 }
 
 func TestInitPage(t *testing.T) {
-	page := InitPage(42)
-	expected := [16 * 1024]byte{}
+	page := InitPage(42, DefaultPageSize)
+	expected := make([]byte, 16*1024)
 	copy(expected[0:4], []byte{0, 0, 0, 42})
 	testutil.MustEqual(t, page.bs, expected)
 
 	id := page.GetID()
 	testutil.MustEqual(t, id, PageID(42))
+
+	page = InitPage(42, MaxPageSize)
+	testutil.MustEqual(t, page.Size(), 64*1024)
+}
+
+func TestValidatePageSize(t *testing.T) {
+	for _, size := range []int{4 * 1024, 8 * 1024, 16 * 1024, 32 * 1024, 64 * 1024} {
+		testutil.MustBeNil(t, ValidatePageSize(size))
+	}
+
+	for _, size := range []int{0, 2 * 1024, 10000, 128 * 1024} {
+		testutil.MustEqual(t, ValidatePageSize(size) != nil, true)
+	}
 }
 
 func TestPage_AppendTuple(t *testing.T) {
@@ -50,7 +65,7 @@ func TestPage_AppendTuple(t *testing.T) {
 		NewTuple([]interface{}{[]byte{'g', 'h', 'i', 'j', 'k'}, int64(96)}, 0),
 		NewTuple([]interface{}{[]byte{'l', 'm', 'n', 'o', 'p'}, int64(96)}, 0),
 	}
-	page := InitPage(42)
+	page := InitPage(42, DefaultPageSize)
 
 	for _, tuple := range tuples {
 		err := page.AppendTuple(tuple)
@@ -79,19 +94,48 @@ func TestPage_AppendTuple(t *testing.T) {
 	// a page can contains $max tuples
 	// -4 because a page always has 4 byte ID
 	// -2 because a page always has 2 byte tuplesCount
-	// +4 because a slot is 4 byte
-	max := (PageSize - 4 - 2) / (tupleSize + 4)
+	// +8 because a slot is 8 byte
+	for _, pageSize := range []int{MinPageSize, DefaultPageSize, MaxPageSize} {
+		max := (pageSize - 4 - 2) / (tupleSize + 8)
 
-	page = InitPage(50)
-	// append $max tuples in the page.
-	// Error should not happen.
-	for i := 0; i < max; i++ {
-		err := page.AppendTuple(tuple)
-		testutil.MustBeNil(t, err)
+		page = InitPage(50, pageSize)
+		// append $max tuples in the page.
+		// Error should not happen.
+		for i := 0; i < max; i++ {
+			err := page.AppendTuple(tuple)
+			testutil.MustBeNil(t, err)
+		}
+
+		// because the page already contains $max tuples,
+		// no available space error must happen.
+		err = page.AppendTuple(tuple)
+		testutil.MustEqual(t, err == nil, false)
+	}
+}
+
+func TestPage_ReplaceTuples(t *testing.T) {
+	page := InitPage(42, MinPageSize)
+	for i := 0; i < 3; i++ {
+		testutil.MustBeNil(t, page.AppendTuple(NewTuple([]interface{}{int64(i), "name"}, 0)))
 	}
 
-	// because the page already contains $max tuples,
-	// no available space error must happen.
-	err = page.AppendTuple(tuple)
+	replaced := []sdb.Tuple{NewTuple([]interface{}{int64(0), "a longer name"}, 0), NewTuple([]interface{}{int64(2), "name"}, 0)}
+	testutil.MustBeNil(t, page.ReplaceTuples(replaced))
+
+	tuples, err := page.GetTuples()
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, len(tuples), 2)
+	for i, tuple := range tuples {
+		testutil.MustEqual(t, tuple, replaced[i].(*Tuple))
+	}
+	testutil.MustEqual(t, page.GetID(), PageID(42))
+
+	// the page is not changed when the tuples do not fit
+	large := NewTuple([]interface{}{int64(0), strings.Repeat("x", MinPageSize)}, 0)
+	err = page.ReplaceTuples([]sdb.Tuple{large})
 	testutil.MustEqual(t, err == nil, false)
+
+	tuples, err = page.GetTuples()
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, len(tuples), 2)
 }
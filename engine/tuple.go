@@ -14,10 +14,11 @@ import (
 
 // Tuple represents a row in a table. The size varies.
 // The tuple layout looks like below:
-// |Type(2byte)|Length(2byte)|IsKey(1byte)|value(Nbyte)|Type(4byte)|Length(2byte)|IsKey(1byte)|value(Nbyte)|...|Type(4byte)|Length(2byte)|IsKey(1byte)|value(Nbyte)|
+// |Type(2byte)|Length(2byte)|IsKey(1byte)|IsNull(1byte)|spare(2byte)|value(Nbyte)|...|Type(2byte)|Length(2byte)|IsKey(1byte)|IsNull(1byte)|spare(2byte)|value(Nbyte)|
 // The N depends on the type.
 // e.g. When the type is int64, the length is 8byte (=64bit).
 //      When the type is []byte and the length is 100, the length is 100 byte.
+// When IsNull is 1, the column value is NULL. Then the type and length are 0, and value is empty.
 type Tuple struct {
 	Data []*TupleData
 }
@@ -35,7 +36,8 @@ const (
 
 // TupleData represents a column in a row.
 type TupleData struct {
-	Key bool
+	Key  bool
+	Null bool
 
 	Typ          Type
 	Length       uint16 // n byte
@@ -86,11 +88,13 @@ func TypeFromString(s string) Type {
 }
 
 // NewTuple returns a tuple which represents a row in a table.
-// values are supposed to be the multiple column value of a column.
+// values are supposed to be the multiple column value of a column. nil value means NULL.
 func NewTuple(values []interface{}, keyIndex int) *Tuple {
 	t := &Tuple{Data: make([]*TupleData, len(values))}
 	for i, v := range values {
 		switch actual := v.(type) {
+		case nil:
+			t.Data[i] = &TupleData{Null: true}
 		case bool:
 			t.Data[i] = &TupleData{Typ: Bool, Length: 1, BoolVal: actual}
 		case int64:
@@ -118,12 +122,22 @@ func NewTuple(values []interface{}, keyIndex int) *Tuple {
 
 // Serialize encodes given t into byte slice. The size is not fixed.
 func (t *Tuple) Serialize() ([]byte, error) {
-	// type + length + is_key + spare
-	metadataLen := 2 + 2 + 1 + 3
+	// type + length + is_key + is_null + spare
+	metadataLen := 2 + 2 + 1 + 1 + 2
 	var buf bytes.Buffer
 	for _, d := range t.Data {
 		var result []byte
 
+		if d.Null {
+			result = make([]byte, metadataLen)
+			result[5] = 1
+			if d.Key {
+				result[4] = 1
+			}
+			buf.Write(result)
+			continue
+		}
+
 		switch d.Typ {
 		case Bool:
 			result = make([]byte, metadataLen+int(d.Length))
@@ -187,9 +201,16 @@ func (t *Tuple) Deserialize(r io.Reader) error {
 		offset += 2
 		length := bytesToUint16(bs[offset : offset+2])
 		offset += 2
-		isKey := bs[offset : offset+1]
+		isKey := bs[offset]
+		isNull := bs[offset+1]
 		offset += 4
-		d := &TupleData{Key: isKey[0] == 1, Length: length}
+		d := &TupleData{Key: isKey == 1, Length: length}
+		if isNull == 1 {
+			d.Null = true
+			t.Data = append(t.Data, d)
+			continue
+		}
+
 		switch typ {
 		case Bool:
 			d.Typ = Bool
@@ -233,6 +254,11 @@ func (t *Tuple) String() string {
 	// put spaces at the head to print as an element of page. See page.String()
 	sb.WriteString("    Tuple{\n")
 	for _, d := range t.Data {
+		if d.Null {
+			sb.WriteString(fmt.Sprintf("      (key: %v) NULL,\n", d.Key))
+			continue
+		}
+
 		switch d.Typ {
 		case Bool:
 			sb.WriteString(fmt.Sprintf("      (key: %v) (bool) %v,\n", d.Key, d.BoolVal))
@@ -253,30 +279,50 @@ func (t *Tuple) String() string {
 	return sb.String()
 }
 
+// Value returns the i-th column value as Go value. nil is returned when the column is NULL.
+func (t *Tuple) Value(i int) interface{} {
+	return t.Data[i].value()
+}
+
+func (d *TupleData) value() interface{} {
+	if d.Null {
+		return nil
+	}
+
+	switch d.Typ {
+	case Bool:
+		return d.BoolVal
+	case Int64:
+		return d.Int64Val
+	case Float64:
+		return d.Float64Val
+	case Bytes:
+		return d.BytesVal
+	case String:
+		return d.StringVal
+	case Timestamp:
+		// Because timestamp is internally stored as int64, decodes into time.Time to keep the type
+		// in projected tuple as well
+		return time.Unix(d.TimestampVal, 0)
+	}
+
+	return nil
+}
+
+// Len returns the number of the columns.
+func (t *Tuple) Len() int {
+	return len(t.Data)
+}
+
 func (t *Tuple) Projection(indices []int) sdb.Tuple {
 	vals := []interface{}{}
-	keyIndex := 0
-	for index := range indices {
+	keyIndex := -1
+	for i, index := range indices {
 		data := t.Data[index]
 		if data.Key {
-			keyIndex = index
-		}
-		switch data.Typ {
-		case Bool:
-			vals = append(vals, data.BoolVal)
-		case Int64:
-			vals = append(vals, data.Int64Val)
-		case Float64:
-			vals = append(vals, data.Float64Val)
-		case Bytes:
-			vals = append(vals, data.BytesVal)
-		case String:
-			vals = append(vals, data.StringVal)
-		case Timestamp:
-			// Because timestamp is internally stored as int64, decodes into time.Time to keep the type
-			// in projected tuple as well
-			vals = append(vals, time.Unix(data.TimestampVal, 0))
+			keyIndex = i
 		}
+		vals = append(vals, data.value())
 	}
 
 	return NewTuple(vals, keyIndex)
@@ -289,6 +335,11 @@ func (t *Tuple) Less(than sdb.Tuple) bool {
 		if data.Key {
 			for _, thanD := range thanT.Data {
 				if thanD.Key {
+					// NULL is smaller than any value
+					if data.Null || thanD.Null {
+						return data.Null && !thanD.Null
+					}
+
 					switch data.Typ {
 					case Bool:
 						if !data.BoolVal && thanD.BoolVal {
@@ -310,8 +361,8 @@ func (t *Tuple) Less(than sdb.Tuple) bool {
 					case String:
 						return data.StringVal < thanD.StringVal
 					case Timestamp:
-						dt := time.Unix(0, data.TimestampVal)
-						tt := time.Unix(0, thanD.TimestampVal)
+						dt := time.Unix(data.TimestampVal, 0)
+						tt := time.Unix(thanD.TimestampVal, 0)
 						return dt.Before(tt)
 					}
 				}
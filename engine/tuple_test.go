@@ -18,7 +18,7 @@ func Test_Serialize_Deserialize_Tuple(t *testing.T) {
 		0, 1, // Type bool
 		0, 1, // Length 1
 		0,       // Key: false
-		0, 0, 0, // spare bytes (always 0)
+		0, 0, 0, // Null: false, and spare bytes (always 0)
 		1, // value: true
 
 		0, 2, // Type Int64
@@ -50,7 +50,7 @@ func Test_Serialize_Deserialize_Tuple(t *testing.T) {
 		0, 8, // Length 8
 		0, // Key: false
 		0, 0, 0,
-		13, 35, 76, 207, 82, 67, 0, 0, // value: Unixnano timestamp of tim
+		0, 0, 0, 0, 56, 109, 67, 128, // value: Unix timestamp of tim
 	}
 
 	testutil.MustEqual(t, s, expected)
@@ -64,5 +64,54 @@ func Test_Serialize_Deserialize_Tuple(t *testing.T) {
 	testutil.MustEqual(t, nt.Data[2], &TupleData{Typ: Float64, Length: 8, Float64Val: 3.14})
 	testutil.MustEqual(t, nt.Data[3], &TupleData{Typ: Bytes, Length: 3, BytesVal: []byte{'a', 'b', 'c'}})
 	testutil.MustEqual(t, nt.Data[4], &TupleData{Typ: String, Length: 24, StringVal: "sdb is a simple database"})
-	testutil.MustEqual(t, nt.Data[5], &TupleData{Typ: Timestamp, Length: 8, TimestampVal: tim.UnixNano()})
+	testutil.MustEqual(t, nt.Data[5], &TupleData{Typ: Timestamp, Length: 8, TimestampVal: tim.Unix()})
+}
+
+func Test_Serialize_Deserialize_Tuple_Null(t *testing.T) {
+	tuple := NewTuple([]interface{}{int64(99), nil, "sdb"}, 0)
+
+	s, err := tuple.Serialize()
+	testutil.MustBeNil(t, err)
+	expected := []byte{
+		0, 2, // Type Int64
+		0, 8, // Length 8
+		1,    // Key: true
+		0,    // Null: false
+		0, 0, // spare bytes (always 0)
+		0, 0, 0, 0, 0, 0, 0, 99, // value: 99
+
+		0, 0, // Type is 0 for NULL
+		0, 0, // Length 0
+		0,    // Key: false
+		1,    // Null: true
+		0, 0, // spare bytes (always 0)
+
+		0, 5, // Type String
+		0, 3, // Length 3
+		0,    // Key: false
+		0,    // Null: false
+		0, 0, // spare bytes (always 0)
+		115, 100, 98, // value: "sdb"
+	}
+
+	testutil.MustEqual(t, s, expected)
+
+	var nt Tuple
+	err = nt.Deserialize(bytes.NewReader(s))
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, len(nt.Data), 3)
+	testutil.MustEqual(t, nt.Data[1], &TupleData{Null: true})
+	testutil.MustEqual(t, nt.Value(0), int64(99))
+	testutil.MustEqual(t, nt.Value(1), nil)
+	testutil.MustEqual(t, nt.Value(2), "sdb")
+}
+
+func TestTuple_Projection(t *testing.T) {
+	tuple := NewTuple([]interface{}{int64(99), nil, "sdb"}, 0)
+
+	projected := tuple.Projection([]int{2, 0})
+	testutil.MustEqual(t, projected, NewTuple([]interface{}{"sdb", int64(99)}, 1))
+
+	projected = tuple.Projection([]int{1})
+	testutil.MustEqual(t, projected, NewTuple([]interface{}{nil}, -1))
 }
@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/dty1er/sdb/header"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// upgradeSteps migrates the db files from the key format version to the next version.
+// Each step must persist the header with the next version at the end.
+var upgradeSteps = map[uint32]func(diskManager sdb.DiskManager) error{
+	header.FormatVersion1: upgradeFromV1,
+}
+
+// Upgrade migrates the db files written in the older format to the current format in place.
+// from is the format version of the db files. sdb must not be running while upgrading.
+func Upgrade(diskManager sdb.DiskManager, from uint32) error {
+	if from > header.CurrentFormatVersion {
+		return fmt.Errorf("%w: format version %d", header.ErrUnsupportedVersion, from)
+	}
+
+	for v := from; v < header.CurrentFormatVersion; v++ {
+		step, ok := upgradeSteps[v]
+		if !ok {
+			return fmt.Errorf("upgrade from format version %d is not supported", v)
+		}
+
+		if err := step(diskManager); err != nil {
+			return fmt.Errorf("upgrade from format version %d: %w", v, err)
+		}
+	}
+
+	return nil
+}
+
+// legacyPageSize is the page size of FormatVersion1.
+const legacyPageSize = 16 * 1024
+
+// legacyPage is the page written in FormatVersion1.
+// Its header layout is |page_id(4byte)|tuples_count(2byte)|slot1(4byte)|...|slotN(4byte)|
+// and the slot layout is |offset(2byte)|length(2byte)|.
+type legacyPage struct {
+	bs [legacyPageSize]byte
+}
+
+func (p *legacyPage) Size() int {
+	return legacyPageSize
+}
+
+func (p *legacyPage) Deserialize(r io.Reader) error {
+	_, err := io.ReadFull(r, p.bs[:])
+	return err
+}
+
+func (p *legacyPage) getTuples() ([]*Tuple, error) {
+	tuplesCount := int(bytesToUint16(p.bs[4:]))
+	tuples := make([]*Tuple, tuplesCount)
+	for i := 0; i < tuplesCount; i++ {
+		offset := bytesToUint16(p.bs[6+i*4:])
+		length := bytesToUint16(p.bs[8+i*4:])
+
+		var t Tuple
+		if err := t.Deserialize(bytes.NewReader(p.bs[offset : offset+length])); err != nil {
+			return nil, err
+		}
+		tuples[i] = &t
+	}
+
+	return tuples, nil
+}
+
+// upgradeProgressFile records the progress of upgradeFromV1 so that an interrupted upgrade can be
+// run again. Until it is written, the original files are untouched.
+const upgradeProgressFile = "__upgrade.db"
+
+// upgradeTempPrefix is the prefix of the files which hold the converted pages until they replace the original files.
+const upgradeTempPrefix = "__upgrade_"
+
+// upgradeProgress is persisted on upgradeProgressFile.
+type upgradeProgress struct {
+	// PageDirectory is the page directory after upgrade. The pages are on the temporary files.
+	PageDirectory *PageDirectory
+	// OldFiles are the files which hold the legacy pages.
+	OldFiles []string
+	// Copied is true when the converted pages replaced the original files.
+	Copied bool
+}
+
+func (up *upgradeProgress) Serialize() ([]byte, error) {
+	var buff bytes.Buffer
+	if err := json.NewEncoder(&buff).Encode(up); err != nil {
+		return nil, fmt.Errorf("serialize upgrade progress: %w", err)
+	}
+
+	return buff.Bytes(), nil
+}
+
+func (up *upgradeProgress) Deserialize(r io.Reader) error {
+	if err := json.NewDecoder(r).Decode(up); err != nil {
+		return fmt.Errorf("deserialize json into upgrade progress %w", err)
+	}
+
+	return nil
+}
+
+// pageFilenames returns the files in the page directory.
+func pageFilenames(pd *PageDirectory) []string {
+	seen := map[string]bool{}
+	filenames := []string{}
+	for _, loc := range pd.PageLocation {
+		if !seen[loc.Filename] {
+			seen[loc.Filename] = true
+			filenames = append(filenames, loc.Filename)
+		}
+	}
+	sort.Strings(filenames)
+
+	return filenames
+}
+
+// upgradeFromV1 rewrites every page in the new page layout, then creates the header.
+// Because the new slot is larger, a page might not fit in a page after upgrade.
+// So the tuples in a table are read at once, then placed on the new pages from the head.
+//
+// The converted pages are written on the temporary files first, then copied over the original files
+// after the progress is recorded. So the upgrade can be run again when it is interrupted at any point.
+func upgradeFromV1(diskManager sdb.DiskManager) error {
+	progress := &upgradeProgress{}
+	if err := diskManager.Load(upgradeProgressFile, 0, progress); err != nil {
+		return err
+	}
+
+	if progress.PageDirectory == nil {
+		if err := convertFromV1(diskManager, progress); err != nil {
+			return err
+		}
+	}
+
+	newPageDirectory := progress.PageDirectory
+	if !progress.Copied {
+		if err := replaceUpgradedFiles(diskManager, progress); err != nil {
+			return err
+		}
+	}
+
+	for _, filename := range pageFilenames(newPageDirectory) {
+		if err := diskManager.Remove(upgradeTempPrefix + filename); err != nil {
+			return err
+		}
+	}
+
+	// the creation time is unknown, so the time of upgrade is recorded
+	hdr := &header.Header{FormatVersion: header.FormatVersion2, PageSize: legacyPageSize, CreatedAt: time.Now()}
+	if err := hdr.Persist(diskManager); err != nil {
+		return err
+	}
+
+	// When it is not removed because of a crash, the engine removes it on start.
+	return diskManager.Remove(upgradeProgressFile)
+}
+
+// convertFromV1 reads the legacy pages then writes them in the new layout on the temporary files.
+// The progress is persisted at the end.
+func convertFromV1(diskManager sdb.DiskManager, progress *upgradeProgress) error {
+	pageDirectory := NewPageDirectory(0)
+	if err := diskManager.Load("__page_directory.db", 0, pageDirectory); err != nil {
+		return err
+	}
+
+	newPageDirectory := NewPageDirectory(legacyPageSize)
+	newPageDirectory.MaxPageCountPerFile = pageDirectory.MaxPageCountPerFile
+
+	tables := make([]string, 0, len(pageDirectory.PageIDs))
+	for table := range pageDirectory.PageIDs {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		tuples := []*Tuple{}
+		for _, pageID := range pageDirectory.GetPageIDs(table) {
+			loc, err := pageDirectory.GetPageLocation(table, pageID)
+			if err != nil {
+				return err
+			}
+
+			var p legacyPage
+			if err := diskManager.Load(loc.Filename, int(loc.Offset), &p); err != nil {
+				return err
+			}
+
+			ts, err := p.getTuples()
+			if err != nil {
+				return fmt.Errorf("read page %d of table %s: %w", pageID, table, err)
+			}
+			tuples = append(tuples, ts...)
+		}
+
+		pages := []*Page{InitPage(1, legacyPageSize)}
+		for _, t := range tuples {
+			page := pages[len(pages)-1]
+			if err := page.AppendTuple(t); err != nil {
+				page = InitPage(uint32(len(pages)+1), legacyPageSize)
+				if err := page.AppendTuple(t); err != nil {
+					return err
+				}
+				pages = append(pages, page)
+			}
+		}
+
+		for _, page := range pages {
+			newPageDirectory.RegisterPage(table, page)
+			loc, err := newPageDirectory.GetPageLocation(table, page.GetID())
+			if err != nil {
+				return err
+			}
+
+			if err := diskManager.Persist(upgradeTempPrefix+loc.Filename, int(loc.Offset), page); err != nil {
+				return err
+			}
+		}
+	}
+
+	progress.PageDirectory = newPageDirectory
+	progress.OldFiles = pageFilenames(pageDirectory)
+	return diskManager.Persist(upgradeProgressFile, 0, progress)
+}
+
+// replaceUpgradedFiles copies the pages on the temporary files to the original files, then persists the page directory.
+// The original files are removed first so that no legacy page is left after the new pages.
+func replaceUpgradedFiles(diskManager sdb.DiskManager, progress *upgradeProgress) error {
+	newPageDirectory := progress.PageDirectory
+	for _, filename := range append(progress.OldFiles, pageFilenames(newPageDirectory)...) {
+		if err := diskManager.Remove(filename); err != nil {
+			return err
+		}
+	}
+
+	for table, pageIDs := range newPageDirectory.PageIDs {
+		for _, pageID := range pageIDs {
+			loc, err := newPageDirectory.GetPageLocation(table, pageID)
+			if err != nil {
+				return err
+			}
+
+			page := NewPage(make([]byte, legacyPageSize))
+			if err := diskManager.Load(upgradeTempPrefix+loc.Filename, int(loc.Offset), page); err != nil {
+				return err
+			}
+
+			if err := diskManager.Persist(loc.Filename, int(loc.Offset), page); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := diskManager.Persist("__page_directory.db", 0, newPageDirectory); err != nil {
+		return err
+	}
+
+	progress.Copied = true
+	return diskManager.Persist(upgradeProgressFile, 0, progress)
+}
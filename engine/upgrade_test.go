@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/header"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+// for test
+type rawPage struct {
+	bs []byte
+}
+
+func (p *rawPage) Size() int {
+	return len(p.bs)
+}
+
+func (p *rawPage) Serialize() ([]byte, error) {
+	return p.bs, nil
+}
+
+// newLegacyPage builds a page in FormatVersion1 layout.
+func newLegacyPage(t *testing.T, id uint32, tuples []*Tuple) *rawPage {
+	bs := make([]byte, legacyPageSize)
+	putUint32OnBytes(bs[0:], id)
+	putUint16OnBytes(bs[4:], uint16(len(tuples)))
+	last := legacyPageSize
+	for i, tuple := range tuples {
+		tb, err := tuple.Serialize()
+		testutil.MustBeNil(t, err)
+		start := last - len(tb)
+		copy(bs[start:last], tb)
+		putUint16OnBytes(bs[6+i*4:], uint16(start))
+		putUint16OnBytes(bs[8+i*4:], uint16(len(tb)))
+		last = start
+	}
+
+	return &rawPage{bs: bs}
+}
+
+func TestUpgrade(t *testing.T) {
+	dm, err := diskmanager.New(t.TempDir())
+	testutil.MustBeNil(t, err)
+
+	tuples := []*Tuple{}
+	for i := 0; i < 600; i++ {
+		tuples = append(tuples, NewTuple([]interface{}{int64(i), "abcdefghijklmnopqrstuvwxyz"}, 0))
+	}
+
+	// 2 legacy pages which are almost full
+	pd := NewPageDirectory(0)
+	pd.PageIDs["users"] = []PageID{1, 2}
+	pd.PageLocation["users#1"] = &pageLocation{Filename: "users__1.db", Offset: 0}
+	pd.PageLocation["users#2"] = &pageLocation{Filename: "users__1.db", Offset: legacyPageSize}
+	testutil.MustBeNil(t, dm.Persist("users__1.db", 0, newLegacyPage(t, 1, tuples[:300])))
+	testutil.MustBeNil(t, dm.Persist("users__1.db", legacyPageSize, newLegacyPage(t, 2, tuples[300:])))
+	testutil.MustBeNil(t, dm.Persist("__page_directory.db", 0, pd))
+
+	// legacy database must be rejected
+	_, err = header.Verify(dm, true)
+	testutil.MustEqual(t, err != nil, true)
+
+	err = Upgrade(dm, header.FormatVersion1)
+	testutil.MustBeNil(t, err)
+
+	hdr, err := header.Verify(dm, true)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, hdr.PageSize, uint32(legacyPageSize))
+
+	upgraded := NewPageDirectory(0)
+	testutil.MustBeNil(t, dm.Load("__page_directory.db", 0, upgraded))
+	testutil.MustEqual(t, upgraded.PageSize, legacyPageSize)
+	// wider slots need one more page
+	testutil.MustEqual(t, len(upgraded.GetPageIDs("users")), 3)
+
+	got := []*Tuple{}
+	for _, pageID := range upgraded.GetPageIDs("users") {
+		loc, err := upgraded.GetPageLocation("users", pageID)
+		testutil.MustBeNil(t, err)
+		p := NewPage(make([]byte, legacyPageSize))
+		testutil.MustBeNil(t, dm.Load(loc.Filename, int(loc.Offset), p))
+		ts, err := p.GetTuples()
+		testutil.MustBeNil(t, err)
+		got = append(got, ts...)
+	}
+
+	testutil.MustEqual(t, got, tuples)
+}
+
+// faultyDiskManager fails on the failAt-th write to simulate a crash.
+type faultyDiskManager struct {
+	sdb.DiskManager
+	writes int
+	failAt int
+}
+
+var errCrash = errors.New("crash")
+
+func (dm *faultyDiskManager) write() error {
+	dm.writes++
+	if dm.writes == dm.failAt {
+		return errCrash
+	}
+	return nil
+}
+
+func (dm *faultyDiskManager) Persist(name string, offset int, s sdb.Serializer) error {
+	if err := dm.write(); err != nil {
+		return err
+	}
+	return dm.DiskManager.Persist(name, offset, s)
+}
+
+func (dm *faultyDiskManager) Remove(name string) error {
+	if err := dm.write(); err != nil {
+		return err
+	}
+	return dm.DiskManager.Remove(name)
+}
+
+// persistLegacyTable writes the tuples on the legacy pages, perPage tuples in each page.
+func persistLegacyTable(t *testing.T, dm sdb.DiskManager, pd *PageDirectory, table string, tuples []*Tuple, perPage int) {
+	filename := toFilename(table, 1)
+	for i := 0; i*perPage < len(tuples); i++ {
+		id := PageID(i + 1)
+		end := (i + 1) * perPage
+		if end > len(tuples) {
+			end = len(tuples)
+		}
+		pd.PageIDs[table] = append(pd.PageIDs[table], id)
+		pd.PageLocation[EncodePageDirectoryID(table, id)] = &pageLocation{Filename: filename, Offset: uint32(i * legacyPageSize)}
+		testutil.MustBeNil(t, dm.Persist(filename, i*legacyPageSize, newLegacyPage(t, uint32(id), tuples[i*perPage:end])))
+	}
+}
+
+func readUpgradedTable(t *testing.T, dm sdb.DiskManager, table string) []*Tuple {
+	upgraded := NewPageDirectory(0)
+	testutil.MustBeNil(t, dm.Load("__page_directory.db", 0, upgraded))
+
+	got := []*Tuple{}
+	for _, pageID := range upgraded.GetPageIDs(table) {
+		loc, err := upgraded.GetPageLocation(table, pageID)
+		testutil.MustBeNil(t, err)
+		p := NewPage(make([]byte, legacyPageSize))
+		testutil.MustBeNil(t, dm.Load(loc.Filename, int(loc.Offset), p))
+		ts, err := p.GetTuples()
+		testutil.MustBeNil(t, err)
+		got = append(got, ts...)
+	}
+
+	return got
+}
+
+func TestUpgrade_Interrupted(t *testing.T) {
+	users := []*Tuple{}
+	for i := 0; i < 600; i++ {
+		users = append(users, NewTuple([]interface{}{int64(i), "abcdefghijklmnopqrstuvwxyz"}, 0))
+	}
+	items := []*Tuple{}
+	for i := 0; i < 6; i++ {
+		items = append(items, NewTuple([]interface{}{int64(i), "item"}, 0))
+	}
+
+	// crash at every write until the upgrade completes without the crash
+	for failAt := 1; ; failAt++ {
+		dir := t.TempDir()
+		dm, err := diskmanager.New(dir)
+		testutil.MustBeNil(t, err)
+
+		pd := NewPageDirectory(0)
+		// users grows to 3 pages, items shrinks to 1 page
+		persistLegacyTable(t, dm, pd, "users", users, 300)
+		persistLegacyTable(t, dm, pd, "items", items, 2)
+		testutil.MustBeNil(t, dm.Persist("__page_directory.db", 0, pd))
+
+		err = Upgrade(&faultyDiskManager{DiskManager: dm, failAt: failAt}, header.FormatVersion1)
+		if err == nil {
+			break
+		}
+		testutil.MustEqual(t, errors.Is(err, errCrash), true)
+
+		// run again unless the header has been written
+		hdr, err := header.Load(dm)
+		testutil.MustBeNil(t, err)
+		if hdr == nil {
+			testutil.MustBeNil(t, Upgrade(dm, header.FormatVersion1))
+		}
+
+		_, err = New(&config.Server{BufferPoolEntryCount: 2}, &catalog.Catalog{}, dm)
+		testutil.MustBeNil(t, err)
+
+		testutil.MustEqual(t, readUpgradedTable(t, dm, "users"), users)
+		testutil.MustEqual(t, readUpgradedTable(t, dm, "items"), items)
+
+		// the trailing legacy pages and the temporary files must be removed
+		stat, err := os.Stat(path.Join(dir, "items__1.db"))
+		testutil.MustBeNil(t, err)
+		testutil.MustEqual(t, stat.Size(), int64(legacyPageSize))
+		entries, err := os.ReadDir(dir)
+		testutil.MustBeNil(t, err)
+		for _, entry := range entries {
+			testutil.MustEqual(t, strings.HasPrefix(entry.Name(), "__upgrade"), false)
+		}
+	}
+}
+
+func TestNew_UpgradeRequired(t *testing.T) {
+	dir := t.TempDir()
+	dm, err := diskmanager.New(dir)
+	testutil.MustBeNil(t, err)
+
+	pd := NewPageDirectory(0)
+	persistLegacyTable(t, dm, pd, "users", []*Tuple{NewTuple([]interface{}{int64(1), "a"}, 0)}, 1)
+	testutil.MustBeNil(t, dm.Persist("__page_directory.db", 0, pd))
+
+	c, err := catalog.New(dm)
+	testutil.MustBeNil(t, err)
+	columns := []*schema.ColumnDef{{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}}}
+	indices := []*schema.Index{{Table: "users", Name: "users_pkey_id", ColumnIndex: 0}}
+	testutil.MustBeNil(t, c.AddTable("users", columns, indices))
+	// the index written in the older format cannot be read
+	testutil.MustBeNil(t, dm.Persist(string(toIndexKey("users", "users_pkey_id"))+".idx", 0, &rawPage{bs: []byte("legacy")}))
+
+	_, err = New(&config.Server{BufferPoolEntryCount: 2, PageSize: 4096}, c, dm)
+	testutil.MustEqual(t, errors.Is(err, header.ErrUpgradeRequired), true)
+}
@@ -3,18 +3,27 @@ package executor
 import (
 	"fmt"
 
+	"github.com/dty1er/sdb/config"
 	"github.com/dty1er/sdb/engine"
 	"github.com/dty1er/sdb/planner"
+	"github.com/dty1er/sdb/schema"
 	"github.com/dty1er/sdb/sdb"
 )
 
 type Executor struct {
-	engine  sdb.Engine
-	catalog sdb.Catalog
+	engine      sdb.Engine
+	catalog     sdb.Catalog
+	diskManager sdb.DiskManager
+	workMem     int
 }
 
-func New(engine sdb.Engine, catalog sdb.Catalog) *Executor {
-	return &Executor{engine: engine, catalog: catalog}
+// env returns the environment where the plan is executed.
+func (e *Executor) env() *planner.Env {
+	return &planner.Env{Engine: e.engine, DiskManager: e.diskManager, WorkMem: e.workMem, PageSize: e.engine.PageSize()}
+}
+
+func New(conf *config.Server, engine sdb.Engine, catalog sdb.Catalog, diskManager sdb.DiskManager) *Executor {
+	return &Executor{engine: engine, catalog: catalog, diskManager: diskManager, workMem: conf.WorkMem}
 }
 
 func (e *Executor) execCreateTable(plan *planner.CreateTablePlan) (*sdb.Result, error) {
@@ -29,71 +38,270 @@ func (e *Executor) execCreateTable(plan *planner.CreateTablePlan) (*sdb.Result,
 	return &sdb.Result{Code: "OK", RS: &sdb.ResultSet{Message: "table is successfully created"}}, nil
 }
 
+// insertBatchSize is the number of the rows read from the source of the insert before they are inserted.
+const insertBatchSize = 1000
+
+// insertResult is the number of the rows inserted and updated by the insert, and the rows of RETURNING clause.
+type insertResult struct {
+	inserted int
+	updated  int
+	returned []sdb.Tuple
+}
+
 func (e *Executor) execInsert(plan *planner.InsertPlan) (*sdb.Result, error) {
-	for i, v := range plan.Values {
-		tuple := engine.NewTuple(v, plan.Table.PrimaryKeyIndex)
+	env := e.env()
+	plan.Open(env)
 
-		// put in the table
-		if err := e.engine.InsertTuple(plan.Table.Name, tuple); err != nil {
+	result := &insertResult{}
+	if plan.Source != nil {
+		if err := e.insertFromSource(plan, env, result); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, v := range plan.Values {
+		if err := e.writeRow(plan, v, plan.Indices[i], result); err != nil {
 			return nil, err
 		}
+	}
+
+	rs := &sdb.ResultSet{Message: "record successfully inserted"}
+	if plan.OnConflict != nil {
+		rs.Message = fmt.Sprintf("%d records inserted, %d records updated", result.inserted, result.updated)
+	}
+	if plan.Returning != nil {
+		rs.Columns, rs.ColumnTypes = resultColumns(plan.Returning)
+		rs.Values = result.returned
+		rs.Count = len(result.returned)
+	}
+
+	return &sdb.Result{Code: "OK", RS: rs}, nil
+}
+
+// insertFromSource reads the rows from the source and inserts them in batches. When the source reads the table
+// to be inserted, every row is read before inserting.
+func (e *Executor) insertFromSource(plan *planner.InsertPlan, env *planner.Env, result *insertResult) error {
+	if err := plan.Source.Open(env); err != nil {
+		return err
+	}
+	defer plan.Source.Close()
+
+	for {
+		batch := []sdb.Tuple{}
+		for plan.ReadsTable || len(batch) < insertBatchSize {
+			t, err := plan.Source.Next()
+			if err != nil {
+				return err
+			}
+			if t == nil {
+				break
+			}
+			batch = append(batch, t)
+		}
 
-		// save tuple in index
-		indices := plan.Indices[i]
-		for j := range indices.Keys {
-			if err := e.engine.InsertIndex(plan.Table.Name, indices.Idx[j].Name, indices.Keys[j], tuple); err != nil {
-				return nil, err
+		for _, t := range batch {
+			row, indices, err := plan.Row(t)
+			if err != nil {
+				return err
+			}
+			if err := e.writeRow(plan, row, indices, result); err != nil {
+				return err
 			}
 		}
+
+		if len(batch) < insertBatchSize || plan.ReadsTable {
+			return nil
+		}
+	}
+}
+
+// writeRow inserts the row. The primary key index is probed first, and the row whose key already exists
+// is an error without ON CONFLICT, is skipped for DO NOTHING, or updates the existing row for DO UPDATE.
+// The written record is returned by RETURNING clause.
+func (e *Executor) writeRow(plan *planner.InsertPlan, row []interface{}, indices *planner.Indices, result *insertResult) error {
+	key := row[plan.Table.PrimaryKeyIndex]
+	existing, err := e.engine.LookupIndex(plan.Table.Name, plan.PrimaryKey.Name, key)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && plan.OnConflict == nil {
+		return fmt.Errorf("duplicate key %v violates primary key %s of table %s", key, plan.PrimaryKey.Name, plan.Table.Name)
+	}
+
+	switch {
+	case existing == nil:
+		if err := e.insertRow(plan.Table, row, indices); err != nil {
+			return err
+		}
+		result.inserted++
+	case plan.OnConflict.Update == nil:
+		return nil
+	default:
+		updated, indices, err := plan.UpdatedRow(existing, row)
+		if err != nil {
+			return err
+		}
+		if err := e.updateRow(plan, updated, indices); err != nil {
+			return err
+		}
+		result.updated++
+		row = updated
+	}
+
+	if plan.Returning != nil {
+		t, err := plan.Returned(row)
+		if err != nil {
+			return err
+		}
+		result.returned = append(result.returned, t)
+	}
+
+	return nil
+}
+
+// insertRow puts the record in the table and its keys in the indices.
+func (e *Executor) insertRow(table *schema.Table, row []interface{}, indices *planner.Indices) error {
+	tuple := engine.NewTuple(row, table.PrimaryKeyIndex)
+	page, err := e.engine.InsertTuple(table.Name, tuple)
+	if err != nil {
+		return err
+	}
+
+	return e.putIndices(table, tuple, page, indices)
+}
+
+// updateRow replaces the record of the same primary key in the table, which is found by the primary key index.
+func (e *Executor) updateRow(plan *planner.InsertPlan, row []interface{}, indices *planner.Indices) error {
+	tuple := engine.NewTuple(row, plan.Table.PrimaryKeyIndex)
+	page, err := e.engine.UpdateTuple(plan.Table.Name, plan.PrimaryKey.Name, tuple)
+	if err != nil {
+		return err
+	}
+
+	// the entry of the same key is replaced
+	return e.putIndices(plan.Table, tuple, page, indices)
+}
+
+// putIndices puts the keys of the tuple on the page in the indices.
+func (e *Executor) putIndices(table *schema.Table, tuple sdb.Tuple, page int, indices *planner.Indices) error {
+	for j := range indices.Keys {
+		if err := e.engine.InsertIndex(table.Name, indices.Idx[j].Name, indices.Keys[j], tuple, page); err != nil {
+			return err
+		}
 	}
 
-	return &sdb.Result{Code: "OK", RS: &sdb.ResultSet{Message: "record successfully inserted"}}, nil
+	return nil
 }
 
 func (e *Executor) execSelect(plan *planner.SelectPlan) (*sdb.Result, error) {
-	tbl := "users"
-	resultSet := []sdb.Tuple{}
 	pj := plan.LogicalPlan.(*planner.Projection)
+	env := e.env()
+	if err := pj.Open(env); err != nil {
+		return nil, err
+	}
+	defer pj.Close()
+
+	// tuples are pulled from the root of the plan one by one
+	rs := []sdb.Tuple{}
 	for {
-		tuple := pj.Input.Next(e.engine)
-		if tuple == nil {
-			break
+		t, err := pj.Next()
+		if err != nil {
+			return nil, err
 		}
 
-		t := pj.Input.Process(tuple)
-		if t != nil {
-			resultSet = append(resultSet, t)
+		if t == nil {
+			break
 		}
+
+		rs = append(rs, t)
 	}
 
-	// do projection
+	projectionCols, projectionTypes := resultColumns(pj)
+
+	return &sdb.Result{
+		Code: "OK",
+		RS: &sdb.ResultSet{
+			Message:     "successfully fetched records",
+			Columns:     projectionCols,
+			ColumnTypes: projectionTypes,
+			Values:      rs,
+			Count:       len(rs),
+		},
+	}, nil
+}
+
+// resultColumns returns the names and the types of the columns of the projection.
+func resultColumns(pj *planner.Projection) ([]string, []string) {
 	projectionCols := []string{}
+	projectionTypes := []string{}
 	for _, col := range pj.Columns {
-		c := col.(*planner.Column)
-		projectionCols = append(projectionCols, c.Name)
+		switch c := col.(type) {
+		case *planner.Column:
+			name := c.Name
+			if c.Alias != "" {
+				name = c.Alias
+			}
+			projectionCols = append(projectionCols, name)
+			projectionTypes = append(projectionTypes, resultType(c.Type))
+		case *planner.NamedExpr:
+			projectionCols = append(projectionCols, c.Name)
+			projectionTypes = append(projectionTypes, resultType(c.Type))
+		}
 	}
 
-	projectionColIndices := []int{}
-	for i, colDef := range e.catalog.GetTable(tbl).Columns {
-		for _, col := range projectionCols {
-			if colDef.Name == col {
-				projectionColIndices = append(projectionColIndices, i)
-			}
+	return projectionCols, projectionTypes
+}
+
+// resultType returns the name of the type of the result column. The expression which is always NULL
+// (e.g. coalesce(null, null)) has no type, so it is returned as string.
+func resultType(typ schema.ColumnType) string {
+	if typ == 0 {
+		return schema.ColumnTypeString.String()
+	}
+	return typ.String()
+}
+
+func (e *Executor) execAnalyze(plan *planner.AnalyzePlan) (*sdb.Result, error) {
+	for _, table := range plan.Tables {
+		stats, err := planner.CollectStatistics(e.engine, table)
+		if err != nil {
+			return nil, fmt.Errorf("analyze table %s: %w", table.Name, err)
+		}
+
+		if err := e.catalog.SetStatistics(table.Name, stats); err != nil {
+			return nil, err
 		}
 	}
 
-	rs := []sdb.Tuple{}
-	for _, result := range resultSet {
-		rs = append(rs, result.Projection(projectionColIndices))
+	return &sdb.Result{Code: "OK", RS: &sdb.ResultSet{Message: "table statistics are successfully collected"}}, nil
+}
+
+func (e *Executor) execExplain(plan *planner.ExplainPlan) (*sdb.Result, error) {
+	pj := plan.Select.LogicalPlan.(*planner.Projection)
+	lines := planner.Explain(pj, nil)
+	if plan.Analyze {
+		analyzed, err := planner.ExplainAnalyze(pj, e.env())
+		if err != nil {
+			return nil, err
+		}
+		lines = analyzed
+	}
+
+	// each line of the plan is a row
+	rs := make([]sdb.Tuple, len(lines))
+	for i, line := range lines {
+		rs[i] = engine.NewTuple([]interface{}{line}, 0)
 	}
 
 	return &sdb.Result{
 		Code: "OK",
 		RS: &sdb.ResultSet{
-			Message: "successfully fetched records",
-			Columns: projectionCols,
-			Values:  rs,
-			Count:   len(rs),
+			Message:     "query plan is successfully explained",
+			Columns:     []string{"QUERY PLAN"},
+			ColumnTypes: []string{schema.ColumnTypeString.String()},
+			Values:      rs,
+			Count:       len(rs),
 		},
 	}, nil
 }
@@ -106,6 +314,10 @@ func (e *Executor) Execute(plan sdb.Plan) (*sdb.Result, error) {
 		return e.execInsert(p)
 	case *planner.SelectPlan:
 		return e.execSelect(p)
+	case *planner.AnalyzePlan:
+		return e.execAnalyze(p)
+	case *planner.ExplainPlan:
+		return e.execExplain(p)
 	default:
 		return nil, fmt.Errorf("unexpected statement type")
 	}
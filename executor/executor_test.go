@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/config"
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/planner"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+// testDB runs the queries through the parser, the planner and the executor on a temporary database.
+type testDB struct {
+	parser   *parser.Parser
+	planner  *planner.Planner
+	executor *Executor
+}
+
+func newTestDB(t *testing.T) *testDB {
+	t.Helper()
+	dm, err := diskmanager.New(t.TempDir())
+	testutil.MustBeNil(t, err)
+
+	c, err := catalog.New(dm)
+	testutil.MustBeNil(t, err)
+
+	conf := &config.Server{BufferPoolEntryCount: 2, PageSize: 4096}
+	e, err := engine.New(conf, c, dm)
+	testutil.MustBeNil(t, err)
+
+	return &testDB{parser: parser.New(c), planner: planner.New(c), executor: New(conf, e, c, dm)}
+}
+
+func (db *testDB) exec(query string) (*sdb.Result, error) {
+	stmt, err := db.parser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := db.planner.Plan(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.executor.Execute(plan)
+}
+
+func (db *testDB) mustExec(t *testing.T, query string) *sdb.Result {
+	t.Helper()
+	result, err := db.exec(query)
+	testutil.MustBeNil(t, err)
+	return result
+}
+
+func TestExecutor_Insert_DuplicateKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "values", query: `insert into users values (1, "bob");`},
+		{name: "expressions", query: `insert into users values (2 - 1, upper("bob"));`},
+		{name: "select", query: `insert into users select id, name from users;`},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			db.mustExec(t, `create table users (id int64 primary key, name string);`)
+			db.mustExec(t, `insert into users values (1, "alice");`)
+
+			_, err := db.exec(test.query)
+			testutil.MustEqual(t, err.Error(), "duplicate key 1 violates primary key users_pkey_id of table users")
+
+			result := db.mustExec(t, `select * from users;`)
+			testutil.MustEqual(t, result.RS.Count, 1)
+			testutil.MustEqual(t, result.RS.Values[0].Value(1), "alice")
+		})
+	}
+}
+
+func TestExecutor_Insert_OnConflict(t *testing.T) {
+	db := newTestDB(t)
+	db.mustExec(t, `create table users (id int64 primary key, name string, n int64);`)
+	db.mustExec(t, `insert into users values (1, "alice", 1), (2, "bob", 1);`)
+
+	result := db.mustExec(t, `insert into users values (2, "b", 10), (3, "carol", 1) on conflict (id) do nothing;`)
+	testutil.MustEqual(t, result.RS.Message, "1 records inserted, 0 records updated")
+
+	result = db.mustExec(t, `insert into users values (1, "a", 10), (4, "dave", 1) on conflict (id) do update set n = users.n + excluded.n;`)
+	testutil.MustEqual(t, result.RS.Message, "1 records inserted, 1 records updated")
+
+	// the updated tuple is found by the index again
+	db.mustExec(t, `insert into users values (1, "a", 100) on conflict (id) do update set name = excluded.name || "!";`)
+
+	result = db.mustExec(t, `select id, name, n from users order by id;`)
+	rows := [][]interface{}{}
+	for _, tuple := range result.RS.Values {
+		rows = append(rows, []interface{}{tuple.Value(0), tuple.Value(1), tuple.Value(2)})
+	}
+	testutil.MustEqual(t, rows, [][]interface{}{
+		{int64(1), "a!", int64(11)},
+		{int64(2), "bob", int64(1)},
+		{int64(3), "carol", int64(1)},
+		{int64(4), "dave", int64(1)},
+	})
+}
+
+func TestExecutor_Select_ColumnTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "columns", query: `select id, name from users;`, expected: []string{"int64", "string"}},
+		{name: "null", query: `select null, coalesce(null, null) from users;`, expected: []string{"string", "string"}},
+		{name: "null in cte", query: `with c as (select null as x from users) select x from c;`, expected: []string{"string"}},
+		{name: "null decided by union", query: `select null from users union select id from users;`, expected: []string{"int64"}},
+	}
+
+	db := newTestDB(t)
+	db.mustExec(t, `create table users (id int64 primary key, name string);`)
+	db.mustExec(t, `insert into users values (1, "alice");`)
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			result := db.mustExec(t, test.query)
+			testutil.MustEqual(t, result.RS.ColumnTypes, test.expected)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// header package provides the database header which records the settings of the database
+// and the on-disk format version of the db files.
+// The settings are decided when the database is initialized, and never changed after that.
+package header
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dty1er/sdb/sdb"
+)
+
+// Filename is the name of the header file in the db files directory.
+const Filename = "__sdb_header"
+
+// On-disk format versions. Whenever the layout of the db files (e.g. page, tuple) changes,
+// a new version must be added with the upgrade step from the previous version.
+const (
+	// FormatVersion1 is the format before the header is introduced. There is no header file,
+	// the page size is 16KB, and the slot in the page header is 2 byte offset and 2 byte length.
+	FormatVersion1 uint32 = iota + 1
+	// FormatVersion2 has the header file, configurable page size, and 4 byte offset and 4 byte length slot.
+	FormatVersion2
+
+	CurrentFormatVersion = FormatVersion2
+)
+
+var magic = [8]byte{'s', 'd', 'b', 'h', 'e', 'a', 'd', 'r'}
+
+const headerSize = 8 + 4 + 4 + 8
+
+// sdb uses BigEndian as its byteOrder in their byte representation
+var byteOrder = binary.BigEndian
+
+var (
+	// ErrUpgradeRequired is returned when the db files are written in the older format.
+	ErrUpgradeRequired = errors.New("db files are written in older format, run `sdb upgrade`")
+	// ErrUnsupportedVersion is returned when the db files are written by newer sdb.
+	ErrUnsupportedVersion = errors.New("db files are written in newer format which this sdb does not support")
+)
+
+// Header is persisted on the disk as __sdb_header file.
+// The layout looks like below:
+// |magic(8byte)|format_version(4byte)|page_size(4byte)|created_at(8byte)|
+// created_at is unix time in nanoseconds.
+type Header struct {
+	FormatVersion uint32
+	PageSize      uint32
+	CreatedAt     time.Time
+}
+
+// New returns the header for a new database.
+func New(pageSize int) *Header {
+	return &Header{
+		FormatVersion: CurrentFormatVersion,
+		PageSize:      uint32(pageSize),
+		CreatedAt:     time.Now(),
+	}
+}
+
+// Load reads the header file. When the file does not exist, nil is returned.
+// Load does not check the format version. Use Verify to make sure sdb can read the db files.
+func Load(dm sdb.DiskManager) (*Header, error) {
+	var h Header
+	if err := dm.Load(Filename, 0, &h); err != nil {
+		return nil, fmt.Errorf("load header: %w", err)
+	}
+
+	if h.FormatVersion == 0 {
+		return nil, nil
+	}
+
+	return &h, nil
+}
+
+// Verify loads the header then makes sure the db files are written in the current format.
+// initialized must be true when the database already has some data, because the database
+// written in FormatVersion1 does not have the header. When the database is not initialized yet,
+// nil header is returned.
+func Verify(dm sdb.DiskManager, initialized bool) (*Header, error) {
+	h, err := Load(dm)
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		if initialized {
+			return nil, fmt.Errorf("%w: format version %d", ErrUpgradeRequired, FormatVersion1)
+		}
+		return nil, nil
+	}
+
+	if h.FormatVersion < CurrentFormatVersion {
+		return nil, fmt.Errorf("%w: format version %d", ErrUpgradeRequired, h.FormatVersion)
+	}
+
+	if h.FormatVersion > CurrentFormatVersion {
+		return nil, fmt.Errorf("%w: format version %d", ErrUnsupportedVersion, h.FormatVersion)
+	}
+
+	return h, nil
+}
+
+// Persist writes the header on the disk.
+func (h *Header) Persist(dm sdb.DiskManager) error {
+	if err := dm.Persist(Filename, 0, h); err != nil {
+		return fmt.Errorf("persist header: %w", err)
+	}
+
+	return nil
+}
+
+func (h *Header) Serialize() ([]byte, error) {
+	bs := make([]byte, headerSize)
+	copy(bs[0:], magic[:])
+	byteOrder.PutUint32(bs[8:], h.FormatVersion)
+	byteOrder.PutUint32(bs[12:], h.PageSize)
+	byteOrder.PutUint64(bs[16:], uint64(h.CreatedAt.UnixNano()))
+	return bs, nil
+}
+
+func (h *Header) Deserialize(r io.Reader) error {
+	bs := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+
+	if !bytes.Equal(bs[0:8], magic[:]) {
+		return fmt.Errorf("header file is broken or not a sdb header")
+	}
+
+	h.FormatVersion = byteOrder.Uint32(bs[8:])
+	h.PageSize = byteOrder.Uint32(bs[12:])
+	h.CreatedAt = time.Unix(0, int64(byteOrder.Uint64(bs[16:])))
+	return nil
+}
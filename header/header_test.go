@@ -0,0 +1,63 @@
+package header
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestHeader_Load_Persist(t *testing.T) {
+	dm, err := diskmanager.New(t.TempDir())
+	testutil.MustBeNil(t, err)
+
+	// header is not found in a new database
+	h, err := Load(dm)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, h, (*Header)(nil))
+
+	createdAt := time.Date(2021, time.June, 1, 10, 0, 0, 0, time.UTC)
+	err = (&Header{FormatVersion: CurrentFormatVersion, PageSize: 8192, CreatedAt: createdAt}).Persist(dm)
+	testutil.MustBeNil(t, err)
+
+	h, err = Load(dm)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, h.FormatVersion, CurrentFormatVersion)
+	testutil.MustEqual(t, h.PageSize, uint32(8192))
+	testutil.MustEqual(t, h.CreatedAt.Equal(createdAt), true)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      *Header
+		initialized bool
+		wantErr     error
+		wantNil     bool
+	}{
+		{name: "new database", header: nil, initialized: false, wantNil: true},
+		{name: "database without header", header: nil, initialized: true, wantErr: ErrUpgradeRequired},
+		{name: "older format", header: &Header{FormatVersion: FormatVersion1, PageSize: 8192}, initialized: true, wantErr: ErrUpgradeRequired},
+		{name: "newer format", header: &Header{FormatVersion: CurrentFormatVersion + 1, PageSize: 8192}, initialized: true, wantErr: ErrUnsupportedVersion},
+		{name: "current format", header: New(8192), initialized: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			dm, err := diskmanager.New(t.TempDir())
+			testutil.MustBeNil(t, err)
+			if test.header != nil {
+				testutil.MustBeNil(t, test.header.Persist(dm))
+			}
+
+			h, err := Verify(dm, test.initialized)
+			testutil.MustEqual(t, errors.Is(err, test.wantErr), true)
+			if test.wantErr == nil {
+				testutil.MustEqual(t, h == nil, test.wantNil)
+			}
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/dty1er/sdb/schema"
 	"github.com/dty1er/sdb/sdb"
 )
 
@@ -30,6 +32,11 @@ func (l *lexer) consume(tk tokenKind) bool {
 	return false
 }
 
+// peek reports if the next token is the kind without consuming it.
+func (l *lexer) peek(tk tokenKind) bool {
+	return l.index < len(l.tokens) && l.tokens[l.index].Kind == tk
+}
+
 func (l *lexer) atoi(s string) int {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -68,6 +75,26 @@ func (l *lexer) mustBeStringVal() *token {
 	return cur
 }
 
+// mustBeEnd checks no token is left except ";". E.g. UNION after ORDER BY is not a part of the query.
+func (l *lexer) mustBeEnd() {
+	if l.index < len(l.tokens) && !l.peek(EOF) {
+		panic("unexpected token after the end of the statement")
+	}
+}
+
+func (l *lexer) isOperator() bool {
+	if l.index >= len(l.tokens) {
+		return false
+	}
+
+	switch l.tokens[l.index].Kind {
+	case EQ, NEQ, LT, LTE, GT, GTE:
+		return true
+	}
+
+	return false
+}
+
 func (l *lexer) mustBeOperator() *token {
 	types := []tokenKind{EQ, NEQ, LT, LTE, GT, GTE}
 	cur := l.tokens[l.index]
@@ -125,7 +152,8 @@ func (l *lexer) lexCreateTableStmt() *CreateTableStatement {
 	tbl := l.mustBe(STRING_VAL)
 	l.mustBe(LPAREN)
 
-	var columns, types []string
+	var columns, types, notNulls []string
+	var defaults map[string]Expr
 	pk := ""
 	for {
 		column := l.mustBe(STRING_VAL)
@@ -134,13 +162,30 @@ func (l *lexer) lexCreateTableStmt() *CreateTableStatement {
 		columns = append(columns, column.Val)
 		types = append(types, typ.Kind.String())
 
-		if l.consume(PRIMARY) {
-			if pk != "" {
-				panic(fmt.Sprintf("composite primary key is not implemented as of now"))
+		// column options can be specified in any order
+	options:
+		for {
+			switch {
+			case l.consume(PRIMARY):
+				if pk != "" {
+					panic(fmt.Sprintf("composite primary key is not implemented as of now"))
+				}
+
+				l.mustBe(KEY)
+				pk = column.Val
+			case l.consume(NOT):
+				l.mustBe(NULL)
+				notNulls = append(notNulls, column.Val)
+			case l.consume(NULL):
+				// explicitly nullable. Columns are nullable by default.
+			case l.consume(DEFAULT):
+				if defaults == nil {
+					defaults = map[string]Expr{}
+				}
+				defaults[column.Val] = l.lexDefaultValue()
+			default:
+				break options
 			}
-
-			l.mustBe(KEY)
-			pk = column.Val
 		}
 
 		if !l.consume(COMMA) {
@@ -156,7 +201,30 @@ func (l *lexer) lexCreateTableStmt() *CreateTableStatement {
 		Columns:       columns,
 		Types:         types,
 		PrimaryKeyCol: pk,
+		NotNullCols:   notNulls,
+		Defaults:      defaults,
+	}
+}
+
+// lexDefaultValue reads the default value of the column. It must be a literal, NULL, or now().
+func (l *lexer) lexDefaultValue() Expr {
+	if l.consume(MINUS) {
+		return &Value{Val: "-" + l.mustBeNumberVal().Val}
+	}
+
+	val := l.mustBeOr(STRING_VAL, NUMBER_VAL, NULL)
+	switch {
+	case val.Kind == NULL:
+		return &NullVal{}
+	case val.Kind == STRING_VAL && l.consume(LPAREN):
+		l.mustBe(RPAREN)
+		if strings.ToLower(val.Val) != "now" {
+			panic(fmt.Sprintf("function %s cannot be used as default value", val.Val))
+		}
+		return &FuncExpr{Name: "now"}
 	}
+
+	return &Value{Val: val.Val, Quoted: val.Quoted}
 }
 
 func (l *lexer) lexInsertStmt() *InsertStatement {
@@ -179,16 +247,23 @@ func (l *lexer) lexInsertStmt() *InsertStatement {
 
 	}
 
+	// insert the result of the query e.g. insert into users (id, name) select ...
+	if l.isQuery() {
+		sel := l.lexQuery()
+		onConflict, returning := l.lexOnConflict(), l.lexReturning()
+		l.mustBe(EOF)
+		return &InsertStatement{Table: tbl.Val, Columns: columns, Select: sel, OnConflict: onConflict, Returning: returning}
+	}
+
 	l.mustBe(VALUES)
 
-	rows := [][]string{}
+	rows := [][]Expr{}
 	for { // for-loop to read multiple rows
 		l.mustBe(LPAREN)
 
-		values := []string{}
+		values := []Expr{}
 		for { // for-loop to read multiple values in a row
-			val := l.mustBeOr(STRING_VAL, NUMBER_VAL)
-			values = append(values, val.Val)
+			values = append(values, l.lexExpr())
 
 			if !l.consume(COMMA) {
 				break
@@ -204,15 +279,69 @@ func (l *lexer) lexInsertStmt() *InsertStatement {
 		}
 	}
 
+	onConflict, returning := l.lexOnConflict(), l.lexReturning()
 	l.mustBe(EOF)
 
 	return &InsertStatement{
-		Table:   tbl.Val,
-		Columns: columns,
-		Rows:    rows,
+		Table:      tbl.Val,
+		Columns:    columns,
+		Rows:       rows,
+		OnConflict: onConflict,
+		Returning:  returning,
 	}
 }
 
+// lexReturning reads RETURNING clause. nil is returned when it is not given.
+func (l *lexer) lexReturning() []SelectExpr {
+	if !l.consume(RETURNING) {
+		return nil
+	}
+
+	return l.lexSelectExprs()
+}
+
+// lexOnConflict reads ON CONFLICT clause of the insert. nil is returned when it is not given.
+// The conflict target can be omitted only for DO NOTHING.
+func (l *lexer) lexOnConflict() *OnConflict {
+	if !l.consume(ON) {
+		return nil
+	}
+	l.mustBe(CONFLICT)
+
+	oc := &OnConflict{}
+	if l.consume(LPAREN) {
+		for {
+			oc.Columns = append(oc.Columns, l.mustBe(STRING_VAL).Val)
+			if !l.consume(COMMA) {
+				break
+			}
+		}
+		l.mustBe(RPAREN)
+	}
+
+	l.mustBe(DO)
+	if l.consume(NOTHING) {
+		return oc
+	}
+
+	l.mustBe(UPDATE)
+	if len(oc.Columns) == 0 {
+		panic("ON CONFLICT DO UPDATE requires the conflict target")
+	}
+
+	l.mustBe(SET)
+	for {
+		column := l.mustBe(STRING_VAL).Val
+		l.mustBe(EQ)
+		oc.Update = append(oc.Update, &SetExpr{Column: column, Expr: l.lexExpr()})
+		if !l.consume(COMMA) {
+			break
+		}
+	}
+
+	return oc
+}
+
 type Expr interface {
 	isExpr()
 }
@@ -229,6 +358,13 @@ type OrExpr struct {
 	Left, Right Expr
 }
 
+// NotExpr negates the operand.
+type NotExpr struct {
+	Expr
+
+	Operand Expr
+}
+
 type OperatorType uint8
 
 const (
@@ -238,6 +374,12 @@ const (
 	Op_LTE
 	Op_GT
 	Op_GTE
+	Op_ADD
+	Op_SUB
+	Op_MUL
+	Op_DIV
+	Op_MOD
+	Op_CONCAT
 )
 
 type ComparisonExpr struct {
@@ -248,10 +390,221 @@ type ComparisonExpr struct {
 	Right    Expr
 }
 
+// BinaryExpr is an arithmetic operation (Op_ADD, Op_SUB, Op_MUL, Op_DIV, Op_MOD) or
+// string concatenation (Op_CONCAT).
+type BinaryExpr struct {
+	Expr
+
+	Left     Expr
+	Operator OperatorType
+	Right    Expr
+}
+
+// UnaryMinusExpr negates the number.
+type UnaryMinusExpr struct {
+	Expr
+
+	Operand Expr
+}
+
 type Value struct {
 	Expr
 
 	Val string
+	// Quoted is true when the value is a quoted string. Numbers, true and false are not quoted.
+	Quoted bool
+}
+
+// NullVal is NULL literal.
+type NullVal struct {
+	Expr
+}
+
+// FuncExpr is a function call. Name is lower-cased.
+type FuncExpr struct {
+	Expr
+
+	Name string
+	Args []Expr
+	// Star is true when the argument is "*" like COUNT(*).
+	Star bool
+	// Over is the window of the window function call. It is nil for other function calls.
+	Over *WindowSpec
+}
+
+// WindowSpec is the window of "OVER (PARTITION BY ... ORDER BY ... ROWS ...)".
+type WindowSpec struct {
+	PartitionBy []Expr
+	OrderBy     []*Order
+	// Frame is nil when ROWS is not specified.
+	Frame *WindowFrame
+}
+
+// WindowFrame is the rows of the partition which a window function is computed on.
+type WindowFrame struct {
+	Start, End *FrameBound
+}
+
+type FrameBoundType uint8
+
+const (
+	FrameUnboundedPreceding FrameBoundType = iota + 1
+	FramePreceding
+	FrameCurrentRow
+	FrameFollowing
+	FrameUnboundedFollowing
+)
+
+// FrameBound is the start or end of the window frame. Offset is used for FramePreceding and FrameFollowing.
+type FrameBound struct {
+	Type   FrameBoundType
+	Offset int
+}
+
+var aggregateFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// windowFuncs is the functions which can be called only with OVER.
+var windowFuncs = map[string]bool{"row_number": true, "rank": true, "dense_rank": true, "lag": true, "lead": true}
+
+// IsAggregate reports if the function is an aggregate function. An aggregate function with OVER is
+// a window function.
+func (f *FuncExpr) IsAggregate() bool {
+	return aggregateFuncs[f.Name] && f.Over == nil
+}
+
+// HasAggregate reports if the expression contains any aggregate function.
+func HasAggregate(expr Expr) bool {
+	return containsFunc(expr, (*FuncExpr).IsAggregate)
+}
+
+// HasWindow reports if the expression contains any window function.
+func HasWindow(expr Expr) bool {
+	return containsFunc(expr, func(f *FuncExpr) bool { return f.Over != nil })
+}
+
+// containsFunc reports if the expression contains the function which satisfies match.
+// The functions in the subqueries are not searched because they belong to the subqueries.
+func containsFunc(expr Expr, match func(f *FuncExpr) bool) bool {
+	switch e := expr.(type) {
+	case *FuncExpr:
+		if match(e) {
+			return true
+		}
+		for _, arg := range e.Args {
+			if containsFunc(arg, match) {
+				return true
+			}
+		}
+		if e.Over != nil {
+			for _, p := range e.Over.PartitionBy {
+				if containsFunc(p, match) {
+					return true
+				}
+			}
+			for _, o := range e.Over.OrderBy {
+				if containsFunc(o.Expr, match) {
+					return true
+				}
+			}
+		}
+	case *AndExpr:
+		return containsFunc(e.Left, match) || containsFunc(e.Right, match)
+	case *OrExpr:
+		return containsFunc(e.Left, match) || containsFunc(e.Right, match)
+	case *NotExpr:
+		return containsFunc(e.Operand, match)
+	case *IsNullExpr:
+		return containsFunc(e.Operand, match)
+	case *ComparisonExpr:
+		return containsFunc(e.Left, match) || containsFunc(e.Right, match)
+	case *BinaryExpr:
+		return containsFunc(e.Left, match) || containsFunc(e.Right, match)
+	case *UnaryMinusExpr:
+		return containsFunc(e.Operand, match)
+	case *InExpr:
+		// the functions in the subquery belong to the subquery
+		for _, v := range e.Values {
+			if containsFunc(v, match) {
+				return true
+			}
+		}
+		return containsFunc(e.Operand, match)
+	case *LikeExpr:
+		return containsFunc(e.Operand, match) || containsFunc(e.Pattern, match)
+	case *CaseExpr:
+		for _, w := range e.Whens {
+			if containsFunc(w.Cond, match) || containsFunc(w.Result, match) {
+				return true
+			}
+		}
+		return e.Operand != nil && containsFunc(e.Operand, match) || e.Else != nil && containsFunc(e.Else, match)
+	}
+
+	return false
+}
+
+// InExpr is "Operand IN (Values)" predicate. When Subquery is not nil, it is "Operand IN (subquery)"
+// and Values is nil. When Not is true, it is "NOT IN".
+type InExpr struct {
+	Expr
+
+	Operand  Expr
+	Values   []Expr
+	Subquery *Subquery
+	Not      bool
+}
+
+// Subquery is a SELECT statement in an expression. Used as a value, it is a scalar subquery which
+// returns a single column and at most one row.
+type Subquery struct {
+	Expr
+
+	Select Query
+	// Outer is the columns of the outer queries referred in the subquery, including the ones in its subqueries.
+	// It is set by the validator.
+	Outer []*ColName
+}
+
+// ExistsExpr is "EXISTS (subquery)" predicate.
+type ExistsExpr struct {
+	Expr
+
+	Subquery *Subquery
+}
+
+// LikeExpr is "Operand LIKE Pattern" predicate. In the pattern, "%" matches any sequence of characters,
+// "_" matches any single character, and "\" escapes them. When Not is true, it is "NOT LIKE".
+type LikeExpr struct {
+	Expr
+
+	Operand Expr
+	Pattern Expr
+	Not     bool
+}
+
+// CaseExpr is "CASE [Operand] WHEN ... THEN ... [ELSE Else] END".
+// When Operand is nil, the result of the first When whose Cond is true is chosen. Otherwise, the result of
+// the first When whose Cond is equal to Operand is chosen. Else is nil when it is omitted.
+type CaseExpr struct {
+	Expr
+
+	Operand Expr
+	Whens   []*When
+	Else    Expr
+}
+
+// When is "WHEN Cond THEN Result" in CASE expression.
+type When struct {
+	Cond   Expr
+	Result Expr
+}
+
+// IsNullExpr is "IS NULL" or "IS NOT NULL" predicate.
+type IsNullExpr struct {
+	Expr
+
+	Operand Expr
+	Not     bool
 }
 
 type ColName struct {
@@ -286,6 +639,19 @@ type TableName struct {
 	SimpleTableExpr
 
 	Name string
+	// CTE is the common table expression which the name refers to. It is set by the validator.
+	CTE *CommonTableExpr
+}
+
+// DerivedTable is a SELECT statement in FROM clause. It must be aliased.
+// Columns renames the columns of the result when it is written as "(SELECT ...) AS t (a, b)".
+type DerivedTable struct {
+	SimpleTableExpr
+
+	Select  Query
+	Columns []string
+	// Table is the result columns of Select. It is set by the validator.
+	Table *schema.Table
 }
 
 type TableExpr interface {
@@ -299,6 +665,42 @@ type AliasedTableExpr struct {
 	As   string
 }
 
+type JoinType uint8
+
+const (
+	InnerJoin JoinType = iota + 1
+	LeftJoin
+	// SemiJoin and AntiJoin are not written in the statement. The planner uses them for
+	// EXISTS and IN with a subquery: semi join produces the left rows which match any right row,
+	// and anti join produces the left rows which match no right row.
+	SemiJoin
+	AntiJoin
+)
+
+func (jt JoinType) String() string {
+	switch jt {
+	case LeftJoin:
+		return "left join"
+	case SemiJoin:
+		return "semi join"
+	case AntiJoin:
+		return "anti join"
+	}
+
+	return "inner join"
+}
+
+// JoinTableExpr is "LeftExpr JOIN RightExpr ON Condition".
+// Joins are left-associative, so RightExpr is always *AliasedTableExpr.
+type JoinTableExpr struct {
+	TableExpr
+
+	LeftExpr  TableExpr
+	Join      JoinType
+	RightExpr TableExpr
+	Condition Expr
+}
+
 type Where struct {
 	Expr Expr
 }
@@ -328,25 +730,213 @@ type Limit struct {
 	Count  int
 }
 
+// Query is a statement which produces rows; *SelectStatement or *SetOperationStatement.
+type Query interface {
+	sdb.Statement
+	isQuery()
+}
+
+// CommonTableExpr is "Name (Columns) AS (Select)" in WITH clause. The statement and the common table
+// expressions after it can refer to it as a table. Nil Columns means the names in the select list are used.
+type CommonTableExpr struct {
+	Name    string
+	Columns []string
+	Select  Query
+	// Table is the result columns of Select. It is set by the validator.
+	Table *schema.Table
+}
+
 type SelectStatement struct {
 	sdb.Statement
 
+	With        []*CommonTableExpr
 	Distinct    bool
 	SelectExprs []SelectExpr
 	From        TableExpr
 	Where       *Where
+	GroupBy     []Expr
+	Having      *Where
 	OrderBy     []*Order
 	Limit       *Limit
 }
 
+func (s *SelectStatement) isQuery() {}
+
+// SetOperationType is the operation combining the results of the queries.
+type SetOperationType uint8
+
+const (
+	Union SetOperationType = iota + 1
+	Intersect
+	Except
+)
+
+func (t SetOperationType) String() string {
+	switch t {
+	case Intersect:
+		return "intersect"
+	case Except:
+		return "except"
+	}
+
+	return "union"
+}
+
+// SetOperationStatement is "Left UNION Right", "Left INTERSECT Right" or "Left EXCEPT Right".
+// Without All, the duplicated rows are removed from the result. The result columns are named after
+// the ones of Left, and OrderBy can refer to them only by the names. OrderBy and Limit are applied to
+// the combined result.
+type SetOperationStatement struct {
+	sdb.Statement
+
+	With    []*CommonTableExpr
+	Type    SetOperationType
+	All     bool
+	Left    Query
+	Right   Query
+	OrderBy []*Order
+	Limit   *Limit
+}
+
+func (s *SetOperationStatement) isQuery() {}
+
+// IsAggregated reports if the statement groups the rows. It is true when GROUP BY or HAVING is
+// specified, or aggregate functions are used. The aggregated statement produces a row per group.
+func (s *SelectStatement) IsAggregated() bool {
+	if len(s.GroupBy) > 0 || s.Having != nil {
+		return true
+	}
+
+	for _, se := range s.SelectExprs {
+		if ae, ok := se.(*AliasedExpr); ok && HasAggregate(ae.Expr) {
+			return true
+		}
+	}
+
+	for _, o := range s.OrderBy {
+		if HasAggregate(o.Expr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasWindow reports if the statement computes window functions in the select list or ORDER BY.
+func (s *SelectStatement) HasWindow() bool {
+	for _, se := range s.SelectExprs {
+		if ae, ok := se.(*AliasedExpr); ok && HasWindow(ae.Expr) {
+			return true
+		}
+	}
+
+	for _, o := range s.OrderBy {
+		if HasWindow(o.Expr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lexExpr reads an expression.
+// The precedence is unary minus > "*", "/", "%" > "+", "-" > "||" > comparison > NOT > AND > OR,
+// and parentheses can be used to change it.
+func (l *lexer) lexExpr() Expr {
+	return l.lexOrExpr()
+}
+
+func (l *lexer) lexOrExpr() Expr {
+	left := l.lexAndExpr()
+	for l.consume(OR) {
+		left = &OrExpr{Left: left, Right: l.lexAndExpr()}
+	}
+
+	return left
+}
+
+func (l *lexer) lexAndExpr() Expr {
+	left := l.lexNotExpr()
+	for l.consume(AND) {
+		left = &AndExpr{Left: left, Right: l.lexNotExpr()}
+	}
+
+	return left
+}
+
+func (l *lexer) lexNotExpr() Expr {
+	if l.consume(NOT) {
+		return &NotExpr{Operand: l.lexNotExpr()}
+	}
+
+	return l.lexComparisonExpr()
+}
+
 func (l *lexer) lexComparisonExpr() Expr {
-	left := l.mustBeStringVal()
+	left := l.lexConcatExpr()
+
+	if l.consume(IS) {
+		not := l.consume(NOT)
+		l.mustBe(NULL)
+		return &IsNullExpr{Operand: left, Not: not}
+	}
+
+	// NOT here is a part of NOT IN, NOT BETWEEN or NOT LIKE
+	not := false
+	if l.peek(NOT) && l.index+1 < len(l.tokens) {
+		switch l.tokens[l.index+1].Kind {
+		case IN, BETWEEN, LIKE:
+			not = l.consume(NOT)
+		}
+	}
+
+	switch {
+	case l.consume(IN):
+		in := &InExpr{Operand: left, Not: not}
+		l.mustBe(LPAREN)
+		if l.isQuery() {
+			in.Subquery = &Subquery{Select: l.lexQuery()}
+			l.mustBe(RPAREN)
+			return in
+		}
+
+		in.Values = []Expr{}
+		for {
+			in.Values = append(in.Values, l.lexConcatExpr())
+			if !l.consume(COMMA) {
+				break
+			}
+		}
+		l.mustBe(RPAREN)
+		return in
+	case l.consume(BETWEEN):
+		// "a BETWEEN b AND c" is "a >= b AND a <= c"
+		low := l.lexConcatExpr()
+		l.mustBe(AND)
+		high := l.lexConcatExpr()
+		var between Expr = &AndExpr{
+			Left:  &ComparisonExpr{Left: left, Operator: Op_GTE, Right: low},
+			Right: &ComparisonExpr{Left: left, Operator: Op_LTE, Right: high},
+		}
+		if not {
+			between = &NotExpr{Operand: between}
+		}
+		return between
+	case l.consume(LIKE):
+		return &LikeExpr{Operand: left, Pattern: l.lexConcatExpr(), Not: not}
+	}
+
+	if !l.isOperator() {
+		// e.g. parenthesized expression or boolean column
+		return left
+	}
+
 	op := l.mustBeOperator()
-	right := l.mustBeStringOrNumberVal()
 	c := &ComparisonExpr{
-		Left:  &ColName{Name: left.Val},
-		Right: &Value{Val: right.Val},
+		Left:  left,
+		Right: l.lexConcatExpr(),
 	}
+
 	switch op.Kind {
 	case EQ:
 		c.Operator = Op_EQ
@@ -365,98 +955,560 @@ func (l *lexer) lexComparisonExpr() Expr {
 	return c
 }
 
-func (l *lexer) lexSelectStmt() *SelectStatement {
-	stmt := &SelectStatement{}
+func (l *lexer) lexConcatExpr() Expr {
+	left := l.lexAdditiveExpr()
+	for l.consume(CONCAT) {
+		left = &BinaryExpr{Left: left, Operator: Op_CONCAT, Right: l.lexAdditiveExpr()}
+	}
 
-	if l.consume(DISTINCT) {
-		stmt.Distinct = true
+	return left
+}
+
+func (l *lexer) lexAdditiveExpr() Expr {
+	left := l.lexMultiplicativeExpr()
+	for {
+		switch {
+		case l.consume(PLUS):
+			left = &BinaryExpr{Left: left, Operator: Op_ADD, Right: l.lexMultiplicativeExpr()}
+		case l.consume(MINUS):
+			left = &BinaryExpr{Left: left, Operator: Op_SUB, Right: l.lexMultiplicativeExpr()}
+		default:
+			return left
+		}
 	}
+}
 
-	stmt.SelectExprs = []SelectExpr{}
+func (l *lexer) lexMultiplicativeExpr() Expr {
+	left := l.lexUnaryExpr()
 	for {
 		switch {
-		// FUTURE WORK: support column with qualifier (e.g. SELECT mytable.* or mytable.id)
 		case l.consume(ASTERISK):
-			stmt.SelectExprs = append(stmt.SelectExprs, &StarExpr{})
+			left = &BinaryExpr{Left: left, Operator: Op_MUL, Right: l.lexUnaryExpr()}
+		case l.consume(SLASH):
+			left = &BinaryExpr{Left: left, Operator: Op_DIV, Right: l.lexUnaryExpr()}
+		case l.consume(PERCENT):
+			left = &BinaryExpr{Left: left, Operator: Op_MOD, Right: l.lexUnaryExpr()}
 		default:
-			sv := l.mustBeStringVal()
-			e := &AliasedExpr{
-				Expr: &ColName{Name: sv.Val},
+			return left
+		}
+	}
+}
+
+// lexUnaryExpr reads unary minus. Minus followed by a number is a negative literal.
+func (l *lexer) lexUnaryExpr() Expr {
+	if !l.consume(MINUS) {
+		return l.lexOperand()
+	}
+
+	if l.index < len(l.tokens) && l.tokens[l.index].Kind == NUMBER_VAL {
+		return &Value{Val: "-" + l.mustBeNumberVal().Val}
+	}
+
+	return &UnaryMinusExpr{Operand: l.lexUnaryExpr()}
+}
+
+// lexOperand reads an operand of the comparison.
+// Unquoted string is a column name except for true and false; quoted string and number are values.
+// Unquoted string followed by "(" is a function call.
+func (l *lexer) lexOperand() Expr {
+	if l.consume(LPAREN) {
+		if l.isQuery() {
+			sq := &Subquery{Select: l.lexQuery()}
+			l.mustBe(RPAREN)
+			return sq
+		}
+
+		e := l.lexExpr()
+		l.mustBe(RPAREN)
+		return e
+	}
+
+	if l.consume(NULL) {
+		return &NullVal{}
+	}
+
+	if l.consume(CASE) {
+		return l.lexCaseExpr()
+	}
+
+	if l.consume(EXISTS) {
+		l.mustBe(LPAREN)
+		e := &ExistsExpr{Subquery: &Subquery{Select: l.lexQuery()}}
+		l.mustBe(RPAREN)
+		return e
+	}
+
+	tk := l.mustBeStringOrNumberVal()
+	if tk.Kind == NUMBER_VAL || tk.Quoted {
+		return &Value{Val: tk.Val, Quoted: tk.Quoted}
+	}
+
+	if l.consume(LPAREN) {
+		f := l.lexFuncCall(tk.Val)
+		if l.consume(OVER) {
+			f.Over = l.lexWindowSpec()
+		}
+		return f
+	}
+
+	switch strings.ToLower(tk.Val) {
+	case "true", "false":
+		return &Value{Val: tk.Val}
+	}
+
+	return newColName(tk.Val)
+}
+
+// lexCaseExpr reads CASE expression. Leading CASE is already consumed.
+func (l *lexer) lexCaseExpr() *CaseExpr {
+	c := &CaseExpr{Whens: []*When{}}
+	if !l.peek(WHEN) {
+		c.Operand = l.lexExpr()
+	}
+
+	l.mustBe(WHEN)
+	for {
+		w := &When{Cond: l.lexExpr()}
+		l.mustBe(THEN)
+		w.Result = l.lexExpr()
+		c.Whens = append(c.Whens, w)
+
+		if !l.consume(WHEN) {
+			break
+		}
+	}
+
+	if l.consume(ELSE) {
+		c.Else = l.lexExpr()
+	}
+
+	l.mustBe(END)
+	return c
+}
+
+// newColName makes the column name from "column" or "qualifier.column".
+func newColName(s string) *ColName {
+	if i := strings.Index(s, "."); i > 0 {
+		return &ColName{Qualifier: s[:i], Name: s[i+1:]}
+	}
+
+	return &ColName{Name: s}
+}
+
+// lexFuncCall reads the arguments of the function. Leading "(" is already consumed.
+// EXTRACT(field FROM source) is read as extract("field", source).
+func (l *lexer) lexFuncCall(name string) *FuncExpr {
+	f := &FuncExpr{Name: strings.ToLower(name), Args: []Expr{}}
+	if f.Name == "extract" {
+		field := l.mustBeStringVal()
+		l.mustBe(FROM)
+		f.Args = append(f.Args, &Value{Val: field.Val}, l.lexExpr())
+		l.mustBe(RPAREN)
+		return f
+	}
+
+	if l.consume(ASTERISK) {
+		f.Star = true
+		l.mustBe(RPAREN)
+		return f
+	}
+
+	if l.consume(RPAREN) {
+		return f
+	}
+
+	for {
+		f.Args = append(f.Args, l.lexExpr())
+		if !l.consume(COMMA) {
+			break
+		}
+	}
+
+	l.mustBe(RPAREN)
+	return f
+}
+
+// lexWindowSpec reads the window "(PARTITION BY ... ORDER BY ... ROWS ...)". Leading OVER is already consumed.
+// "ROWS start" is read as "ROWS BETWEEN start AND CURRENT ROW".
+func (l *lexer) lexWindowSpec() *WindowSpec {
+	l.mustBe(LPAREN)
+	w := &WindowSpec{}
+	if l.consume(PARTITION) {
+		l.mustBe(BY)
+		w.PartitionBy = []Expr{}
+		for {
+			w.PartitionBy = append(w.PartitionBy, l.lexExpr())
+			if !l.consume(COMMA) {
+				break
 			}
+		}
+	}
+
+	w.OrderBy = l.lexOrderBy()
+
+	if l.consume(ROWS) {
+		if l.consume(BETWEEN) {
+			w.Frame = &WindowFrame{Start: l.lexFrameBound()}
+			l.mustBe(AND)
+			w.Frame.End = l.lexFrameBound()
+		} else {
+			w.Frame = &WindowFrame{Start: l.lexFrameBound(), End: &FrameBound{Type: FrameCurrentRow}}
+		}
+	}
+
+	l.mustBe(RPAREN)
+	return w
+}
+
+// lexFrameBound reads UNBOUNDED PRECEDING, n PRECEDING, CURRENT ROW, n FOLLOWING or UNBOUNDED FOLLOWING.
+func (l *lexer) lexFrameBound() *FrameBound {
+	if l.consume(UNBOUNDED) {
+		if l.mustBeOr(PRECEDING, FOLLOWING).Kind == PRECEDING {
+			return &FrameBound{Type: FrameUnboundedPreceding}
+		}
+		return &FrameBound{Type: FrameUnboundedFollowing}
+	}
+
+	if l.consume(CURRENT) {
+		l.mustBe(ROW)
+		return &FrameBound{Type: FrameCurrentRow}
+	}
+
+	offset := l.atoi(l.mustBeNumberVal().Val)
+	if l.mustBeOr(PRECEDING, FOLLOWING).Kind == PRECEDING {
+		return &FrameBound{Type: FramePreceding, Offset: offset}
+	}
+	return &FrameBound{Type: FrameFollowing, Offset: offset}
+}
+
+// isQualifiedStar reports if the next tokens are "mytable.*".
+func (l *lexer) isQualifiedStar() bool {
+	if l.index+1 >= len(l.tokens) {
+		return false
+	}
+
+	cur := l.tokens[l.index]
+	return cur.Kind == STRING_VAL && !cur.Quoted && strings.HasSuffix(cur.Val, ".") && l.tokens[l.index+1].Kind == ASTERISK
+}
+
+// lexTableExpr reads the table and the following joins.
+func (l *lexer) lexTableExpr() TableExpr {
+	var te TableExpr = l.lexAliasedTableExpr()
+	for {
+		var join JoinType
+		switch {
+		case l.consume(JOIN):
+			join = InnerJoin
+		case l.consume(INNER):
+			l.mustBe(JOIN)
+			join = InnerJoin
+		case l.consume(LEFT):
+			l.consume(OUTER)
+			l.mustBe(JOIN)
+			join = LeftJoin
+		default:
+			return te
+		}
+
+		right := l.lexAliasedTableExpr()
+		l.mustBe(ON)
+		te = &JoinTableExpr{LeftExpr: te, Join: join, RightExpr: right, Condition: l.lexExpr()}
+	}
+}
+
+// lexAliasedTableExpr reads the table name or the derived table, and its alias. "AS" can be omitted.
+func (l *lexer) lexAliasedTableExpr() *AliasedTableExpr {
+	if l.consume(LPAREN) {
+		dt := &DerivedTable{Select: l.lexQuery()}
+		l.mustBe(RPAREN)
+		ate := &AliasedTableExpr{Expr: dt, As: l.lexTableAlias()}
+		if ate.As == "" {
+			panic("subquery in FROM must have an alias")
+		}
+		if l.consume(LPAREN) {
+			dt.Columns = l.lexNameList()
+		}
+		return ate
+	}
+
+	tbl := l.mustBeStringVal()
+	return &AliasedTableExpr{Expr: &TableName{Name: tbl.Val}, As: l.lexTableAlias()}
+}
+
+// lexTableAlias reads the alias of the table if exists.
+func (l *lexer) lexTableAlias() string {
+	if l.consume(AS) {
+		return l.mustBeStringVal().Val
+	}
+	if l.index < len(l.tokens) && l.tokens[l.index].Kind == STRING_VAL && !l.tokens[l.index].Quoted {
+		return l.mustBeStringVal().Val
+	}
+
+	return ""
+}
+
+// lexNameList reads comma separated names and the closing parenthesis. Leading "(" is already consumed.
+func (l *lexer) lexNameList() []string {
+	names := []string{}
+	for {
+		names = append(names, l.mustBeStringVal().Val)
+		if !l.consume(COMMA) {
+			break
+		}
+	}
+	l.mustBe(RPAREN)
+
+	return names
+}
+
+// isQuery reports if the next token starts a query, which is SELECT statement optionally led by WITH clause.
+func (l *lexer) isQuery() bool {
+	return l.peek(SELECT) || l.peek(WITH)
+}
+
+// lexQuery reads the query optionally led by WITH clause. ORDER BY and LIMIT after the set operations
+// are applied to the combined result.
+func (l *lexer) lexQuery() Query {
+	with := l.lexWith()
+	q := l.lexSetOperation()
+	orderBy, limit := l.lexOrderBy(), l.lexLimit()
+
+	var w *[]*CommonTableExpr
+	var ob *[]*Order
+	var lm **Limit
+	switch s := q.(type) {
+	case *SelectStatement:
+		w, ob, lm = &s.With, &s.OrderBy, &s.Limit
+	case *SetOperationStatement:
+		w, ob, lm = &s.With, &s.OrderBy, &s.Limit
+	}
+
+	// the parenthesized query can have its own clauses
+	if (orderBy != nil && *ob != nil) || (limit != nil && *lm != nil) {
+		panic("multiple ORDER BY or LIMIT clauses are not allowed")
+	}
+	if orderBy != nil {
+		*ob = orderBy
+	}
+	if limit != nil {
+		*lm = limit
+	}
+	*w = append(with, *w...)
+
+	return q
+}
+
+// lexSetOperation reads the queries combined by UNION and EXCEPT. INTERSECT binds tighter than them.
+func (l *lexer) lexSetOperation() Query {
+	left := l.lexIntersect()
+	for {
+		var typ SetOperationType
+		switch {
+		case l.consume(UNION):
+			typ = Union
+		case l.consume(EXCEPT):
+			typ = Except
+		default:
+			return left
+		}
+
+		all := l.consume(ALL)
+		if !all {
+			l.consume(DISTINCT)
+		}
+		left = &SetOperationStatement{Type: typ, All: all, Left: left, Right: l.lexIntersect()}
+	}
+}
+
+// lexIntersect reads the queries combined by INTERSECT.
+func (l *lexer) lexIntersect() Query {
+	left := l.lexQueryTerm()
+	for l.consume(INTERSECT) {
+		all := l.consume(ALL)
+		if !all {
+			l.consume(DISTINCT)
+		}
+		left = &SetOperationStatement{Type: Intersect, All: all, Left: left, Right: l.lexQueryTerm()}
+	}
+
+	return left
+}
+
+// lexQueryTerm reads SELECT statement without ORDER BY and LIMIT, or the parenthesized query.
+func (l *lexer) lexQueryTerm() Query {
+	if l.consume(LPAREN) {
+		q := l.lexQuery()
+		l.mustBe(RPAREN)
+		return q
+	}
+
+	l.mustBe(SELECT)
+	return l.lexSelectStmt()
+}
+
+// lexWith reads WITH clause if exists.
+func (l *lexer) lexWith() []*CommonTableExpr {
+	var with []*CommonTableExpr
+	if l.consume(WITH) {
+		with = []*CommonTableExpr{}
+		for {
+			cte := &CommonTableExpr{Name: l.mustBeStringVal().Val}
+			if l.consume(LPAREN) {
+				cte.Columns = l.lexNameList()
+			}
+			l.mustBe(AS)
+			l.mustBe(LPAREN)
+			cte.Select = l.lexQuery()
+			l.mustBe(RPAREN)
+
+			with = append(with, cte)
+			if !l.consume(COMMA) {
+				break
+			}
+		}
+	}
+
+	return with
+}
+
+// lexSelectExprs reads the select list.
+func (l *lexer) lexSelectExprs() []SelectExpr {
+	exprs := []SelectExpr{}
+	for {
+		switch {
+		case l.consume(ASTERISK):
+			exprs = append(exprs, &StarExpr{})
+		case l.isQualifiedStar():
+			// "mytable.*" is tokenized to "mytable." and "*"
+			tbl := l.mustBeStringVal()
+			l.mustBe(ASTERISK)
+			exprs = append(exprs, &StarExpr{Table: strings.TrimSuffix(tbl.Val, ".")})
+		default:
+			e := &AliasedExpr{Expr: l.lexExpr()}
 			if l.consume(AS) {
 				sv := l.mustBeStringVal()
 				e.As = sv.Val
 			}
 
-			stmt.SelectExprs = append(stmt.SelectExprs, e)
+			exprs = append(exprs, e)
 		}
 
 		if l.consume(COMMA) {
 			continue
 		}
 
-		break
+		return exprs
 	}
+}
+
+func (l *lexer) lexSelectStmt() *SelectStatement {
+	stmt := &SelectStatement{}
+
+	if l.consume(DISTINCT) {
+		stmt.Distinct = true
+	}
+
+	stmt.SelectExprs = l.lexSelectExprs()
 
 	l.mustBe(FROM)
 
-	sv := l.mustBeStringVal()
-	stmt.From = &AliasedTableExpr{Expr: &TableName{Name: sv.Val}}
+	stmt.From = l.lexTableExpr()
 
 	if l.consume(WHERE) {
-		w := &Where{}
-		// TODO: Right now it can use only 1 comparison operator as where expression
-		e := l.lexComparisonExpr()
-		w.Expr = e
-		stmt.Where = w
+		stmt.Where = &Where{Expr: l.lexExpr()}
 	}
 
-	if l.consume(ORDER) {
+	if l.consume(GROUP) {
 		l.mustBe(BY)
-		os := []*Order{}
+		stmt.GroupBy = []Expr{}
 		for {
-			o := &Order{}
-			col := l.mustBeStringVal()
-			o.Expr = &ColName{Name: col.Val}
-			if l.consume(ASC) {
-				o.Direction = OrderDirection_ASC
-			} else if l.consume(DESC) {
-				o.Direction = OrderDirection_DESC
-			} else {
-				o.Direction = OrderDirection_ASC // by default
+			stmt.GroupBy = append(stmt.GroupBy, l.lexExpr())
+			if !l.consume(COMMA) {
+				break
 			}
+		}
+	}
 
-			os = append(os, o)
+	if l.consume(HAVING) {
+		stmt.Having = &Where{Expr: l.lexExpr()}
+	}
 
-			if l.consume(COMMA) {
-				continue
-			}
+	return stmt
+}
 
-			break
-		}
-		stmt.OrderBy = os
+// lexOrderBy reads ORDER BY clause if exists.
+func (l *lexer) lexOrderBy() []*Order {
+	if !l.consume(ORDER) {
+		return nil
 	}
 
-	if l.consume(LIMIT) {
-		offset := "0"
-		limit := "0"
-		offsetOrLimit := l.mustBeNumberVal()
-		if l.consume(COMMA) {
-			// In case "LIMIT 2, 5", offset is 2, limit is 5
-			offset = offsetOrLimit.Val
-			limit = l.mustBeNumberVal().Val
-		} else if l.consume(OFFSET) {
-			// In case "LIMIT 2 OFFSET 5", offset is 5, limit is 2
-			limit = offsetOrLimit.Val
-			offset = l.mustBeNumberVal().Val
+	l.mustBe(BY)
+	os := []*Order{}
+	for {
+		o := &Order{Expr: l.lexExpr()}
+		if l.consume(ASC) {
+			o.Direction = OrderDirection_ASC
+		} else if l.consume(DESC) {
+			o.Direction = OrderDirection_DESC
 		} else {
-			// Just "LIMIT 2", without offset; offset is 0 by default
-			limit = offsetOrLimit.Val
+			o.Direction = OrderDirection_ASC // by default
+		}
+
+		os = append(os, o)
+
+		if l.consume(COMMA) {
+			continue
 		}
 
-		stmt.Limit = &Limit{Offset: l.atoi(offset), Count: l.atoi(limit)}
+		break
+	}
+
+	return os
+}
+
+// lexLimit reads LIMIT clause if exists.
+func (l *lexer) lexLimit() *Limit {
+	if !l.consume(LIMIT) {
+		return nil
+	}
+
+	offset := "0"
+	limit := "0"
+	offsetOrLimit := l.mustBeNumberVal()
+	if l.consume(COMMA) {
+		// In case "LIMIT 2, 5", offset is 2, limit is 5
+		offset = offsetOrLimit.Val
+		limit = l.mustBeNumberVal().Val
+	} else if l.consume(OFFSET) {
+		// In case "LIMIT 2 OFFSET 5", offset is 5, limit is 2
+		limit = offsetOrLimit.Val
+		offset = l.mustBeNumberVal().Val
+	} else {
+		// Just "LIMIT 2", without offset; offset is 0 by default
+		limit = offsetOrLimit.Val
+	}
+
+	return &Limit{Offset: l.atoi(offset), Count: l.atoi(limit)}
+}
+
+func (l *lexer) lexExplainStmt() *ExplainStatement {
+	stmt := &ExplainStatement{}
+	if l.consume(ANALYZE) {
+		stmt.Analyze = true
 	}
 
+	stmt.Stmt = l.lexQuery()
+	l.mustBeEnd()
+	return stmt
+}
+
+func (l *lexer) lexAnalyzeStmt() *AnalyzeStatement {
+	stmt := &AnalyzeStatement{}
+	if l.tokens[l.index].Kind == STRING_VAL {
+		stmt.Table = l.mustBe(STRING_VAL).Val
+	}
+
+	l.mustBe(EOF)
 	return stmt
 }
 
@@ -482,8 +1534,19 @@ func (l *lexer) lex() (stmt sdb.Statement, err error) {
 		return l.lexCreateTableStmt(), nil
 	case l.consume(INSERT):
 		return l.lexInsertStmt(), nil
-	case l.consume(SELECT):
-		return l.lexSelectStmt(), nil
+	case l.isQuery() || l.peek(LPAREN):
+		q := l.lexQuery()
+		l.mustBeEnd()
+		return q, nil
+	case l.consume(ANALYZE):
+		return l.lexAnalyzeStmt(), nil
+	case l.consume(EXPLAIN):
+		return l.lexExplainStmt(), nil
+	case l.peek(UPDATE):
+		return nil, fmt.Errorf("UPDATE statement is not supported")
+	case l.peek(STRING_VAL) && !l.tokens[l.index].Quoted && strings.EqualFold(l.tokens[l.index].Val, "delete"):
+		// DELETE is not a keyword so that it can still be used as an identifier
+		return nil, fmt.Errorf("DELETE statement is not supported")
 	default:
 		return nil, fmt.Errorf("unexpected leading token")
 	}
@@ -11,6 +11,10 @@ type CreateTableStatement struct {
 	Columns       []string
 	Types         []string
 	PrimaryKeyCol string
+	NotNullCols   []string
+	// Defaults holds the default value of the column by column name.
+	// The value is *Value, *NullVal or *FuncExpr (now()).
+	Defaults map[string]Expr
 }
 
 type InsertStatement struct {
@@ -18,7 +22,45 @@ type InsertStatement struct {
 
 	Table   string
 	Columns []string
-	Rows    [][]string
+	// Rows are the values to be inserted. Each value is an expression which does not refer to any column.
+	Rows [][]Expr
+	// Select is the query whose result is inserted. Rows is nil when it is not nil.
+	Select Query
+	// OnConflict is the action for the row whose primary key already exists. nil when it is not given.
+	OnConflict *OnConflict
+	// Returning is the select list evaluated for each inserted or updated row. nil when it is not given.
+	// RETURNING is only available on INSERT because UPDATE and DELETE statements are not supported.
+	Returning []SelectExpr
+}
+
+// OnConflict is "ON CONFLICT (Columns) DO NOTHING" or "ON CONFLICT (Columns) DO UPDATE SET ...".
+// Update is nil for DO NOTHING.
+type OnConflict struct {
+	Columns []string
+	Update  []*SetExpr
+}
+
+// SetExpr is "Column = Expr" in SET clause. In ON CONFLICT DO UPDATE, Expr refers to the existing row
+// by the table name and to the row to be inserted by "excluded".
+type SetExpr struct {
+	Column string
+	Expr   Expr
+}
+
+// AnalyzeStatement collects the statistics of the table. When Table is empty, every table is analyzed.
+type AnalyzeStatement struct {
+	sdb.Statement
+
+	Table string
+}
+
+// ExplainStatement shows the plan of the query.
+// When Analyze is true, the statement is executed and the plan is shown with the actual statistics.
+type ExplainStatement struct {
+	sdb.Statement
+
+	Analyze bool
+	Stmt    Query
 }
 
 type Parser struct {
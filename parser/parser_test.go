@@ -24,6 +24,39 @@ func TestParser_parse_CreateTable(t *testing.T) {
 				PrimaryKeyCol: "id",
 			},
 		},
+		{
+			name:  "ok: not null",
+			query: `create table users (id int64 primary key, name string not null, nickname string null, verified bool not null);`,
+			expected: &CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"id", "name", "nickname", "verified"},
+				Types:         []string{"int64", "string", "string", "bool"},
+				PrimaryKeyCol: "id",
+				NotNullCols:   []string{"name", "verified"},
+			},
+		},
+		{
+			name:  "ok: default",
+			query: `create table users (id int64 primary key, name string default null, verified bool not null default false, age int64 default 20, registered timestamp default now());`,
+			expected: &CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"id", "name", "verified", "age", "registered"},
+				Types:         []string{"int64", "string", "bool", "int64", "timestamp"},
+				PrimaryKeyCol: "id",
+				NotNullCols:   []string{"verified"},
+				Defaults: map[string]Expr{
+					"name":       &NullVal{},
+					"verified":   &Value{Val: "false"},
+					"age":        &Value{Val: "20"},
+					"registered": &FuncExpr{Name: "now"},
+				},
+			},
+		},
+		{
+			name:      "failure: unknown function on default",
+			query:     `create table users (id int64 primary key, registered timestamp default today());`,
+			wantError: true,
+		},
 		{
 			name:      "failure: composite primary key",
 			query:     `create table users (id int64 primary key, name string primary key, verified bool);`,
@@ -67,9 +100,9 @@ func TestParser_parse_Insert(t *testing.T) {
 			expected: &InsertStatement{
 				Table:   "users",
 				Columns: []string{"id", "name", "verified", "registered"},
-				Rows: [][]string{
-					{"1", "bob", "true", "2021-05-01 17:59:59"},
-					{"2", "alice", "false", "2021-05-02 17:59:59"},
+				Rows: [][]Expr{
+					{&Value{Val: "1"}, &Value{Val: "bob", Quoted: true}, &Value{Val: "true"}, &Value{Val: "2021-05-01 17:59:59", Quoted: true}},
+					{&Value{Val: "2"}, &Value{Val: "alice", Quoted: true}, &Value{Val: "false"}, &Value{Val: "2021-05-02 17:59:59", Quoted: true}},
 				},
 			},
 		},
@@ -79,12 +112,121 @@ func TestParser_parse_Insert(t *testing.T) {
 			expected: &InsertStatement{
 				Table:   "users",
 				Columns: []string{},
-				Rows: [][]string{
-					{"1", "bob", "true", "2021-05-01 17:59:59"},
-					{"2", "alice", "false", "2021-05-02 17:59:59"},
+				Rows: [][]Expr{
+					{&Value{Val: "1"}, &Value{Val: "bob", Quoted: true}, &Value{Val: "true"}, &Value{Val: "2021-05-01 17:59:59", Quoted: true}},
+					{&Value{Val: "2"}, &Value{Val: "alice", Quoted: true}, &Value{Val: "false"}, &Value{Val: "2021-05-02 17:59:59", Quoted: true}},
+				},
+			},
+		},
+		{
+			name:  "ok: null",
+			query: `insert into users (id, name) values (1, null), (2, "alice");`,
+			expected: &InsertStatement{
+				Table:   "users",
+				Columns: []string{"id", "name"},
+				Rows: [][]Expr{
+					{&Value{Val: "1"}, &NullVal{}},
+					{&Value{Val: "2"}, &Value{Val: "alice", Quoted: true}},
+				},
+			},
+		},
+		{
+			name:  "ok: negative number",
+			query: `insert into users (id, score) values (-1, -2.5);`,
+			expected: &InsertStatement{
+				Table:   "users",
+				Columns: []string{"id", "score"},
+				Rows:    [][]Expr{{&Value{Val: "-1"}, &Value{Val: "-2.5"}}},
+			},
+		},
+		{
+			name:  "ok: expressions",
+			query: `insert into users (id, name) values (1 + 2, lower("BOB"));`,
+			expected: &InsertStatement{
+				Table:   "users",
+				Columns: []string{"id", "name"},
+				Rows: [][]Expr{{
+					&BinaryExpr{Left: &Value{Val: "1"}, Operator: Op_ADD, Right: &Value{Val: "2"}},
+					&FuncExpr{Name: "lower", Args: []Expr{&Value{Val: "BOB", Quoted: true}}},
+				}},
+			},
+		},
+		{
+			name:  "ok: select",
+			query: `insert into users (id, name) select id, name from members where id > 1;`,
+			expected: &InsertStatement{
+				Table:   "users",
+				Columns: []string{"id", "name"},
+				Select: &SelectStatement{
+					SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}, &AliasedExpr{Expr: &ColName{Name: "name"}}},
+					From:        &AliasedTableExpr{Expr: &TableName{Name: "members"}},
+					Where:       &Where{Expr: &ComparisonExpr{Left: &ColName{Name: "id"}, Operator: Op_GT, Right: &Value{Val: "1"}}},
+				},
+			},
+		},
+		{
+			name:  "ok: on conflict do nothing",
+			query: `insert into users (id, name) values (1, "bob") on conflict (id) do nothing;`,
+			expected: &InsertStatement{
+				Table:      "users",
+				Columns:    []string{"id", "name"},
+				Rows:       [][]Expr{{&Value{Val: "1"}, &Value{Val: "bob", Quoted: true}}},
+				OnConflict: &OnConflict{Columns: []string{"id"}},
+			},
+		},
+		{
+			name:  "ok: on conflict do update",
+			query: `insert into users (id, name, score) select id, name, score from members on conflict (id) do update set name = excluded.name, score = users.score + 1;`,
+			expected: &InsertStatement{
+				Table:   "users",
+				Columns: []string{"id", "name", "score"},
+				Select: &SelectStatement{
+					SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}, &AliasedExpr{Expr: &ColName{Name: "name"}}, &AliasedExpr{Expr: &ColName{Name: "score"}}},
+					From:        &AliasedTableExpr{Expr: &TableName{Name: "members"}},
+				},
+				OnConflict: &OnConflict{
+					Columns: []string{"id"},
+					Update: []*SetExpr{
+						{Column: "name", Expr: &ColName{Qualifier: "excluded", Name: "name"}},
+						{Column: "score", Expr: &BinaryExpr{Left: &ColName{Qualifier: "users", Name: "score"}, Operator: Op_ADD, Right: &Value{Val: "1"}}},
+					},
+				},
+			},
+		},
+		{
+			name:  "ok: returning",
+			query: `insert into users (id, name) values (1, "bob") on conflict do nothing returning *, id + 1 as next;`,
+			expected: &InsertStatement{
+				Table:      "users",
+				Columns:    []string{"id", "name"},
+				Rows:       [][]Expr{{&Value{Val: "1"}, &Value{Val: "bob", Quoted: true}}},
+				OnConflict: &OnConflict{},
+				Returning: []SelectExpr{
+					&StarExpr{},
+					&AliasedExpr{Expr: &BinaryExpr{Left: &ColName{Name: "id"}, Operator: Op_ADD, Right: &Value{Val: "1"}}, As: "next"},
 				},
 			},
 		},
+		{
+			name:      "failure: returning nothing",
+			query:     `insert into users (id, name) values (1, "bob") returning;`,
+			wantError: true,
+		},
+		{
+			name:      "failure: do update without conflict target",
+			query:     `insert into users (id, name) values (1, "bob") on conflict do update set name = excluded.name;`,
+			wantError: true,
+		},
+		{
+			name:      "failure: do update without set",
+			query:     `insert into users (id, name) values (1, "bob") on conflict (id) do update;`,
+			wantError: true,
+		},
+		{
+			name:      "failure: select and values",
+			query:     `insert into users select id from members values (1);`,
+			wantError: true,
+		},
 		{
 			name:      "failure: no table name",
 			query:     `insert into values (1, "bob", true, "2021-05-01 17:59:59"), (2, "alice", false, "2021-05-02 17:59:59");`,
@@ -231,6 +373,225 @@ func TestParser_parse_Select(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "ok: where is null",
+			query: `select * from users where name is null`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&StarExpr{},
+				},
+				From: &AliasedTableExpr{
+					Expr: &TableName{
+						Name: "users",
+					},
+				},
+				Where: &Where{
+					Expr: &IsNullExpr{
+						Operand: &ColName{
+							Name: "name",
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "ok: where is not null",
+			query: `select * from users where name is not null`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&StarExpr{},
+				},
+				From: &AliasedTableExpr{
+					Expr: &TableName{
+						Name: "users",
+					},
+				},
+				Where: &Where{
+					Expr: &IsNullExpr{
+						Operand: &ColName{
+							Name: "name",
+						},
+						Not: true,
+					},
+				},
+			},
+		},
+		{
+			name:  "ok: and has higher precedence than or",
+			query: `select * from users where id = 1 or id >= 2 and name != "bob"`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&StarExpr{},
+				},
+				From: &AliasedTableExpr{
+					Expr: &TableName{
+						Name: "users",
+					},
+				},
+				Where: &Where{
+					Expr: &OrExpr{
+						Left: &ComparisonExpr{Left: &ColName{Name: "id"}, Operator: Op_EQ, Right: &Value{Val: "1"}},
+						Right: &AndExpr{
+							Left:  &ComparisonExpr{Left: &ColName{Name: "id"}, Operator: Op_GTE, Right: &Value{Val: "2"}},
+							Right: &ComparisonExpr{Left: &ColName{Name: "name"}, Operator: Op_NEQ, Right: &Value{Val: "bob", Quoted: true}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "ok: parentheses and not",
+			query: `select * from users where not (id<1 or id>10) and verified = true`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&StarExpr{},
+				},
+				From: &AliasedTableExpr{
+					Expr: &TableName{
+						Name: "users",
+					},
+				},
+				Where: &Where{
+					Expr: &AndExpr{
+						Left: &NotExpr{
+							Operand: &OrExpr{
+								Left:  &ComparisonExpr{Left: &ColName{Name: "id"}, Operator: Op_LT, Right: &Value{Val: "1"}},
+								Right: &ComparisonExpr{Left: &ColName{Name: "id"}, Operator: Op_GT, Right: &Value{Val: "10"}},
+							},
+						},
+						Right: &ComparisonExpr{Left: &ColName{Name: "verified"}, Operator: Op_EQ, Right: &Value{Val: "true"}},
+					},
+				},
+			},
+		},
+		{
+			name:  "ok: column vs column",
+			query: `select * from users where name <> nickname and 20 <= age`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&StarExpr{},
+				},
+				From: &AliasedTableExpr{
+					Expr: &TableName{
+						Name: "users",
+					},
+				},
+				Where: &Where{
+					Expr: &AndExpr{
+						Left:  &ComparisonExpr{Left: &ColName{Name: "name"}, Operator: Op_NEQ, Right: &ColName{Name: "nickname"}},
+						Right: &ComparisonExpr{Left: &Value{Val: "20"}, Operator: Op_LTE, Right: &ColName{Name: "age"}},
+					},
+				},
+			},
+		},
+		{
+			name:      "failure: unclosed paren",
+			query:     `select * from users where (id = 1 or id = 2`,
+			wantError: true,
+		},
+		{
+			name:      "failure: no operand",
+			query:     `select * from users where id = 1 and`,
+			wantError: true,
+		},
+		{
+			name:  "ok: group by and having",
+			query: `select name, COUNT(*), sum(score) as total from users where id > 1 group by name having max(score) >= 10 order by count(*) desc`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&AliasedExpr{Expr: &ColName{Name: "name"}},
+					&AliasedExpr{Expr: &FuncExpr{Name: "count", Args: []Expr{}, Star: true}},
+					&AliasedExpr{Expr: &FuncExpr{Name: "sum", Args: []Expr{&ColName{Name: "score"}}}, As: "total"},
+				},
+				From: &AliasedTableExpr{
+					Expr: &TableName{
+						Name: "users",
+					},
+				},
+				Where: &Where{
+					Expr: &ComparisonExpr{Left: &ColName{Name: "id"}, Operator: Op_GT, Right: &Value{Val: "1"}},
+				},
+				GroupBy: []Expr{&ColName{Name: "name"}},
+				Having: &Where{
+					Expr: &ComparisonExpr{
+						Left:     &FuncExpr{Name: "max", Args: []Expr{&ColName{Name: "score"}}},
+						Operator: Op_GTE,
+						Right:    &Value{Val: "10"},
+					},
+				},
+				OrderBy: []*Order{
+					{Expr: &FuncExpr{Name: "count", Args: []Expr{}, Star: true}, Direction: OrderDirection_DESC},
+				},
+			},
+		},
+		{
+			name:      "failure: unclosed function call",
+			query:     `select count(id from users`,
+			wantError: true,
+		},
+		{
+			name:      "failure: group without by",
+			query:     `select name from users group name`,
+			wantError: true,
+		},
+		{
+			name:  "ok: join",
+			query: `select u.name, d.* from users as u join depts d on u.dept_id = d.id`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&AliasedExpr{Expr: &ColName{Name: "name", Qualifier: "u"}},
+					&StarExpr{Table: "d"},
+				},
+				From: &JoinTableExpr{
+					LeftExpr:  &AliasedTableExpr{Expr: &TableName{Name: "users"}, As: "u"},
+					Join:      InnerJoin,
+					RightExpr: &AliasedTableExpr{Expr: &TableName{Name: "depts"}, As: "d"},
+					Condition: &ComparisonExpr{
+						Left:     &ColName{Name: "dept_id", Qualifier: "u"},
+						Operator: Op_EQ,
+						Right:    &ColName{Name: "id", Qualifier: "d"},
+					},
+				},
+			},
+		},
+		{
+			name:  "ok: multiple joins are left associative",
+			query: `select * from users inner join depts on users.dept_id = depts.id left outer join teams on teams.id = users.team_id`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{
+					&StarExpr{},
+				},
+				From: &JoinTableExpr{
+					LeftExpr: &JoinTableExpr{
+						LeftExpr:  &AliasedTableExpr{Expr: &TableName{Name: "users"}},
+						Join:      InnerJoin,
+						RightExpr: &AliasedTableExpr{Expr: &TableName{Name: "depts"}},
+						Condition: &ComparisonExpr{
+							Left:     &ColName{Name: "dept_id", Qualifier: "users"},
+							Operator: Op_EQ,
+							Right:    &ColName{Name: "id", Qualifier: "depts"},
+						},
+					},
+					Join:      LeftJoin,
+					RightExpr: &AliasedTableExpr{Expr: &TableName{Name: "teams"}},
+					Condition: &ComparisonExpr{
+						Left:     &ColName{Name: "id", Qualifier: "teams"},
+						Operator: Op_EQ,
+						Right:    &ColName{Name: "team_id", Qualifier: "users"},
+					},
+				},
+			},
+		},
+		{
+			name:      "failure: join without on",
+			query:     `select * from users join depts`,
+			wantError: true,
+		},
+		{
+			name:      "failure: left join without join",
+			query:     `select * from users left depts on users.id = depts.id`,
+			wantError: true,
+		},
 		{
 			name:  "ok: order by 1",
 			query: `select * from users order by id`,
@@ -373,6 +734,63 @@ func TestParser_parse_Select(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "ok: derived table",
+			query: `select t.a from (select id from users) as t (a)`,
+			expected: &SelectStatement{
+				SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Qualifier: "t", Name: "a"}}},
+				From: &AliasedTableExpr{
+					Expr: &DerivedTable{
+						Select: &SelectStatement{
+							SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+							From:        &AliasedTableExpr{Expr: &TableName{Name: "users"}},
+						},
+						Columns: []string{"a"},
+					},
+					As: "t",
+				},
+			},
+		},
+		{
+			name:  "ok: with",
+			query: `with a as (select id from users), b (x) as (select id from a) select * from b`,
+			expected: &SelectStatement{
+				With: []*CommonTableExpr{
+					{
+						Name: "a",
+						Select: &SelectStatement{
+							SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+							From:        &AliasedTableExpr{Expr: &TableName{Name: "users"}},
+						},
+					},
+					{
+						Name:    "b",
+						Columns: []string{"x"},
+						Select: &SelectStatement{
+							SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+							From:        &AliasedTableExpr{Expr: &TableName{Name: "a"}},
+						},
+					},
+				},
+				SelectExprs: []SelectExpr{&StarExpr{}},
+				From:        &AliasedTableExpr{Expr: &TableName{Name: "b"}},
+			},
+		},
+		{
+			name:      "failure: derived table without alias",
+			query:     `select * from (select id from users)`,
+			wantError: true,
+		},
+		{
+			name:      "failure: with without select",
+			query:     `with a as (select id from users)`,
+			wantError: true,
+		},
+		{
+			name:      "failure: with without parentheses",
+			query:     `with a as select id from users select * from a`,
+			wantError: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -387,3 +805,305 @@ func TestParser_parse_Select(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_parse_SetOperation(t *testing.T) {
+	sel := func(table string) *SelectStatement {
+		return &SelectStatement{
+			SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+			From:        &AliasedTableExpr{Expr: &TableName{Name: table}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		expected  Query
+		wantError bool
+	}{
+		{
+			name:     "ok: union all",
+			query:    `select id from a union all select id from b`,
+			expected: &SetOperationStatement{Type: Union, All: true, Left: sel("a"), Right: sel("b")},
+		},
+		{
+			name:  "ok: left-associative",
+			query: `select id from a union select id from b except distinct select id from c`,
+			expected: &SetOperationStatement{
+				Type:  Except,
+				Left:  &SetOperationStatement{Type: Union, Left: sel("a"), Right: sel("b")},
+				Right: sel("c"),
+			},
+		},
+		{
+			name:  "ok: intersect binds tighter",
+			query: `select id from a except select id from b intersect all select id from c`,
+			expected: &SetOperationStatement{
+				Type:  Except,
+				Left:  sel("a"),
+				Right: &SetOperationStatement{Type: Intersect, All: true, Left: sel("b"), Right: sel("c")},
+			},
+		},
+		{
+			name:  "ok: order by and limit of the result",
+			query: `with c as (select id from a) select id from a union select id from c order by id desc limit 3`,
+			expected: &SetOperationStatement{
+				With:    []*CommonTableExpr{{Name: "c", Select: sel("a")}},
+				Type:    Union,
+				Left:    sel("a"),
+				Right:   sel("c"),
+				OrderBy: []*Order{{Expr: &ColName{Name: "id"}, Direction: OrderDirection_DESC}},
+				Limit:   &Limit{Count: 3},
+			},
+		},
+		{
+			name:  "ok: parenthesized",
+			query: `(select id from a limit 1) union (select id from b union select id from c)`,
+			expected: &SetOperationStatement{
+				Type: Union,
+				Left: &SelectStatement{
+					SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+					From:        &AliasedTableExpr{Expr: &TableName{Name: "a"}},
+					Limit:       &Limit{Count: 1},
+				},
+				Right: &SetOperationStatement{Type: Union, Left: sel("b"), Right: sel("c")},
+			},
+		},
+		{name: "failure: order by before union", query: `select id from a order by id union select id from b`, wantError: true},
+		{name: "failure: no right query", query: `select id from a union`, wantError: true},
+		{name: "failure: multiple limits", query: `(select id from a limit 1) limit 2`, wantError: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := New(nil)
+			stmt, err := p.parse(test.query)
+			testutil.MustEqual(t, err != nil, test.wantError)
+			if !test.wantError {
+				testutil.MustEqual(t, stmt, sdb.Statement(test.expected))
+			}
+		})
+	}
+}
+
+func TestParser_parse_Expr(t *testing.T) {
+	col := func(name string) *ColName { return &ColName{Name: name} }
+	val := func(v string) *Value { return &Value{Val: v} }
+	str := func(v string) *Value { return &Value{Val: v, Quoted: true} }
+	binary := func(left Expr, op OperatorType, right Expr) *BinaryExpr {
+		return &BinaryExpr{Left: left, Operator: op, Right: right}
+	}
+
+	tests := []struct {
+		name      string
+		expr      string
+		expected  Expr
+		wantError bool
+	}{
+		{name: "ok: multiplication precedes addition", expr: `a + b * 2`, expected: binary(col("a"), Op_ADD, binary(col("b"), Op_MUL, val("2")))},
+		{name: "ok: left associative", expr: `a - b - c`, expected: binary(binary(col("a"), Op_SUB, col("b")), Op_SUB, col("c"))},
+		{name: "ok: parentheses", expr: `(a + b) % 3`, expected: binary(binary(col("a"), Op_ADD, col("b")), Op_MOD, val("3"))},
+		{name: "ok: division", expr: `a/b`, expected: binary(col("a"), Op_DIV, col("b"))},
+		{name: "ok: concatenation after arithmetic", expr: `name || id + 1`, expected: binary(col("name"), Op_CONCAT, binary(col("id"), Op_ADD, val("1")))},
+		{name: "ok: negative number", expr: `a * -1.5`, expected: binary(col("a"), Op_MUL, val("-1.5"))},
+		{name: "ok: unary minus", expr: `-a + 1`, expected: binary(&UnaryMinusExpr{Operand: col("a")}, Op_ADD, val("1"))},
+		{
+			name:     "ok: comparison of arithmetic",
+			expr:     `a + 1 > b * 2`,
+			expected: &ComparisonExpr{Left: binary(col("a"), Op_ADD, val("1")), Operator: Op_GT, Right: binary(col("b"), Op_MUL, val("2"))},
+		},
+		{
+			name:     "ok: function",
+			expr:     `substr(lower(name), 1, 3)`,
+			expected: &FuncExpr{Name: "substr", Args: []Expr{&FuncExpr{Name: "lower", Args: []Expr{col("name")}}, val("1"), val("3")}},
+		},
+		{name: "ok: no arguments", expr: `NOW()`, expected: &FuncExpr{Name: "now", Args: []Expr{}}},
+		{name: "ok: extract", expr: `extract(year from registered)`, expected: &FuncExpr{Name: "extract", Args: []Expr{val("year"), col("registered")}}},
+		{name: "failure: extract without from", expr: `extract(year, registered)`, wantError: true},
+		{name: "failure: missing operand", expr: `a +`, wantError: true},
+		{name: "ok: in", expr: `a in (1, b + 1)`, expected: &InExpr{Operand: col("a"), Values: []Expr{val("1"), binary(col("b"), Op_ADD, val("1"))}}},
+		{name: "ok: not in", expr: `a NOT IN ("x")`, expected: &InExpr{Operand: col("a"), Values: []Expr{str("x")}, Not: true}},
+		{
+			name: "ok: between",
+			expr: `a between 1 and b - 1`,
+			expected: &AndExpr{
+				Left:  &ComparisonExpr{Left: col("a"), Operator: Op_GTE, Right: val("1")},
+				Right: &ComparisonExpr{Left: col("a"), Operator: Op_LTE, Right: binary(col("b"), Op_SUB, val("1"))},
+			},
+		},
+		{
+			name: "ok: not between",
+			expr: `a not between 1 and 5`,
+			expected: &NotExpr{Operand: &AndExpr{
+				Left:  &ComparisonExpr{Left: col("a"), Operator: Op_GTE, Right: val("1")},
+				Right: &ComparisonExpr{Left: col("a"), Operator: Op_LTE, Right: val("5")},
+			}},
+		},
+		{name: "ok: like", expr: `name like "ab%"`, expected: &LikeExpr{Operand: col("name"), Pattern: str("ab%")}},
+		{name: "ok: not like", expr: `name not like "%b"`, expected: &LikeExpr{Operand: col("name"), Pattern: str("%b"), Not: true}},
+		{
+			name: "ok: searched case",
+			expr: `case when a > 1 then "big" when a is null then "none" else "small" end`,
+			expected: &CaseExpr{
+				Whens: []*When{
+					{Cond: &ComparisonExpr{Left: col("a"), Operator: Op_GT, Right: val("1")}, Result: str("big")},
+					{Cond: &IsNullExpr{Operand: col("a")}, Result: str("none")},
+				},
+				Else: str("small"),
+			},
+		},
+		{
+			name:     "ok: simple case",
+			expr:     `CASE a WHEN 1 THEN b END + 1`,
+			expected: binary(&CaseExpr{Operand: col("a"), Whens: []*When{{Cond: val("1"), Result: col("b")}}}, Op_ADD, val("1")),
+		},
+		{
+			name: "ok: in subquery",
+			expr: `a in (select id from depts where id > 1)`,
+			expected: &InExpr{Operand: col("a"), Subquery: &Subquery{Select: &SelectStatement{
+				SelectExprs: []SelectExpr{&AliasedExpr{Expr: col("id")}},
+				From:        &AliasedTableExpr{Expr: &TableName{Name: "depts"}},
+				Where:       &Where{Expr: &ComparisonExpr{Left: col("id"), Operator: Op_GT, Right: val("1")}},
+			}}},
+		},
+		{
+			name: "ok: not exists",
+			expr: `not exists (select * from depts)`,
+			expected: &NotExpr{Operand: &ExistsExpr{Subquery: &Subquery{Select: &SelectStatement{
+				SelectExprs: []SelectExpr{&StarExpr{}},
+				From:        &AliasedTableExpr{Expr: &TableName{Name: "depts"}},
+			}}}},
+		},
+		{
+			name: "ok: scalar subquery",
+			expr: `(select max(id) from depts) + 1`,
+			expected: binary(&Subquery{Select: &SelectStatement{
+				SelectExprs: []SelectExpr{&AliasedExpr{Expr: &FuncExpr{Name: "max", Args: []Expr{col("id")}}}},
+				From:        &AliasedTableExpr{Expr: &TableName{Name: "depts"}},
+			}}, Op_ADD, val("1")),
+		},
+		{
+			name: "ok: window",
+			expr: `sum(a) over (partition by b, c order by d desc rows between unbounded preceding and 1 following)`,
+			expected: &FuncExpr{Name: "sum", Args: []Expr{col("a")}, Over: &WindowSpec{
+				PartitionBy: []Expr{col("b"), col("c")},
+				OrderBy:     []*Order{{Expr: col("d"), Direction: OrderDirection_DESC}},
+				Frame: &WindowFrame{
+					Start: &FrameBound{Type: FrameUnboundedPreceding},
+					End:   &FrameBound{Type: FrameFollowing, Offset: 1},
+				},
+			}},
+		},
+		{name: "ok: empty window", expr: `row_number() over ()`, expected: &FuncExpr{Name: "row_number", Args: []Expr{}, Over: &WindowSpec{}}},
+		{
+			name: "ok: frame without between",
+			expr: `count(*) over (order by a rows 2 preceding)`,
+			expected: &FuncExpr{Name: "count", Args: []Expr{}, Star: true, Over: &WindowSpec{
+				OrderBy: []*Order{{Expr: col("a"), Direction: OrderDirection_ASC}},
+				Frame:   &WindowFrame{Start: &FrameBound{Type: FramePreceding, Offset: 2}, End: &FrameBound{Type: FrameCurrentRow}},
+			}},
+		},
+		{name: "failure: window without parentheses", expr: `rank() over order by a`, wantError: true},
+		{name: "failure: invalid frame bound", expr: `sum(a) over (rows between current and 1 following)`, wantError: true},
+		{name: "failure: in without values", expr: `a in ()`, wantError: true},
+		{name: "failure: exists without subquery", expr: `exists (1)`, wantError: true},
+		{name: "failure: unclosed subquery", expr: `(select id from depts`, wantError: true},
+		{name: "failure: between without and", expr: `a between 1, 2`, wantError: true},
+		{name: "failure: case without when", expr: `case else 1 end`, wantError: true},
+		{name: "failure: case without end", expr: `case when a then 1`, wantError: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := New(nil)
+			stmt, err := p.parse("select " + test.expr + " from users;")
+			testutil.MustEqual(t, err != nil, test.wantError)
+			if !test.wantError {
+				testutil.MustEqual(t, stmt.(*SelectStatement).SelectExprs[0].(*AliasedExpr).Expr, test.expected)
+			}
+		})
+	}
+}
+
+func TestParser_parse_Unsupported(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{name: "update returning", query: `UPDATE users SET id = 1 RETURNING id;`, err: "UPDATE statement is not supported"},
+		{name: "delete returning", query: `delete from users returning id;`, err: "DELETE statement is not supported"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := New(nil)
+			_, err := p.parse(test.query)
+			testutil.MustEqual(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestParser_parse_Analyze(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		expected  *AnalyzeStatement
+		wantError bool
+	}{
+		{name: "ok: every table", query: `analyze;`, expected: &AnalyzeStatement{}},
+		{name: "ok: table", query: `ANALYZE users;`, expected: &AnalyzeStatement{Table: "users"}},
+		{name: "failure: too many tables", query: `analyze users items;`, wantError: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := New(nil)
+			stmt, err := p.parse(test.query)
+			testutil.MustEqual(t, err != nil, test.wantError)
+			if !test.wantError {
+				testutil.MustEqual(t, stmt.(*AnalyzeStatement), test.expected)
+			}
+		})
+	}
+}
+
+func TestParser_parse_Explain(t *testing.T) {
+	selectStmt := &SelectStatement{
+		SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+		From:        &AliasedTableExpr{Expr: &TableName{Name: "users"}},
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		expected  *ExplainStatement
+		wantError bool
+	}{
+		{name: "ok: explain", query: `explain select id from users;`, expected: &ExplainStatement{Stmt: selectStmt}},
+		{name: "ok: explain analyze", query: `EXPLAIN ANALYZE select id from users;`, expected: &ExplainStatement{Analyze: true, Stmt: selectStmt}},
+		{
+			name:  "ok: explain with",
+			query: `explain with u as (select id from users) select id from u;`,
+			expected: &ExplainStatement{Stmt: &SelectStatement{
+				With:        []*CommonTableExpr{{Name: "u", Select: selectStmt}},
+				SelectExprs: []SelectExpr{&AliasedExpr{Expr: &ColName{Name: "id"}}},
+				From:        &AliasedTableExpr{Expr: &TableName{Name: "u"}},
+			}},
+		},
+		{name: "failure: not select", query: `explain analyze users;`, wantError: true},
+		{name: "failure: no statement", query: `explain;`, wantError: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := New(nil)
+			stmt, err := p.parse(test.query)
+			testutil.MustEqual(t, err != nil, test.wantError)
+			if !test.wantError {
+				testutil.MustEqual(t, stmt.(*ExplainStatement), test.expected)
+			}
+		})
+	}
+}
@@ -23,8 +23,12 @@ const (
 	AND
 	OR
 	LEFT
+	INNER
+	OUTER
 	JOIN
 	ON
+	GROUP
+	HAVING
 	ORDER
 	BY
 	ASC
@@ -39,9 +43,45 @@ const (
 	INTO
 	VALUES
 
+	ANALYZE
+	EXPLAIN
+
 	PRIMARY
 	KEY
 
+	NOT
+	NULL
+	IS
+	DEFAULT
+	IN
+	BETWEEN
+	LIKE
+	CASE
+	WHEN
+	THEN
+	ELSE
+	END
+	EXISTS
+	WITH
+	UNION
+	INTERSECT
+	EXCEPT
+	ALL
+	OVER
+	PARTITION
+	ROWS
+	UNBOUNDED
+	PRECEDING
+	FOLLOWING
+	CURRENT
+	ROW
+	CONFLICT
+	DO
+	NOTHING
+	UPDATE
+	SET
+	RETURNING
+
 	BOOL
 	INT64
 	FLOAT64
@@ -62,6 +102,11 @@ const (
 	GTE
 	NEQ
 	ASTERISK
+	PLUS
+	MINUS
+	SLASH
+	PERCENT
+	CONCAT
 )
 
 func (tk tokenKind) String() string {
@@ -84,8 +129,12 @@ var keywords = []*keyword{
 	{s: "and", tk: AND},
 	{s: "or", tk: OR},
 	{s: "left", tk: LEFT},
+	{s: "inner", tk: INNER},
+	{s: "outer", tk: OUTER},
 	{s: "join", tk: JOIN},
 	{s: "on", tk: ON},
+	{s: "group", tk: GROUP},
+	{s: "having", tk: HAVING},
 	{s: "order", tk: ORDER},
 	{s: "by", tk: BY},
 	{s: "asc", tk: ASC},
@@ -97,8 +146,42 @@ var keywords = []*keyword{
 	{s: "insert", tk: INSERT},
 	{s: "into", tk: INTO},
 	{s: "values", tk: VALUES},
+	{s: "analyze", tk: ANALYZE},
+	{s: "explain", tk: EXPLAIN},
 	{s: "primary", tk: PRIMARY},
 	{s: "key", tk: KEY},
+	{s: "not", tk: NOT},
+	{s: "null", tk: NULL},
+	{s: "is", tk: IS},
+	{s: "default", tk: DEFAULT},
+	{s: "in", tk: IN},
+	{s: "between", tk: BETWEEN},
+	{s: "like", tk: LIKE},
+	{s: "case", tk: CASE},
+	{s: "when", tk: WHEN},
+	{s: "then", tk: THEN},
+	{s: "else", tk: ELSE},
+	{s: "end", tk: END},
+	{s: "exists", tk: EXISTS},
+	{s: "with", tk: WITH},
+	{s: "union", tk: UNION},
+	{s: "intersect", tk: INTERSECT},
+	{s: "except", tk: EXCEPT},
+	{s: "all", tk: ALL},
+	{s: "over", tk: OVER},
+	{s: "partition", tk: PARTITION},
+	{s: "rows", tk: ROWS},
+	{s: "unbounded", tk: UNBOUNDED},
+	{s: "preceding", tk: PRECEDING},
+	{s: "following", tk: FOLLOWING},
+	{s: "current", tk: CURRENT},
+	{s: "row", tk: ROW},
+	{s: "conflict", tk: CONFLICT},
+	{s: "do", tk: DO},
+	{s: "nothing", tk: NOTHING},
+	{s: "update", tk: UPDATE},
+	{s: "set", tk: SET},
+	{s: "returning", tk: RETURNING},
 	{s: "bool", tk: BOOL},
 	{s: "int64", tk: INT64},
 	{s: "float64", tk: FLOAT64},
@@ -114,7 +197,13 @@ var keywords = []*keyword{
 	{s: ">", tk: GT},
 	{s: ">=", tk: GTE},
 	{s: "<>", tk: NEQ},
+	{s: "!=", tk: NEQ},
 	{s: "*", tk: ASTERISK},
+	{s: "+", tk: PLUS},
+	{s: "-", tk: MINUS},
+	{s: "/", tk: SLASH},
+	{s: "%", tk: PERCENT},
+	{s: "||", tk: CONCAT},
 	{s: ";", tk: EOF},
 }
 
@@ -131,6 +220,8 @@ type token struct {
 	Kind tokenKind
 
 	Val string
+	// Quoted is true when the STRING_VAL is quoted. Unquoted STRING_VAL can be an identifier.
+	Quoted bool
 }
 
 type tokenizer struct {
@@ -147,7 +238,7 @@ func (t *tokenizer) isSpace() bool {
 }
 
 func (t *tokenizer) isSymbol() bool {
-	symbols := []byte{'{', '}', '(', ')', ',', '=', '*', ';'}
+	symbols := []byte{'{', '}', '(', ')', ',', '=', '<', '>', '!', '*', ';', '+', '-', '/', '%', '|'}
 	for _, symbol := range symbols {
 		if t.query[t.pos] == symbol {
 			return true
@@ -213,6 +304,10 @@ func (t *tokenizer) scanQuotedStringVal() string {
 	return string(out)
 }
 
+func isIdentChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '_'
+}
+
 func (t *tokenizer) match(s string) bool {
 	length := len(s)
 	// remaining characters length must be longer than s length
@@ -220,12 +315,17 @@ func (t *tokenizer) match(s string) bool {
 		return false
 	}
 
-	if strings.ToLower(t.query[t.pos:t.pos+length]) == strings.ToLower(s) {
-		t.pos += length
-		return true
+	if strings.ToLower(t.query[t.pos:t.pos+length]) != strings.ToLower(s) {
+		return false
+	}
+
+	// word keyword must not be a part of identifier. e.g. "is" must not match "is_active"
+	if isIdentChar(s[length-1]) && t.pos+length < len(t.query) && isIdentChar(t.query[t.pos+length]) {
+		return false
 	}
 
-	return false
+	t.pos += length
+	return true
 }
 
 func (t *tokenizer) tokenize() []*token {
@@ -250,7 +350,7 @@ func (t *tokenizer) tokenize() []*token {
 		switch {
 		case t.match(`"`):
 			s := t.scanQuotedStringVal()
-			tokens = append(tokens, &token{Kind: STRING_VAL, Val: s})
+			tokens = append(tokens, &token{Kind: STRING_VAL, Val: s, Quoted: true})
 		case t.isNumber():
 			s := t.scanNumber()
 			tokens = append(tokens, &token{Kind: NUMBER_VAL, Val: s})
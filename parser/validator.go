@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/dty1er/sdb/schema"
@@ -74,6 +76,26 @@ func (v *validator) validateCreateTableStmt(stmt *CreateTableStatement) error {
 		}
 	}
 
+	for _, notNullCol := range stmt.NotNullCols {
+		found := false
+		for _, columnName := range stmt.Columns {
+			if columnName == notNullCol {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("not null column %s must be in column", notNullCol)
+		}
+	}
+
+	for column, def := range stmt.Defaults {
+		if err := validateDefault(stmt, column, def); err != nil {
+			return err
+		}
+	}
+
 	if v.catalog.FindTable(stmt.Table) {
 		return fmt.Errorf("table %s already exists", stmt.Table)
 	}
@@ -81,48 +103,1375 @@ func (v *validator) validateCreateTableStmt(stmt *CreateTableStatement) error {
 	return nil
 }
 
-func (v *validator) validateInsertStmt(stmt *InsertStatement) error {
-	if len(stmt.Rows) > 1000 {
-		return fmt.Errorf("Inserting rows number exceeded the limit 1000: %d", len(stmt.Rows))
+// validateDefault checks the default value of the column can be stored in the column.
+func validateDefault(stmt *CreateTableStatement, column string, def Expr) error {
+	typ := ""
+	for i, columnName := range stmt.Columns {
+		if columnName == column {
+			typ = stmt.Types[i]
+			break
+		}
+	}
+
+	if typ == "" {
+		return fmt.Errorf("column %s with default value must be in column", column)
 	}
-	// colLen := len(stmt.Columns)
-	// for _, row := range stmt.Rows {
-	// 	if len(row) != colLen {
-	// 		return fmt.Errorf("row size %d must be the same as column length %d", len(row), colLen)
-	// 	}
-	// }
 
+	switch d := def.(type) {
+	case *NullVal:
+		if column == stmt.PrimaryKeyCol {
+			return fmt.Errorf("default value of primary key %s cannot be null", column)
+		}
+
+		for _, notNullCol := range stmt.NotNullCols {
+			if column == notNullCol {
+				return fmt.Errorf("default value of not null column %s cannot be null", column)
+			}
+		}
+	case *FuncExpr:
+		if schema.StrToColumnType(typ) != schema.ColumnTypeTimestamp {
+			return fmt.Errorf("default value %s() is not allowed for column %s, type %s", d.Name, column, typ)
+		}
+	case *Value:
+		if _, err := schema.ConvertValue(d.Val, schema.StrToColumnType(typ)); err != nil {
+			return fmt.Errorf("invalid default value %v for column %s, type %s", d.Val, column, typ)
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validateInsertStmt(stmt *InsertStatement) error {
 	if !v.catalog.FindTable(stmt.Table) {
 		return fmt.Errorf("table %s does not exist", stmt.Table)
 	}
 
 	table := v.catalog.GetTable(stmt.Table)
 
-	for i, col := range stmt.Columns {
-		var typ schema.ColumnType
+	// When no columns are specified, values for every column must be specified.
+	columns := stmt.Columns
+	if len(columns) == 0 {
+		columns = make([]string, len(table.Columns))
+		for i, colDef := range table.Columns {
+			columns[i] = colDef.Name
+		}
+	}
+
+	colLen := len(columns)
+	for _, row := range stmt.Rows {
+		if len(row) != colLen {
+			return fmt.Errorf("row size %d must be the same as column length %d", len(row), colLen)
+		}
+	}
+
+	var queryCols []*schema.ColumnDef
+	if stmt.Select != nil {
+		cols, err := v.validateQuery(&scope{}, stmt.Select)
+		if err != nil {
+			return err
+		}
+		if len(cols) != colLen {
+			return fmt.Errorf("query returns %d columns but column length is %d", len(cols), colLen)
+		}
+		queryCols = cols
+	}
+
+	colDefs := make([]*schema.ColumnDef, len(columns))
+	for i, col := range columns {
 		for _, actualCol := range table.Columns {
-			if col == actualCol.Name {
-				typ = actualCol.Type
+			if strings.ToLower(col) == actualCol.Name {
+				colDefs[i] = actualCol
 				break
 			}
 		}
-		if typ == 0 {
+		if colDefs[i] == nil {
 			return fmt.Errorf("column %s is not defined in the table %s", col, stmt.Table)
 		}
+	}
+
+	// omitted columns become the default value, or NULL if the column has no default value
+	for _, colDef := range table.Columns {
+		specified := false
+		for _, cd := range colDefs {
+			if cd == colDef {
+				specified = true
+				break
+			}
+		}
+
+		if !specified && !colDef.Nullable() && !colDef.HasDefault() {
+			return fmt.Errorf("column %s cannot be omitted because it is not null", colDef.Name)
+		}
+	}
 
+	if stmt.Select != nil {
+		for i, colDef := range colDefs {
+			if !assignableType(queryCols[i].Type, colDef.Type) {
+				return fmt.Errorf("column %s is %s but the query returns %s", colDef.Name, colDef.Type, queryCols[i].Type)
+			}
+		}
+	}
+
+	for i, colDef := range colDefs {
 		for _, row := range stmt.Rows {
-			v := row[i]
-			if _, err := schema.ConvertValue(v, typ); err != nil {
-				return fmt.Errorf("invalid value %v for column %s, type %s", v, col, typ)
+			switch val := row[i].(type) {
+			case *NullVal:
+				if !colDef.Nullable() {
+					return fmt.Errorf("column %s cannot be null", colDef.Name)
+				}
+			case *Value:
+				if _, err := schema.ConvertValue(val.Val, colDef.Type); err != nil {
+					return fmt.Errorf("invalid value %v for column %s, type %s", val.Val, colDef.Name, colDef.Type)
+				}
+			default:
+				typ, err := v.validateInsertValue(val)
+				if err != nil {
+					return err
+				}
+				if !assignableType(typ, colDef.Type) {
+					return fmt.Errorf("column %s is %s but the value is %s", colDef.Name, colDef.Type, typ)
+				}
+			}
+		}
+	}
+
+	if err := v.validateOnConflict(table, stmt.OnConflict); err != nil {
+		return err
+	}
+
+	return v.validateReturning(table, stmt.Returning)
+}
+
+// validateReturning validates RETURNING clause. It is the select list for the rows of the table.
+func (v *validator) validateReturning(table *schema.Table, exprs []SelectExpr) error {
+	sc := &scope{tables: []*scopeTable{{name: table.Name, table: table}}}
+	for _, se := range exprs {
+		switch s := se.(type) {
+		case *StarExpr:
+			if s.Table != "" && !strings.EqualFold(s.Table, table.Name) {
+				return fmt.Errorf("table %s is not the table to be inserted", s.Table)
+			}
+		case *AliasedExpr:
+			if HasAggregate(s.Expr) {
+				return fmt.Errorf("aggregate functions are not allowed in RETURNING")
+			}
+			if HasWindow(s.Expr) {
+				return fmt.Errorf("window functions are not allowed in RETURNING")
+			}
+			if _, err := v.validateExpr(sc, s.Expr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateOnConflict validates ON CONFLICT clause. The conflict target must be the primary key, and
+// the primary key cannot be updated. The expressions in SET clause refer to the existing row by the
+// table name and to the row to be inserted by excluded.
+func (v *validator) validateOnConflict(table *schema.Table, oc *OnConflict) error {
+	if oc == nil {
+		return nil
+	}
+
+	pk := table.Columns[table.PrimaryKeyIndex]
+	if len(oc.Columns) != 0 && (len(oc.Columns) != 1 || strings.ToLower(oc.Columns[0]) != pk.Name) {
+		return fmt.Errorf("ON CONFLICT target must be the primary key %s", pk.Name)
+	}
+
+	sc := &scope{tables: []*scopeTable{{name: table.Name, table: table}, {name: "excluded", table: table}}}
+	assigned := map[string]bool{}
+	for _, set := range oc.Update {
+		colDef := findColumnDef(table, set.Column)
+		if colDef == nil {
+			return fmt.Errorf("column %s is not defined in the table %s", set.Column, table.Name)
+		}
+		if colDef == pk {
+			return fmt.Errorf("primary key %s cannot be updated", pk.Name)
+		}
+		if assigned[colDef.Name] {
+			return fmt.Errorf("column %s is assigned more than once", colDef.Name)
+		}
+		assigned[colDef.Name] = true
+
+		switch val := set.Expr.(type) {
+		case *NullVal:
+			if !colDef.Nullable() {
+				return fmt.Errorf("column %s cannot be null", colDef.Name)
+			}
+		case *Value:
+			if _, err := schema.ConvertValue(val.Val, colDef.Type); err != nil {
+				return fmt.Errorf("invalid value %v for column %s, type %s", val.Val, colDef.Name, colDef.Type)
+			}
+		default:
+			if HasAggregate(val) {
+				return fmt.Errorf("aggregate functions are not allowed in ON CONFLICT DO UPDATE")
+			}
+			if HasWindow(val) {
+				return fmt.Errorf("window functions are not allowed in ON CONFLICT DO UPDATE")
+			}
+			typ, err := v.validateOperand(sc, val)
+			if err != nil {
+				return err
+			}
+			if !assignableType(typ, colDef.Type) {
+				return fmt.Errorf("column %s is %s but the value is %s", colDef.Name, colDef.Type, typ)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateInsertValue validates the expression in VALUES and returns its type. It cannot refer to any column.
+func (v *validator) validateInsertValue(expr Expr) (schema.ColumnType, error) {
+	if HasAggregate(expr) {
+		return 0, fmt.Errorf("aggregate functions are not allowed in VALUES")
+	}
+	if HasWindow(expr) {
+		return 0, fmt.Errorf("window functions are not allowed in VALUES")
+	}
+
+	return v.validateOperand(&scope{}, expr)
+}
+
+// assignableType reports if the value of the type can be stored in the column of the column type.
+// int64 is converted to float64, and the type of NULL is 0.
+func assignableType(typ, column schema.ColumnType) bool {
+	return typ == 0 || typ == column || typ == schema.ColumnTypeInt64 && column == schema.ColumnTypeFloat64
+}
+
+// scope is the tables which can be referred in the select statement.
+// The scope of a subquery has the scope of the outer query, so the columns of the outer query can be referred.
+type scope struct {
+	tables []*scopeTable
+	// outer is the scope of the outer query, and sub is the subquery of this scope. They are nil
+	// for the top level query.
+	outer *scope
+	sub   *Subquery
+	// ctes is the common table expressions which can be referred in FROM clause. The later one hides
+	// the earlier one of the same name.
+	ctes []*CommonTableExpr
+}
+
+type scopeTable struct {
+	// name is the alias of the table, or the table name if no alias is given.
+	name  string
+	table *schema.Table
+}
+
+// findColumn resolves the column. The column without qualifier must be in exactly one table.
+func (sc *scope) findColumn(col *ColName) (*scopeTable, *schema.ColumnDef, error) {
+	var found *scopeTable
+	var colDef *schema.ColumnDef
+	for _, st := range sc.tables {
+		if col.Qualifier != "" && !strings.EqualFold(st.name, col.Qualifier) {
+			continue
+		}
+
+		cd := findColumnDef(st.table, col.Name)
+		if cd == nil {
+			continue
+		}
+
+		// derived tables can have the columns of the same name
+		if found != nil || countColumns(st.table, col.Name) > 1 {
+			return nil, nil, fmt.Errorf("column reference %s is ambiguous", col.Name)
+		}
+		found, colDef = st, cd
+	}
+
+	if found != nil {
+		return found, colDef, nil
+	}
+
+	// the column of the outer query is recorded in the subquery
+	if sc.outer != nil {
+		if st, cd, err := sc.outer.findColumn(col); err == nil {
+			sc.sub.addOuter(col)
+			return st, cd, nil
+		}
+	}
+
+	if col.Qualifier != "" {
+		if !sc.hasTable(col.Qualifier) {
+			return nil, nil, fmt.Errorf("table %s is not in FROM clause", col.Qualifier)
+		}
+		return nil, nil, fmt.Errorf("column %s does not exist in table %s", col.Name, col.Qualifier)
+	}
+
+	if len(sc.tables) == 1 {
+		return nil, nil, fmt.Errorf("column %s does not exist in table %s", col.Name, sc.tables[0].table.Name)
+	}
+
+	return nil, nil, fmt.Errorf("column %s does not exist", col.Name)
+}
+
+// owns reports if the table is in the FROM clause of this scope, not of the outer query.
+func (sc *scope) owns(st *scopeTable) bool {
+	for _, t := range sc.tables {
+		if t == st {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sq *Subquery) addOuter(col *ColName) {
+	for _, c := range sq.Outer {
+		if c == col {
+			return
+		}
+	}
+
+	sq.Outer = append(sq.Outer, col)
+}
+
+func (sc *scope) hasTable(name string) bool {
+	for _, st := range sc.tables {
+		if strings.EqualFold(st.name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findCTE returns the common table expression of the name, or nil if not found.
+func (sc *scope) findCTE(name string) *CommonTableExpr {
+	for i := len(sc.ctes) - 1; i >= 0; i-- {
+		if strings.EqualFold(sc.ctes[i].Name, name) {
+			return sc.ctes[i]
+		}
+	}
+
+	return nil
+}
+
+// addTables adds the tables in FROM clause to the scope. The join condition is validated
+// against the tables added so far.
+func (v *validator) addTables(sc *scope, te TableExpr) error {
+	switch t := te.(type) {
+	case *AliasedTableExpr:
+		var name string
+		var table *schema.Table
+		switch tbl := t.Expr.(type) {
+		case *TableName:
+			name = tbl.Name
+			if cte := sc.findCTE(tbl.Name); cte != nil {
+				tbl.CTE, table = cte, cte.Table
+			} else if v.catalog.FindTable(tbl.Name) {
+				table = v.catalog.GetTable(tbl.Name)
+			} else {
+				return fmt.Errorf("table %s does not exist", tbl.Name)
+			}
+		case *DerivedTable:
+			// the derived table cannot refer to the columns of the outer query
+			cols, err := v.validateQuery(&scope{ctes: sc.ctes}, tbl.Select)
+			if err != nil {
+				return err
+			}
+
+			tbl.Table, err = derivedTable(t.As, cols, tbl.Columns)
+			if err != nil {
+				return err
+			}
+			table = tbl.Table
+		}
+
+		if t.As != "" {
+			name = t.As
+		}
+
+		if sc.hasTable(name) {
+			return fmt.Errorf("table name %s is specified more than once", name)
+		}
+
+		sc.tables = append(sc.tables, &scopeTable{name: name, table: table})
+	case *JoinTableExpr:
+		if err := v.addTables(sc, t.LeftExpr); err != nil {
+			return err
+		}
+
+		if err := v.addTables(sc, t.RightExpr); err != nil {
+			return err
+		}
+
+		if HasAggregate(t.Condition) {
+			return fmt.Errorf("aggregate functions are not allowed in JOIN conditions")
+		}
+		if HasWindow(t.Condition) {
+			return fmt.Errorf("window functions are not allowed in JOIN conditions")
+		}
+
+		if err := v.validatePredicate(sc, t.Condition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// derivedTable returns the table made of the result columns of the derived table or the common table expression.
+// When names is not nil, the columns are renamed to them.
+func derivedTable(name string, cols []*schema.ColumnDef, names []string) (*schema.Table, error) {
+	if names != nil && len(names) != len(cols) {
+		return nil, fmt.Errorf("%s has %d columns available but %d columns specified", name, len(cols), len(names))
+	}
+
+	table := &schema.Table{Name: name, Columns: cols}
+	for i, n := range names {
+		if countColumns(&schema.Table{Columns: cols[:i]}, n) > 0 {
+			return nil, fmt.Errorf("column name %s is specified more than once in %s", n, name)
+		}
+		cols[i].Name = strings.ToLower(n)
+	}
+
+	return table, nil
+}
+
+func (v *validator) validateSelectStmt(stmt Query) error {
+	_, err := v.validateQuery(&scope{}, stmt)
+	return err
+}
+
+// validateQuery validates the query in the scope, and returns the result columns.
+func (v *validator) validateQuery(sc *scope, q Query) ([]*schema.ColumnDef, error) {
+	if s, ok := q.(*SetOperationStatement); ok {
+		return v.validateSetOperation(sc, s)
+	}
+
+	return v.validateSelect(sc, q.(*SelectStatement))
+}
+
+// validateSetOperation validates both sides of the set operation, and returns the result columns.
+// The sides must have the same number of columns, and the types of each column must be matched.
+// Each side has its own FROM clause, but shares the outer query and the common table expressions.
+func (v *validator) validateSetOperation(sc *scope, stmt *SetOperationStatement) ([]*schema.ColumnDef, error) {
+	if err := v.validateWith(sc, stmt.With); err != nil {
+		return nil, err
+	}
+
+	op := strings.ToUpper(stmt.Type.String())
+	left, err := v.validateQuery(&scope{outer: sc.outer, sub: sc.sub, ctes: sc.ctes}, stmt.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := v.validateQuery(&scope{outer: sc.outer, sub: sc.sub, ctes: sc.ctes}, stmt.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(left) != len(right) {
+		return nil, fmt.Errorf("each %s query must have the same number of columns", op)
+	}
+
+	cols := make([]*schema.ColumnDef, len(left))
+	for i := range left {
+		typ := left[i].Type
+		switch r := right[i].Type; {
+		case typ == 0:
+			typ = r
+		case r == 0 || r == typ:
+		case isNumber(typ) && isNumber(r):
+			typ = schema.ColumnTypeFloat64
+		default:
+			return nil, fmt.Errorf("%s types %s and %s cannot be matched", op, typ, r)
+		}
+		cols[i] = &schema.ColumnDef{Name: left[i].Name, Type: typ}
+	}
+
+	// the result can be sorted only by the names of its columns
+	result := &schema.Table{Columns: cols}
+	for _, o := range stmt.OrderBy {
+		c, ok := o.Expr.(*ColName)
+		if !ok || c.Qualifier != "" {
+			return nil, fmt.Errorf("ORDER BY on %s result must be a column name", op)
+		}
+
+		switch countColumns(result, c.Name) {
+		case 0:
+			return nil, fmt.Errorf("column %s does not exist in %s result", c.Name, op)
+		case 1:
+		default:
+			return nil, fmt.Errorf("column reference %s is ambiguous", c.Name)
+		}
+	}
+
+	return cols, nil
+}
+
+// validateWith validates the common table expressions in order, then adds them to the scope.
+// Each of them can refer to the ones before it, but not to itself.
+func (v *validator) validateWith(sc *scope, with []*CommonTableExpr) error {
+	for i, cte := range with {
+		for _, prev := range with[:i] {
+			if strings.EqualFold(prev.Name, cte.Name) {
+				return fmt.Errorf("WITH query name %s is specified more than once", cte.Name)
+			}
+		}
+
+		cols, err := v.validateQuery(&scope{ctes: sc.ctes}, cte.Select)
+		if err != nil {
+			return err
+		}
+
+		cte.Table, err = derivedTable(cte.Name, cols, cte.Columns)
+		if err != nil {
+			return err
+		}
+
+		// copy not to modify the common table expressions of the outer query
+		sc.ctes = append(append([]*CommonTableExpr{}, sc.ctes...), cte)
+	}
+
+	return nil
+}
+
+// validateSelect validates the select statement in the scope, and returns the result columns.
+// The column is named after its alias or the column name, and is unnamed for other expressions.
+func (v *validator) validateSelect(sc *scope, stmt *SelectStatement) ([]*schema.ColumnDef, error) {
+	if err := v.validateWith(sc, stmt.With); err != nil {
+		return nil, err
+	}
+
+	if err := v.addTables(sc, stmt.From); err != nil {
+		return nil, err
+	}
+
+	cols := []*schema.ColumnDef{}
+	for _, se := range stmt.SelectExprs {
+		switch s := se.(type) {
+		case *StarExpr:
+			if s.Table != "" && !sc.hasTable(s.Table) {
+				return nil, fmt.Errorf("table %s is not in FROM clause", s.Table)
+			}
+			for _, st := range sc.tables {
+				if s.Table != "" && !strings.EqualFold(st.name, s.Table) {
+					continue
+				}
+				for _, colDef := range st.table.Columns {
+					cols = append(cols, &schema.ColumnDef{Name: colDef.Name, Type: colDef.Type})
+				}
+			}
+		case *AliasedExpr:
+			typ, err := v.validateExpr(sc, s.Expr)
+			if err != nil {
+				return nil, err
+			}
+			// the literal has its own type when it is a result column
+			if val, ok := s.Expr.(*Value); ok {
+				typ = literalType(val.Val)
+			}
+
+			name := s.As
+			if c, ok := s.Expr.(*ColName); ok && name == "" {
+				name = c.Name
+			}
+			cols = append(cols, &schema.ColumnDef{Name: strings.ToLower(name), Type: typ})
+		}
+	}
+
+	if stmt.Where != nil {
+		if HasAggregate(stmt.Where.Expr) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in WHERE")
+		}
+		if HasWindow(stmt.Where.Expr) {
+			return nil, fmt.Errorf("window functions are not allowed in WHERE")
+		}
+
+		if err := v.validatePredicate(sc, stmt.Where.Expr); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, g := range stmt.GroupBy {
+		col, ok := g.(*ColName)
+		if !ok {
+			return nil, fmt.Errorf("only columns can be used in GROUP BY")
+		}
+
+		st, _, err := sc.findColumn(col)
+		if err != nil {
+			return nil, err
+		}
+		if !sc.owns(st) {
+			return nil, fmt.Errorf("column %s of the outer query cannot be used in GROUP BY", col.Name)
+		}
+	}
+
+	if stmt.Having != nil {
+		if HasWindow(stmt.Having.Expr) {
+			return nil, fmt.Errorf("window functions are not allowed in HAVING")
+		}
+
+		if err := v.validatePredicate(sc, stmt.Having.Expr); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, o := range stmt.OrderBy {
+		if _, err := v.validateExpr(sc, o.Expr); err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.IsAggregated() {
+		if err := validateGrouping(sc, stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	return cols, nil
+}
+
+// validateSubquery validates the subquery in the scope of the outer query, and returns the types of
+// the result columns. When single is true, the subquery must return a single column.
+func (v *validator) validateSubquery(sc *scope, sq *Subquery, single bool) ([]schema.ColumnType, error) {
+	cols, err := v.validateQuery(&scope{outer: sc, sub: sq, ctes: sc.ctes}, sq.Select)
+	if err != nil {
+		return nil, err
+	}
+
+	if single && len(cols) != 1 {
+		return nil, fmt.Errorf("subquery must return only one column")
+	}
+
+	types := make([]schema.ColumnType, len(cols))
+	for i, col := range cols {
+		types[i] = col.Type
+	}
+
+	return types, nil
+}
+
+// validateGrouping checks every column referred after the grouping is in GROUP BY clause.
+// Other columns can be used only as the arguments of the aggregate functions.
+func validateGrouping(sc *scope, stmt *SelectStatement) error {
+	// grouped holds the columns in GROUP BY as "table.column"
+	grouped := map[string]bool{}
+	for _, g := range stmt.GroupBy {
+		st, colDef, _ := sc.findColumn(g.(*ColName))
+		grouped[st.name+"."+colDef.Name] = true
+	}
+
+	exprs := []Expr{}
+	for _, se := range stmt.SelectExprs {
+		switch s := se.(type) {
+		case *StarExpr:
+			return fmt.Errorf("* cannot be selected with GROUP BY or aggregate functions")
+		case *AliasedExpr:
+			exprs = append(exprs, s.Expr)
+		}
+	}
+
+	if stmt.Having != nil {
+		exprs = append(exprs, stmt.Having.Expr)
+	}
+
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+
+	for _, expr := range exprs {
+		if err := validateGrouped(sc, expr, grouped); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateGrouped(sc *scope, expr Expr, grouped map[string]bool) error {
+	switch e := expr.(type) {
+	case *ColName:
+		// the column of the outer query is a constant in the group
+		st, colDef, _ := sc.findColumn(e)
+		if sc.owns(st) && !grouped[st.name+"."+colDef.Name] {
+			return fmt.Errorf("column %s must appear in the GROUP BY clause or be used in an aggregate function", e.Name)
+		}
+	case *Subquery:
+		for _, c := range e.Outer {
+			if err := validateGrouped(sc, c, grouped); err != nil {
+				return err
+			}
+		}
+	case *ExistsExpr:
+		return validateGrouped(sc, e.Subquery, grouped)
+	case *FuncExpr:
+		if e.IsAggregate() {
+			return nil
+		}
+		for _, arg := range e.Args {
+			if err := validateGrouped(sc, arg, grouped); err != nil {
+				return err
+			}
+		}
+		if e.Over != nil {
+			for _, p := range e.Over.PartitionBy {
+				if err := validateGrouped(sc, p, grouped); err != nil {
+					return err
+				}
+			}
+			for _, o := range e.Over.OrderBy {
+				if err := validateGrouped(sc, o.Expr, grouped); err != nil {
+					return err
+				}
+			}
+		}
+	case *AndExpr:
+		if err := validateGrouped(sc, e.Left, grouped); err != nil {
+			return err
+		}
+		return validateGrouped(sc, e.Right, grouped)
+	case *OrExpr:
+		if err := validateGrouped(sc, e.Left, grouped); err != nil {
+			return err
+		}
+		return validateGrouped(sc, e.Right, grouped)
+	case *NotExpr:
+		return validateGrouped(sc, e.Operand, grouped)
+	case *IsNullExpr:
+		return validateGrouped(sc, e.Operand, grouped)
+	case *ComparisonExpr:
+		if err := validateGrouped(sc, e.Left, grouped); err != nil {
+			return err
+		}
+		return validateGrouped(sc, e.Right, grouped)
+	case *BinaryExpr:
+		if err := validateGrouped(sc, e.Left, grouped); err != nil {
+			return err
+		}
+		return validateGrouped(sc, e.Right, grouped)
+	case *UnaryMinusExpr:
+		return validateGrouped(sc, e.Operand, grouped)
+	case *InExpr:
+		for _, val := range e.Values {
+			if err := validateGrouped(sc, val, grouped); err != nil {
+				return err
+			}
+		}
+		if e.Subquery != nil {
+			if err := validateGrouped(sc, e.Subquery, grouped); err != nil {
+				return err
+			}
+		}
+		return validateGrouped(sc, e.Operand, grouped)
+	case *LikeExpr:
+		if err := validateGrouped(sc, e.Operand, grouped); err != nil {
+			return err
+		}
+		return validateGrouped(sc, e.Pattern, grouped)
+	case *CaseExpr:
+		for _, w := range e.Whens {
+			if err := validateGrouped(sc, w.Cond, grouped); err != nil {
+				return err
+			}
+			if err := validateGrouped(sc, w.Result, grouped); err != nil {
+				return err
+			}
+		}
+		if e.Operand != nil {
+			if err := validateGrouped(sc, e.Operand, grouped); err != nil {
+				return err
+			}
+		}
+		if e.Else != nil {
+			return validateGrouped(sc, e.Else, grouped)
+		}
+	}
+
+	return nil
+}
+
+// countColumns returns the number of the columns of the name in the table.
+func countColumns(table *schema.Table, name string) int {
+	n := 0
+	for _, colDef := range table.Columns {
+		if colDef.Name == strings.ToLower(name) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func findColumnDef(table *schema.Table, name string) *schema.ColumnDef {
+	for _, colDef := range table.Columns {
+		if colDef.Name == strings.ToLower(name) {
+			return colDef
+		}
+	}
+
+	return nil
+}
+
+// validateExpr checks the columns in the expression exist in the table and the operands of
+// the comparisons are comparable. It returns the type of the expression.
+// The type of literal and NULL is 0 because it is decided by the context.
+func (v *validator) validateExpr(sc *scope, expr Expr) (schema.ColumnType, error) {
+	switch e := expr.(type) {
+	case *ColName:
+		_, colDef, err := sc.findColumn(e)
+		if err != nil {
+			return 0, err
+		}
+		return colDef.Type, nil
+	case *Value, *NullVal:
+		return 0, nil
+	case *AndExpr:
+		if err := v.validatePredicate(sc, e.Left); err != nil {
+			return 0, err
+		}
+		return schema.ColumnTypeBool, v.validatePredicate(sc, e.Right)
+	case *OrExpr:
+		if err := v.validatePredicate(sc, e.Left); err != nil {
+			return 0, err
+		}
+		return schema.ColumnTypeBool, v.validatePredicate(sc, e.Right)
+	case *NotExpr:
+		return schema.ColumnTypeBool, v.validatePredicate(sc, e.Operand)
+	case *IsNullExpr:
+		_, err := v.validateExpr(sc, e.Operand)
+		return schema.ColumnTypeBool, err
+	case *ComparisonExpr:
+		return schema.ColumnTypeBool, v.validateComparison(sc, e.Left, e.Right)
+	case *InExpr:
+		if e.Subquery != nil {
+			types, err := v.validateSubquery(sc, e.Subquery, true)
+			if err != nil {
+				return 0, err
+			}
+
+			typ, err := v.validateExpr(sc, e.Operand)
+			if err != nil {
+				return 0, err
+			}
+			if err := validateComparable(types[0], e.Operand); err != nil {
+				return 0, err
+			}
+			if typ != 0 && types[0] != 0 && !comparableTypes(typ, types[0]) {
+				return 0, fmt.Errorf("%s and %s cannot be compared", typ, types[0])
+			}
+			return schema.ColumnTypeBool, nil
+		}
+
+		for _, val := range e.Values {
+			if err := v.validateComparison(sc, e.Operand, val); err != nil {
+				return 0, err
+			}
+		}
+		return schema.ColumnTypeBool, nil
+	case *Subquery:
+		types, err := v.validateSubquery(sc, e, true)
+		if err != nil {
+			return 0, err
+		}
+		return types[0], nil
+	case *ExistsExpr:
+		_, err := v.validateSubquery(sc, e.Subquery, false)
+		return schema.ColumnTypeBool, err
+	case *LikeExpr:
+		for _, operand := range []Expr{e.Operand, e.Pattern} {
+			typ, err := v.validateOperand(sc, operand)
+			if err != nil {
+				return 0, err
+			}
+			if typ != 0 && typ != schema.ColumnTypeString {
+				return 0, fmt.Errorf("LIKE cannot be applied to %s", typ)
+			}
+		}
+		return schema.ColumnTypeBool, nil
+	case *CaseExpr:
+		return v.validateCase(sc, e)
+	case *BinaryExpr:
+		return v.validateBinary(sc, e)
+	case *UnaryMinusExpr:
+		typ, err := v.validateOperand(sc, e.Operand)
+		if err != nil {
+			return 0, err
+		}
+		if typ != 0 && !isNumber(typ) {
+			return 0, fmt.Errorf("- cannot be applied to %s", typ)
+		}
+		return typ, nil
+	case *FuncExpr:
+		switch {
+		case e.Over != nil:
+			return v.validateWindow(sc, e)
+		case windowFuncs[e.Name]:
+			return 0, fmt.Errorf("window function %s requires an OVER clause", e.Name)
+		case e.IsAggregate():
+			return v.validateAggregate(sc, e)
+		}
+		return v.validateFunc(sc, e)
+	}
+
+	return 0, fmt.Errorf("unexpected expression %T", expr)
+}
+
+// validateComparison checks the two operands can be compared.
+func (v *validator) validateComparison(sc *scope, left, right Expr) error {
+	lt, err := v.validateExpr(sc, left)
+	if err != nil {
+		return err
+	}
+
+	rt, err := v.validateExpr(sc, right)
+	if err != nil {
+		return err
+	}
+
+	if err := validateComparable(lt, right); err != nil {
+		return err
+	}
+
+	if err := validateComparable(rt, left); err != nil {
+		return err
+	}
+
+	if lt != 0 && rt != 0 && !comparableTypes(lt, rt) {
+		return fmt.Errorf("%s and %s cannot be compared", lt, rt)
+	}
+
+	return nil
+}
+
+// validateCase checks the conditions and the results of CASE and returns the result type.
+// Each condition must be boolean, or comparable with the operand when it is given.
+func (v *validator) validateCase(sc *scope, e *CaseExpr) (schema.ColumnType, error) {
+	results := []Expr{}
+	for _, w := range e.Whens {
+		if e.Operand != nil {
+			if err := v.validateComparison(sc, e.Operand, w.Cond); err != nil {
+				return 0, err
+			}
+		} else if err := v.validatePredicate(sc, w.Cond); err != nil {
+			return 0, err
+		}
+		results = append(results, w.Result)
+	}
+	if e.Else != nil {
+		results = append(results, e.Else)
+	}
+
+	types := make([]schema.ColumnType, len(results))
+	for i, result := range results {
+		typ, err := v.validateOperand(sc, result)
+		if err != nil {
+			return 0, err
+		}
+		types[i] = typ
+	}
+
+	return commonType("results of CASE", types)
+}
+
+// validateOperand is validateExpr for the operand of the operator or the argument of the function.
+// The type of the literal is inferred from the literal itself because the operator does not decide it.
+func (v *validator) validateOperand(sc *scope, expr Expr) (schema.ColumnType, error) {
+	if val, ok := expr.(*Value); ok {
+		return literalType(val.Val), nil
+	}
+
+	return v.validateExpr(sc, expr)
+}
+
+// literalType returns the type of the literal. It is an int64, float64, bool, or string in this order.
+func literalType(val string) schema.ColumnType {
+	if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return schema.ColumnTypeInt64
+	}
+
+	if _, err := strconv.ParseFloat(val, 64); err == nil {
+		return schema.ColumnTypeFloat64
+	}
+
+	switch strings.ToLower(val) {
+	case "true", "false":
+		return schema.ColumnTypeBool
+	}
+
+	return schema.ColumnTypeString
+}
+
+var binaryOperators = map[OperatorType]string{Op_ADD: "+", Op_SUB: "-", Op_MUL: "*", Op_DIV: "/", Op_MOD: "%", Op_CONCAT: "||"}
+
+// validateBinary checks the operands and returns the result type.
+// Concatenation is string. Arithmetic is int64 when both operands are int64, otherwise float64.
+func (v *validator) validateBinary(sc *scope, e *BinaryExpr) (schema.ColumnType, error) {
+	lt, err := v.validateOperand(sc, e.Left)
+	if err != nil {
+		return 0, err
+	}
+
+	rt, err := v.validateOperand(sc, e.Right)
+	if err != nil {
+		return 0, err
+	}
+
+	op := binaryOperators[e.Operator]
+	for _, typ := range []schema.ColumnType{lt, rt} {
+		if typ == 0 { // NULL
+			continue
+		}
+
+		if e.Operator == Op_CONCAT && typ == schema.ColumnTypeBytes || e.Operator != Op_CONCAT && !isNumber(typ) {
+			return 0, fmt.Errorf("%s cannot be applied to %s", op, typ)
+		}
+	}
+
+	switch {
+	case e.Operator == Op_CONCAT:
+		return schema.ColumnTypeString, nil
+	case lt == schema.ColumnTypeFloat64 || rt == schema.ColumnTypeFloat64:
+		return schema.ColumnTypeFloat64, nil
+	case lt == 0 && rt == 0:
+		return 0, nil
+	}
+
+	return schema.ColumnTypeInt64, nil
+}
+
+// truncFields are the fields date_trunc accepts, and extractFields are the ones extract accepts.
+var (
+	truncFields   = map[string]bool{"year": true, "quarter": true, "month": true, "week": true, "day": true, "hour": true, "minute": true, "second": true}
+	extractFields = map[string]bool{"year": true, "quarter": true, "month": true, "week": true, "day": true, "hour": true, "minute": true, "second": true, "dow": true, "doy": true, "epoch": true}
+)
+
+// validateFunc checks the arguments of the scalar function and returns the result type.
+func (v *validator) validateFunc(sc *scope, f *FuncExpr) (schema.ColumnType, error) {
+	if f.Star {
+		return 0, fmt.Errorf("%s(*) is not supported", f.Name)
+	}
+
+	types := make([]schema.ColumnType, len(f.Args))
+	for i, arg := range f.Args {
+		typ, err := v.validateOperand(sc, arg)
+		if err != nil {
+			return 0, err
+		}
+		types[i] = typ
+	}
+
+	// args checks the number of the arguments and their types. Each of want is the allowed types of the argument.
+	// NULL is allowed for any argument.
+	args := func(want ...[]schema.ColumnType) error {
+		if len(types) != len(want) {
+			return fmt.Errorf("%s takes %d arguments but got %d", f.Name, len(want), len(types))
+		}
+
+		for i, typ := range types {
+			if typ == 0 {
+				continue
+			}
+
+			allowed := false
+			for _, w := range want[i] {
+				allowed = allowed || typ == w
+			}
+			if !allowed {
+				return fmt.Errorf("argument %d of %s cannot be %s", i+1, f.Name, typ)
+			}
+		}
+
+		return nil
+	}
+
+	str := []schema.ColumnType{schema.ColumnTypeString}
+	integer := []schema.ColumnType{schema.ColumnTypeInt64}
+	number := []schema.ColumnType{schema.ColumnTypeInt64, schema.ColumnTypeFloat64}
+	timestamp := []schema.ColumnType{schema.ColumnTypeTimestamp}
+
+	switch f.Name {
+	case "lower", "upper":
+		return schema.ColumnTypeString, args(str)
+	case "length":
+		return schema.ColumnTypeInt64, args([]schema.ColumnType{schema.ColumnTypeString, schema.ColumnTypeBytes})
+	case "substr":
+		if len(types) == 2 {
+			return schema.ColumnTypeString, args(str, integer)
+		}
+		return schema.ColumnTypeString, args(str, integer, integer)
+	case "abs", "round":
+		want := [][]schema.ColumnType{number}
+		if f.Name == "round" && len(types) == 2 {
+			want = append(want, integer)
+		}
+		if err := args(want...); err != nil {
+			return 0, err
+		}
+		return types[0], nil
+	case "coalesce":
+		if len(types) == 0 {
+			return 0, fmt.Errorf("coalesce takes at least 1 argument")
+		}
+		return commonType("arguments of coalesce", types)
+	case "now":
+		return schema.ColumnTypeTimestamp, args()
+	case "date_trunc", "extract":
+		if err := args(str, timestamp); err != nil {
+			return 0, err
+		}
+
+		fields, typ := truncFields, schema.ColumnTypeTimestamp
+		if f.Name == "extract" {
+			fields, typ = extractFields, schema.ColumnTypeInt64
+		}
+
+		field, ok := f.Args[0].(*Value)
+		if !ok || !fields[strings.ToLower(field.Val)] {
+			return 0, fmt.Errorf("field of %s must be one of %s", f.Name, fieldNames(fields))
+		}
+		return typ, nil
+	}
+
+	return 0, fmt.Errorf("unknown function %s", f.Name)
+}
+
+// commonType returns the result type of coalesce or CASE. Every type must be the same, though int64
+// and float64 can be mixed and the result is float64. what names the values in the error.
+func commonType(what string, types []schema.ColumnType) (schema.ColumnType, error) {
+	result := schema.ColumnType(0)
+	for _, typ := range types {
+		switch {
+		case typ == 0:
+			continue
+		case result == 0:
+			result = typ
+		case !comparableTypes(result, typ):
+			return 0, fmt.Errorf("%s must be the same type but got %s and %s", what, result, typ)
+		case typ == schema.ColumnTypeFloat64:
+			result = typ
+		}
+	}
+
+	return result, nil
+}
+
+func fieldNames(fields map[string]bool) string {
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// validateAggregate checks the argument of the aggregate function and returns the result type.
+// COUNT is int64 and AVG is float64. SUM, MIN and MAX are the same type as the argument.
+func (v *validator) validateAggregate(sc *scope, f *FuncExpr) (schema.ColumnType, error) {
+	if f.Star {
+		if f.Name != "count" {
+			return 0, fmt.Errorf("%s(*) is not supported", f.Name)
+		}
+		return schema.ColumnTypeInt64, nil
+	}
+
+	if len(f.Args) != 1 {
+		return 0, fmt.Errorf("%s takes exactly 1 argument", f.Name)
+	}
+
+	arg := f.Args[0]
+	if HasAggregate(arg) {
+		return 0, fmt.Errorf("aggregate function calls cannot be nested")
+	}
+	col, ok := arg.(*ColName)
+	if !ok {
+		return 0, fmt.Errorf("argument of %s must be a column", f.Name)
+	}
+	if st, _, err := sc.findColumn(col); err == nil && !sc.owns(st) {
+		return 0, fmt.Errorf("argument of %s must be a column in FROM clause", f.Name)
+	}
+
+	typ, err := v.validateExpr(sc, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	return aggregateType(f.Name, typ)
+}
+
+// aggregateType returns the result type of the aggregate function of the argument type.
+func aggregateType(name string, typ schema.ColumnType) (schema.ColumnType, error) {
+	if name == "count" {
+		return schema.ColumnTypeInt64, nil
+	}
+
+	switch name {
+	case "sum", "avg":
+		if typ != schema.ColumnTypeInt64 && typ != schema.ColumnTypeFloat64 {
+			return 0, fmt.Errorf("%s cannot be applied to %s", name, typ)
+		}
+		if name == "avg" {
+			return schema.ColumnTypeFloat64, nil
+		}
+	case "min", "max":
+		if typ == schema.ColumnTypeBool || typ == schema.ColumnTypeBytes {
+			return 0, fmt.Errorf("%s cannot be applied to %s", name, typ)
+		}
+	}
+
+	return typ, nil
+}
+
+// validateWindow validates the window function call and returns the result type.
+// The arguments and the window are computed after the grouping, so they can contain aggregate functions.
+func (v *validator) validateWindow(sc *scope, f *FuncExpr) (schema.ColumnType, error) {
+	exprs := append([]Expr{}, f.Args...)
+	exprs = append(exprs, f.Over.PartitionBy...)
+	for _, o := range f.Over.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+	for _, expr := range exprs {
+		if HasWindow(expr) {
+			return 0, fmt.Errorf("window function calls cannot be nested")
+		}
+		if _, err := v.validateOperand(sc, expr); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := validateFrame(f.Over.Frame); err != nil {
+		return 0, err
+	}
+
+	switch f.Name {
+	case "row_number", "rank", "dense_rank":
+		if f.Star || len(f.Args) != 0 {
+			return 0, fmt.Errorf("%s takes no arguments", f.Name)
+		}
+		return schema.ColumnTypeInt64, nil
+	case "lag", "lead":
+		if f.Star || len(f.Args) == 0 || len(f.Args) > 3 {
+			return 0, fmt.Errorf("%s takes 1 to 3 arguments", f.Name)
+		}
+		typ, err := v.validateOperand(sc, f.Args[0])
+		if err != nil {
+			return 0, err
+		}
+		if len(f.Args) > 1 {
+			if val, ok := f.Args[1].(*Value); !ok || literalType(val.Val) != schema.ColumnTypeInt64 {
+				return 0, fmt.Errorf("offset of %s must be a non-negative integer", f.Name)
 			}
 		}
+		if len(f.Args) > 2 {
+			if err := validateComparable(typ, f.Args[2]); err != nil {
+				return 0, err
+			}
+			dt, _ := v.validateExpr(sc, f.Args[2])
+			if typ != 0 && dt != 0 && typ != dt {
+				return 0, fmt.Errorf("default value of %s must be %s but got %s", f.Name, typ, dt)
+			}
+		}
+		return typ, nil
+	}
+
+	if !aggregateFuncs[f.Name] {
+		return 0, fmt.Errorf("%s is not a window function", f.Name)
+	}
+
+	if f.Star {
+		if f.Name != "count" {
+			return 0, fmt.Errorf("%s(*) is not supported", f.Name)
+		}
+		return schema.ColumnTypeInt64, nil
+	}
+	if len(f.Args) != 1 {
+		return 0, fmt.Errorf("%s takes exactly 1 argument", f.Name)
+	}
+
+	typ, _ := v.validateOperand(sc, f.Args[0])
+	return aggregateType(f.Name, typ)
+}
+
+// validateFrame checks the frame does not start after its end, e.g. "ROWS BETWEEN CURRENT ROW AND 1 PRECEDING".
+func validateFrame(frame *WindowFrame) error {
+	if frame == nil {
+		return nil
+	}
+
+	if frame.Start.Type == FrameUnboundedFollowing {
+		return fmt.Errorf("frame start cannot be UNBOUNDED FOLLOWING")
+	}
+	if frame.End.Type == FrameUnboundedPreceding {
+		return fmt.Errorf("frame end cannot be UNBOUNDED PRECEDING")
+	}
+	if frame.Start.Type > frame.End.Type {
+		return fmt.Errorf("frame cannot start after its end")
+	}
+
+	return nil
+}
+
+// validatePredicate checks the expression is boolean.
+func (v *validator) validatePredicate(sc *scope, expr Expr) error {
+	typ, err := v.validateExpr(sc, expr)
+	if err != nil {
+		return err
+	}
+
+	if val, ok := expr.(*Value); ok {
+		switch strings.ToLower(val.Val) {
+		case "true", "false":
+			return nil
+		}
+		return fmt.Errorf("%s is not boolean", val.Val)
+	}
+
+	if typ != 0 && typ != schema.ColumnTypeBool {
+		return fmt.Errorf("boolean expression is expected but got %s", typ)
 	}
 
 	return nil
 }
 
-func (v *validator) validateSelectStmt(stmt *SelectStatement) error {
-	// TODO: write something
+// validateComparable checks the literal can be compared with the operand of the given type.
+// A quoted literal is compared with string, bytes, and timestamp, and the other literals
+// (numbers, true and false) are compared with the type of the literal.
+func validateComparable(typ schema.ColumnType, operand Expr) error {
+	val, ok := operand.(*Value)
+	if !ok || typ == 0 {
+		return nil
+	}
+
+	quotedType := typ == schema.ColumnTypeString || typ == schema.ColumnTypeBytes || typ == schema.ColumnTypeTimestamp
+	if val.Quoted != quotedType {
+		return fmt.Errorf("%v cannot be compared with %s", val.Val, typ)
+	}
+
+	if !val.Quoted && !comparableTypes(typ, literalType(val.Val)) {
+		return fmt.Errorf("%v cannot be compared with %s", val.Val, typ)
+	}
+
+	if _, err := schema.ConvertValue(val.Val, typ); err != nil {
+		return fmt.Errorf("%v cannot be compared with %s", val.Val, typ)
+	}
+
+	return nil
+}
+
+func comparableTypes(t1, t2 schema.ColumnType) bool {
+	if t1 == t2 {
+		return true
+	}
+
+	return isNumber(t1) && isNumber(t2)
+}
+
+func isNumber(t schema.ColumnType) bool {
+	return t == schema.ColumnTypeInt64 || t == schema.ColumnTypeFloat64
+}
+
+func (v *validator) validateAnalyzeStmt(stmt *AnalyzeStatement) error {
+	if stmt.Table != "" && !v.catalog.FindTable(stmt.Table) {
+		return fmt.Errorf("table %s does not exist", stmt.Table)
+	}
+
 	return nil
 }
 
@@ -132,8 +1481,12 @@ func (v *validator) validate() error {
 		return v.validateCreateTableStmt(s)
 	case *InsertStatement:
 		return v.validateInsertStmt(s)
-	case *SelectStatement:
+	case Query:
 		return v.validateSelectStmt(s)
+	case *AnalyzeStatement:
+		return v.validateAnalyzeStmt(s)
+	case *ExplainStatement:
+		return v.validateSelectStmt(s.Stmt)
 	default:
 		return fmt.Errorf("unexpected statement type")
 	}
@@ -128,6 +128,60 @@ func TestValidator_Validate_CreateTable(t *testing.T) {
 			catalog:   c,
 			wantError: true,
 		},
+		{
+			name: "default value type invalid",
+			stmt: &CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"id", "name", "verified", "registered"},
+				Types:         []string{"INT64", "STRING", "BOOL", "TIMESTAMP"},
+				PrimaryKeyCol: "id",
+				Defaults:      map[string]Expr{"verified": &Value{Val: "abc"}},
+			},
+			catalog:   c,
+			wantError: true,
+		},
+		{
+			name: "now() on non-timestamp column",
+			stmt: &CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"id", "name", "verified", "registered"},
+				Types:         []string{"INT64", "STRING", "BOOL", "TIMESTAMP"},
+				PrimaryKeyCol: "id",
+				Defaults:      map[string]Expr{"name": &FuncExpr{Name: "now"}},
+			},
+			catalog:   c,
+			wantError: true,
+		},
+		{
+			name: "default null on not null column",
+			stmt: &CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"id", "name", "verified", "registered"},
+				Types:         []string{"INT64", "STRING", "BOOL", "TIMESTAMP"},
+				PrimaryKeyCol: "id",
+				NotNullCols:   []string{"name"},
+				Defaults:      map[string]Expr{"name": &NullVal{}},
+			},
+			catalog:   c,
+			wantError: true,
+		},
+		{
+			name: "ok: default",
+			stmt: &CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"id", "name", "verified", "registered"},
+				Types:         []string{"INT64", "STRING", "BOOL", "TIMESTAMP"},
+				PrimaryKeyCol: "id",
+				NotNullCols:   []string{"verified"},
+				Defaults: map[string]Expr{
+					"name":       &NullVal{},
+					"verified":   &Value{Val: "false"},
+					"registered": &FuncExpr{Name: "now"},
+				},
+			},
+			catalog:   c,
+			wantError: false,
+		},
 		{
 			name: "ok",
 			stmt: &CreateTableStatement{
@@ -163,7 +217,7 @@ func TestValidator_Validate_Insert(t *testing.T) {
 					{
 						Name:    "name",
 						Type:    schema.ColumnTypeString,
-						Options: []schema.ColumnOption{},
+						Options: []schema.ColumnOption{schema.ColumnOptionNotNull},
 					},
 					{
 						Name:    "nickname",
@@ -180,9 +234,9 @@ func TestValidator_Validate_Insert(t *testing.T) {
 			},
 		},
 	}
-	tooManyRows := [][]string{}
+	manyRows := [][]Expr{}
 	for i := 1; i <= 1001; i++ {
-		tooManyRows = append(tooManyRows, []string{fmt.Sprintf("%d", i)})
+		manyRows = append(manyRows, []Expr{&Value{Val: fmt.Sprintf("%d", i)}, &Value{Val: "Arthur"}})
 	}
 	tests := []struct {
 		name      string
@@ -195,34 +249,34 @@ func TestValidator_Validate_Insert(t *testing.T) {
 			stmt: &InsertStatement{
 				Table:   "users",
 				Columns: []string{"nickname", "id", "name"},
-				Rows: [][]string{
-					{"Art", "1", "Arthur"},
-					{"Cliff", "3", "Clifford"},
-					{"Ed", "2", "Edgar"},
+				Rows: [][]Expr{
+					{&Value{Val: "Art"}, &Value{Val: "1"}, &Value{Val: "Arthur"}},
+					{&Value{Val: "Cliff"}, &Value{Val: "3"}, &Value{Val: "Clifford"}},
+					{&Value{Val: "Ed"}, &Value{Val: "2"}, &Value{Val: "Edgar"}},
 				},
 			},
 			catalog:   c,
 			wantError: true,
 		},
 		{
-			name: "too many rows",
+			name: "ok: more than 1000 rows",
 			stmt: &InsertStatement{
 				Table:   "students",
-				Columns: []string{"id"},
-				Rows:    tooManyRows,
+				Columns: []string{"id", "name"},
+				Rows:    manyRows,
 			},
 			catalog:   c,
-			wantError: true,
+			wantError: false,
 		},
 		{
 			name: "columns and rows length invalid",
 			stmt: &InsertStatement{
 				Table:   "students",
 				Columns: []string{"nickname", "id", "name"},
-				Rows: [][]string{
-					{"Art", "1", "Arthur"},
-					{"Cliff", "3", "Clifford"},
-					{"Ed", "2"}, // last column value missing
+				Rows: [][]Expr{
+					{&Value{Val: "Art"}, &Value{Val: "1"}, &Value{Val: "Arthur"}},
+					{&Value{Val: "Cliff"}, &Value{Val: "3"}, &Value{Val: "Clifford"}},
+					{&Value{Val: "Ed"}, &Value{Val: "2"}}, // last column value missing
 				},
 			},
 			catalog:   c,
@@ -233,24 +287,72 @@ func TestValidator_Validate_Insert(t *testing.T) {
 			stmt: &InsertStatement{
 				Table:   "students",
 				Columns: []string{"nickname", "id", "name"},
-				Rows: [][]string{
-					{"Art", "1", "Arthur"},
-					{"Cliff", "3", "Clifford"},
-					{"Ed", "a", "Edgar"}, // invalid id
+				Rows: [][]Expr{
+					{&Value{Val: "Art"}, &Value{Val: "1"}, &Value{Val: "Arthur"}},
+					{&Value{Val: "Cliff"}, &Value{Val: "3"}, &Value{Val: "Clifford"}},
+					{&Value{Val: "Ed"}, &Value{Val: "a"}, &Value{Val: "Edgar"}}, // invalid id
 				},
 			},
 			catalog:   c,
 			wantError: true,
 		},
+		{
+			name: "null on the primary key",
+			stmt: &InsertStatement{
+				Table:   "students",
+				Columns: []string{"nickname", "id", "name"},
+				Rows: [][]Expr{
+					{&Value{Val: "Art"}, &NullVal{}, &Value{Val: "Arthur"}},
+				},
+			},
+			catalog:   c,
+			wantError: true,
+		},
+		{
+			name: "primary key omitted",
+			stmt: &InsertStatement{
+				Table:   "students",
+				Columns: []string{"nickname", "name"},
+				Rows: [][]Expr{
+					{&Value{Val: "Art"}, &Value{Val: "Arthur"}},
+				},
+			},
+			catalog:   c,
+			wantError: true,
+		},
+		{
+			name: "null on the not null column",
+			stmt: &InsertStatement{
+				Table:   "students",
+				Columns: []string{"id", "name"},
+				Rows: [][]Expr{
+					{&Value{Val: "1"}, &NullVal{}},
+				},
+			},
+			catalog:   c,
+			wantError: true,
+		},
+		{
+			name: "ok: null",
+			stmt: &InsertStatement{
+				Table:   "students",
+				Columns: []string{"id", "name", "nickname"},
+				Rows: [][]Expr{
+					{&Value{Val: "1"}, &Value{Val: "Arthur"}, &NullVal{}},
+				},
+			},
+			catalog:   c,
+			wantError: false,
+		},
 		{
 			name: "ok",
 			stmt: &InsertStatement{
 				Table:   "students",
 				Columns: []string{"nickname", "id", "name"},
-				Rows: [][]string{
-					{"Art", "1", "Arthur"},
-					{"Cliff", "3", "Clifford"},
-					{"Ed", "2", "Edgar"},
+				Rows: [][]Expr{
+					{&Value{Val: "Art"}, &Value{Val: "1"}, &Value{Val: "Arthur"}},
+					{&Value{Val: "Cliff"}, &Value{Val: "3"}, &Value{Val: "Clifford"}},
+					{&Value{Val: "Ed"}, &Value{Val: "2"}, &Value{Val: "Edgar"}},
 				},
 			},
 			catalog:   c,
@@ -266,3 +368,325 @@ func TestValidator_Validate_Insert(t *testing.T) {
 		})
 	}
 }
+
+func TestValidator_Validate_InsertQuery(t *testing.T) {
+	c := &catalog.Catalog{
+		Tables: map[string]*schema.Table{
+			"users": {
+				Name: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString, Options: []schema.ColumnOption{schema.ColumnOptionNotNull}},
+					{Name: "score", Type: schema.ColumnTypeFloat64},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantError bool
+	}{
+		{name: "ok: select", query: `insert into users select id + 10, name, score from users where score > 1;`, wantError: false},
+		{name: "ok: int64 to float64", query: `insert into users (id, name, score) select id + 10, name, id from users;`, wantError: false},
+		{name: "ok: union", query: `insert into users (id, name) select id, name from users union select 100, "x" from users;`, wantError: false},
+		{name: "ok: expressions", query: `insert into users (id, name, score) values (1 + 2, upper("a") || "b", -1 * 2), (4, lower("B"), null);`, wantError: false},
+		{name: "query of different number of columns", query: `insert into users (id, name) select id from users;`, wantError: true},
+		{name: "query of unmatched type", query: `insert into users (id, name) select score, name from users;`, wantError: true},
+		{name: "invalid query", query: `insert into users (id, name) select id, age from users;`, wantError: true},
+		{name: "unmatched type of expression", query: `insert into users (id, name) values (1, 1 + 2);`, wantError: true},
+		{name: "column in values", query: `insert into users (id, name) values (1, name);`, wantError: true},
+		{name: "aggregate in values", query: `insert into users (id, name) values (count(*), "a");`, wantError: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			stmt, err := New(c).parse(test.query)
+			testutil.MustBeNil(t, err)
+
+			err = newValidator(stmt, c).validate()
+			testutil.MustEqual(t, err != nil, test.wantError)
+		})
+	}
+}
+
+func TestValidator_Validate_OnConflictReturning(t *testing.T) {
+	c := &catalog.Catalog{
+		Tables: map[string]*schema.Table{
+			"users": {
+				Name: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString, Options: []schema.ColumnOption{schema.ColumnOptionNotNull}},
+					{Name: "score", Type: schema.ColumnTypeFloat64},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantError bool
+	}{
+		{name: "ok: do nothing", query: `insert into users (id, name) values (1, "a") on conflict (id) do nothing;`, wantError: false},
+		{name: "ok: do nothing without target", query: `insert into users (id, name) values (1, "a") on conflict do nothing;`, wantError: false},
+		{name: "ok: do update", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set name = excluded.name, score = users.score + excluded.id;`, wantError: false},
+		{name: "ok: literal", query: `insert into users (id, name) select id + 10, name from users on conflict (id) do update set name = "b", score = null;`, wantError: false},
+		{name: "target is not the primary key", query: `insert into users (id, name) values (1, "a") on conflict (name) do nothing;`, wantError: true},
+		{name: "update the primary key", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set id = excluded.id + 1;`, wantError: true},
+		{name: "unknown column", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set age = 1;`, wantError: true},
+		{name: "assigned twice", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set name = "b", name = "c";`, wantError: true},
+		{name: "ambiguous column", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set name = name;`, wantError: true},
+		{name: "unmatched type", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set name = excluded.score;`, wantError: true},
+		{name: "not null", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set name = null;`, wantError: true},
+		{name: "aggregate", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set score = sum(excluded.score);`, wantError: true},
+		{name: "ok: returning", query: `insert into users (id, name) values (1, "a") returning *, users.*, id * 2 as double, upper(name);`, wantError: false},
+		{name: "returning unknown column", query: `insert into users (id, name) values (1, "a") returning age;`, wantError: true},
+		{name: "returning another table", query: `insert into users (id, name) values (1, "a") returning depts.*;`, wantError: true},
+		{name: "returning excluded", query: `insert into users (id, name) values (1, "a") on conflict (id) do update set name = "b" returning excluded.name;`, wantError: true},
+		{name: "aggregate in returning", query: `insert into users (id, name) values (1, "a") returning count(*);`, wantError: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			stmt, err := New(c).parse(test.query)
+			testutil.MustBeNil(t, err)
+
+			err = newValidator(stmt, c).validate()
+			testutil.MustEqual(t, err != nil, test.wantError)
+		})
+	}
+}
+
+func TestValidator_Validate_Select(t *testing.T) {
+	c := &catalog.Catalog{
+		Tables: map[string]*schema.Table{
+			"users": {
+				Name: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString},
+					{Name: "score", Type: schema.ColumnTypeFloat64},
+					{Name: "verified", Type: schema.ColumnTypeBool},
+					{Name: "dept_id", Type: schema.ColumnTypeInt64},
+					{Name: "registered", Type: schema.ColumnTypeTimestamp},
+				},
+			},
+			"depts": {
+				Name: "depts",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantError bool
+	}{
+		{name: "table not found", query: `select * from items`, wantError: true},
+		{name: "column not found", query: `select id, age from users`, wantError: true},
+		{name: "column in where not found", query: `select * from users where age = 1`, wantError: true},
+		{name: "column in order by not found", query: `select * from users order by age`, wantError: true},
+		{name: "invalid literal", query: `select * from users where id = "a"`, wantError: true},
+		{name: "quoted number for int64", query: `select * from users where id = "1"`, wantError: true},
+		{name: "number for string", query: `select * from users where name = 1`, wantError: true},
+		{name: "number for string on the left", query: `select * from users where 1 = name`, wantError: true},
+		{name: "boolean for string", query: `select * from users where name = true`, wantError: true},
+		{name: "number for bool", query: `select * from users where verified = 1`, wantError: true},
+		{name: "number for timestamp", query: `select * from users where registered > 1`, wantError: true},
+		{name: "number in list for string", query: `select * from users where name in ("a", 1)`, wantError: true},
+		{name: "ok: literals of the column types", query: `select * from users where name = "1" and id = 1 and score > 1 and verified = true and registered > "2021-05-01"`, wantError: false},
+		{name: "incomparable columns", query: `select * from users where id = name`, wantError: true},
+		{name: "non boolean where", query: `select * from users where id`, wantError: true},
+		{name: "non boolean operand", query: `select * from users where verified and name`, wantError: true},
+		{name: "ok: boolean column", query: `select * from users where verified and not id = 1`, wantError: false},
+		{name: "ok: number columns", query: `select * from users where id < score or score is null`, wantError: false},
+		{name: "ok", query: `select id, name from users where (id >= 1 and name = "bob") or id = null order by id`, wantError: false},
+		{name: "unknown function", query: `select foo(id) from users`, wantError: true},
+		{name: "sum of string", query: `select sum(name) from users`, wantError: true},
+		{name: "star on sum", query: `select sum(*) from users`, wantError: true},
+		{name: "too many arguments", query: `select max(id, score) from users`, wantError: true},
+		{name: "nested aggregate", query: `select max(count(id)) from users`, wantError: true},
+		{name: "aggregate in where", query: `select id from users where count(*) > 1`, wantError: true},
+		{name: "expression in group by", query: `select count(*) from users group by id = 1`, wantError: true},
+		{name: "non grouped column", query: `select id, count(*) from users group by name`, wantError: true},
+		{name: "non grouped column in having", query: `select name from users group by name having id > 1`, wantError: true},
+		{name: "non grouped column in order by", query: `select name from users group by name order by id`, wantError: true},
+		{name: "star with group by", query: `select * from users group by id`, wantError: true},
+		{name: "non boolean having", query: `select name from users group by name having count(*)`, wantError: true},
+		{name: "ok: aggregates without group by", query: `select count(*), count(name), sum(score), avg(id), min(name), max(score) from users`, wantError: false},
+		{name: "ok: group by", query: `select name, count(*) as c from users where id > 1 group by name having sum(score) > 1.5 and name is not null order by max(id) desc, name`, wantError: false},
+		{name: "ambiguous column", query: `select name from users join depts on dept_id = depts.id`, wantError: true},
+		{name: "unknown qualifier", query: `select u.name from users join depts on users.dept_id = depts.id`, wantError: true},
+		{name: "qualifier hidden by alias", query: `select users.name from users as u join depts on u.dept_id = depts.id`, wantError: true},
+		{name: "duplicate table name", query: `select * from users join users on users.id = users.id`, wantError: true},
+		{name: "column not found in join condition", query: `select * from users join depts on users.dept = depts.id`, wantError: true},
+		{name: "star of unknown table", query: `select t.* from users join depts on users.dept_id = depts.id`, wantError: true},
+		{name: "non boolean join condition", query: `select * from users join depts on users.id`, wantError: true},
+		{name: "aggregate in join condition", query: `select * from users join depts on count(*) > 1`, wantError: true},
+		{name: "ok: join", query: `select u.name, d.name, score from users u left join depts as d on u.dept_id = d.id and d.name is not null order by d.id`, wantError: false},
+		{name: "ok: self join", query: `select a.id, b.id from users a join users b on a.id < b.id`, wantError: false},
+		{name: "ok: join with group by", query: `select d.name, count(*) from users join depts d on users.dept_id = d.id group by d.name having max(users.score) > 1`, wantError: false},
+		{name: "ok: arithmetic", query: `select id * 2 + score, -score, id % 3 from users where id / 2 > 1`, wantError: false},
+		{name: "arithmetic on string", query: `select name + 1 from users`, wantError: true},
+		{name: "arithmetic with string literal", query: `select id - "a" from users`, wantError: true},
+		{name: "unary minus on string", query: `select -name from users`, wantError: true},
+		{name: "ok: concatenation", query: `select name || "-" || id from users where name || "a" = "boba"`, wantError: false},
+		{name: "incomparable expression", query: `select * from users where id + 1 = "a"`, wantError: true},
+		{name: "ok: functions", query: `select lower(name), upper(name), length(name), substr(name, 2), substr(name, 1, 2), abs(score), round(score, 1), coalesce(score, id, 0), now() from users`, wantError: false},
+		{name: "ok: date functions", query: `select date_trunc("month", registered), extract(dow from registered) from users where date_trunc("day", registered) = "2021-05-01"`, wantError: false},
+		{name: "function argument type", query: `select lower(id) from users`, wantError: true},
+		{name: "function argument count", query: `select substr(name) from users`, wantError: true},
+		{name: "no argument for abs", query: `select abs() from users`, wantError: true},
+		{name: "coalesce of different types", query: `select coalesce(name, id) from users`, wantError: true},
+		{name: "unknown date field", query: `select date_trunc("fortnight", registered) from users`, wantError: true},
+		{name: "non literal date field", query: `select extract(name from registered) from users`, wantError: true},
+		{name: "ok: expression of aggregates", query: `select name, sum(score) / count(*) + 1 from users group by name having round(avg(score)) > 1`, wantError: false},
+		{name: "non grouped column in expression", query: `select id + 1, count(*) from users group by name`, wantError: true},
+		{name: "ok: in, between and like", query: `select * from users where id in (1, 2, null) and score between 1 and 2.5 and name not like "a%"`, wantError: false},
+		{name: "in with incomparable value", query: `select * from users where id in (1, "a")`, wantError: true},
+		{name: "between with incomparable value", query: `select * from users where registered between "2021-01-01" and 1`, wantError: true},
+		{name: "like of non string", query: `select * from users where id like "1%"`, wantError: true},
+		{name: "ok: case", query: `select case when score > 1 then id else score end, case dept_id when 1 then "a" end from users`, wantError: false},
+		{name: "case with non boolean condition", query: `select case when name then 1 end from users`, wantError: true},
+		{name: "case with incomparable operand", query: `select case name when id then 1 end from users`, wantError: true},
+		{name: "case of different types", query: `select case when verified then name else id end from users`, wantError: true},
+		{name: "ok: case of aggregates", query: `select name, case when count(*) > 1 then "many" else "one" end from users group by name`, wantError: false},
+		{name: "non grouped column in case", query: `select case when id > 1 then 1 end, count(*) from users group by name`, wantError: true},
+		{name: "ok: subqueries", query: `select id, (select max(id) from depts) from users where dept_id in (select id from depts) and exists (select * from depts)`, wantError: false},
+		{name: "ok: correlated subquery", query: `select name from users u where exists (select * from depts d where d.id = u.dept_id and d.name = name)`, wantError: false},
+		{name: "column not found in subquery", query: `select * from users where exists (select * from depts where age = 1)`, wantError: true},
+		{name: "scalar subquery of many columns", query: `select (select id, name from depts) from users`, wantError: true},
+		{name: "in subquery of many columns", query: `select * from users where id in (select * from depts)`, wantError: true},
+		{name: "in subquery of incomparable column", query: `select * from users where id in (select name from depts)`, wantError: true},
+		{name: "ok: subquery of aggregates", query: `select dept_id, (select name from depts where id = dept_id) from users group by dept_id`, wantError: false},
+		{name: "non grouped column in subquery", query: `select dept_id, (select name from depts where depts.id = users.id) from users group by dept_id`, wantError: true},
+		{name: "outer column in group by", query: `select * from users where exists (select count(*) from depts group by dept_id)`, wantError: true},
+		{name: "outer column in aggregate", query: `select * from users where exists (select sum(score) from depts)`, wantError: true},
+		{name: "ok: derived table", query: `select t.n, d.name from (select dept_id, count(*) as n from users group by dept_id) t join depts d on t.dept_id = d.id where t.n > 1`, wantError: false},
+		{name: "ok: renamed derived table", query: `select a, b from (select id, name from users) as t (a, b) where b = "bob"`, wantError: false},
+		{name: "unnamed column of derived table", query: `select t.count from (select count(*) from users) t`, wantError: true},
+		{name: "column of derived table renamed", query: `select id from (select id from users) t (a)`, wantError: true},
+		{name: "too many column names of derived table", query: `select * from (select id from users) t (a, b)`, wantError: true},
+		{name: "ambiguous column of derived table", query: `select id from (select users.id, depts.id from users join depts on users.dept_id = depts.id) t`, wantError: true},
+		{name: "outer column in derived table", query: `select * from users u where exists (select * from (select * from depts where id = u.dept_id) t)`, wantError: true},
+		{name: "incomparable column of derived table", query: `select * from (select id, name from users) t where name = id`, wantError: true},
+		{name: "ok: with", query: `with a as (select id, name from users), b (x) as (select id from a where name = "bob") select * from b join depts on b.x = depts.id where x in (select id from a)`, wantError: false},
+		{name: "ok: with hides table", query: `with users as (select id from depts) select id from users`, wantError: false},
+		{name: "ok: with in subquery", query: `select * from users where id in (with a as (select id from depts) select id from a)`, wantError: false},
+		{name: "with refers to itself", query: `with a as (select id from a) select * from a`, wantError: true},
+		{name: "with refers to later one", query: `with a as (select id from b), b as (select id from users) select * from a`, wantError: true},
+		{name: "duplicate with name", query: `with a as (select id from users), a as (select id from depts) select * from a`, wantError: true},
+		{name: "column not found in with", query: `with a as (select id from users) select name from a`, wantError: true},
+		{name: "with out of scope", query: `select * from users where exists (with a as (select id from depts) select * from a) and id in (select id from a)`, wantError: true},
+		{name: "ok: union", query: `select id, name from users union all select id, name from depts order by name desc limit 3`, wantError: false},
+		{name: "ok: union of int64 and float64", query: `select id from users intersect select score from users except select 1 from depts`, wantError: false},
+		{name: "ok: correlated union", query: `select * from depts d where exists (select id from users where dept_id = d.id union select id from users where id = d.id)`, wantError: false},
+		{name: "ok: union in derived table", query: `select t.name from (select name from users union select name from depts) t where t.name <> "hr"`, wantError: false},
+		{name: "union of different number of columns", query: `select id, name from users union select id from depts`, wantError: true},
+		{name: "union of unmatched types", query: `select id from users union select name from depts`, wantError: true},
+		{name: "union of unmatched literal", query: `select registered from users union select "a" from depts`, wantError: true},
+		{name: "invalid union side", query: `select id from users union select age from depts`, wantError: true},
+		{name: "union sides share from", query: `select id from users union select users.name from depts`, wantError: true},
+		{name: "order by qualified column of union", query: `select id from users union select id from depts order by users.id`, wantError: true},
+		{name: "order by right column of union", query: `select id as x from users union select id from depts order by id`, wantError: true},
+		{name: "order by expression of union", query: `select id from users union select id from depts order by id + 1`, wantError: true},
+		{name: "ok: window functions", query: `select id, row_number() over (), rank() over (partition by dept_id order by score desc), lag(name, 2, "none") over (order by id) from users`, wantError: false},
+		{name: "ok: running sum", query: `select sum(score) over (order by id rows between 2 preceding and current row) from users order by avg(score) over (partition by dept_id)`, wantError: false},
+		{name: "ok: window of aggregates", query: `select dept_id, rank() over (order by count(*) desc) from users group by dept_id`, wantError: false},
+		{name: "window function without over", query: `select row_number() from users`, wantError: true},
+		{name: "window function in where", query: `select id from users where row_number() over () = 1`, wantError: true},
+		{name: "window function in having", query: `select dept_id from users group by dept_id having rank() over () = 1`, wantError: true},
+		{name: "nested window function", query: `select sum(rank() over ()) over () from users`, wantError: true},
+		{name: "non grouped column in window", query: `select dept_id, rank() over (order by id) from users group by dept_id`, wantError: true},
+		{name: "arguments of rank", query: `select rank(id) over () from users`, wantError: true},
+		{name: "non integer offset of lag", query: `select lag(id, 1.5) over () from users`, wantError: true},
+		{name: "unmatched default of lead", query: `select lead(id, 1, "x") over () from users`, wantError: true},
+		{name: "not a window function", query: `select lower(name) over () from users`, wantError: true},
+		{name: "frame starts after its end", query: `select sum(id) over (rows between current row and 1 preceding) from users`, wantError: true},
+		{name: "explain of invalid select", query: `explain select * from items`, wantError: true},
+		{name: "ok: explain analyze", query: `explain analyze select id from users where id > 1`, wantError: false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			stmt, err := New(c).parse(test.query)
+			testutil.MustBeNil(t, err)
+
+			err = newValidator(stmt, c).validate()
+			testutil.MustEqual(t, err != nil, test.wantError)
+		})
+	}
+}
+
+func TestValidator_Validate_Subquery(t *testing.T) {
+	c := &catalog.Catalog{
+		Tables: map[string]*schema.Table{
+			"users": {
+				Name: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64},
+					{Name: "dept_id", Type: schema.ColumnTypeInt64},
+				},
+			},
+			"depts": {
+				Name: "depts",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64},
+					{Name: "name", Type: schema.ColumnTypeString},
+				},
+			},
+		},
+	}
+
+	stmt, err := New(c).parse(`select * from users where exists (select * from depts where id = dept_id and name in (select name from depts where id = users.id))`)
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, newValidator(stmt, c).validate())
+
+	// the columns of the outer query are recorded in every subquery between the query and the column
+	exists := stmt.(*SelectStatement).Where.Expr.(*ExistsExpr)
+	in := exists.Subquery.Select.(*SelectStatement).Where.Expr.(*AndExpr).Right.(*InExpr)
+	testutil.MustEqual(t, exists.Subquery.Outer, []*ColName{{Name: "dept_id"}, {Name: "id", Qualifier: "users"}})
+	testutil.MustEqual(t, in.Subquery.Outer, []*ColName{{Name: "id", Qualifier: "users"}})
+}
+
+func TestValidator_Validate_With(t *testing.T) {
+	c := &catalog.Catalog{
+		Tables: map[string]*schema.Table{
+			"users": {
+				Name: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64},
+					{Name: "name", Type: schema.ColumnTypeString},
+				},
+			},
+		},
+	}
+
+	stmt, err := New(c).parse(`with a (k, v) as (select id, name from users), b as (select k, v as Val, k + 1 from a) select * from b`)
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, newValidator(stmt, c).validate())
+
+	// the columns are named after the column list, the aliases or the column names
+	with := stmt.(*SelectStatement).With
+	testutil.MustEqual(t, with[1].Table, &schema.Table{Name: "b", Columns: []*schema.ColumnDef{
+		{Name: "k", Type: schema.ColumnTypeInt64},
+		{Name: "val", Type: schema.ColumnTypeString},
+		{Name: "", Type: schema.ColumnTypeInt64},
+	}})
+	testutil.MustEqual(t, with[1].Select.(*SelectStatement).From.(*AliasedTableExpr).Expr.(*TableName).CTE, with[0])
+}
+
+func TestValidator_Validate_Analyze(t *testing.T) {
+	c := &catalog.Catalog{Tables: map[string]*schema.Table{"users": {Name: "users"}}}
+
+	testutil.MustBeNil(t, newValidator(&AnalyzeStatement{}, c).validate())
+	testutil.MustBeNil(t, newValidator(&AnalyzeStatement{Table: "users"}, c).validate())
+	testutil.MustEqual(t, newValidator(&AnalyzeStatement{Table: "items"}, c).validate() != nil, true)
+}
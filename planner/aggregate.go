@@ -0,0 +1,408 @@
+package planner
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// accumulator computes an aggregate function incrementally.
+// NULL is ignored except for COUNT(*).
+type accumulator interface {
+	add(v interface{}) error
+	// size returns the memory in bytes used by the values the accumulator holds.
+	size() int
+	// result returns the aggregated value. It is NULL when no value is added except for COUNT.
+	result() interface{}
+}
+
+func newAccumulator(a *AggregateExpr) accumulator {
+	switch a.Func {
+	case "count":
+		return &countAccumulator{star: a.Arg == nil}
+	case "sum":
+		return &sumAccumulator{}
+	case "avg":
+		return &avgAccumulator{}
+	case "min":
+		return &minMaxAccumulator{max: false}
+	case "max":
+		return &minMaxAccumulator{max: true}
+	}
+
+	// must not come here because the statement is validated
+	panic(fmt.Sprintf("unexpected aggregate function %s", a.Func))
+}
+
+type countAccumulator struct {
+	star  bool
+	count int64
+}
+
+func (acc *countAccumulator) add(v interface{}) error {
+	if acc.star || v != nil {
+		acc.count++
+	}
+	return nil
+}
+
+func (acc *countAccumulator) size() int {
+	return 0
+}
+
+func (acc *countAccumulator) result() interface{} {
+	return acc.count
+}
+
+// sumAccumulator sums int64 or float64. The result is the same type as the values.
+type sumAccumulator struct {
+	sum interface{}
+}
+
+func (acc *sumAccumulator) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	switch x := v.(type) {
+	case int64:
+		if acc.sum == nil {
+			acc.sum = x
+			return nil
+		}
+
+		sum, err := evalInt64(parser.Op_ADD, acc.sum.(int64), x)
+		if err != nil {
+			return err
+		}
+		acc.sum = sum
+	case float64:
+		if acc.sum == nil {
+			acc.sum = x
+		} else {
+			acc.sum = acc.sum.(float64) + x
+		}
+	default:
+		return fmt.Errorf("cannot sum %v", v)
+	}
+
+	return nil
+}
+
+func (acc *sumAccumulator) size() int {
+	return 0
+}
+
+func (acc *sumAccumulator) result() interface{} {
+	return acc.sum
+}
+
+type avgAccumulator struct {
+	sum   float64
+	count int64
+}
+
+func (acc *avgAccumulator) add(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		acc.sum += float64(x)
+	case float64:
+		acc.sum += x
+	default:
+		return fmt.Errorf("cannot average %v", v)
+	}
+
+	acc.count++
+	return nil
+}
+
+func (acc *avgAccumulator) size() int {
+	return 0
+}
+
+func (acc *avgAccumulator) result() interface{} {
+	if acc.count == 0 {
+		return nil
+	}
+	return acc.sum / float64(acc.count)
+}
+
+type minMaxAccumulator struct {
+	max   bool
+	value interface{}
+}
+
+func (acc *minMaxAccumulator) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	if acc.value == nil {
+		acc.value = v
+		return nil
+	}
+
+	cmp, ok := compareValues(v, acc.value)
+	if !ok {
+		return fmt.Errorf("cannot compare %v and %v", v, acc.value)
+	}
+
+	if (acc.max && cmp > 0) || (!acc.max && cmp < 0) {
+		acc.value = v
+	}
+
+	return nil
+}
+
+// size returns the length of the string or bytes value. The other values have no extra memory.
+func (acc *minMaxAccumulator) size() int {
+	switch v := acc.value.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	}
+	return 0
+}
+
+func (acc *minMaxAccumulator) result() interface{} {
+	return acc.value
+}
+
+// group holds the group by values and the accumulators of the group.
+type group struct {
+	values []interface{}
+	accs   []accumulator
+}
+
+func (a *Aggregate) newGroup(values []interface{}) *group {
+	g := &group{values: values, accs: make([]accumulator, len(a.Aggregates))}
+	for i, agg := range a.Aggregates {
+		g.accs[i] = newAccumulator(agg)
+	}
+
+	return g
+}
+
+// accumulate adds the tuple to the accumulators of the group. It returns how many bytes
+// the values held by the accumulators grew.
+func (a *Aggregate) accumulate(g *group, t sdb.Tuple) (int, error) {
+	grown := 0
+	for i, agg := range a.Aggregates {
+		var v interface{}
+		if agg.Arg != nil {
+			var err error
+			if v, err = eval(agg.Arg, t); err != nil {
+				return 0, err
+			}
+		}
+
+		before := g.accs[i].size()
+		if err := g.accs[i].add(v); err != nil {
+			return 0, err
+		}
+		grown += g.accs[i].size() - before
+	}
+
+	return grown, nil
+}
+
+// tuple makes the output tuple of the group.
+func (g *group) tuple() sdb.Tuple {
+	values := make([]interface{}, 0, len(g.values)+len(g.accs))
+	values = append(values, g.values...)
+	for _, acc := range g.accs {
+		values = append(values, acc.result())
+	}
+
+	return engine.NewTuple(values, -1)
+}
+
+// aggGroupOverhead is the rough memory in bytes a group uses in addition to its key.
+// It is used to decide when the groups exceed work_mem.
+const aggGroupOverhead = 128
+
+// aggMaxPartitionCount is the max number of the partitions the tuples are spilled into.
+const aggMaxPartitionCount = 8
+
+// aggMinSpillBlockSize is the smallest block size of the partitions.
+const aggMinSpillBlockSize = 1024
+
+// aggPartition is the spilled input tuples whose groups did not fit in work_mem.
+// level is the number of the times the tuples have been partitioned.
+type aggPartition struct {
+	file  *spillFile
+	level int
+}
+
+// partitionOf decides the partition of the group key. The level is mixed into the hash so that
+// the tuples in a partition are split into the different partitions in the next level.
+func partitionOf(key string, level, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte{byte(level)})
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// spillLayout decides the number of the partitions and their block size. The blocks being written
+// to the partitions and the block being read from a partition take at most half of work_mem,
+// and the rest is left for the groups. When even three pages do not fit, the blocks are made smaller.
+func (a *Aggregate) spillLayout() (count, blockSize int) {
+	budget := a.env.WorkMem / 2
+	blockSize = a.env.spillBlockSize()
+	count = budget/blockSize - 1
+	if count > aggMaxPartitionCount {
+		count = aggMaxPartitionCount
+	}
+	if count >= 2 {
+		return count, blockSize
+	}
+
+	blockSize = budget / 3
+	if blockSize < aggMinSpillBlockSize {
+		blockSize = aggMinSpillBlockSize
+	}
+	return 2, blockSize
+}
+
+// hashAggregate groups the tuples read by next with a hash table. The groups are returned
+// in the order they first appear.
+//
+// When the groups exceed work_mem, no more group is added to the hash table. The tuples of the
+// existing groups are still aggregated on memory, but the tuples of the new groups are spilled to
+// the partitions by the hash of the group key. Each partition is aggregated later in the same way,
+// and it is partitioned again if its groups still exceed work_mem.
+// At least one group is aggregated on memory in every pass, so it always finishes.
+func (a *Aggregate) hashAggregate(next func() (sdb.Tuple, error), level int) ([]*group, []*aggPartition, error) {
+	groups := map[string]*group{}
+	order := []*group{}
+	size := 0
+	var writers []*spillWriter
+
+	// the groups can use work_mem except the memory for spilling
+	partitionCount, blockSize := a.spillLayout()
+	groupMem := a.env.WorkMem - (partitionCount+1)*blockSize
+	for {
+		t, err := next()
+		if err != nil {
+			return nil, nil, a.discardWriters(writers, err)
+		}
+
+		if t == nil {
+			break
+		}
+
+		values, err := sortKeys(a.GroupBy, t)
+		if err != nil {
+			return nil, nil, a.discardWriters(writers, err)
+		}
+
+		key := encodeKey(values)
+		g, ok := groups[key]
+		if !ok && writers != nil {
+			if err := spillTuple(writers[partitionOf(key, level, partitionCount)], t); err != nil {
+				return nil, nil, a.discardWriters(writers, err)
+			}
+			continue
+		}
+
+		if !ok {
+			g = a.newGroup(values)
+			groups[key] = g
+			order = append(order, g)
+
+			size += len(key) + aggGroupOverhead
+		}
+
+		grown, err := a.accumulate(g, t)
+		if err != nil {
+			return nil, nil, a.discardWriters(writers, err)
+		}
+
+		// The existing groups may still grow after spilling starts (e.g. MAX of strings),
+		// but no more group is added.
+		size += grown
+		if writers == nil && a.env.WorkMem > 0 && size > groupMem {
+			writers = make([]*spillWriter, partitionCount)
+			for i := range writers {
+				writers[i] = newSpillWriter(a.env.DiskManager, blockSize)
+			}
+		}
+	}
+
+	// Without GROUP BY, the result has one row even if there is no input.
+	if len(a.GroupBy) == 0 && len(order) == 0 && level == 0 {
+		order = append(order, a.newGroup([]interface{}{}))
+	}
+
+	partitions := []*aggPartition{}
+	for i, w := range writers {
+		f, err := w.close()
+		if err != nil {
+			removePartitions(a.env.DiskManager, partitions)
+			return nil, nil, a.discardWriters(writers[i:], err)
+		}
+
+		if f.blocks == 0 {
+			continue
+		}
+
+		partitions = append(partitions, &aggPartition{file: f, level: level + 1})
+	}
+
+	return order, partitions, nil
+}
+
+func spillTuple(w *spillWriter, t sdb.Tuple) error {
+	serialized, err := t.Serialize()
+	if err != nil {
+		return err
+	}
+
+	return w.write(serialized)
+}
+
+// discardWriters removes the files being written, then returns err.
+func (a *Aggregate) discardWriters(writers []*spillWriter, err error) error {
+	for _, w := range writers {
+		a.env.DiskManager.Remove(w.file.name)
+	}
+
+	return err
+}
+
+func removePartitions(dm sdb.DiskManager, partitions []*aggPartition) error {
+	var firstErr error
+	for _, p := range partitions {
+		if err := p.file.remove(dm); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// nextPartition aggregates the next spilled partition. The partition file is removed after it is read.
+func (a *Aggregate) nextPartition() error {
+	p := a.partitions[0]
+	a.partitions = a.partitions[1:]
+
+	r := newSpillReader(a.env.DiskManager, p.file)
+	groups, partitions, err := a.hashAggregate(r.read, p.level)
+	if rerr := p.file.remove(a.env.DiskManager); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return err
+	}
+
+	a.groups = groups
+	a.idx = 0
+	a.partitions = append(a.partitions, partitions...)
+	return nil
+}
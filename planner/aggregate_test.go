@@ -0,0 +1,300 @@
+package planner
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func values(tuples []sdb.Tuple, n int) [][]interface{} {
+	rows := make([][]interface{}, len(tuples))
+	for i, t := range tuples {
+		rows[i] = make([]interface{}, n)
+		for j := 0; j < n; j++ {
+			rows[i][j] = t.Value(j)
+		}
+	}
+	return rows
+}
+
+func TestAggregate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2021, 5, d, 0, 0, 0, 0, time.UTC) }
+	aggregates := func() []*AggregateExpr {
+		return []*AggregateExpr{
+			{Func: "count"},
+			{Func: "count", Arg: &Column{Name: "price", Index: 2}},
+			{Func: "sum", Arg: &Column{Name: "price", Index: 2}},
+			{Func: "avg", Arg: &Column{Name: "price", Index: 2}},
+			{Func: "min", Arg: &Column{Name: "id", Index: 0}},
+			{Func: "max", Arg: &Column{Name: "created", Index: 4}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		groupBy  []Expr
+		input    List
+		expected [][]interface{}
+	}{
+		{
+			name:    "group by",
+			groupBy: []Expr{&Column{Name: "category", Index: 1}},
+			input:   &Scan{Table: &Table{Name: "items"}},
+			expected: [][]interface{}{
+				{"book", int64(3), int64(2), float64(21), float64(10.5), int64(1), day(3)},
+				{"food", int64(2), int64(2), float64(6), float64(3), int64(2), day(4)},
+				{nil, int64(1), int64(1), float64(7), float64(7), int64(4), day(5)},
+			},
+		},
+		{
+			name:    "without group by",
+			groupBy: []Expr{},
+			input:   &Scan{Table: &Table{Name: "items"}},
+			expected: [][]interface{}{
+				{int64(6), int64(5), float64(34), float64(6.8), int64(1), day(5)},
+			},
+		},
+		{
+			name:    "no input without group by",
+			groupBy: []Expr{},
+			input:   &Selection{Filter: &BoolExpr{Value: false}, Input: &Scan{Table: &Table{Name: "items"}}},
+			expected: [][]interface{}{
+				{int64(0), int64(0), nil, nil, nil, nil},
+			},
+		},
+		{
+			name:     "no input with group by",
+			groupBy:  []Expr{&Column{Name: "category", Index: 1}},
+			input:    &Selection{Filter: &BoolExpr{Value: false}, Input: &Scan{Table: &Table{Name: "items"}}},
+			expected: [][]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			agg := &Aggregate{GroupBy: test.groupBy, Aggregates: aggregates(), Input: test.input}
+			got := collect(t, agg, newItemsEngine())
+			testutil.MustEqual(t, values(got, len(test.groupBy)+6), test.expected)
+		})
+	}
+}
+
+func TestAggregate_Spill(t *testing.T) {
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 3000; i++ {
+		var v interface{} = int64(i)
+		if i%7 == 0 {
+			v = nil
+		}
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i), fmt.Sprintf("key%d", i%300), v}, 0))
+	}
+	e := newEngineWithTuples("events", tuples, 32)
+
+	newAggregate := func() *Aggregate {
+		return &Aggregate{
+			GroupBy: []Expr{&Column{Name: "key", Index: 1}},
+			Aggregates: []*AggregateExpr{
+				{Func: "count"},
+				{Func: "sum", Arg: &Column{Name: "v", Index: 2}},
+				{Func: "max", Arg: &Column{Name: "v", Index: 2}},
+			},
+			Input: &Scan{Table: &Table{Name: "events"}},
+		}
+	}
+
+	// the groups are produced in different order when they are spilled
+	sorted := func(rows [][]interface{}) [][]interface{} {
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0].(string) < rows[j][0].(string) })
+		return rows
+	}
+	expected := sorted(values(collect(t, newAggregate(), e), 4))
+	testutil.MustEqual(t, len(expected), 300)
+
+	tests := []struct {
+		name    string
+		workMem int
+		spilled bool
+	}{
+		{name: "in memory", workMem: 1024 * 1024, spilled: false},
+		{name: "partitioned once", workMem: 16 * 1024, spilled: true},
+		{name: "partitioned recursively", workMem: 1, spilled: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dm, err := diskmanager.New(dir)
+			testutil.MustBeNil(t, err)
+
+			agg := newAggregate()
+			testutil.MustBeNil(t, agg.Open(&Env{Engine: e, DiskManager: dm, WorkMem: test.workMem}))
+			testutil.MustEqual(t, len(agg.partitions) > 0, test.spilled)
+
+			got := []sdb.Tuple{}
+			for {
+				tp, err := agg.Next()
+				testutil.MustBeNil(t, err)
+				if tp == nil {
+					break
+				}
+				got = append(got, tp)
+			}
+			testutil.MustBeNil(t, agg.Close())
+
+			testutil.MustEqual(t, sorted(values(got, 4)), expected)
+			testutil.MustEqual(t, spillFiles(t, dir), []string{})
+		})
+	}
+}
+
+func TestAggregate_Spill_StringState(t *testing.T) {
+	// a few groups, but the max of the long strings takes most of the memory
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("%04d%s", i, strings.Repeat("x", 1000))
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i % 10), name}, 0))
+	}
+	e := newEngineWithTuples("events", tuples, 10)
+
+	newAggregate := func() *Aggregate {
+		return &Aggregate{
+			GroupBy:    []Expr{&Column{Name: "key", Index: 0}},
+			Aggregates: []*AggregateExpr{{Func: "max", Arg: &Column{Name: "name", Index: 1}}},
+			Input:      &Scan{Table: &Table{Name: "events"}},
+		}
+	}
+	expected := values(collect(t, newAggregate(), e), 2)
+
+	dir := t.TempDir()
+	dm, err := diskmanager.New(dir)
+	testutil.MustBeNil(t, err)
+
+	agg := newAggregate()
+	testutil.MustBeNil(t, agg.Open(&Env{Engine: e, DiskManager: dm, WorkMem: 16 * 1024, PageSize: 1024}))
+	testutil.MustEqual(t, len(agg.partitions) > 0, true)
+
+	got := []sdb.Tuple{}
+	for {
+		tp, err := agg.Next()
+		testutil.MustBeNil(t, err)
+		if tp == nil {
+			break
+		}
+		got = append(got, tp)
+	}
+	testutil.MustBeNil(t, agg.Close())
+
+	sorted := func(rows [][]interface{}) [][]interface{} {
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0].(int64) < rows[j][0].(int64) })
+		return rows
+	}
+	testutil.MustEqual(t, sorted(values(got, 2)), sorted(expected))
+}
+
+func TestAggregate_Spill_Encrypted(t *testing.T) {
+	// the tuples are larger than the blocks of the partitions
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 300; i++ {
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i % 50), strings.Repeat("x", 1500) + fmt.Sprint(i)}, 0))
+	}
+	e := newEngineWithTuples("events", tuples, 10)
+
+	newAggregate := func() *Aggregate {
+		return &Aggregate{
+			GroupBy:    []Expr{&Column{Name: "key", Index: 0}},
+			Aggregates: []*AggregateExpr{{Func: "count"}, {Func: "min", Arg: &Column{Name: "name", Index: 1}}},
+			Input:      &Scan{Table: &Table{Name: "events"}},
+		}
+	}
+	expected := values(collect(t, newAggregate(), e), 3)
+
+	dir := t.TempDir()
+	dm, err := diskmanager.New(dir, diskmanager.WithEncryptionKey(bytes.Repeat([]byte{1}, 32)))
+	testutil.MustBeNil(t, err)
+
+	agg := newAggregate()
+	env := &Env{Engine: e, DiskManager: dm, WorkMem: 8 * 1024, PageSize: 4096}
+	testutil.MustBeNil(t, agg.Open(env))
+	testutil.MustEqual(t, len(agg.partitions) > 0, true)
+	_, blockSize := agg.spillLayout()
+	testutil.MustEqual(t, blockSize < 1500, true)
+
+	got := []sdb.Tuple{}
+	for {
+		tp, err := agg.Next()
+		testutil.MustBeNil(t, err)
+		if tp == nil {
+			break
+		}
+		got = append(got, tp)
+	}
+	testutil.MustBeNil(t, agg.Close())
+
+	sorted := func(rows [][]interface{}) [][]interface{} {
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0].(int64) < rows[j][0].(int64) })
+		return rows
+	}
+	testutil.MustEqual(t, sorted(values(got, 3)), sorted(expected))
+	testutil.MustEqual(t, spillFiles(t, dir), []string{})
+}
+
+func TestAggregate_SpillLayout(t *testing.T) {
+	tests := []struct {
+		name      string
+		workMem   int
+		pageSize  int
+		count     int
+		blockSize int
+	}{
+		{name: "max partitions", workMem: 4 * 1024 * 1024, pageSize: 16 * 1024, count: 8, blockSize: 16 * 1024},
+		{name: "fewer partitions", workMem: 128 * 1024, pageSize: 16 * 1024, count: 3, blockSize: 16 * 1024},
+		{name: "smaller blocks", workMem: 64 * 1024, pageSize: 16 * 1024, count: 2, blockSize: 32 * 1024 / 3},
+		{name: "smallest blocks", workMem: 1, pageSize: 16 * 1024, count: 2, blockSize: aggMinSpillBlockSize},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			agg := &Aggregate{env: &Env{WorkMem: test.workMem, PageSize: test.pageSize}}
+			count, blockSize := agg.spillLayout()
+			testutil.MustEqual(t, count, test.count)
+			testutil.MustEqual(t, blockSize, test.blockSize)
+		})
+	}
+}
+
+func TestAggregate_Close_RemovesPartitions(t *testing.T) {
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 100; i++ {
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i)}, 0))
+	}
+	e := newEngineWithTuples("events", tuples, 10)
+
+	dir := t.TempDir()
+	dm, err := diskmanager.New(dir)
+	testutil.MustBeNil(t, err)
+
+	agg := &Aggregate{
+		GroupBy:    []Expr{&Column{Name: "id", Index: 0}},
+		Aggregates: []*AggregateExpr{{Func: "count"}},
+		Input:      &Scan{Table: &Table{Name: "events"}},
+	}
+	testutil.MustBeNil(t, agg.Open(&Env{Engine: e, DiskManager: dm, WorkMem: 1}))
+	testutil.MustEqual(t, len(spillFiles(t, dir)) > 0, true)
+
+	// closed before all the partitions are read
+	_, err = agg.Next()
+	testutil.MustBeNil(t, err)
+	testutil.MustBeNil(t, agg.Close())
+	testutil.MustEqual(t, spillFiles(t, dir), []string{})
+}
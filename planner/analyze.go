@@ -0,0 +1,210 @@
+package planner
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// AnalyzePlan collects the statistics of the tables.
+type AnalyzePlan struct {
+	sdb.Plan
+
+	Tables []*schema.Table
+}
+
+func (p *Planner) PlanAnalyze(stmt *parser.AnalyzeStatement) *AnalyzePlan {
+	if stmt.Table == "" {
+		return &AnalyzePlan{Tables: p.catalog.ListTables()}
+	}
+
+	return &AnalyzePlan{Tables: []*schema.Table{p.catalog.GetTable(stmt.Table)}}
+}
+
+// analyzeSamplePages is the max number of the pages ANALYZE reads. When the table has more pages,
+// the pages are chosen randomly and the statistics are estimated from them.
+var analyzeSamplePages = 300
+
+// statisticsTarget is the max number of the most common values and the histogram buckets per column.
+const statisticsTarget = 10
+
+// CollectStatistics reads the pages of the table and computes the statistics.
+// Every page is read when the table is small; otherwise analyzeSamplePages pages are sampled.
+func CollectStatistics(e sdb.Engine, table *schema.Table) (*schema.TableStatistics, error) {
+	pageCount := e.PageCount(table.Name)
+	pages := samplePages(pageCount, analyzeSamplePages)
+	stats := &schema.TableStatistics{
+		PageCount:    pageCount,
+		SampledPages: len(pages),
+		Columns:      make([]*schema.ColumnStatistics, len(table.Columns)),
+	}
+
+	rows := 0
+	nulls := make([]int, len(table.Columns))
+	values := make([][]interface{}, len(table.Columns))
+	for _, n := range pages {
+		tuples, err := e.ReadPage(table.Name, n)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range tuples {
+			rows++
+			for i := range table.Columns {
+				v := t.Value(i)
+				if v == nil {
+					nulls[i]++
+					continue
+				}
+
+				values[i] = append(values[i], v)
+			}
+		}
+	}
+
+	if len(pages) > 0 {
+		stats.RowCount = int64(math.Round(float64(rows) * float64(pageCount) / float64(len(pages))))
+	}
+
+	for i, col := range table.Columns {
+		stats.Columns[i] = columnStatistics(col.Type, values[i], nulls[i], rows, stats.RowCount)
+	}
+
+	return stats, nil
+}
+
+// samplePages returns the pages to be read in ascending order. Every page is returned when count <= max.
+func samplePages(count, max int) []int {
+	if count <= max {
+		pages := make([]int, count)
+		for i := range pages {
+			pages[i] = i
+		}
+		return pages
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	pages := r.Perm(count)[:max]
+	sort.Ints(pages)
+	return pages
+}
+
+// valueCount is a distinct value and how many times it appears in the sample.
+type valueCount struct {
+	value interface{}
+	count int
+}
+
+// columnStatistics computes the statistics of the column from the non-NULL values found in the sample.
+// sampleRows is the number of the sampled rows, and totalRows is the estimated number of the rows in the table.
+func columnStatistics(typ schema.ColumnType, values []interface{}, nulls, sampleRows int, totalRows int64) *schema.ColumnStatistics {
+	cs := &schema.ColumnStatistics{}
+	if sampleRows == 0 {
+		return cs
+	}
+
+	cs.NullFraction = float64(nulls) / float64(sampleRows)
+	if len(values) == 0 {
+		return cs
+	}
+
+	counts := map[string]*valueCount{}
+	distinct := []*valueCount{}
+	for _, v := range values {
+		key := encodeKey([]interface{}{v})
+		vc, ok := counts[key]
+		if !ok {
+			vc = &valueCount{value: v}
+			counts[key] = vc
+			distinct = append(distinct, vc)
+		}
+		vc.count++
+	}
+
+	singles := 0
+	for _, vc := range distinct {
+		if vc.count == 1 {
+			singles++
+		}
+	}
+
+	whole := int64(sampleRows) == totalRows
+	cs.DistinctCount = estimateDistinct(len(values), len(distinct), singles, float64(totalRows)*(1-cs.NullFraction), whole)
+
+	// the values of bytes are not ordered in a meaningful way nor formatted as the literals
+	if typ == schema.ColumnTypeBytes {
+		return cs
+	}
+
+	sort.Slice(distinct, func(i, j int) bool {
+		cmp, _ := compareValues(distinct[i].value, distinct[j].value)
+		return cmp < 0
+	})
+	cs.Min = schema.FormatValue(distinct[0].value)
+	cs.Max = schema.FormatValue(distinct[len(distinct)-1].value)
+
+	// The most common values are the values which appear more than once and more often than the average.
+	// When every distinct value is found and they fit in the target, the average is not considered.
+	byCount := make([]*valueCount, len(distinct))
+	copy(byCount, distinct)
+	sort.SliceStable(byCount, func(i, j int) bool { return byCount[i].count > byCount[j].count })
+
+	complete := whole && len(distinct) <= statisticsTarget
+	avg := float64(len(values)) / float64(len(distinct))
+	common := map[*valueCount]bool{}
+	for _, vc := range byCount {
+		if len(cs.MostCommonValues) == statisticsTarget {
+			break
+		}
+		if vc.count < 2 || (!complete && float64(vc.count) < avg*1.25) {
+			break
+		}
+
+		common[vc] = true
+		cs.MostCommonValues = append(cs.MostCommonValues, schema.FormatValue(vc.value))
+		cs.MostCommonFreqs = append(cs.MostCommonFreqs, float64(vc.count)/float64(sampleRows))
+	}
+
+	// the histogram is built on the sorted values except the most common values
+	rest := []interface{}{}
+	for _, vc := range distinct {
+		if common[vc] {
+			continue
+		}
+		for i := 0; i < vc.count; i++ {
+			rest = append(rest, vc.value)
+		}
+	}
+
+	if len(rest) < 2 {
+		return cs
+	}
+
+	buckets := statisticsTarget
+	if len(rest)-1 < buckets {
+		buckets = len(rest) - 1
+	}
+	for i := 0; i <= buckets; i++ {
+		cs.Histogram = append(cs.Histogram, schema.FormatValue(rest[i*(len(rest)-1)/buckets]))
+	}
+
+	return cs
+}
+
+// estimateDistinct estimates the number of the distinct values in the table by Haas and Stokes' Duj1 estimator.
+// n is the number of the sampled values, d is the distinct values in them, f1 is the values which appear
+// only once, and total is the estimated number of the values in the table.
+func estimateDistinct(n, d, f1 int, total float64, whole bool) float64 {
+	if whole || n == 0 {
+		return float64(d)
+	}
+
+	nd := float64(n) * float64(d) / (float64(n-f1) + float64(f1)*float64(n)/total)
+
+	return math.Min(math.Max(nd, float64(d)), math.Max(total, float64(d)))
+}
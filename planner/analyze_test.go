@@ -0,0 +1,124 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/sdb"
+
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestCollectStatistics(t *testing.T) {
+	table := &schema.Table{
+		Name: "items",
+		Columns: []*schema.ColumnDef{
+			{Name: "id", Type: schema.ColumnTypeInt64},
+			{Name: "category", Type: schema.ColumnTypeString},
+			{Name: "price", Type: schema.ColumnTypeFloat64},
+			{Name: "active", Type: schema.ColumnTypeBool},
+			{Name: "created", Type: schema.ColumnTypeTimestamp},
+			{Name: "code", Type: schema.ColumnTypeBytes},
+		},
+	}
+
+	stats, err := CollectStatistics(newItemsEngine(), table)
+	testutil.MustBeNil(t, err)
+	day := func(d int) string { return fmt.Sprintf("2021-05-0%d 00:00:00", d) }
+	testutil.MustEqual(t, stats, &schema.TableStatistics{
+		RowCount:     6,
+		PageCount:    2,
+		SampledPages: 2,
+		Columns: []*schema.ColumnStatistics{
+			{DistinctCount: 6, Min: "1", Max: "6", Histogram: []string{"1", "2", "3", "4", "5", "6"}},
+			{
+				DistinctCount: 2, NullFraction: 1.0 / 6, Min: "book", Max: "food",
+				MostCommonValues: []string{"book", "food"}, MostCommonFreqs: []float64{3.0 / 6, 2.0 / 6},
+			},
+			{
+				DistinctCount: 3, NullFraction: 1.0 / 6, Min: "3", Max: "10.5",
+				MostCommonValues: []string{"3", "10.5"}, MostCommonFreqs: []float64{2.0 / 6, 2.0 / 6},
+			},
+			{
+				DistinctCount: 2, Min: "false", Max: "true",
+				MostCommonValues: []string{"false", "true"}, MostCommonFreqs: []float64{3.0 / 6, 3.0 / 6},
+			},
+			{
+				DistinctCount: 5, NullFraction: 1.0 / 6, Min: day(1), Max: day(5),
+				Histogram: []string{day(1), day(2), day(3), day(4), day(5)},
+			},
+			// bytes has no value statistics
+			{DistinctCount: 5, NullFraction: 1.0 / 6},
+		},
+	})
+
+	// empty table
+	stats, err = CollectStatistics(newItemsEngine(), &schema.Table{Name: "users", Columns: table.Columns[:1]})
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, stats, &schema.TableStatistics{Columns: []*schema.ColumnStatistics{{}}})
+}
+
+func TestCollectStatistics_Sample(t *testing.T) {
+	defer func(pages int) { analyzeSamplePages = pages }(analyzeSamplePages)
+	analyzeSamplePages = 50
+
+	// 1000 pages of 2 tuples: (unique id, id % 10, id % 100 or NULL for even ids, 0 or id for odd ids)
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 2000; i++ {
+		var v interface{} = int64(i % 100)
+		if i%2 == 0 {
+			v = nil
+		}
+		skewed := int64(0)
+		if i%2 == 1 {
+			skewed = int64(i)
+		}
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i), int64(i % 10), v, skewed}, 0))
+	}
+	e := newEngineWithTuples("nums", tuples, 2)
+
+	table := &schema.Table{
+		Name: "nums",
+		Columns: []*schema.ColumnDef{
+			{Name: "id", Type: schema.ColumnTypeInt64},
+			{Name: "mod10", Type: schema.ColumnTypeInt64},
+			{Name: "mod100", Type: schema.ColumnTypeInt64},
+			{Name: "skewed", Type: schema.ColumnTypeInt64},
+		},
+	}
+
+	stats, err := CollectStatistics(e, table)
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, e.pagesRead, 50)
+	testutil.MustEqual(t, stats.RowCount, int64(2000))
+	testutil.MustEqual(t, stats.PageCount, 1000)
+	testutil.MustEqual(t, stats.SampledPages, 50)
+
+	// every sampled id is unique, so the column is estimated to be unique
+	id := stats.Columns[0]
+	testutil.MustEqual(t, math.Round(id.DistinctCount), 2000.0)
+	testutil.MustEqual(t, len(id.MostCommonValues), 0)
+	testutil.MustEqual(t, len(id.Histogram), statisticsTarget+1)
+
+	// every value of mod10 appears many times in the sample
+	mod10 := stats.Columns[1]
+	if mod10.DistinctCount < 10 || mod10.DistinctCount > 11 {
+		t.Errorf("distinct count of mod10 is %v", mod10.DistinctCount)
+	}
+
+	mod100 := stats.Columns[2]
+	testutil.MustEqual(t, mod100.NullFraction, 0.5)
+	// the estimate is between the distinct values found in the sample and the non-NULL rows
+	if mod100.DistinctCount < 20 || mod100.DistinctCount > 1000 {
+		t.Errorf("distinct count of mod100 is %v", mod100.DistinctCount)
+	}
+
+	// half of the rows are 0
+	skewed := stats.Columns[3]
+	testutil.MustEqual(t, skewed.MostCommonValues, []string{"0"})
+	testutil.MustEqual(t, skewed.MostCommonFreqs, []float64{0.5})
+	testutil.MustEqual(t, skewed.Min, "0")
+}
@@ -0,0 +1,410 @@
+package planner
+
+import (
+	"math"
+	"time"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+)
+
+// The costs are relative to the cost to read a page sequentially.
+const (
+	seqPageCost = 1.0
+	// cpuTupleCost is the cost to process a tuple.
+	cpuTupleCost = 0.01
+	// cpuOperatorCost is the cost to evaluate an operator such as a comparison.
+	cpuOperatorCost = 0.0025
+)
+
+// The estimations below are used when the table is not analyzed or the statistics cannot be applied.
+const (
+	defaultRowCount         = 1000
+	defaultPageCount        = 10
+	defaultEqSelectivity    = 0.005
+	defaultRangeSelectivity = 1.0 / 3
+	defaultNullFraction     = 0.005
+	defaultLikeSelectivity  = 0.05
+	defaultSelectivity      = 0.5
+)
+
+// tableRows returns the estimated number of the rows in the table.
+func tableRows(table *schema.Table) float64 {
+	if table.Statistics == nil {
+		return defaultRowCount
+	}
+
+	return float64(table.Statistics.RowCount)
+}
+
+// tablePages returns the estimated number of the pages of the table.
+func tablePages(table *schema.Table) float64 {
+	if table.Statistics == nil {
+		return defaultPageCount
+	}
+
+	return float64(table.Statistics.PageCount)
+}
+
+// indexLookupCost is the cost to find a tuple by the index. The index is a B-tree on memory,
+// so no page is read; the cost is the comparisons to walk down the tree.
+func indexLookupCost(rows float64) float64 {
+	return cpuOperatorCost*math.Log2(rows+1) + cpuTupleCost
+}
+
+// indexTupleCost is the cost to read a tuple by the index in the order of the key. The tuples are
+// not read from a page at a time; the B-tree nodes are followed for each tuple.
+const indexTupleCost = 4 * cpuTupleCost
+
+// sortCost is the cost to sort the tuples by the keys.
+func sortCost(rows float64, keys int) float64 {
+	if rows < 2 {
+		return 0
+	}
+
+	return 2 * cpuOperatorCost * float64(keys) * rows * math.Log2(rows)
+}
+
+// tupleWidth is the estimated size of the tuple in bytes.
+func tupleWidth(sc *scope) float64 {
+	width := 0.0
+	for _, st := range sc.tables {
+		for _, ci := range st.columns {
+			switch st.table.Columns[ci].Type {
+			case schema.ColumnTypeBool:
+				width++
+			case schema.ColumnTypeString, schema.ColumnTypeBytes:
+				width += 32
+			default:
+				width += 8
+			}
+		}
+	}
+
+	return width
+}
+
+// selectivity estimates the fraction of the rows for which the predicates are true.
+func (o *optimizer) selectivity(preds []parser.Expr) float64 {
+	s := 1.0
+	for _, pred := range preds {
+		s *= o.predicateSelectivity(pred)
+	}
+
+	return s
+}
+
+func (o *optimizer) predicateSelectivity(expr parser.Expr) float64 {
+	switch e := expr.(type) {
+	case *parser.AndExpr:
+		return o.predicateSelectivity(e.Left) * o.predicateSelectivity(e.Right)
+	case *parser.OrExpr:
+		l, r := o.predicateSelectivity(e.Left), o.predicateSelectivity(e.Right)
+		return l + r - l*r
+	case *parser.NotExpr:
+		return 1 - o.predicateSelectivity(e.Operand)
+	case *parser.IsNullExpr:
+		s := defaultNullFraction
+		if c, ok := e.Operand.(*parser.ColName); ok {
+			s = o.nullFraction(c)
+		}
+		if e.Not {
+			return 1 - s
+		}
+		return s
+	case *parser.ComparisonExpr:
+		return o.comparisonSelectivity(e)
+	case *parser.InExpr:
+		if e.Subquery != nil {
+			return defaultSelectivity
+		}
+		s := 0.0
+		for _, val := range e.Values {
+			s += o.comparisonSelectivity(&parser.ComparisonExpr{Left: e.Operand, Operator: parser.Op_EQ, Right: val})
+		}
+		s = math.Min(s, 1)
+		if e.Not {
+			return 1 - s
+		}
+		return s
+	case *parser.LikeExpr:
+		s := defaultLikeSelectivity
+		c, cok := e.Operand.(*parser.ColName)
+		pattern, pok := e.Pattern.(*parser.Value)
+		if cok && pok {
+			s = o.likeSelectivity(c, pattern.Val)
+		}
+		if e.Not {
+			return 1 - s
+		}
+		return s
+	case *parser.NullVal:
+		return 0
+	}
+
+	return defaultSelectivity
+}
+
+// likeSelectivity estimates the selectivity of "column LIKE pattern". The pattern is matched with
+// the most common values, and defaultLikeSelectivity is applied to the other values.
+func (o *optimizer) likeSelectivity(c *parser.ColName, pattern string) float64 {
+	rel, ci := o.resolve(c)
+	if rel == nil || rel.table.Statistics == nil || rel.table.Columns[ci].Type != schema.ColumnTypeString {
+		return defaultLikeSelectivity
+	}
+
+	cs := rel.table.Statistics.Columns[ci]
+	mcvFreq, matched := 0.0, 0.0
+	for i, v := range cs.MostCommonValues {
+		mcvFreq += cs.MostCommonFreqs[i]
+		if likeMatch(v, pattern) {
+			matched += cs.MostCommonFreqs[i]
+		}
+	}
+
+	return matched + math.Max(1-cs.NullFraction-mcvFreq, 0)*defaultLikeSelectivity
+}
+
+func (o *optimizer) comparisonSelectivity(e *parser.ComparisonExpr) float64 {
+	// comparison with NULL is never true
+	_, lnull := e.Left.(*parser.NullVal)
+	_, rnull := e.Right.(*parser.NullVal)
+	if lnull || rnull {
+		return 0
+	}
+
+	lc, lok := e.Left.(*parser.ColName)
+	rc, rok := e.Right.(*parser.ColName)
+	switch {
+	case lok && rok:
+		eq := defaultEqSelectivity
+		if d := math.Max(o.distinctCount(lc), o.distinctCount(rc)); d > 0 {
+			eq = 1 / d
+		}
+
+		return operatorSelectivity(e.Operator, eq, 1)
+	case lok || rok:
+		c, other, op := lc, e.Right, e.Operator
+		if !lok {
+			c, other, op = rc, e.Left, flipOperator(op)
+		}
+
+		if val, ok := other.(*parser.Value); ok {
+			if s, ok := o.valueSelectivity(c, op, val.Val); ok {
+				return s
+			}
+		}
+
+		notNull := 1 - o.nullFraction(c)
+		eq := defaultEqSelectivity
+		if d := o.distinctCount(c); d > 0 {
+			eq = notNull / d
+		}
+
+		return operatorSelectivity(e.Operator, eq, notNull)
+	}
+
+	return defaultSelectivity
+}
+
+// operatorSelectivity returns the selectivity of the comparison from the selectivity of the equality.
+// notNull is the fraction of the rows which can be compared.
+func operatorSelectivity(op parser.OperatorType, eq, notNull float64) float64 {
+	switch op {
+	case parser.Op_EQ:
+		return eq
+	case parser.Op_NEQ:
+		return math.Max(notNull-eq, 0)
+	}
+
+	return defaultRangeSelectivity
+}
+
+// flipOperator returns the operator which gives the same result when the operands are swapped.
+func flipOperator(op parser.OperatorType) parser.OperatorType {
+	switch op {
+	case parser.Op_LT:
+		return parser.Op_GT
+	case parser.Op_LTE:
+		return parser.Op_GTE
+	case parser.Op_GT:
+		return parser.Op_LT
+	case parser.Op_GTE:
+		return parser.Op_LTE
+	}
+
+	return op
+}
+
+// valueSelectivity estimates the selectivity of "column op literal" by the most common values and
+// the histogram of the column. false is returned when the column has no statistics to use.
+func (o *optimizer) valueSelectivity(c *parser.ColName, op parser.OperatorType, literal string) (float64, bool) {
+	rel, ci := o.resolve(c)
+	if rel == nil || rel.table.Statistics == nil {
+		return 0, false
+	}
+
+	typ := rel.table.Columns[ci].Type
+	cs := rel.table.Statistics.Columns[ci]
+	v, err := schema.ConvertValue(literal, typ)
+	if err != nil || typ == schema.ColumnTypeBytes || cs.Min == "" {
+		return 0, false
+	}
+
+	notNull := 1 - cs.NullFraction
+	// mcvFreq is the fraction of the most common values, and matched is the one of them satisfying the predicate
+	mcvFreq, matched := 0.0, 0.0
+	for i, literal := range cs.MostCommonValues {
+		mcv, err := schema.ConvertValue(literal, typ)
+		if err != nil {
+			return 0, false
+		}
+
+		mcvFreq += cs.MostCommonFreqs[i]
+		if cmp, ok := compareValues(mcv, v); ok && compareResult(op, cmp) {
+			matched += cs.MostCommonFreqs[i]
+		}
+	}
+
+	// rest is the fraction of the values which are neither NULL nor the most common values
+	rest := math.Max(notNull-mcvFreq, 0)
+	switch op {
+	case parser.Op_EQ, parser.Op_NEQ:
+		eq := matched
+		if op == parser.Op_NEQ {
+			eq = mcvFreq - matched
+		}
+		if eq == 0 {
+			// the value is not a most common value, so it is one of the other distinct values
+			if others := cs.DistinctCount - float64(len(cs.MostCommonValues)); others >= 1 {
+				eq = rest / others
+			}
+		}
+		if op == parser.Op_NEQ {
+			return math.Max(notNull-eq, 0), true
+		}
+		return eq, true
+	}
+
+	bounds := cs.Histogram
+	if len(bounds) < 2 {
+		bounds = []string{cs.Min, cs.Max}
+	}
+	less, ok := histogramFraction(bounds, typ, v)
+	if !ok {
+		return matched + rest*defaultRangeSelectivity, true
+	}
+	if op == parser.Op_GT || op == parser.Op_GTE {
+		less = 1 - less
+	}
+
+	return matched + rest*less, true
+}
+
+// compareResult returns whether the comparison by op is true when the comparison result is cmp.
+func compareResult(op parser.OperatorType, cmp int) bool {
+	switch op {
+	case parser.Op_EQ:
+		return cmp == 0
+	case parser.Op_NEQ:
+		return cmp != 0
+	case parser.Op_LT:
+		return cmp < 0
+	case parser.Op_LTE:
+		return cmp <= 0
+	case parser.Op_GT:
+		return cmp > 0
+	case parser.Op_GTE:
+		return cmp >= 0
+	}
+
+	return false
+}
+
+// histogramFraction estimates the fraction of the values in the histogram which are smaller than v.
+// Within a bucket, the values are assumed to be distributed uniformly when they are numbers or timestamps.
+func histogramFraction(bounds []string, typ schema.ColumnType, v interface{}) (float64, bool) {
+	values := make([]interface{}, len(bounds))
+	for i, b := range bounds {
+		bv, err := schema.ConvertValue(b, typ)
+		if err != nil {
+			return 0, false
+		}
+		values[i] = bv
+	}
+
+	if cmp, ok := compareValues(v, values[0]); !ok || cmp <= 0 {
+		return 0, ok
+	}
+	last := len(values) - 1
+	if cmp, _ := compareValues(v, values[last]); cmp >= 0 {
+		return 1, true
+	}
+
+	buckets := float64(last)
+	for i := 0; i < last; i++ {
+		if cmp, _ := compareValues(v, values[i+1]); cmp >= 0 {
+			continue
+		}
+
+		position := 0.5
+		lo, lok := numericValue(values[i])
+		hi, hok := numericValue(values[i+1])
+		x, xok := numericValue(v)
+		if lok && hok && xok && hi > lo {
+			position = (x - lo) / (hi - lo)
+		}
+		return (float64(i) + position) / buckets, true
+	}
+
+	return 1, true
+}
+
+// numericValue returns the value as float64 to interpolate it. Timestamp is converted to the unix time.
+func numericValue(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case time.Time:
+		return float64(x.UnixNano()), true
+	}
+
+	return 0, false
+}
+
+// nullFraction returns the fraction of NULL in the column.
+func (o *optimizer) nullFraction(c *parser.ColName) float64 {
+	rel, ci := o.resolve(c)
+	if rel == nil {
+		return defaultNullFraction
+	}
+	if !rel.table.Columns[ci].Nullable() {
+		return 0
+	}
+
+	if rel.table.Statistics == nil {
+		return defaultNullFraction
+	}
+
+	return rel.table.Statistics.Columns[ci].NullFraction
+}
+
+// distinctCount returns the number of the distinct values in the column. 0 is returned when unknown.
+func (o *optimizer) distinctCount(c *parser.ColName) float64 {
+	rel, ci := o.resolve(c)
+	if rel == nil {
+		return 0
+	}
+	if rel.table.Statistics != nil {
+		return math.Max(rel.table.Statistics.Columns[ci].DistinctCount, 1)
+	}
+
+	// primary key is unique
+	if rel.table.Columns[ci].HasOption(schema.ColumnOptionPrimaryKey) {
+		return tableRows(rel.table)
+	}
+
+	return 0
+}
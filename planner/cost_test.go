@@ -0,0 +1,71 @@
+package planner
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestOptimizer_Selectivity(t *testing.T) {
+	c := newOptimizerCatalog(true)
+	// score is 0 to 100, and 10% of the rows are 50
+	c.Tables["users"].Statistics.Columns[3] = &schema.ColumnStatistics{
+		DistinctCount:    100,
+		Min:              "0",
+		Max:              "100",
+		MostCommonValues: []string{"50"},
+		MostCommonFreqs:  []float64{0.1},
+		Histogram:        []string{"0", "10", "20", "30", "40", "50", "60", "70", "80", "90", "100"},
+	}
+	// floor is 1 to 5 without histogram
+	c.Tables["depts"].Statistics.Columns[2] = &schema.ColumnStatistics{DistinctCount: 3, NullFraction: 0.2, Min: "1", Max: "5"}
+	// 20% of the names are "alice" and 10% are "bob"
+	c.Tables["depts"].Statistics.Columns[1] = &schema.ColumnStatistics{
+		DistinctCount:    10,
+		Min:              "alice",
+		Max:              "zoe",
+		MostCommonValues: []string{"alice", "bob"},
+		MostCommonFreqs:  []float64{0.2, 0.1},
+	}
+
+	tests := []struct {
+		where    string
+		expected float64
+	}{
+		{where: "u.score = 50", expected: 0.1},
+		{where: "u.score = 7", expected: 0.9 / 99},
+		{where: "u.score <> 50", expected: 0.9},
+		{where: "u.score < 25", expected: 0.9 * 0.25},
+		{where: "25 > u.score", expected: 0.9 * 0.25},
+		{where: "u.score >= 55", expected: 0.9 * 0.45},
+		{where: "u.score <= 55", expected: 0.1 + 0.9*0.55},
+		{where: "u.score > 200", expected: 0},
+		{where: "d.floor < 2", expected: 0.8 * 0.25},
+		{where: "d.floor = 2", expected: 0.8 / 3},
+		{where: "u.score in (50, 7)", expected: 0.1 + 0.9/99},
+		{where: "u.score not in (50, null)", expected: 0.9},
+		{where: `d.name like "a%"`, expected: 0.2 + 0.7*defaultLikeSelectivity},
+		{where: `d.name not like "_o%"`, expected: 1 - (0.1 + 0.7*defaultLikeSelectivity)},
+		// no value statistics
+		{where: "u.dept_id < 5", expected: defaultRangeSelectivity},
+		{where: `u.name = "a"`, expected: 1.0 / 9000},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.where, func(t *testing.T) {
+			stmt, err := parser.New(c).Parse("select u.id from users u join depts d on u.dept_id = d.id where " + test.where + ";")
+			testutil.MustBeNil(t, err)
+
+			sel := stmt.(*parser.SelectStatement)
+			o := newOptimizer(New(c), sel)
+			s := o.selectivity(flattenAnd(sel.Where.Expr))
+			if math.Abs(s-test.expected) > 1e-9 {
+				t.Errorf("selectivity is %v, expected %v", s, test.expected)
+			}
+		})
+	}
+}
@@ -32,6 +32,27 @@ func (p *Planner) PlanCreateTable(stmt *parser.CreateTableStatement) *CreateTabl
 			idxName := fmt.Sprintf("%s_pkey_%s", table, column)
 			indices = append(indices, &schema.Index{Table: table, Name: idxName, ColumnIndex: i})
 		}
+
+		for _, notNullCol := range stmt.NotNullCols {
+			if column == strings.ToLower(notNullCol) {
+				columns[i].Options = append(columns[i].Options, schema.ColumnOptionNotNull)
+			}
+		}
+
+		for defaultCol, def := range stmt.Defaults {
+			if column != strings.ToLower(defaultCol) {
+				continue
+			}
+
+			switch d := def.(type) {
+			case *parser.Value:
+				columns[i].Options = append(columns[i].Options, schema.ColumnOptionDefaultValue)
+				columns[i].DefaultVal = d.Val
+			case *parser.FuncExpr:
+				columns[i].Options = append(columns[i].Options, schema.ColumnOptionDefaultCurrentTimestamp)
+			}
+			// DEFAULT NULL is the same as no default value
+		}
 	}
 
 	return &CreateTablePlan{
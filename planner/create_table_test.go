@@ -35,6 +35,38 @@ func TestPlanner_PlanCreateTable(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ok: not null and default",
+			stmt: &parser.CreateTableStatement{
+				Table:         "users",
+				Columns:       []string{"Id", "Name", "Verified", "Registered"},
+				Types:         []string{"INT64", "STRING", "BOOL", "TIMESTAMP"},
+				PrimaryKeyCol: "id",
+				NotNullCols:   []string{"Verified"},
+				Defaults: map[string]parser.Expr{
+					"Name":       &parser.NullVal{},
+					"Verified":   &parser.Value{Val: "false"},
+					"Registered": &parser.FuncExpr{Name: "now"},
+				},
+			},
+			expected: &CreateTablePlan{
+				Table: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString},
+					{
+						Name:       "verified",
+						Type:       schema.ColumnTypeBool,
+						Options:    []schema.ColumnOption{schema.ColumnOptionNotNull, schema.ColumnOptionDefaultValue},
+						DefaultVal: "false",
+					},
+					{Name: "registered", Type: schema.ColumnTypeTimestamp, Options: []schema.ColumnOption{schema.ColumnOptionDefaultCurrentTimestamp}},
+				},
+				Indices: []*schema.Index{
+					{Table: "users", Name: "users_pkey_id", ColumnIndex: 0},
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,472 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// ExplainPlan shows the operator tree of the SELECT statement.
+// When Analyze is true, the plan is executed and each operator is shown with its actual statistics.
+type ExplainPlan struct {
+	sdb.Plan
+
+	Analyze bool
+	Select  *SelectPlan
+}
+
+func (p *Planner) PlanExplain(stmt *parser.ExplainStatement) *ExplainPlan {
+	return &ExplainPlan{Analyze: stmt.Analyze, Select: p.PlanSelect(stmt.Stmt)}
+}
+
+// OperatorStats is the actual statistics of an operator measured by EXPLAIN ANALYZE.
+// The pages and the elapsed time include the ones of the inputs of the operator.
+type OperatorStats struct {
+	// Rows is the number of the tuples produced, and Loops is how many times the operator is opened.
+	Rows  int
+	Loops int
+	// PagesRead is the pages loaded from the disk, and PagesHit is the pages found on the buffer pool.
+	PagesRead int
+	PagesHit  int
+	Elapsed   time.Duration
+}
+
+// Explain returns the lines which show the operator tree from the root. The plans of the subqueries in
+// the expressions of an operator are shown under it after its inputs.
+// When stats is not nil, each operator is annotated with its statistics.
+func Explain(root List, stats map[List]*OperatorStats) []string {
+	lines := []string{}
+	var walk func(l List, depth int)
+	walk = func(l List, depth int) {
+		l = unwrap(l)
+		line := describe(l)
+		if depth > 0 {
+			line = strings.Repeat("  ", depth-1) + "-> " + line
+		}
+		if stats != nil {
+			line += " " + formatStats(stats[l])
+		}
+		lines = append(lines, line)
+
+		for _, child := range children(l) {
+			walk(child, depth+1)
+		}
+
+		for _, sq := range subqueries(expressions(l)...) {
+			line := strings.Repeat("  ", depth) + "-> Subquery"
+			if sq.Correlated {
+				line += " (correlated)"
+			}
+			lines = append(lines, line)
+			walk(sq.Plan, depth+2)
+		}
+	}
+	walk(root, 0)
+
+	return lines
+}
+
+// ExplainAnalyze executes the plan and returns the lines of the plan annotated with the actual statistics.
+// The result of the query is discarded.
+func ExplainAnalyze(root List, env *Env) ([]string, error) {
+	pages := &pageCounter{Engine: env.Engine}
+	stats := map[List]*OperatorStats{}
+	list := instrument(root, pages, stats)
+	defer uninstrument(root)
+
+	start := time.Now()
+	analyzeEnv := *env
+	analyzeEnv.Engine = pages
+	if err := list.Open(&analyzeEnv); err != nil {
+		return nil, err
+	}
+
+	for {
+		t, err := list.Next()
+		if err != nil {
+			list.Close()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+	}
+
+	if err := list.Close(); err != nil {
+		return nil, err
+	}
+
+	lines := Explain(root, stats)
+	return append(lines, fmt.Sprintf("Execution time: %s", formatDuration(time.Since(start)))), nil
+}
+
+// pageCounter counts the pages read through the engine.
+type pageCounter struct {
+	sdb.Engine
+
+	read, hit int
+}
+
+func (pc *pageCounter) ReadPage(table string, n int) ([]sdb.Tuple, error) {
+	if pc.Engine.PageCached(table, n) {
+		pc.hit++
+	} else {
+		pc.read++
+	}
+
+	return pc.Engine.ReadPage(table, n)
+}
+
+// instrumented measures the operator. The operator is still the one in the plan; only its inputs are
+// replaced with the instrumented ones.
+type instrumented struct {
+	List
+
+	pages *pageCounter
+	stats *OperatorStats
+}
+
+func (in *instrumented) Open(env *Env) error {
+	in.stats.Loops++
+	return in.measure(func() error { return in.List.Open(env) })
+}
+
+func (in *instrumented) Next() (sdb.Tuple, error) {
+	var t sdb.Tuple
+	err := in.measure(func() error {
+		var err error
+		t, err = in.List.Next()
+		return err
+	})
+	if t != nil {
+		in.stats.Rows++
+	}
+
+	return t, err
+}
+
+func (in *instrumented) Close() error {
+	return in.measure(in.List.Close)
+}
+
+func (in *instrumented) measure(fn func() error) error {
+	start, read, hit := time.Now(), in.pages.read, in.pages.hit
+	err := fn()
+	in.stats.Elapsed += time.Since(start)
+	in.stats.PagesRead += in.pages.read - read
+	in.stats.PagesHit += in.pages.hit - hit
+	return err
+}
+
+// instrument wraps the operator and its inputs to measure them. The plans of the subqueries are also wrapped.
+func instrument(l List, pages *pageCounter, stats map[List]*OperatorStats) List {
+	replaceInputs(l, func(input List) List { return instrument(input, pages, stats) })
+	for _, sq := range subqueries(expressions(l)...) {
+		sq.Plan = instrument(sq.Plan, pages, stats)
+	}
+
+	stats[l] = &OperatorStats{}
+	return &instrumented{List: l, pages: pages, stats: stats[l]}
+}
+
+// uninstrument restores the inputs of the operators replaced by instrument.
+func uninstrument(l List) {
+	replaceInputs(l, func(input List) List {
+		input = unwrap(input)
+		uninstrument(input)
+		return input
+	})
+	for _, sq := range subqueries(expressions(l)...) {
+		sq.Plan = unwrap(sq.Plan)
+		uninstrument(sq.Plan)
+	}
+}
+
+func unwrap(l List) List {
+	if in, ok := l.(*instrumented); ok {
+		return in.List
+	}
+
+	return l
+}
+
+// children returns the inputs of the operator.
+func children(l List) []List {
+	inputs := []List{}
+	replaceInputs(l, func(input List) List {
+		inputs = append(inputs, input)
+		return input
+	})
+
+	return inputs
+}
+
+// replaceInputs replaces each input of the operator with the one returned by fn.
+func replaceInputs(l List, fn func(List) List) {
+	switch n := l.(type) {
+	case *Projection:
+		n.Input = fn(n.Input)
+	case *Selection:
+		n.Input = fn(n.Input)
+	case *Limit:
+		n.Input = fn(n.Input)
+	case *Offset:
+		n.Input = fn(n.Input)
+	case *OrderBy:
+		n.Input = fn(n.Input)
+	case *Distinct:
+		n.Input = fn(n.Input)
+	case *Aggregate:
+		n.Input = fn(n.Input)
+	case *Window:
+		n.Input = fn(n.Input)
+	case *Append:
+		n.Left, n.Right = fn(n.Left), fn(n.Right)
+	case *HashSetOp:
+		n.Left, n.Right = fn(n.Left), fn(n.Right)
+	case *NestedLoopJoin:
+		n.Left, n.Right = fn(n.Left), fn(n.Right)
+	case *IndexNestedLoopJoin:
+		n.Left = fn(n.Left)
+	case *HashJoin:
+		n.Left, n.Right = fn(n.Left), fn(n.Right)
+	case *MergeJoin:
+		n.Left, n.Right = fn(n.Left), fn(n.Right)
+	}
+}
+
+// describe returns the operator name and its details.
+func describe(l List) string {
+	switch n := l.(type) {
+	case *Projection:
+		return fmt.Sprintf("Projection (columns: %s)", formatExprs(n.Columns))
+	case *Selection:
+		return fmt.Sprintf("Selection (filter: %s)", formatExpr(n.Filter))
+	case *Limit:
+		return fmt.Sprintf("Limit (%s)", formatExpr(n.Limit))
+	case *Offset:
+		return fmt.Sprintf("Offset (%s)", formatExpr(n.Offset))
+	case *OrderBy:
+		keys := make([]string, len(n.Columns))
+		for i, c := range n.Columns {
+			keys[i] = formatExpr(c) + " " + n.Directirons[i]
+		}
+		s := "OrderBy (keys: " + strings.Join(keys, ", ")
+		if n.TopN > 0 {
+			s += fmt.Sprintf("; top: %d", n.TopN)
+		}
+		return s + ")"
+	case *Distinct:
+		return fmt.Sprintf("Distinct (columns: %s)", formatExprs(n.Columns))
+	case *Aggregate:
+		aggs := make([]Expr, len(n.Aggregates))
+		for i, a := range n.Aggregates {
+			aggs[i] = a
+		}
+		if len(n.GroupBy) == 0 {
+			return fmt.Sprintf("Aggregate (aggregates: %s)", formatExprs(aggs))
+		}
+		return fmt.Sprintf("Aggregate (group by: %s; aggregates: %s)", formatExprs(n.GroupBy), formatExprs(aggs))
+	case *Window:
+		funcs := make([]Expr, len(n.Funcs))
+		for i, f := range n.Funcs {
+			funcs[i] = f
+		}
+		details := []string{}
+		if len(n.PartitionBy) > 0 {
+			details = append(details, "partition by: "+formatExprs(n.PartitionBy))
+		}
+		if len(n.OrderBy) > 0 {
+			details = append(details, "order by: "+formatExprs(n.OrderBy))
+		}
+		return fmt.Sprintf("Window (%s)", strings.Join(append(details, "functions: "+formatExprs(funcs)), "; "))
+	case *Values:
+		return fmt.Sprintf("Values (rows: %d)", len(n.Rows))
+	case *Append:
+		return "Append"
+	case *HashSetOp:
+		if n.All {
+			return fmt.Sprintf("HashSetOp (%s all)", n.Type)
+		}
+		return fmt.Sprintf("HashSetOp (%s)", n.Type)
+	case *Scan:
+		return "Scan on " + formatTable(n.Table)
+	case *IndexScan:
+		s := fmt.Sprintf("IndexScan on %s using %s", formatTable(n.Table), n.Index)
+		conds := []string{}
+		if n.Keys != nil {
+			conds = append(conds, "keys: "+formatExprs(n.Keys))
+		}
+		if n.Low != nil {
+			conds = append(conds, formatBound("key >", n.Low))
+		}
+		if n.High != nil {
+			conds = append(conds, formatBound("key <", n.High))
+		}
+		if len(conds) > 0 {
+			s += " (" + strings.Join(conds, " and ") + ")"
+		}
+		return s
+	case *NestedLoopJoin:
+		return "NestedLoopJoin " + formatJoin(n.Type, nil, nil, n.Condition)
+	case *IndexNestedLoopJoin:
+		return fmt.Sprintf("IndexNestedLoopJoin on %s using %s (%s; key: %s%s)", formatTable(n.Table), n.Index, n.Type, formatExpr(n.LeftKey), formatCondition(n.Condition))
+	case *HashJoin:
+		return "HashJoin " + formatJoin(n.Type, n.LeftKeys, n.RightKeys, n.Condition)
+	case *MergeJoin:
+		return "MergeJoin " + formatJoin(n.Type, n.LeftKeys, n.RightKeys, n.Condition)
+	}
+
+	return fmt.Sprintf("%T", l)
+}
+
+func formatTable(t *Table) string {
+	if t.Alias != "" {
+		return t.Name + " " + t.Alias
+	}
+
+	return t.Name
+}
+
+func formatBound(op string, b *IndexBound) string {
+	if b.Inclusive {
+		op += "="
+	}
+
+	return op + " " + formatExpr(b.Value)
+}
+
+func formatJoin(typ parser.JoinType, leftKeys, rightKeys []Expr, cond Expr) string {
+	s := "(" + typ.String()
+	if len(leftKeys) > 0 {
+		keys := make([]string, len(leftKeys))
+		for i := range leftKeys {
+			keys[i] = formatExpr(leftKeys[i]) + " = " + formatExpr(rightKeys[i])
+		}
+		s += "; keys: " + strings.Join(keys, ", ")
+	}
+
+	return s + formatCondition(cond) + ")"
+}
+
+func formatCondition(cond Expr) string {
+	if cond == nil {
+		return ""
+	}
+
+	return "; condition: " + formatExpr(cond)
+}
+
+func formatStats(s *OperatorStats) string {
+	if s == nil || s.Loops == 0 {
+		return "(never executed)"
+	}
+
+	return fmt.Sprintf("(actual rows=%d loops=%d pages read=%d hit=%d time=%s)", s.Rows, s.Loops, s.PagesRead, s.PagesHit, formatDuration(s.Elapsed))
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3f ms", float64(d)/float64(time.Millisecond))
+}
+
+func formatExprs(exprs []Expr) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = formatExpr(e)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// formatExpr formats the expression like SQL.
+func formatExpr(expr Expr) string {
+	switch e := expr.(type) {
+	case *Column:
+		if e.Table != "" {
+			return e.Table + "." + e.Name
+		}
+		return e.Name
+	case *BoolExpr:
+		return fmt.Sprint(e.Value)
+	case *Int64Expr:
+		return fmt.Sprint(e.Value)
+	case *Float64Expr:
+		return fmt.Sprint(e.Value)
+	case *BytesExpr:
+		return fmt.Sprintf("%q", e.Value)
+	case *StringExpr:
+		return fmt.Sprintf("%q", e.Value)
+	case *TimestampExpr:
+		return `"` + e.Value.UTC().Format("2006-01-02 15:04:05") + `"`
+	case *NullExpr:
+		return "NULL"
+	case *ComparisonExpr:
+		return formatExpr(e.Left) + " " + operators[e.Operator] + " " + formatExpr(e.Right)
+	case *AndExpr:
+		return formatExpr(e.Left) + " and " + formatExpr(e.Right)
+	case *OrExpr:
+		return "(" + formatExpr(e.Left) + " or " + formatExpr(e.Right) + ")"
+	case *NotExpr:
+		return "not (" + formatExpr(e.Operand) + ")"
+	case *IsNullExpr:
+		if e.Not {
+			return formatExpr(e.Operand) + " is not null"
+		}
+		return formatExpr(e.Operand) + " is null"
+	case *InExpr:
+		values := "subquery"
+		if e.Subquery == nil {
+			values = formatExprs(e.Values)
+		}
+		if e.Not {
+			return formatExpr(e.Operand) + " not in (" + values + ")"
+		}
+		return formatExpr(e.Operand) + " in (" + values + ")"
+	case *SubqueryExpr:
+		return "(subquery)"
+	case *ExistsExpr:
+		return "exists (subquery)"
+	case *OuterColumn:
+		return formatExpr(e.Column)
+	case *LikeExpr:
+		if e.Not {
+			return formatExpr(e.Operand) + " not like " + formatExpr(e.Pattern)
+		}
+		return formatExpr(e.Operand) + " like " + formatExpr(e.Pattern)
+	case *CaseExpr:
+		s := "case"
+		if e.Operand != nil {
+			s += " " + formatExpr(e.Operand)
+		}
+		for _, w := range e.Whens {
+			s += " when " + formatExpr(w.Cond) + " then " + formatExpr(w.Result)
+		}
+		if e.Else != nil {
+			s += " else " + formatExpr(e.Else)
+		}
+		return s + " end"
+	case *WindowFunc:
+		if len(e.Args) == 0 && e.Func == "count" {
+			return "count(*)"
+		}
+		return e.Func + "(" + formatExprs(e.Args) + ")"
+	case *AggregateExpr:
+		if e.Arg == nil {
+			return e.Func + "(*)"
+		}
+		return e.Func + "(" + formatExpr(e.Arg) + ")"
+	case *BinaryExpr:
+		return "(" + formatExpr(e.Left) + " " + operators[e.Operator] + " " + formatExpr(e.Right) + ")"
+	case *UnaryMinusExpr:
+		return "-" + formatExpr(e.Operand)
+	case *FuncExpr:
+		return e.Name + "(" + formatExprs(e.Args) + ")"
+	case *NamedExpr:
+		return formatExpr(e.Operand)
+	}
+
+	return fmt.Sprintf("%T", expr)
+}
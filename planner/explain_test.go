@@ -0,0 +1,129 @@
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:  "index range and residual filter",
+			query: `select name from users where id > 10 and id <= 20 and score > 10`,
+			expected: []string{
+				"Projection (columns: users.name)",
+				"-> Selection (filter: users.score > 10)",
+				"  -> IndexScan on users using users_pkey_id (key > 10 and key <= 20)",
+			},
+		},
+		{
+			name:  "join, aggregate and order by",
+			query: `select d.name, count(*) from users u join depts d on u.dept_id = d.id group by d.name order by d.name limit 3`,
+			expected: []string{
+				"Projection (columns: d.name, count(*))",
+				"-> Limit (3)",
+				"  -> Offset (0)",
+				"    -> OrderBy (keys: d.name asc; top: 3)",
+				"      -> Aggregate (group by: d.name; aggregates: count(*))",
+				"        -> HashJoin (inner join; keys: u.dept_id = d.id; condition: u.dept_id = d.id)",
+				"          -> Scan on users u",
+				"          -> Scan on depts d",
+			},
+		},
+		{
+			name:  "subqueries",
+			query: `select name, (select name from depts d where d.id = u.dept_id) from users u where dept_id in (select id from depts) and score > (select max(floor) from depts)`,
+			expected: []string{
+				"Projection (columns: u.name, (subquery))",
+				"-> HashJoin (semi join; keys: u.dept_id = subquery1.c1; condition: u.dept_id = subquery1.c1)",
+				"  -> Selection (filter: u.score > (subquery))",
+				"    -> Scan on users u",
+				"    -> Subquery",
+				"      -> Projection (columns: max(floor))",
+				"        -> Aggregate (aggregates: max(depts.floor))",
+				"          -> Scan on depts",
+				"  -> Projection (columns: depts.id)",
+				"    -> Scan on depts",
+				"-> Subquery (correlated)",
+				"  -> Projection (columns: d.name)",
+				"    -> IndexScan on depts d using depts_pkey_id (keys: u.dept_id)",
+			},
+		},
+		{
+			name:  "set operations",
+			query: `select dept_id from users union select id from depts except all select id from depts where id = 1 order by dept_id`,
+			expected: []string{
+				"Projection (columns: dept_id)",
+				"-> OrderBy (keys: dept_id asc)",
+				"  -> HashSetOp (except all)",
+				"    -> Projection (columns: dept_id)",
+				"      -> Distinct (columns: dept_id)",
+				"        -> Append",
+				"          -> Projection (columns: users.dept_id)",
+				"            -> Scan on users",
+				"          -> Projection (columns: depts.id)",
+				"            -> Scan on depts",
+				"    -> Projection (columns: depts.id)",
+				"      -> IndexScan on depts using depts_pkey_id (keys: 1)",
+			},
+		},
+		{
+			name:  "window functions",
+			query: `select name, rank() over (partition by dept_id order by score desc), sum(score) over (partition by dept_id order by score desc) from users`,
+			expected: []string{
+				"Projection (columns: users.name, rank(), sum(score))",
+				"-> Window (partition by: users.dept_id; order by: users.score; functions: rank(), sum(users.score))",
+				"  -> OrderBy (keys: users.dept_id asc, users.score desc)",
+				"    -> Scan on users",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			plan := planQuery(t, newOptimizerCatalog(true), test.query)
+			testutil.MustEqual(t, Explain(plan, nil), test.expected)
+		})
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	e := newJoinEngine()
+	e.pages["empty"] = nil
+	id := &Column{Table: "users", Name: "id", Index: 0, Type: schema.ColumnTypeInt64}
+
+	plan := &Projection{
+		Input: &NestedLoopJoin{
+			Type:       parser.InnerJoin,
+			Left:       &Selection{Input: &Scan{Table: &Table{Name: "users"}}, Filter: &ComparisonExpr{Left: id, Operator: parser.Op_GT, Right: &Int64Expr{Value: 3}}},
+			Right:      &Scan{Table: &Table{Name: "depts"}},
+			RightWidth: 2,
+		},
+		Columns: []Expr{id},
+	}
+
+	lines, err := ExplainAnalyze(plan, &Env{Engine: e})
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, len(lines), 6)
+	testutil.MustEqual(t, strings.HasPrefix(lines[0], "Projection (columns: users.id) (actual rows=6 loops=1 pages read=7 hit=0 "), true)
+	testutil.MustEqual(t, strings.HasPrefix(lines[1], "-> NestedLoopJoin (inner join) (actual rows=6 loops=1 pages read=7 hit=0 "), true)
+	testutil.MustEqual(t, strings.HasPrefix(lines[2], "  -> Selection (filter: users.id > 3) (actual rows=2 loops=1 pages read=3 hit=0 "), true)
+	testutil.MustEqual(t, strings.HasPrefix(lines[3], "    -> Scan on users (actual rows=5 loops=1 pages read=3 hit=0 "), true)
+	testutil.MustEqual(t, strings.HasPrefix(lines[4], "  -> Scan on depts (actual rows=6 loops=2 pages read=4 hit=0 "), true)
+	testutil.MustEqual(t, strings.HasPrefix(lines[5], "Execution time: "), true)
+
+	// the inner side is never opened when the outer side is empty
+	plan.Input.(*NestedLoopJoin).Left = &Scan{Table: &Table{Name: "empty"}}
+	lines, err = ExplainAnalyze(plan, &Env{Engine: e})
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, lines[3], "  -> Scan on depts (never executed)")
+}
@@ -0,0 +1,658 @@
+package planner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// eval evaluates the expression for the tuple and returns the value as Go value.
+// NULL is represented as nil. Predicates follow three-valued logic; they return true, false,
+// or nil which means unknown.
+func eval(expr Expr, t sdb.Tuple) (interface{}, error) {
+	switch e := expr.(type) {
+	case *Column:
+		return t.Value(e.Index), nil
+	case *BoolExpr:
+		return e.Value, nil
+	case *Int64Expr:
+		return e.Value, nil
+	case *Float64Expr:
+		return e.Value, nil
+	case *BytesExpr:
+		return e.Value, nil
+	case *StringExpr:
+		return e.Value, nil
+	case *TimestampExpr:
+		return e.Value, nil
+	case *NullExpr:
+		return nil, nil
+	case *ComparisonExpr:
+		return evalComparison(e, t)
+	case *AndExpr:
+		return evalLogical(e.Left, e.Right, false, t)
+	case *OrExpr:
+		return evalLogical(e.Left, e.Right, true, t)
+	case *NotExpr:
+		v, err := evalBool(e.Operand, t)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return !v.(bool), nil
+	case *IsNullExpr:
+		v, err := eval(e.Operand, t)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.Not, nil
+	case *BinaryExpr:
+		return evalBinary(e, t)
+	case *UnaryMinusExpr:
+		v, err := eval(e.Operand, t)
+		if err != nil {
+			return nil, err
+		}
+		switch x := v.(type) {
+		case int64:
+			if x == math.MinInt64 {
+				return nil, errOutOfRange
+			}
+			return -x, nil
+		case float64:
+			return -x, nil
+		case nil:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot negate %v", v)
+	case *InExpr:
+		return evalIn(e, t)
+	case *LikeExpr:
+		return evalLike(e, t)
+	case *CaseExpr:
+		return evalCase(e, t)
+	case *SubqueryExpr:
+		return evalSubquery(e, t)
+	case *ExistsExpr:
+		rows, err := e.Subquery.run(t, 1)
+		if err != nil {
+			return nil, err
+		}
+		return len(rows) > 0, nil
+	case *OuterColumn:
+		return e.Outer.tuple.Value(e.Column.Index), nil
+	case *FuncExpr:
+		return evalFunc(e, t)
+	case *NamedExpr:
+		return eval(e.Operand, t)
+	}
+
+	return nil, fmt.Errorf("unexpected expression %T", expr)
+}
+
+// evalPredicate evaluates the predicate for the tuple. It returns true only when the result is true;
+// false and unknown are not distinguished.
+func evalPredicate(expr Expr, t sdb.Tuple) (bool, error) {
+	v, err := evalBool(expr, t)
+	if err != nil || v == nil {
+		return false, err
+	}
+
+	return v.(bool), nil
+}
+
+// evalBool evaluates the expression which must be boolean. The result is bool or nil (unknown).
+func evalBool(expr Expr, t sdb.Tuple) (interface{}, error) {
+	v, err := eval(expr, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, nil
+	}
+
+	if _, ok := v.(bool); !ok {
+		return nil, fmt.Errorf("boolean is expected but got %v", v)
+	}
+
+	return v, nil
+}
+
+// evalLogical evaluates AND (or is false) or OR (or is true).
+// When one operand decides the result (false for AND, true for OR), the result is decided even if
+// the other operand is unknown.
+func evalLogical(left, right Expr, or bool, t sdb.Tuple) (interface{}, error) {
+	l, err := evalBool(left, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// short circuit
+	if l != nil && l.(bool) == or {
+		return or, nil
+	}
+
+	r, err := evalBool(right, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if r != nil && r.(bool) == or {
+		return or, nil
+	}
+
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	return !or, nil
+}
+
+func evalComparison(e *ComparisonExpr, t sdb.Tuple) (interface{}, error) {
+	l, err := eval(e.Left, t)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := eval(e.Right, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	cmp, ok := compareValues(l, r)
+	if !ok {
+		return nil, fmt.Errorf("cannot compare %v and %v", l, r)
+	}
+
+	switch e.Operator {
+	case parser.Op_EQ:
+		return cmp == 0, nil
+	case parser.Op_NEQ:
+		return cmp != 0, nil
+	case parser.Op_LT:
+		return cmp < 0, nil
+	case parser.Op_LTE:
+		return cmp <= 0, nil
+	case parser.Op_GT:
+		return cmp > 0, nil
+	case parser.Op_GTE:
+		return cmp >= 0, nil
+	}
+
+	return nil, fmt.Errorf("unexpected operator %v", e.Operator)
+}
+
+// evalIn evaluates IN. It is true when any value is equal to the operand. When no value is equal and
+// the operand or some value is NULL, it is unknown. IN with no value, which is the empty result of the
+// subquery, is false even for NULL.
+func evalIn(e *InExpr, t sdb.Tuple) (interface{}, error) {
+	v, err := eval(e.Operand, t)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	if e.Subquery != nil {
+		rows, err := e.Subquery.run(t, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			values = append(values, row.Value(0))
+		}
+	} else {
+		for _, val := range e.Values {
+			x, err := eval(val, t)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, x)
+		}
+	}
+
+	if len(values) == 0 {
+		return e.Not, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	unknown := false
+	for _, x := range values {
+		if x == nil {
+			unknown = true
+			continue
+		}
+
+		cmp, ok := compareValues(v, x)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v and %v", v, x)
+		}
+		if cmp == 0 {
+			return !e.Not, nil
+		}
+	}
+
+	if unknown {
+		return nil, nil
+	}
+
+	return e.Not, nil
+}
+
+func evalLike(e *LikeExpr, t sdb.Tuple) (interface{}, error) {
+	v, err := eval(e.Operand, t)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := eval(e.Pattern, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil || p == nil {
+		return nil, nil
+	}
+
+	s, ok1 := v.(string)
+	pattern, ok2 := p.(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("LIKE cannot be applied to %v and %v", v, p)
+	}
+
+	return likeMatch(s, pattern) != e.Not, nil
+}
+
+// likeMatch reports if s matches the LIKE pattern. "%" matches any sequence of characters, "_" matches
+// any single character, and "\" escapes the next character.
+func likeMatch(s, pattern string) bool {
+	str, pat := []rune(s), []rune(pattern)
+	si, pi := 0, 0
+	// When the characters do not match after "%", the pattern after the "%" (star) is tried again
+	// from the next character of str (mark).
+	star, mark := -1, 0
+	for si < len(str) {
+		if pi < len(pat) {
+			switch c := pat[pi]; {
+			case c == '%':
+				star, mark = pi+1, si
+				pi++
+				continue
+			case c == '_':
+				si++
+				pi++
+				continue
+			case c == '\\' && pi+1 < len(pat):
+				if pat[pi+1] == str[si] {
+					si++
+					pi += 2
+					continue
+				}
+			case c == str[si]:
+				si++
+				pi++
+				continue
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+		mark++
+		si, pi = mark, star
+	}
+
+	for pi < len(pat) && pat[pi] == '%' {
+		pi++
+	}
+
+	return pi == len(pat)
+}
+
+// likePrefix splits the LIKE pattern into the prefix without wildcards and the rest starting with a wildcard.
+// The escapes in the prefix are removed.
+func likePrefix(pattern string) (string, string) {
+	var prefix strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '%' || c == '_':
+			return prefix.String(), pattern[i:]
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			prefix.WriteByte(pattern[i])
+		default:
+			prefix.WriteByte(c)
+		}
+	}
+
+	return prefix.String(), ""
+}
+
+// evalCase evaluates CASE. The result is NULL when no When matches and Else is omitted.
+func evalCase(e *CaseExpr, t sdb.Tuple) (interface{}, error) {
+	var operand interface{}
+	if e.Operand != nil {
+		v, err := eval(e.Operand, t)
+		if err != nil {
+			return nil, err
+		}
+		operand = v
+	}
+
+	result := e.Else
+	for _, w := range e.Whens {
+		var match bool
+		if e.Operand == nil {
+			m, err := evalPredicate(w.Cond, t)
+			if err != nil {
+				return nil, err
+			}
+			match = m
+		} else if operand != nil {
+			v, err := eval(w.Cond, t)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				cmp, ok := compareValues(operand, v)
+				if !ok {
+					return nil, fmt.Errorf("cannot compare %v and %v", operand, v)
+				}
+				match = cmp == 0
+			}
+		}
+
+		if match {
+			result = w.Result
+			break
+		}
+	}
+
+	if result == nil {
+		return nil, nil
+	}
+
+	v, err := eval(result, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// int64 result is converted when the other results are float64
+	if i, ok := v.(int64); ok && e.Type == schema.ColumnTypeFloat64 {
+		return float64(i), nil
+	}
+
+	return v, nil
+}
+
+// operators are the symbols of the operators.
+var operators = map[parser.OperatorType]string{
+	parser.Op_EQ:  "=",
+	parser.Op_NEQ: "<>",
+	parser.Op_LT:  "<",
+	parser.Op_LTE: "<=",
+	parser.Op_GT:  ">",
+	parser.Op_GTE: ">=",
+
+	parser.Op_ADD:    "+",
+	parser.Op_SUB:    "-",
+	parser.Op_MUL:    "*",
+	parser.Op_DIV:    "/",
+	parser.Op_MOD:    "%",
+	parser.Op_CONCAT: "||",
+}
+
+// evalBinary evaluates the arithmetic operation or the concatenation. The result is NULL when either
+// operand is NULL. Arithmetic on two int64 values is int64; the division truncates toward zero.
+func evalBinary(e *BinaryExpr, t sdb.Tuple) (interface{}, error) {
+	l, err := eval(e.Left, t)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := eval(e.Right, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	if e.Operator == parser.Op_CONCAT {
+		return schema.FormatValue(l) + schema.FormatValue(r), nil
+	}
+
+	li, lok := l.(int64)
+	ri, rok := r.(int64)
+	if lok && rok {
+		return evalInt64(e.Operator, li, ri)
+	}
+
+	lf, lok := toFloat64(l)
+	rf, rok := toFloat64(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %v and %v", operators[e.Operator], l, r)
+	}
+
+	return evalFloat64(e.Operator, lf, rf)
+}
+
+// evalInt64 computes the int64 arithmetic. Unlike Go, overflow is an error instead of wrapping around.
+func evalInt64(op parser.OperatorType, a, b int64) (interface{}, error) {
+	switch op {
+	case parser.Op_ADD:
+		c := a + b
+		// overflow happens only when a and b have the same sign and c has the other
+		if (a^c)&(b^c) < 0 {
+			return nil, errOutOfRange
+		}
+		return c, nil
+	case parser.Op_SUB:
+		c := a - b
+		if (a^b)&(a^c) < 0 {
+			return nil, errOutOfRange
+		}
+		return c, nil
+	case parser.Op_MUL:
+		c := a * b
+		if a != 0 && (c/a != b || (a == -1 && b == math.MinInt64)) {
+			return nil, errOutOfRange
+		}
+		return c, nil
+	case parser.Op_DIV, parser.Op_MOD:
+		if b == 0 {
+			return nil, errDivisionByZero
+		}
+		if op == parser.Op_DIV {
+			if a == math.MinInt64 && b == -1 {
+				return nil, errOutOfRange
+			}
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+
+	return nil, fmt.Errorf("unexpected operator %v", op)
+}
+
+func evalFloat64(op parser.OperatorType, a, b float64) (interface{}, error) {
+	switch op {
+	case parser.Op_ADD:
+		return a + b, nil
+	case parser.Op_SUB:
+		return a - b, nil
+	case parser.Op_MUL:
+		return a * b, nil
+	case parser.Op_DIV, parser.Op_MOD:
+		if b == 0 {
+			return nil, errDivisionByZero
+		}
+		if op == parser.Op_DIV {
+			return a / b, nil
+		}
+		return math.Mod(a, b), nil
+	}
+
+	return nil, fmt.Errorf("unexpected operator %v", op)
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+var errOutOfRange = errors.New("int64 out of range")
+
+// toFloat64 converts the number to float64.
+func toFloat64(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+
+	return 0, false
+}
+
+// compareValues compares a and b. The result is negative when a < b, 0 when a == b, positive when a > b.
+// When either a or b is NULL or they are not comparable, false is returned as the second value.
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	switch av := a.(type) {
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		default:
+			return 1, true
+		}
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return compareInt64(av, bv), true
+		case float64:
+			return compareFloat64(float64(av), bv), true
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return compareFloat64(av, float64(bv)), true
+		case float64:
+			return compareFloat64(av, bv), true
+		}
+	case []byte:
+		if bv, ok := b.([]byte); ok {
+			return bytes.Compare(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			switch {
+			case av < bv:
+				return -1, true
+			case av > bv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			switch {
+			case av.Before(bv):
+				return -1, true
+			case av.After(bv):
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// encodeKey encodes the values into a string which can be used as a key of map.
+// The keys are the same only when all the values are the same. NULLs are considered the same.
+func encodeKey(values []interface{}) string {
+	var buf bytes.Buffer
+	for _, v := range values {
+		var bs []byte
+		switch x := v.(type) {
+		case nil:
+			buf.WriteByte(0)
+			continue
+		case bool:
+			buf.WriteByte(1)
+			if x {
+				bs = []byte{1}
+			} else {
+				bs = []byte{0}
+			}
+		case int64:
+			buf.WriteByte(2)
+			bs = make([]byte, 8)
+			binary.BigEndian.PutUint64(bs, uint64(x))
+		case float64:
+			buf.WriteByte(3)
+			bs = make([]byte, 8)
+			binary.BigEndian.PutUint64(bs, math.Float64bits(x))
+		case []byte:
+			buf.WriteByte(4)
+			bs = x
+		case string:
+			buf.WriteByte(5)
+			bs = []byte(x)
+		case time.Time:
+			buf.WriteByte(6)
+			bs = make([]byte, 8)
+			binary.BigEndian.PutUint64(bs, uint64(x.UnixNano()))
+		}
+
+		// length prefix makes the boundary of the values unambiguous
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(bs)))
+		buf.Write(length)
+		buf.Write(bs)
+	}
+
+	return buf.String()
+}
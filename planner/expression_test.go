@@ -0,0 +1,174 @@
+package planner
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestEval(t *testing.T) {
+	// id, name, nickname, age, score
+	tuple := engine.NewTuple([]interface{}{int64(1), "bob", "bob", nil, float64(1.5)}, 0)
+	id := &Column{Name: "id", Index: 0}
+	name := &Column{Name: "name", Index: 1}
+	nickname := &Column{Name: "nickname", Index: 2}
+	age := &Column{Name: "age", Index: 3}
+	score := &Column{Name: "score", Index: 4}
+
+	tr := &BoolExpr{Value: true}
+	fa := &BoolExpr{Value: false}
+	unknown := &ComparisonExpr{Left: age, Operator: parser.Op_EQ, Right: &Int64Expr{Value: 1}}
+
+	tests := []struct {
+		name     string
+		expr     Expr
+		expected interface{}
+	}{
+		{name: "column", expr: name, expected: "bob"},
+		{name: "null column", expr: age, expected: nil},
+		{name: "equal", expr: &ComparisonExpr{Left: name, Operator: parser.Op_EQ, Right: &StringExpr{Value: "bob"}}, expected: true},
+		{name: "not equal", expr: &ComparisonExpr{Left: id, Operator: parser.Op_NEQ, Right: &Int64Expr{Value: 2}}, expected: true},
+		{name: "less than", expr: &ComparisonExpr{Left: id, Operator: parser.Op_LT, Right: &Int64Expr{Value: 1}}, expected: false},
+		{name: "less than or equal", expr: &ComparisonExpr{Left: id, Operator: parser.Op_LTE, Right: &Int64Expr{Value: 1}}, expected: true},
+		{name: "greater than", expr: &ComparisonExpr{Left: score, Operator: parser.Op_GT, Right: id}, expected: true},
+		{name: "greater than or equal", expr: &ComparisonExpr{Left: id, Operator: parser.Op_GTE, Right: &Float64Expr{Value: 1.5}}, expected: false},
+		{name: "column vs column", expr: &ComparisonExpr{Left: name, Operator: parser.Op_EQ, Right: nickname}, expected: true},
+		{name: "compared with null column", expr: unknown, expected: nil},
+		{name: "compared with null", expr: &ComparisonExpr{Left: id, Operator: parser.Op_EQ, Right: &NullExpr{}}, expected: nil},
+		{name: "is null", expr: &IsNullExpr{Operand: age}, expected: true},
+		{name: "is not null", expr: &IsNullExpr{Operand: name, Not: true}, expected: true},
+		{name: "true and unknown", expr: &AndExpr{Left: tr, Right: unknown}, expected: nil},
+		{name: "false and unknown", expr: &AndExpr{Left: unknown, Right: fa}, expected: false},
+		{name: "true and true", expr: &AndExpr{Left: tr, Right: tr}, expected: true},
+		{name: "true or unknown", expr: &OrExpr{Left: unknown, Right: tr}, expected: true},
+		{name: "false or unknown", expr: &OrExpr{Left: fa, Right: unknown}, expected: nil},
+		{name: "false or false", expr: &OrExpr{Left: fa, Right: fa}, expected: false},
+		{name: "not true", expr: &NotExpr{Operand: tr}, expected: false},
+		{name: "not unknown", expr: &NotExpr{Operand: unknown}, expected: nil},
+		{name: "int64 addition", expr: &BinaryExpr{Left: id, Operator: parser.Op_ADD, Right: &Int64Expr{Value: 2}}, expected: int64(3)},
+		{name: "int64 and float64", expr: &BinaryExpr{Left: id, Operator: parser.Op_SUB, Right: score}, expected: float64(-0.5)},
+		{name: "multiplication", expr: &BinaryExpr{Left: score, Operator: parser.Op_MUL, Right: &Int64Expr{Value: 2}}, expected: float64(3)},
+		{name: "int64 division truncates", expr: &BinaryExpr{Left: &Int64Expr{Value: -7}, Operator: parser.Op_DIV, Right: &Int64Expr{Value: 2}}, expected: int64(-3)},
+		{name: "float64 division", expr: &BinaryExpr{Left: &Int64Expr{Value: 7}, Operator: parser.Op_DIV, Right: &Float64Expr{Value: 2}}, expected: float64(3.5)},
+		{name: "modulo", expr: &BinaryExpr{Left: &Int64Expr{Value: -7}, Operator: parser.Op_MOD, Right: &Int64Expr{Value: 3}}, expected: int64(-1)},
+		{name: "arithmetic with null", expr: &BinaryExpr{Left: age, Operator: parser.Op_ADD, Right: id}, expected: nil},
+		{name: "concatenation", expr: &BinaryExpr{Left: name, Operator: parser.Op_CONCAT, Right: score}, expected: "bob1.5"},
+		{name: "concatenation with null", expr: &BinaryExpr{Left: name, Operator: parser.Op_CONCAT, Right: age}, expected: nil},
+		{name: "unary minus", expr: &UnaryMinusExpr{Operand: score}, expected: float64(-1.5)},
+		{name: "named expression", expr: &NamedExpr{Operand: &UnaryMinusExpr{Operand: id}, Name: "-id"}, expected: int64(-1)},
+		{name: "in", expr: &InExpr{Operand: id, Values: []Expr{&Int64Expr{Value: 2}, &Float64Expr{Value: 1}}}, expected: true},
+		{name: "in with null", expr: &InExpr{Operand: id, Values: []Expr{&Int64Expr{Value: 2}, age}}, expected: nil},
+		{name: "in matches before null", expr: &InExpr{Operand: id, Values: []Expr{age, &Int64Expr{Value: 1}}}, expected: true},
+		{name: "not in", expr: &InExpr{Operand: name, Values: []Expr{&StringExpr{Value: "alice"}}, Not: true}, expected: true},
+		{name: "not in with null", expr: &InExpr{Operand: id, Values: []Expr{age}, Not: true}, expected: nil},
+		{name: "in of null", expr: &InExpr{Operand: age, Values: []Expr{&Int64Expr{Value: 1}}}, expected: nil},
+		{name: "like", expr: &LikeExpr{Operand: name, Pattern: &StringExpr{Value: "b%"}}, expected: true},
+		{name: "not like", expr: &LikeExpr{Operand: name, Pattern: &StringExpr{Value: "b_b"}, Not: true}, expected: false},
+		{name: "like with null", expr: &LikeExpr{Operand: name, Pattern: &NullExpr{}}, expected: nil},
+		{
+			name: "searched case",
+			expr: &CaseExpr{
+				Whens: []*When{{Cond: unknown, Result: &Int64Expr{Value: 1}}, {Cond: tr, Result: &Int64Expr{Value: 2}}},
+				Else:  &Float64Expr{Value: 3},
+				Type:  schema.ColumnTypeFloat64,
+			},
+			expected: float64(2),
+		},
+		{name: "simple case", expr: &CaseExpr{Operand: name, Whens: []*When{{Cond: nickname, Result: id}}}, expected: int64(1)},
+		{name: "case without else", expr: &CaseExpr{Operand: age, Whens: []*When{{Cond: age, Result: id}}}, expected: nil},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			v, err := eval(test.expr, tuple)
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, v, test.expected)
+		})
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		s        string
+		pattern  string
+		expected bool
+	}{
+		{s: "abc", pattern: "abc", expected: true},
+		{s: "abc", pattern: "ab", expected: false},
+		{s: "abc", pattern: "a%", expected: true},
+		{s: "abc", pattern: "%c", expected: true},
+		{s: "abc", pattern: "%b%", expected: true},
+		{s: "abc", pattern: "a_c", expected: true},
+		{s: "abc", pattern: "_", expected: false},
+		{s: "", pattern: "%", expected: true},
+		{s: "abcbd", pattern: "%b_", expected: true},
+		{s: "abcbd", pattern: "a%b%c", expected: false},
+		{s: "日本語", pattern: "_本_", expected: true},
+		{s: "10%", pattern: "10\\%", expected: true},
+		{s: "100", pattern: "10\\%", expected: false},
+		{s: "a_c", pattern: "a\\_%", expected: true},
+	}
+
+	for _, test := range tests {
+		testutil.MustEqual(t, likeMatch(test.s, test.pattern), test.expected)
+	}
+}
+
+func TestEval_Error(t *testing.T) {
+	tuple := engine.NewTuple([]interface{}{int64(1), "bob"}, 0)
+
+	_, err := eval(&ComparisonExpr{Left: &Column{Index: 0}, Operator: parser.Op_EQ, Right: &Column{Index: 1}}, tuple)
+	testutil.MustEqual(t, err != nil, true)
+
+	_, err = evalPredicate(&Column{Index: 0}, tuple)
+	testutil.MustEqual(t, err != nil, true)
+
+	_, err = eval(&BinaryExpr{Left: &Column{Index: 0}, Operator: parser.Op_DIV, Right: &Int64Expr{Value: 0}}, tuple)
+	testutil.MustEqual(t, err, errDivisionByZero)
+
+	_, err = eval(&BinaryExpr{Left: &Float64Expr{Value: 1}, Operator: parser.Op_MOD, Right: &Float64Expr{Value: 0}}, tuple)
+	testutil.MustEqual(t, err, errDivisionByZero)
+}
+
+func TestEval_Int64Overflow(t *testing.T) {
+	binary := func(l int64, op parser.OperatorType, r int64) Expr {
+		return &BinaryExpr{Left: &Int64Expr{Value: l}, Operator: op, Right: &Int64Expr{Value: r}}
+	}
+
+	tests := []struct {
+		name     string
+		expr     Expr
+		expected interface{}
+		err      error
+	}{
+		{name: "add", expr: binary(math.MaxInt64, parser.Op_ADD, 1), err: errOutOfRange},
+		{name: "add negative", expr: binary(math.MinInt64, parser.Op_ADD, -1), err: errOutOfRange},
+		{name: "add max", expr: binary(math.MaxInt64-1, parser.Op_ADD, 1), expected: int64(math.MaxInt64)},
+		{name: "sub", expr: binary(math.MinInt64, parser.Op_SUB, 1), err: errOutOfRange},
+		{name: "sub negative", expr: binary(0, parser.Op_SUB, math.MinInt64), err: errOutOfRange},
+		{name: "sub min", expr: binary(-1, parser.Op_SUB, math.MaxInt64), expected: int64(math.MinInt64)},
+		{name: "mul", expr: binary(math.MaxInt64/2+1, parser.Op_MUL, 2), err: errOutOfRange},
+		{name: "mul min by -1", expr: binary(math.MinInt64, parser.Op_MUL, -1), err: errOutOfRange},
+		{name: "mul -1 by min", expr: binary(-1, parser.Op_MUL, math.MinInt64), err: errOutOfRange},
+		{name: "mul min", expr: binary(math.MinInt64/2, parser.Op_MUL, 2), expected: int64(math.MinInt64)},
+		{name: "div", expr: binary(math.MinInt64, parser.Op_DIV, -1), err: errOutOfRange},
+		{name: "mod", expr: binary(math.MinInt64, parser.Op_MOD, -1), expected: int64(0)},
+		{name: "negate", expr: &UnaryMinusExpr{Operand: &Int64Expr{Value: math.MinInt64}}, err: errOutOfRange},
+		{name: "abs", expr: &FuncExpr{Name: "abs", Args: []Expr{&Int64Expr{Value: math.MinInt64}}, Type: schema.ColumnTypeInt64}, err: errOutOfRange},
+		{name: "abs min", expr: &FuncExpr{Name: "abs", Args: []Expr{&Int64Expr{Value: math.MinInt64 + 1}}, Type: schema.ColumnTypeInt64}, expected: int64(math.MaxInt64)},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			v, err := eval(test.expr, engine.NewTuple([]interface{}{}, 0))
+			testutil.MustEqual(t, err, test.err)
+			testutil.MustEqual(t, v, test.expected)
+		})
+	}
+}
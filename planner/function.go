@@ -0,0 +1,191 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// evalFunc evaluates the scalar function. The result is NULL when any argument is NULL,
+// except for coalesce which returns the first non-NULL argument.
+func evalFunc(f *FuncExpr, t sdb.Tuple) (interface{}, error) {
+	args := make([]interface{}, len(f.Args))
+	for i, arg := range f.Args {
+		v, err := eval(arg, t)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch f.Name {
+	case "coalesce":
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			// int64 argument is converted when the result is float64
+			if i, ok := arg.(int64); ok && f.Type == schema.ColumnTypeFloat64 {
+				return float64(i), nil
+			}
+			return arg, nil
+		}
+		return nil, nil
+	case "now":
+		return time.Now(), nil
+	}
+
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+
+	switch f.Name {
+	case "lower":
+		return strings.ToLower(args[0].(string)), nil
+	case "upper":
+		return strings.ToUpper(args[0].(string)), nil
+	case "length":
+		if b, ok := args[0].([]byte); ok {
+			return int64(len(b)), nil
+		}
+		return int64(utf8.RuneCountInString(args[0].(string))), nil
+	case "substr":
+		count := int64(-1)
+		if len(args) == 3 {
+			count = args[2].(int64)
+			if count < 0 {
+				return nil, errors.New("negative substring length is not allowed")
+			}
+		}
+		return substr(args[0].(string), args[1].(int64), count), nil
+	case "abs":
+		if i, ok := args[0].(int64); ok {
+			if i == math.MinInt64 {
+				return nil, errOutOfRange
+			}
+			if i < 0 {
+				return -i, nil
+			}
+			return i, nil
+		}
+		return math.Abs(args[0].(float64)), nil
+	case "round":
+		digits := int64(0)
+		if len(args) == 2 {
+			digits = args[1].(int64)
+		}
+		if i, ok := args[0].(int64); ok {
+			return roundInt64(i, digits), nil
+		}
+		p := math.Pow10(int(digits))
+		return math.Round(args[0].(float64)*p) / p, nil
+	case "date_trunc":
+		return dateTrunc(strings.ToLower(args[0].(string)), args[1].(time.Time)), nil
+	case "extract":
+		return extract(strings.ToLower(args[0].(string)), args[1].(time.Time)), nil
+	}
+
+	return nil, fmt.Errorf("unknown function %s", f.Name)
+}
+
+// substr returns count characters of s from start. The first character is at 1.
+// The characters before the first one are counted but not returned, so substr("abc", 0, 2) is "a".
+// Negative count means the rest of the string.
+func substr(s string, start, count int64) string {
+	runes := []rune(s)
+	end := int64(len(runes))
+	if count >= 0 && start+count-1 < end {
+		end = start + count - 1
+	}
+	if start < 1 {
+		start = 1
+	}
+	if start > end {
+		return ""
+	}
+
+	return string(runes[start-1 : end])
+}
+
+// roundInt64 rounds the integer to the digits. Only negative digits change the value; e.g. roundInt64(1250, -2) is 1300.
+// Halfway values are rounded away from zero.
+func roundInt64(i, digits int64) int64 {
+	if digits >= 0 {
+		return i
+	}
+	if digits < -18 {
+		return 0
+	}
+
+	p := int64(math.Pow10(int(-digits)))
+	half := p / 2
+	if i < 0 {
+		return -((-i + half) / p * p)
+	}
+
+	return (i + half) / p * p
+}
+
+// dateTrunc truncates the timestamp to the precision of the field. The week starts on Monday.
+func dateTrunc(field string, t time.Time) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch field {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case "quarter":
+		return time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	}
+
+	// second
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+// extract returns the field of the timestamp. The week is ISO 8601 week number, dow is the day of the week
+// from Sunday (0), doy is the day of the year, and epoch is the seconds since 1970-01-01 00:00:00 UTC.
+func extract(field string, t time.Time) int64 {
+	switch field {
+	case "year":
+		return int64(t.Year())
+	case "quarter":
+		return int64(t.Month()-1)/3 + 1
+	case "month":
+		return int64(t.Month())
+	case "week":
+		_, week := t.ISOWeek()
+		return int64(week)
+	case "day":
+		return int64(t.Day())
+	case "hour":
+		return int64(t.Hour())
+	case "minute":
+		return int64(t.Minute())
+	case "second":
+		return int64(t.Second())
+	case "dow":
+		return int64(t.Weekday())
+	case "doy":
+		return int64(t.YearDay())
+	}
+
+	// epoch
+	return t.Unix()
+}
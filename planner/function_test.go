@@ -0,0 +1,77 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestEvalFunc(t *testing.T) {
+	// name, score, count, registered, nothing
+	registered := time.Date(2021, 5, 12, 10, 20, 30, 0, time.UTC) // Wednesday
+	tuple := engine.NewTuple([]interface{}{"Çarol", float64(-2.25), int64(-1250), registered, nil}, 0)
+	name := &Column{Index: 0, Type: schema.ColumnTypeString}
+	score := &Column{Index: 1, Type: schema.ColumnTypeFloat64}
+	count := &Column{Index: 2, Type: schema.ColumnTypeInt64}
+	ts := &Column{Index: 3, Type: schema.ColumnTypeTimestamp}
+	nothing := &Column{Index: 4, Type: schema.ColumnTypeInt64}
+
+	fn := func(name string, args ...Expr) *FuncExpr {
+		f := &FuncExpr{Name: name, Args: args}
+		f.Type = funcType(f)
+		return f
+	}
+	i := func(v int64) *Int64Expr { return &Int64Expr{Value: v} }
+	s := func(v string) *StringExpr { return &StringExpr{Value: v} }
+
+	tests := []struct {
+		name     string
+		expr     Expr
+		expected interface{}
+	}{
+		{name: "lower", expr: fn("lower", name), expected: "çarol"},
+		{name: "upper", expr: fn("upper", name), expected: "ÇAROL"},
+		{name: "length counts characters", expr: fn("length", name), expected: int64(5)},
+		{name: "substr", expr: fn("substr", name, i(2), i(3)), expected: "aro"},
+		{name: "substr to the end", expr: fn("substr", name, i(3)), expected: "rol"},
+		{name: "substr from before the start", expr: fn("substr", name, i(0), i(2)), expected: "Ç"},
+		{name: "substr after the end", expr: fn("substr", name, i(9)), expected: ""},
+		{name: "abs of int64", expr: fn("abs", count), expected: int64(1250)},
+		{name: "abs of float64", expr: fn("abs", score), expected: float64(2.25)},
+		{name: "round", expr: fn("round", score), expected: float64(-2)},
+		{name: "round to the digits", expr: fn("round", score, i(1)), expected: float64(-2.3)},
+		{name: "round int64 to tens", expr: fn("round", count, i(-2)), expected: int64(-1300)},
+		{name: "null argument", expr: fn("lower", &NullExpr{}), expected: nil},
+		{name: "coalesce", expr: fn("coalesce", nothing, count, i(0)), expected: int64(-1250)},
+		{name: "coalesce converted to float64", expr: fn("coalesce", nothing, i(1), score), expected: float64(1)},
+		{name: "coalesce of nulls", expr: fn("coalesce", nothing, &NullExpr{}), expected: nil},
+		{name: "date_trunc year", expr: fn("date_trunc", s("year"), ts), expected: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "date_trunc quarter", expr: fn("date_trunc", s("quarter"), ts), expected: time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "date_trunc week", expr: fn("date_trunc", s("week"), ts), expected: time.Date(2021, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "date_trunc hour", expr: fn("date_trunc", s("HOUR"), ts), expected: time.Date(2021, 5, 12, 10, 0, 0, 0, time.UTC)},
+		{name: "extract month", expr: fn("extract", s("month"), ts), expected: int64(5)},
+		{name: "extract quarter", expr: fn("extract", s("quarter"), ts), expected: int64(2)},
+		{name: "extract dow", expr: fn("extract", s("dow"), ts), expected: int64(3)},
+		{name: "extract doy", expr: fn("extract", s("doy"), ts), expected: int64(132)},
+		{name: "extract epoch", expr: fn("extract", s("epoch"), ts), expected: registered.Unix()},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			v, err := eval(test.expr, tuple)
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, v, test.expected)
+		})
+	}
+}
+
+func TestEvalFunc_Now(t *testing.T) {
+	before := time.Now()
+	v, err := eval(&FuncExpr{Name: "now", Args: []Expr{}, Type: schema.ColumnTypeTimestamp}, engine.NewTuple([]interface{}{}, -1))
+	testutil.MustBeNil(t, err)
+	testutil.MustEqual(t, !v.(time.Time).Before(before) && !v.(time.Time).After(time.Now()), true)
+}
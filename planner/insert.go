@@ -1,8 +1,10 @@
 package planner
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/dty1er/sdb/engine"
 	"github.com/dty1er/sdb/parser"
 	"github.com/dty1er/sdb/schema"
 	"github.com/dty1er/sdb/sdb"
@@ -13,12 +15,42 @@ type Indices struct {
 	Idx  []*schema.Index
 }
 
+// InsertPlan inserts Values with their Indices. When the values are not known until the execution, i.e.
+// INSERT ... SELECT or VALUES of expressions, the rows are produced by Source instead, and Columns is
+// the position in the table of each column of the source.
 type InsertPlan struct {
 	sdb.Plan
 
-	Table   *schema.Table
-	Indices []*Indices
-	Values  [][]interface{}
+	Table *schema.Table
+	// PrimaryKey is the index of the primary key, which is probed to reject or resolve the conflict.
+	PrimaryKey *schema.Index
+	Indices    []*Indices
+	Values     [][]interface{}
+
+	Source  *Projection
+	Columns []int
+	// ReadsTable is true when Source reads the table to be inserted. Every row must be read before inserting
+	// so that the inserted rows are not read again.
+	ReadsTable bool
+
+	// OnConflict is the action for the row whose primary key already exists. nil when it is not given.
+	OnConflict *OnConflict
+	// Returning is the columns computed for each inserted or updated record. Its Input is nil because
+	// the record is given by Returned. nil when RETURNING is not given.
+	Returning *Projection
+}
+
+// OnConflict is the action for the row whose key is found in the primary key index.
+// Update is nil for DO NOTHING.
+type OnConflict struct {
+	Update []*Assignment
+}
+
+// Assignment sets the value of Expr to the Column-th column of the table. Expr is evaluated for the tuple
+// of the existing row followed by the row to be inserted.
+type Assignment struct {
+	Column int
+	Expr   Expr
 }
 
 func (p *Planner) PlanInsert(stmt *parser.InsertStatement) *InsertPlan {
@@ -38,13 +70,239 @@ func (p *Planner) PlanInsert(stmt *parser.InsertStatement) *InsertPlan {
 		stmt.Columns = columns
 	}
 
-	for _, row := range stmt.Rows {
-		vs, is := p.planInsertRow(tableDef, stmt.Columns, row)
-		values = append(values, vs)
-		indices = append(indices, is)
+	var plan *InsertPlan
+	if stmt.Select != nil || !literalRows(stmt.Rows) {
+		plan = p.planInsertSource(tableDef, stmt)
+	} else {
+		for _, row := range stmt.Rows {
+			vs, is := p.planInsertRow(tableDef, stmt.Columns, row)
+			values = append(values, vs)
+			indices = append(indices, is)
+		}
+		plan = &InsertPlan{Table: tableDef, Indices: indices, Values: values}
+	}
+
+	plan.PrimaryKey = primaryKeyIndex(tableDef, tableDef.PrimaryKeyIndex)
+	plan.OnConflict = p.planOnConflict(tableDef, stmt.OnConflict)
+	if stmt.Returning != nil {
+		plan.Returning = p.planProjection(tableScope(tableDef), nil, stmt.Returning)
+	}
+
+	return plan
+}
+
+// tableScope returns the scope of the record of the table.
+func tableScope(table *schema.Table) *scope {
+	columns := make([]int, len(table.Columns))
+	for i := range columns {
+		columns[i] = i
 	}
 
-	return &InsertPlan{Table: tableDef, Indices: indices, Values: values}
+	return &scope{tables: []*scopeTable{{name: table.Name, table: table, columns: columns}}}
+}
+
+// planOnConflict plans the action on the conflict. The expressions in SET clause are planned for the tuple
+// of the existing row followed by the row to be inserted, which is referred by excluded.
+func (p *Planner) planOnConflict(table *schema.Table, oc *parser.OnConflict) *OnConflict {
+	if oc == nil {
+		return nil
+	}
+
+	plan := &OnConflict{}
+	if oc.Update == nil {
+		return plan
+	}
+
+	excluded := tableScope(table)
+	excluded.tables[0].name = "excluded"
+	excluded.tables[0].pos = 1
+	sc := tableScope(table).concat(excluded)
+
+	plan.Update = make([]*Assignment, len(oc.Update))
+	for i, set := range oc.Update {
+		a := &Assignment{}
+		for j, colDef := range table.Columns {
+			if strings.ToLower(set.Column) == colDef.Name {
+				a.Column = j
+				break
+			}
+		}
+
+		// the literal is converted to the type of the column
+		if val, ok := set.Expr.(*parser.Value); ok {
+			a.Expr = planValue(val.Val, table.Columns[a.Column].Type)
+		} else {
+			a.Expr = p.planExpr(sc, nil, set.Expr)
+		}
+		plan.Update[i] = a
+	}
+
+	return plan
+}
+
+// Open lets the subqueries in SET clause and RETURNING clause be executed in env.
+func (ip *InsertPlan) Open(env *Env) {
+	exprs := []Expr{}
+	if ip.OnConflict != nil {
+		for _, a := range ip.OnConflict.Update {
+			exprs = append(exprs, a.Expr)
+		}
+	}
+	if ip.Returning != nil {
+		exprs = append(exprs, ip.Returning.Columns...)
+	}
+	bindSubqueries(env, exprs...)
+}
+
+// Returned computes the columns of RETURNING clause for the inserted or updated record.
+func (ip *InsertPlan) Returned(row []interface{}) (sdb.Tuple, error) {
+	return ip.Returning.compute(engine.NewTuple(row, -1))
+}
+
+// UpdatedRow makes the record which the existing tuple is updated to by SET clause when the row conflicts with it.
+func (ip *InsertPlan) UpdatedRow(existing sdb.Tuple, row []interface{}) ([]interface{}, *Indices, error) {
+	updated := make([]interface{}, len(ip.Table.Columns))
+	for i := range updated {
+		updated[i] = existing.Value(i)
+	}
+
+	t := engine.NewTuple(append(append([]interface{}{}, updated...), row...), -1)
+	for _, a := range ip.OnConflict.Update {
+		v, err := eval(a.Expr, t)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		v, err = columnValue(ip.Table.Columns[a.Column], v)
+		if err != nil {
+			return nil, nil, err
+		}
+		updated[a.Column] = v
+	}
+
+	return updated, indexKeys(ip.Table, updated), nil
+}
+
+// literalRows reports if every value in the rows is a literal or NULL, so that it is converted on planning.
+func literalRows(rows [][]parser.Expr) bool {
+	for _, row := range rows {
+		for _, v := range row {
+			switch v.(type) {
+			case *parser.Value, *parser.NullVal:
+			default:
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// planInsertSource plans the source of the rows computed on execution; the query, or Values which
+// evaluates the expressions.
+func (p *Planner) planInsertSource(table *schema.Table, stmt *parser.InsertStatement) *InsertPlan {
+	plan := &InsertPlan{Table: table, Columns: make([]int, len(stmt.Columns))}
+	for i, col := range stmt.Columns {
+		for j, colDef := range table.Columns {
+			if strings.ToLower(col) == colDef.Name {
+				plan.Columns[i] = j
+				break
+			}
+		}
+	}
+
+	if stmt.Select != nil {
+		plan.Source, _ = p.planQuery(stmt.Select)
+		plan.ReadsTable = readsTable(plan.Source, table.Name)
+		return plan
+	}
+
+	vs := &Values{Rows: make([][]Expr, len(stmt.Rows))}
+	for i, row := range stmt.Rows {
+		vs.Rows[i] = make([]Expr, len(row))
+		for j, v := range row {
+			// the literal is converted to the type of the column
+			if val, ok := v.(*parser.Value); ok {
+				vs.Rows[i][j] = planValue(val.Val, table.Columns[plan.Columns[j]].Type)
+				continue
+			}
+			vs.Rows[i][j] = p.planExpr(&scope{}, nil, v)
+		}
+	}
+
+	pj := &Projection{Columns: make([]Expr, len(stmt.Columns)), Input: vs}
+	for i := range stmt.Columns {
+		colDef := table.Columns[plan.Columns[i]]
+		pj.Columns[i] = &Column{Name: colDef.Name, Index: i, Type: colDef.Type}
+	}
+	plan.Source = pj
+	plan.ReadsTable = readsTable(pj, table.Name)
+
+	return plan
+}
+
+// Row makes the record of the table from the tuple of the source. The omitted columns are the default values,
+// and int64 is converted to float64 for the float64 column.
+func (ip *InsertPlan) Row(t sdb.Tuple) ([]interface{}, *Indices, error) {
+	row := make([]interface{}, len(ip.Table.Columns))
+	specified := make([]bool, len(ip.Table.Columns))
+	for i, pos := range ip.Columns {
+		v, err := columnValue(ip.Table.Columns[pos], t.Value(i))
+		if err != nil {
+			return nil, nil, err
+		}
+		row[pos] = v
+		specified[pos] = true
+	}
+
+	for i, colDef := range ip.Table.Columns {
+		if !specified[i] {
+			row[i] = colDef.DefaultValue()
+		}
+	}
+
+	return row, indexKeys(ip.Table, row), nil
+}
+
+// columnValue converts the value to be stored in the column. int64 is converted to float64 for the float64 column,
+// and NULL is not allowed for the not null column.
+func columnValue(colDef *schema.ColumnDef, v interface{}) (interface{}, error) {
+	if n, ok := v.(int64); ok && colDef.Type == schema.ColumnTypeFloat64 {
+		v = float64(n)
+	}
+	if v == nil && !colDef.Nullable() {
+		return nil, fmt.Errorf("column %s cannot be null", colDef.Name)
+	}
+
+	return v, nil
+}
+
+// readsTable reports if the plan reads the table, including in its subqueries.
+func readsTable(l List, name string) bool {
+	switch n := l.(type) {
+	case *Scan:
+		if n.Table.Name == name {
+			return true
+		}
+	case *IndexScan:
+		if n.Table.Name == name {
+			return true
+		}
+	}
+
+	for _, sq := range subqueries(expressions(l)...) {
+		if readsTable(sq.Plan, name) {
+			return true
+		}
+	}
+
+	for _, input := range children(l) {
+		if readsTable(input, name) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // planInsertRow creates a complete record and index for the given row to be inserted.
@@ -52,8 +310,8 @@ func (p *Planner) PlanInsert(stmt *parser.InsertStatement) *InsertPlan {
 // Students{"id(int64)", "name(string)", "age(int64)"}
 // But the statement might be
 // (age, id) values (25, 1), (30, 2). In this case, name should be the default value of the column.
-// This method converts the given row (25, 1) to (1, "", 25).
-func (p *Planner) planInsertRow(table *schema.Table, columns, row []string) ([]interface{}, *Indices) {
+// This method converts the given row (25, 1) to (1, nil, 25) when name has no default value. nil means NULL.
+func (p *Planner) planInsertRow(table *schema.Table, columns []string, row []parser.Expr) ([]interface{}, *Indices) {
 	result := make([]interface{}, len(table.Columns))
 	for i, columnDef := range table.Columns {
 		index := -1
@@ -71,10 +329,20 @@ func (p *Planner) planInsertRow(table *schema.Table, columns, row []string) ([]i
 		} else {
 			// Else, use the value from the row.
 			// The type is checked on validate, so ignore error
-			result[i], _ = schema.ConvertValue(row[index], columnDef.Type)
+			switch val := row[index].(type) {
+			case *parser.NullVal:
+				result[i] = nil
+			case *parser.Value:
+				result[i], _ = schema.ConvertValue(val.Val, columnDef.Type)
+			}
 		}
 	}
 
+	return result, indexKeys(table, result)
+}
+
+// indexKeys makes the keys of the record for each index of the table.
+func indexKeys(table *schema.Table, row []interface{}) *Indices {
 	indices := &Indices{
 		Keys: make([]sdb.IndexKey, len(table.Indices)),
 		Idx:  make([]*schema.Index, len(table.Indices)),
@@ -82,7 +350,7 @@ func (p *Planner) planInsertRow(table *schema.Table, columns, row []string) ([]i
 
 	for i, indexDef := range table.Indices {
 		indices.Idx[i] = indexDef
-		key := result[i]
+		key := row[indexDef.ColumnIndex]
 		switch k := key.(type) {
 		case int64:
 			indices.Keys[i] = sdb.NewInt64IndexKey(k)
@@ -91,5 +359,5 @@ func (p *Planner) planInsertRow(table *schema.Table, columns, row []string) ([]i
 		}
 	}
 
-	return result, indices
+	return indices
 }
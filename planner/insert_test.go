@@ -1,9 +1,11 @@
 package planner
 
 import (
+	"sort"
 	"testing"
 
 	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/engine"
 	"github.com/dty1er/sdb/parser"
 	"github.com/dty1er/sdb/schema"
 	"github.com/dty1er/sdb/sdb"
@@ -42,6 +44,32 @@ func TestPlanner_PlanInsert(t *testing.T) {
 					{Table: "students", Name: "students_pkey_id", ColumnIndex: 0},
 				},
 			},
+			"teachers": {
+				Name: "teachers",
+				Columns: []*schema.ColumnDef{
+					{
+						Name:    "id",
+						Type:    schema.ColumnTypeInt64,
+						Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey},
+					},
+					{
+						Name:       "name",
+						Type:       schema.ColumnTypeString,
+						Options:    []schema.ColumnOption{schema.ColumnOptionNotNull, schema.ColumnOptionDefaultValue},
+						DefaultVal: "anonymous",
+					},
+					{
+						Name:       "age",
+						Type:       schema.ColumnTypeInt64,
+						Options:    []schema.ColumnOption{schema.ColumnOptionDefaultValue},
+						DefaultVal: "30",
+					},
+				},
+				PrimaryKeyIndex: 0,
+				Indices: []*schema.Index{
+					{Table: "teachers", Name: "teachers_pkey_id", ColumnIndex: 0},
+				},
+			},
 		},
 	}
 	tests := []struct {
@@ -54,18 +82,19 @@ func TestPlanner_PlanInsert(t *testing.T) {
 			stmt: &parser.InsertStatement{
 				Table:   "students",
 				Columns: []string{"Id", "Age", "Nickname"},
-				Rows: [][]string{
-					{"5", "24", "bob"},
-					{"6", "25", "nick"},
-					{"7", "26", "al"},
+				Rows: [][]parser.Expr{
+					{&parser.Value{Val: "5"}, &parser.Value{Val: "24"}, &parser.Value{Val: "bob"}},
+					{&parser.Value{Val: "6"}, &parser.Value{Val: "25"}, &parser.Value{Val: "nick"}},
+					{&parser.Value{Val: "7"}, &parser.Value{Val: "26"}, &parser.Value{Val: "al"}},
 				},
 			},
 			expected: &InsertPlan{
-				Table: c.Tables["students"],
+				Table:      c.Tables["students"],
+				PrimaryKey: c.Tables["students"].Indices[0],
 				Values: [][]interface{}{
-					{int64(5), "", "bob", int64(24)},
-					{int64(6), "", "nick", int64(25)},
-					{int64(7), "", "al", int64(26)},
+					{int64(5), nil, "bob", int64(24)},
+					{int64(6), nil, "nick", int64(25)},
+					{int64(7), nil, "al", int64(26)},
 				},
 				Indices: []*Indices{
 					{
@@ -83,6 +112,35 @@ func TestPlanner_PlanInsert(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ok: default value",
+			stmt: &parser.InsertStatement{
+				Table:   "teachers",
+				Columns: []string{"id", "age"},
+				Rows: [][]parser.Expr{
+					{&parser.Value{Val: "1"}, &parser.Value{Val: "45"}},
+					{&parser.Value{Val: "2"}, &parser.NullVal{}},
+				},
+			},
+			expected: &InsertPlan{
+				Table:      c.Tables["teachers"],
+				PrimaryKey: c.Tables["teachers"].Indices[0],
+				Values: [][]interface{}{
+					{int64(1), "anonymous", int64(45)},
+					{int64(2), "anonymous", nil},
+				},
+				Indices: []*Indices{
+					{
+						Keys: []sdb.IndexKey{sdb.NewInt64IndexKey(1)},
+						Idx:  []*schema.Index{c.Tables["teachers"].Indices[0]},
+					},
+					{
+						Keys: []sdb.IndexKey{sdb.NewInt64IndexKey(2)},
+						Idx:  []*schema.Index{c.Tables["teachers"].Indices[0]},
+					},
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -93,3 +151,176 @@ func TestPlanner_PlanInsert(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanner_PlanInsert_Source(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		readsTable bool
+		expected   [][]interface{}
+	}{
+		{
+			name:       "select",
+			query:      `insert into depts (name, id) select name, id + 100 from users where id < 3;`,
+			readsTable: false,
+			expected:   [][]interface{}{{int64(101), "alice"}, {int64(102), "bob"}},
+		},
+		{
+			name:       "select from the table to be inserted",
+			query:      `insert into depts select id + 1, name || "2" from depts where name = "hr";`,
+			readsTable: true,
+			expected:   [][]interface{}{{int64(41), "hr2"}},
+		},
+		{
+			name:       "subquery of the table to be inserted",
+			query:      `insert into depts (id) select id from users where dept_id in (select id from depts);`,
+			readsTable: true,
+			expected:   [][]interface{}{{int64(1), nil}, {int64(2), nil}, {int64(4), nil}},
+		},
+		{
+			name:       "expressions",
+			query:      `insert into depts values (2 * 3, upper("x")), (7, null);`,
+			readsTable: false,
+			expected:   [][]interface{}{{int64(6), "X"}, {int64(7), nil}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			c := newJoinCatalog()
+			stmt, err := parser.New(c).Parse(test.query)
+			testutil.MustBeNil(t, err)
+
+			plan := New(c).PlanInsert(stmt.(*parser.InsertStatement))
+			testutil.MustEqual(t, plan.ReadsTable, test.readsTable)
+
+			rows := [][]interface{}{}
+			for _, tuple := range collect(t, plan.Source, newJoinEngine()) {
+				row, indices, err := plan.Row(tuple)
+				testutil.MustBeNil(t, err)
+				testutil.MustEqual(t, indices.Keys, []sdb.IndexKey{sdb.NewInt64IndexKey(row[0].(int64))})
+				rows = append(rows, row)
+			}
+			sort.Slice(rows, func(i, j int) bool { return rows[i][0].(int64) < rows[j][0].(int64) })
+			testutil.MustEqual(t, rows, test.expected)
+		})
+	}
+}
+
+func TestInsertPlan_Row_NotNull(t *testing.T) {
+	c := newJoinCatalog()
+	stmt, err := parser.New(c).Parse(`insert into depts (id, name) select dept_id, name from users;`)
+	testutil.MustBeNil(t, err)
+
+	plan := New(c).PlanInsert(stmt.(*parser.InsertStatement))
+	_, _, err = plan.Row(engine.NewTuple([]interface{}{nil, "carol"}, -1))
+	testutil.MustEqual(t, err.Error(), "column id cannot be null")
+}
+
+func TestInsertPlan_UpdatedRow(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      string
+		expected []interface{}
+	}{
+		{
+			name:     "excluded",
+			set:      `name = excluded.name`,
+			expected: []interface{}{int64(1), "ann", int64(10)},
+		},
+		{
+			name:     "existing and excluded",
+			set:      `dept_id = users.dept_id + excluded.dept_id, name = users.name || "2"`,
+			expected: []interface{}{int64(1), "alice2", int64(30)},
+		},
+		{
+			name:     "literals",
+			set:      `name = "x", dept_id = null`,
+			expected: []interface{}{int64(1), "x", nil},
+		},
+		{
+			name:     "subquery",
+			set:      `name = (select name from depts where id = excluded.dept_id)`,
+			expected: []interface{}{int64(1), "ops", int64(10)},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			c := newJoinCatalog()
+			stmt, err := parser.New(c).Parse(`insert into users values (1, "ann", 20) on conflict (id) do update set ` + test.set + `;`)
+			testutil.MustBeNil(t, err)
+
+			plan := New(c).PlanInsert(stmt.(*parser.InsertStatement))
+			testutil.MustEqual(t, plan.PrimaryKey.Name, "users_pkey_id")
+			plan.Open(&Env{Engine: newJoinEngine()})
+
+			existing := engine.NewTuple([]interface{}{int64(1), "alice", int64(10)}, 0)
+			row, indices, err := plan.UpdatedRow(existing, plan.Values[0])
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, row, test.expected)
+			testutil.MustEqual(t, indices.Keys, []sdb.IndexKey{sdb.NewInt64IndexKey(1)})
+		})
+	}
+}
+
+func TestPlanner_PlanInsert_DoNothing(t *testing.T) {
+	c := newJoinCatalog()
+	stmt, err := parser.New(c).Parse(`insert into depts select id, name from users on conflict do nothing;`)
+	testutil.MustBeNil(t, err)
+
+	plan := New(c).PlanInsert(stmt.(*parser.InsertStatement))
+	testutil.MustEqual(t, plan.PrimaryKey, c.GetTable("depts").Indices[0])
+	testutil.MustEqual(t, plan.OnConflict, &OnConflict{})
+}
+
+func TestInsertPlan_Returned(t *testing.T) {
+	tests := []struct {
+		name      string
+		returning string
+		columns   []string
+		expected  []interface{}
+	}{
+		{
+			name:      "star",
+			returning: `*`,
+			columns:   []string{"id", "name", "dept_id"},
+			expected:  []interface{}{int64(1), "ann", nil},
+		},
+		{
+			name:      "expressions",
+			returning: `name as n, id * 10, (select name from depts where id = 20)`,
+			columns:   []string{"n", "id * 10", "(subquery)"},
+			expected:  []interface{}{"ann", int64(10), "ops"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			c := newJoinCatalog()
+			stmt, err := parser.New(c).Parse(`insert into users (id, name) values (1, "ann") returning ` + test.returning + `;`)
+			testutil.MustBeNil(t, err)
+
+			plan := New(c).PlanInsert(stmt.(*parser.InsertStatement))
+			plan.Open(&Env{Engine: newJoinEngine()})
+
+			columns := []string{}
+			for _, col := range plan.Returning.Columns {
+				switch c := col.(type) {
+				case *Column:
+					columns = append(columns, c.Alias)
+				case *NamedExpr:
+					columns = append(columns, c.Name)
+				}
+			}
+			testutil.MustEqual(t, columns, test.columns)
+
+			tuple, err := plan.Returned(plan.Values[0])
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, values([]sdb.Tuple{tuple}, len(test.expected))[0], test.expected)
+		})
+	}
+}
@@ -0,0 +1,802 @@
+package planner
+
+import (
+	"sort"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/sdb"
+)
+
+func (s *Scan) Open(env *Env) error {
+	s.engine = env.Engine
+	s.page = 0
+	s.tuples = nil
+	s.idx = 0
+	return nil
+}
+
+func (s *Scan) Next() (sdb.Tuple, error) {
+	// read the next page when all the tuples in the current page are returned
+	for s.idx >= len(s.tuples) {
+		if s.page >= s.engine.PageCount(s.Table.Name) {
+			return nil, nil
+		}
+
+		tuples, err := s.engine.ReadPage(s.Table.Name, s.page)
+		if err != nil {
+			return nil, err
+		}
+
+		s.page++
+		s.tuples = tuples
+		s.idx = 0
+	}
+
+	t := s.tuples[s.idx]
+	s.idx++
+	if s.Columns != nil {
+		t = t.Projection(s.Columns)
+	}
+
+	return t, nil
+}
+
+func (s *Scan) Close() error {
+	s.tuples = nil
+	return nil
+}
+
+func (is *IndexScan) Open(env *Env) error {
+	is.engine = env.Engine
+	is.keys = nil
+	is.idx = 0
+	is.iter = nil
+	is.low, is.high = nil, nil
+
+	if is.Keys != nil {
+		// the keys are looked up in ascending order without duplicates. NULL never matches.
+		keys := map[string]bool{}
+		for _, k := range is.Keys {
+			v, err := eval(k, nil)
+			if err != nil {
+				return err
+			}
+			if v == nil || keys[encodeKey([]interface{}{v})] {
+				continue
+			}
+
+			keys[encodeKey([]interface{}{v})] = true
+			is.keys = append(is.keys, v)
+		}
+		sort.Slice(is.keys, func(i, j int) bool {
+			cmp, _ := compareValues(is.keys[i], is.keys[j])
+			return cmp < 0
+		})
+		return nil
+	}
+
+	if is.Low != nil {
+		v, err := eval(is.Low.Value, nil)
+		if err != nil {
+			return err
+		}
+		is.low = v
+	}
+	if is.High != nil {
+		v, err := eval(is.High.Value, nil)
+		if err != nil {
+			return err
+		}
+		is.high = v
+	}
+
+	// nothing is compared with NULL
+	if (is.Low != nil && is.low == nil) || (is.High != nil && is.high == nil) {
+		return nil
+	}
+
+	iter, err := is.engine.SeekIndex(is.Table.Name, is.Index, is.low)
+	if err != nil {
+		return err
+	}
+	is.iter = iter
+
+	return nil
+}
+
+func (is *IndexScan) Next() (sdb.Tuple, error) {
+	t, err := is.next()
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	if is.Columns != nil {
+		t = t.Projection(is.Columns)
+	}
+
+	return t, nil
+}
+
+func (is *IndexScan) next() (sdb.Tuple, error) {
+	if is.Keys != nil {
+		// the key is unique, so at most one tuple is found for each key
+		for is.idx < len(is.keys) {
+			key := is.keys[is.idx]
+			is.idx++
+
+			t, err := is.engine.LookupIndex(is.Table.Name, is.Index, key)
+			if err != nil || t != nil {
+				return t, err
+			}
+		}
+		return nil, nil
+	}
+
+	for is.iter != nil {
+		t := is.iter.Next()
+		if t == nil {
+			is.iter = nil
+			break
+		}
+
+		key := t.Value(is.KeyColumn)
+		// the iterator starts from the low key, so the key equal to it is skipped when the bound is exclusive
+		if is.Low != nil && !is.Low.Inclusive {
+			if cmp, _ := compareValues(key, is.low); cmp <= 0 {
+				continue
+			}
+		}
+
+		// the tuples are sorted by the key, so the scan stops at the first key beyond the high key
+		if is.High != nil {
+			if cmp, _ := compareValues(key, is.high); cmp > 0 || (cmp == 0 && !is.High.Inclusive) {
+				is.iter = nil
+				break
+			}
+		}
+
+		return t, nil
+	}
+
+	return nil, nil
+}
+
+func (is *IndexScan) Close() error {
+	is.keys = nil
+	is.iter = nil
+	return nil
+}
+
+func (s *Selection) Open(env *Env) error {
+	bindSubqueries(env, s.Filter)
+	return s.Input.Open(env)
+}
+
+func (s *Selection) Next() (sdb.Tuple, error) {
+	for {
+		t, err := s.Input.Next()
+		if err != nil || t == nil {
+			return nil, err
+		}
+
+		ok, err := evalPredicate(s.Filter, t)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return t, nil
+		}
+	}
+}
+
+func (s *Selection) Close() error {
+	return s.Input.Close()
+}
+
+func (l *Limit) Open(env *Env) error {
+	l.count = 0
+	return l.Input.Open(env)
+}
+
+func (l *Limit) Next() (sdb.Tuple, error) {
+	// Once the limit is reached, the input is never pulled again so that the scan stops early.
+	if l.count >= l.Limit.(*Int64Expr).Value {
+		return nil, nil
+	}
+
+	t, err := l.Input.Next()
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	l.count++
+	return t, nil
+}
+
+func (l *Limit) Close() error {
+	return l.Input.Close()
+}
+
+func (o *Offset) Open(env *Env) error {
+	o.skipped = false
+	return o.Input.Open(env)
+}
+
+func (o *Offset) Next() (sdb.Tuple, error) {
+	if !o.skipped {
+		o.skipped = true
+		for i := int64(0); i < o.Offset.(*Int64Expr).Value; i++ {
+			t, err := o.Input.Next()
+			if err != nil || t == nil {
+				return nil, err
+			}
+		}
+	}
+
+	return o.Input.Next()
+}
+
+func (o *Offset) Close() error {
+	return o.Input.Close()
+}
+
+func (p *Projection) Open(env *Env) error {
+	bindSubqueries(env, p.Columns...)
+	return p.Input.Open(env)
+}
+
+func (p *Projection) Next() (sdb.Tuple, error) {
+	t, err := p.Input.Next()
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	indices := make([]int, len(p.Columns))
+	for i, col := range p.Columns {
+		c, ok := col.(*Column)
+		if !ok {
+			return p.compute(t)
+		}
+		indices[i] = c.Index
+	}
+
+	return t.Projection(indices), nil
+}
+
+// compute evaluates the columns for the tuple when some of them are not the columns of the tuple.
+func (p *Projection) compute(t sdb.Tuple) (sdb.Tuple, error) {
+	values := make([]interface{}, len(p.Columns))
+	for i, col := range p.Columns {
+		v, err := eval(col, t)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return engine.NewTuple(values, -1), nil
+}
+
+func (p *Projection) Close() error {
+	return p.Input.Close()
+}
+
+func (ob *OrderBy) Open(env *Env) error {
+	bindSubqueries(env, ob.Columns...)
+	if err := ob.Input.Open(env); err != nil {
+		return err
+	}
+
+	ob.env = env
+	ob.idx = 0
+
+	// Sort is a blocking operator; every tuple from the input is read on Open.
+	if ob.TopN > 0 {
+		return ob.topN(ob.TopN)
+	}
+
+	return ob.sort()
+}
+
+func (ob *OrderBy) Next() (sdb.Tuple, error) {
+	if ob.merger != nil {
+		return ob.nextMerged()
+	}
+
+	if ob.idx >= len(ob.sorted) {
+		return nil, nil
+	}
+
+	t := ob.sorted[ob.idx].tuple
+	ob.idx++
+	return t, nil
+}
+
+func (ob *OrderBy) Close() error {
+	ob.sorted = nil
+	if err := ob.removeRuns(); err != nil {
+		ob.Input.Close()
+		return err
+	}
+
+	return ob.Input.Close()
+}
+
+func (vs *Values) Open(env *Env) error {
+	bindSubqueries(env, expressions(vs)...)
+	vs.idx = 0
+	return nil
+}
+
+func (vs *Values) Next() (sdb.Tuple, error) {
+	if vs.idx >= len(vs.Rows) {
+		return nil, nil
+	}
+
+	row := vs.Rows[vs.idx]
+	vs.idx++
+
+	// the values do not refer to any column, so they are evaluated against the empty tuple
+	values := make([]interface{}, len(row))
+	empty := engine.NewTuple([]interface{}{}, -1)
+	for i, expr := range row {
+		v, err := eval(expr, empty)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return engine.NewTuple(values, -1), nil
+}
+
+func (vs *Values) Close() error {
+	return nil
+}
+
+func (d *Distinct) Open(env *Env) error {
+	d.seen = map[string]struct{}{}
+	return d.Input.Open(env)
+}
+
+func (d *Distinct) Next() (sdb.Tuple, error) {
+	for {
+		t, err := d.Input.Next()
+		if err != nil || t == nil {
+			return nil, err
+		}
+
+		values, err := sortKeys(d.Columns, t)
+		if err != nil {
+			return nil, err
+		}
+
+		key := encodeKey(values)
+		if _, ok := d.seen[key]; ok {
+			continue
+		}
+
+		d.seen[key] = struct{}{}
+		return t, nil
+	}
+}
+
+func (d *Distinct) Close() error {
+	d.seen = nil
+	return d.Input.Close()
+}
+
+func (ap *Append) Open(env *Env) error {
+	ap.right = false
+	if err := ap.Left.Open(env); err != nil {
+		return err
+	}
+
+	if err := ap.Right.Open(env); err != nil {
+		ap.Left.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (ap *Append) Next() (sdb.Tuple, error) {
+	if !ap.right {
+		t, err := ap.Left.Next()
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			return coerce(t, ap.Types), nil
+		}
+		ap.right = true
+	}
+
+	t, err := ap.Right.Next()
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	return coerce(t, ap.Types), nil
+}
+
+func (ap *Append) Close() error {
+	if err := ap.Right.Close(); err != nil {
+		ap.Left.Close()
+		return err
+	}
+
+	return ap.Left.Close()
+}
+
+func (op *HashSetOp) Open(env *Env) error {
+	if err := op.Left.Open(env); err != nil {
+		return err
+	}
+
+	if err := op.Right.Open(env); err != nil {
+		op.Left.Close()
+		return err
+	}
+
+	// the right side is read on Open to build the hash table
+	return op.buildCounts()
+}
+
+func (op *HashSetOp) Next() (sdb.Tuple, error) {
+	for {
+		t, err := op.Left.Next()
+		if err != nil || t == nil {
+			return nil, err
+		}
+
+		t = coerce(t, op.Types)
+		if op.produce(op.key(t)) {
+			return t, nil
+		}
+	}
+}
+
+func (op *HashSetOp) Close() error {
+	op.counts = nil
+	if err := op.Right.Close(); err != nil {
+		op.Left.Close()
+		return err
+	}
+
+	return op.Left.Close()
+}
+
+func (a *Aggregate) Open(env *Env) error {
+	if err := a.Input.Open(env); err != nil {
+		return err
+	}
+
+	a.env = env
+	a.idx = 0
+
+	// Aggregate is a blocking operator; every tuple from the input is read on Open.
+	// The groups spilled to the partitions are aggregated on Next after the groups on memory are produced.
+	groups, partitions, err := a.hashAggregate(a.Input.Next, 0)
+	a.groups = groups
+	a.partitions = partitions
+	return err
+}
+
+func (a *Aggregate) Next() (sdb.Tuple, error) {
+	for a.idx >= len(a.groups) {
+		if len(a.partitions) == 0 {
+			return nil, nil
+		}
+
+		if err := a.nextPartition(); err != nil {
+			return nil, err
+		}
+	}
+
+	g := a.groups[a.idx]
+	a.idx++
+	return g.tuple(), nil
+}
+
+func (a *Aggregate) Close() error {
+	a.groups = nil
+	if err := removePartitions(a.env.DiskManager, a.partitions); err != nil {
+		a.Input.Close()
+		return err
+	}
+
+	a.partitions = nil
+	return a.Input.Close()
+}
+
+func (w *Window) Open(env *Env) error {
+	bindSubqueries(env, expressions(w)...)
+	w.tuples, w.results, w.idx = nil, nil, 0
+	w.next, w.done = nil, false
+	return w.Input.Open(env)
+}
+
+func (w *Window) Next() (sdb.Tuple, error) {
+	// Window reads a partition at a time; the functions are computed when the whole partition is read.
+	if w.idx >= len(w.tuples) {
+		if err := w.readPartition(); err != nil {
+			return nil, err
+		}
+		if len(w.tuples) == 0 {
+			return nil, nil
+		}
+	}
+
+	t := w.tuples[w.idx]
+	values := make([]interface{}, 0, t.Len()+len(w.Funcs))
+	for i := 0; i < t.Len(); i++ {
+		values = append(values, t.Value(i))
+	}
+	values = append(values, w.results[w.idx]...)
+	w.idx++
+	return engine.NewTuple(values, -1), nil
+}
+
+func (w *Window) Close() error {
+	w.tuples, w.results, w.next = nil, nil, nil
+	return w.Input.Close()
+}
+
+func (nl *NestedLoopJoin) Open(env *Env) error {
+	bindSubqueries(env, nl.Condition)
+	nl.env = env
+	nl.left = nil
+	nl.rightOpen = false
+	return nl.Left.Open(env)
+}
+
+func (nl *NestedLoopJoin) Next() (sdb.Tuple, error) {
+	for {
+		if nl.left == nil {
+			t, err := nl.Left.Next()
+			if err != nil || t == nil {
+				return nil, err
+			}
+
+			// the right input is scanned from the head for every left tuple
+			if nl.rightOpen {
+				if err := nl.Right.Close(); err != nil {
+					return nil, err
+				}
+			}
+			if err := nl.Right.Open(nl.env); err != nil {
+				return nil, err
+			}
+
+			nl.rightOpen = true
+			nl.left = t
+			nl.matched = false
+		}
+
+		r, err := nl.Right.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if r == nil {
+			padded := padLeft(nl.Type, nl.left, nl.matched, nl.RightWidth)
+			nl.left = nil
+			if padded != nil {
+				return padded, nil
+			}
+			continue
+		}
+
+		t, err := joinCondition(nl.Condition, nl.left, r, nl.RightWidth)
+		if err != nil {
+			return nil, err
+		}
+
+		if t != nil {
+			nl.matched = true
+			t, done := matchLeft(nl.Type, nl.left, t)
+			if done {
+				nl.left = nil
+			}
+			if t != nil {
+				return t, nil
+			}
+		}
+	}
+}
+
+func (nl *NestedLoopJoin) Close() error {
+	if nl.rightOpen {
+		nl.rightOpen = false
+		if err := nl.Right.Close(); err != nil {
+			nl.Left.Close()
+			return err
+		}
+	}
+
+	return nl.Left.Close()
+}
+
+func (inl *IndexNestedLoopJoin) Open(env *Env) error {
+	bindSubqueries(env, inl.Condition)
+	inl.engine = env.Engine
+	return inl.Left.Open(env)
+}
+
+func (inl *IndexNestedLoopJoin) Next() (sdb.Tuple, error) {
+	for {
+		left, err := inl.Left.Next()
+		if err != nil || left == nil {
+			return nil, err
+		}
+
+		key, err := eval(inl.LeftKey, left)
+		if err != nil {
+			return nil, err
+		}
+
+		// NULL never matches
+		if key != nil {
+			right, err := inl.engine.LookupIndex(inl.Table.Name, inl.Index, key)
+			if err != nil {
+				return nil, err
+			}
+
+			if right != nil {
+				if inl.Columns != nil {
+					right = right.Projection(inl.Columns)
+				}
+
+				t, err := joinCondition(inl.Condition, left, right, inl.RightWidth)
+				if err != nil {
+					return nil, err
+				}
+
+				if t != nil {
+					if t, _ := matchLeft(inl.Type, left, t); t != nil {
+						return t, nil
+					}
+					continue
+				}
+			}
+		}
+
+		if padded := padLeft(inl.Type, left, false, inl.RightWidth); padded != nil {
+			return padded, nil
+		}
+	}
+}
+
+func (inl *IndexNestedLoopJoin) Close() error {
+	return inl.Left.Close()
+}
+
+func (hj *HashJoin) Open(env *Env) error {
+	bindSubqueries(env, hj.Condition)
+	if err := hj.Right.Open(env); err != nil {
+		return err
+	}
+
+	if err := hj.Left.Open(env); err != nil {
+		return err
+	}
+
+	hj.left = nil
+	// The right input is read on Open to build the hash table.
+	return hj.buildHashTable()
+}
+
+func (hj *HashJoin) Next() (sdb.Tuple, error) {
+	for {
+		if hj.left == nil {
+			ok, err := hj.nextLeft()
+			if err != nil || !ok {
+				return nil, err
+			}
+		}
+
+		if hj.idx >= len(hj.candidates) {
+			padded := padLeft(hj.Type, hj.left, hj.matched, hj.RightWidth)
+			hj.left = nil
+			if padded != nil {
+				return padded, nil
+			}
+			continue
+		}
+
+		r := hj.candidates[hj.idx]
+		hj.idx++
+		t, err := joinCondition(hj.Condition, hj.left, r, hj.RightWidth)
+		if err != nil {
+			return nil, err
+		}
+
+		if t != nil {
+			hj.matched = true
+			t, done := matchLeft(hj.Type, hj.left, t)
+			if done {
+				hj.left = nil
+			}
+			if t != nil {
+				return t, nil
+			}
+		}
+	}
+}
+
+func (hj *HashJoin) Close() error {
+	hj.table = nil
+	hj.candidates = nil
+	if err := hj.Right.Close(); err != nil {
+		hj.Left.Close()
+		return err
+	}
+
+	return hj.Left.Close()
+}
+
+func (mj *MergeJoin) Open(env *Env) error {
+	bindSubqueries(env, mj.Condition)
+	if err := mj.Left.Open(env); err != nil {
+		return err
+	}
+
+	if err := mj.Right.Open(env); err != nil {
+		return err
+	}
+
+	mj.left = nil
+	mj.group = []sdb.Tuple{}
+	mj.groupKeys = nil
+	return mj.readRight()
+}
+
+func (mj *MergeJoin) Next() (sdb.Tuple, error) {
+	for {
+		if mj.left == nil {
+			ok, err := mj.nextLeft()
+			if err != nil || !ok {
+				return nil, err
+			}
+		}
+
+		if mj.idx >= len(mj.group) {
+			padded := padLeft(mj.Type, mj.left, mj.matched, mj.RightWidth)
+			mj.left = nil
+			if padded != nil {
+				return padded, nil
+			}
+			continue
+		}
+
+		r := mj.group[mj.idx]
+		mj.idx++
+		t, err := joinCondition(mj.Condition, mj.left, r, mj.RightWidth)
+		if err != nil {
+			return nil, err
+		}
+
+		if t != nil {
+			mj.matched = true
+			t, done := matchLeft(mj.Type, mj.left, t)
+			if done {
+				mj.left = nil
+			}
+			if t != nil {
+				return t, nil
+			}
+		}
+	}
+}
+
+func (mj *MergeJoin) Close() error {
+	mj.group = nil
+	if err := mj.Right.Close(); err != nil {
+		mj.Left.Close()
+		return err
+	}
+
+	return mj.Left.Close()
+}
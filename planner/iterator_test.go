@@ -0,0 +1,353 @@
+package planner
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+// pagedEngine is an in-memory engine which holds the tuples by page.
+type pagedEngine struct {
+	sdb.Engine
+
+	pages     map[string][][]sdb.Tuple
+	pagesRead int
+}
+
+func (e *pagedEngine) PageCount(table string) int {
+	return len(e.pages[table])
+}
+
+func (e *pagedEngine) ReadPage(table string, n int) ([]sdb.Tuple, error) {
+	e.pagesRead++
+	return e.pages[table][n], nil
+}
+
+// PageCached reports that no page is cached, so that every page is read from the disk.
+func (e *pagedEngine) PageCached(table string, n int) bool {
+	return false
+}
+
+// LookupIndex finds the tuple whose first column is the key, as if the first column is indexed.
+func (e *pagedEngine) LookupIndex(table, idxName string, key interface{}) (sdb.Tuple, error) {
+	for _, page := range e.pages[table] {
+		for _, t := range page {
+			if cmp, ok := compareValues(t.Value(0), key); ok && cmp == 0 {
+				return t, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// SeekIndex returns the tuples sorted by the first column from the key, as if the first column is indexed.
+func (e *pagedEngine) SeekIndex(table, idxName string, key interface{}) (sdb.IndexIterator, error) {
+	tuples := []sdb.Tuple{}
+	for _, page := range e.pages[table] {
+		for _, t := range page {
+			if cmp, _ := compareValues(t.Value(0), key); key == nil || cmp >= 0 {
+				tuples = append(tuples, t)
+			}
+		}
+	}
+	sort.SliceStable(tuples, func(i, j int) bool {
+		cmp, _ := compareValues(tuples[i].Value(0), tuples[j].Value(0))
+		return cmp < 0
+	})
+
+	return &sliceIterator{tuples: tuples}, nil
+}
+
+type sliceIterator struct {
+	tuples []sdb.Tuple
+}
+
+func (it *sliceIterator) Next() sdb.Tuple {
+	if len(it.tuples) == 0 {
+		return nil
+	}
+
+	t := it.tuples[0]
+	it.tuples = it.tuples[1:]
+	return t
+}
+
+// newPagedEngine returns the engine whose "users" table has (id, name) tuples.
+// Each page has 2 tuples.
+func newPagedEngine(count int) *pagedEngine {
+	tuples := []sdb.Tuple{}
+	for i := 1; i <= count; i++ {
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i), string(rune('a' + i - 1))}, 0))
+	}
+
+	return newEngineWithTuples("users", tuples, 2)
+}
+
+func newEngineWithTuples(table string, tuples []sdb.Tuple, perPage int) *pagedEngine {
+	pages := [][]sdb.Tuple{}
+	for i, t := range tuples {
+		if i%perPage == 0 {
+			pages = append(pages, []sdb.Tuple{})
+		}
+		pages[len(pages)-1] = append(pages[len(pages)-1], t)
+	}
+
+	return &pagedEngine{pages: map[string][][]sdb.Tuple{table: pages}}
+}
+
+func collect(t *testing.T, l List, e sdb.Engine) []sdb.Tuple {
+	return collectIn(t, l, &Env{Engine: e})
+}
+
+func collectIn(t *testing.T, l List, env *Env) []sdb.Tuple {
+	t.Helper()
+
+	testutil.MustBeNil(t, l.Open(env))
+	tuples := []sdb.Tuple{}
+	for {
+		tuple, err := l.Next()
+		testutil.MustBeNil(t, err)
+		if tuple == nil {
+			break
+		}
+		tuples = append(tuples, tuple)
+	}
+	testutil.MustBeNil(t, l.Close())
+
+	return tuples
+}
+
+func ids(tuples []sdb.Tuple) []int64 {
+	result := make([]int64, len(tuples))
+	for i, t := range tuples {
+		result[i] = t.Value(0).(int64)
+	}
+	return result
+}
+
+func TestScan(t *testing.T) {
+	e := newPagedEngine(5)
+	scan := &Scan{Table: &Table{Name: "users"}}
+
+	testutil.MustEqual(t, ids(collect(t, scan, e)), []int64{1, 2, 3, 4, 5})
+	testutil.MustEqual(t, e.pagesRead, 3)
+
+	// the scan can be reopened
+	testutil.MustEqual(t, ids(collect(t, scan, e)), []int64{1, 2, 3, 4, 5})
+
+	// empty table
+	scan = &Scan{Table: &Table{Name: "items"}}
+	testutil.MustEqual(t, ids(collect(t, scan, e)), []int64{})
+}
+
+func TestIndexScan(t *testing.T) {
+	bound := func(v int64, inclusive bool) *IndexBound {
+		return &IndexBound{Value: &Int64Expr{Value: v}, Inclusive: inclusive}
+	}
+
+	tests := []struct {
+		name      string
+		keys      []Expr
+		low, high *IndexBound
+		expected  []int64
+	}{
+		{name: "keys are looked up in order", keys: []Expr{&Int64Expr{Value: 7}, &Int64Expr{Value: 2}, &Int64Expr{Value: 7}, &NullExpr{}, &Int64Expr{Value: 20}}, expected: []int64{2, 7}},
+		{name: "no key", keys: []Expr{}, expected: []int64{}},
+		{name: "every key", expected: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "inclusive range", low: bound(3, true), high: bound(5, true), expected: []int64{3, 4, 5}},
+		{name: "exclusive range", low: bound(3, false), high: bound(5, false), expected: []int64{4}},
+		{name: "lower bound only", low: bound(7, false), expected: []int64{8, 9}},
+		{name: "upper bound only", high: bound(2, true), expected: []int64{1, 2}},
+		{name: "empty range", low: bound(5, true), high: bound(4, true), expected: []int64{}},
+		{name: "null bound", low: &IndexBound{Value: &NullExpr{}}, expected: []int64{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// the tuples are stored in the different order from the key
+			tuples := []sdb.Tuple{}
+			for _, i := range []int64{5, 3, 9, 1, 7, 2, 8, 4, 6} {
+				tuples = append(tuples, engine.NewTuple([]interface{}{i, fmt.Sprint(i)}, 0))
+			}
+			e := newEngineWithTuples("users", tuples, 2)
+
+			is := &IndexScan{Table: &Table{Name: "users"}, Index: "users_pkey_id", Keys: test.keys, Low: test.low, High: test.high}
+			testutil.MustEqual(t, ids(collect(t, is, e)), test.expected)
+			testutil.MustEqual(t, e.pagesRead, 0)
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	e := newPagedEngine(5)
+	s := &Selection{
+		Filter: &ComparisonExpr{Left: &Column{Name: "id", Index: 0}, Operator: parser.Op_GTE, Right: &Int64Expr{Value: 3}},
+		Input:  &Scan{Table: &Table{Name: "users"}},
+	}
+
+	testutil.MustEqual(t, ids(collect(t, s, e)), []int64{3, 4, 5})
+}
+
+func TestLimit_Offset(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit, offset int64
+		expected      []int64
+		pagesRead     int
+	}{
+		{name: "limit stops the scan early", limit: 2, offset: 0, expected: []int64{1, 2}, pagesRead: 1},
+		{name: "limit and offset", limit: 2, offset: 3, expected: []int64{4, 5}, pagesRead: 3},
+		{name: "offset exceeds", limit: 2, offset: 10, expected: []int64{}, pagesRead: 5},
+		{name: "limit 0", limit: 0, offset: 0, expected: []int64{}, pagesRead: 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			e := newPagedEngine(9)
+			l := &Limit{
+				Limit: &Int64Expr{Value: test.limit},
+				Input: &Offset{
+					Offset: &Int64Expr{Value: test.offset},
+					Input:  &Scan{Table: &Table{Name: "users"}},
+				},
+			}
+
+			testutil.MustEqual(t, ids(collect(t, l, e)), test.expected)
+			testutil.MustEqual(t, e.pagesRead, test.pagesRead)
+		})
+	}
+}
+
+func TestProjection(t *testing.T) {
+	e := newPagedEngine(2)
+	pj := &Projection{
+		Columns: []Expr{&Column{Name: "name", Index: 1}, &Column{Name: "id", Index: 0}},
+		Input:   &Scan{Table: &Table{Name: "users"}},
+	}
+
+	tuples := collect(t, pj, e)
+	testutil.MustEqual(t, len(tuples), 2)
+	testutil.MustEqual(t, tuples[0].Value(0), "a")
+	testutil.MustEqual(t, tuples[0].Value(1), int64(1))
+}
+
+// newItemsEngine returns the engine whose "items" table has
+// (id int64, category string, price float64, active bool, created timestamp, code bytes) tuples.
+func newItemsEngine() *pagedEngine {
+	day := func(d int) time.Time { return time.Date(2021, 5, d, 0, 0, 0, 0, time.UTC) }
+	rows := [][]interface{}{
+		{int64(1), "book", float64(10.5), true, day(3), []byte{3}},
+		{int64(2), "food", float64(3), false, day(1), []byte{1}},
+		{int64(3), "book", nil, true, day(2), []byte{2}},
+		{int64(4), nil, float64(7), false, day(5), []byte{5}},
+		{int64(5), "food", float64(3), true, day(4), []byte{4}},
+		{int64(6), "book", float64(10.5), false, nil, nil},
+	}
+
+	tuples := make([]sdb.Tuple, len(rows))
+	for i, row := range rows {
+		tuples[i] = engine.NewTuple(row, 0)
+	}
+
+	return newEngineWithTuples("items", tuples, 4)
+}
+
+func TestOrderBy(t *testing.T) {
+	col := func(name string, index int) *Column { return &Column{Name: name, Index: index} }
+
+	tests := []struct {
+		name       string
+		columns    []Expr
+		directions []string
+		topN       int
+		expected   []int64
+	}{
+		{name: "int64 desc", columns: []Expr{col("id", 0)}, directions: []string{"desc"}, expected: []int64{6, 5, 4, 3, 2, 1}},
+		{name: "string asc, null first", columns: []Expr{col("category", 1)}, directions: []string{"asc"}, expected: []int64{4, 1, 3, 6, 2, 5}},
+		{name: "float64 desc, null last", columns: []Expr{col("price", 2)}, directions: []string{"desc"}, expected: []int64{1, 6, 4, 2, 5, 3}},
+		{name: "bool", columns: []Expr{col("active", 3)}, directions: []string{"asc"}, expected: []int64{2, 4, 6, 1, 3, 5}},
+		{name: "timestamp", columns: []Expr{col("created", 4)}, directions: []string{"asc"}, expected: []int64{6, 2, 3, 1, 5, 4}},
+		{name: "bytes", columns: []Expr{col("code", 5)}, directions: []string{"desc"}, expected: []int64{4, 5, 1, 3, 2, 6}},
+		{
+			name:       "multiple keys in mixed directions",
+			columns:    []Expr{col("category", 1), col("price", 2), col("id", 0)},
+			directions: []string{"desc", "asc", "desc"},
+			expected:   []int64{5, 2, 3, 6, 1, 4},
+		},
+		{
+			name:       "top n",
+			columns:    []Expr{col("category", 1), col("price", 2), col("id", 0)},
+			directions: []string{"desc", "asc", "desc"},
+			topN:       3,
+			expected:   []int64{5, 2, 3},
+		},
+		{
+			name:       "top n larger than the tuples",
+			columns:    []Expr{col("id", 0)},
+			directions: []string{"desc"},
+			topN:       10,
+			expected:   []int64{6, 5, 4, 3, 2, 1},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ob := &OrderBy{
+				Columns:     test.columns,
+				Directirons: test.directions,
+				TopN:        test.topN,
+				Input:       &Scan{Table: &Table{Name: "items"}},
+			}
+
+			testutil.MustEqual(t, ids(collect(t, ob, newItemsEngine())), test.expected)
+		})
+	}
+}
+
+func TestOrderBy_TopN_SameAsSort(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 500; i++ {
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i), int64(r.Intn(50))}, 0))
+	}
+	e := newEngineWithTuples("users", tuples, 16)
+
+	columns := []Expr{&Column{Name: "score", Index: 1}}
+	sorted := ids(collect(t, &OrderBy{Columns: columns, Directirons: []string{"desc"}, Input: &Scan{Table: &Table{Name: "users"}}}, e))
+
+	for _, n := range []int{1, 7, 100, 499} {
+		t.Run(fmt.Sprintf("top %d", n), func(t *testing.T) {
+			ob := &OrderBy{Columns: columns, Directirons: []string{"desc"}, TopN: n, Input: &Scan{Table: &Table{Name: "users"}}}
+			testutil.MustEqual(t, ids(collect(t, ob, e)), sorted[:n])
+		})
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	e := newItemsEngine()
+
+	// category: book, food, book, NULL, food, book
+	d := &Distinct{
+		Columns: []Expr{&Column{Name: "category", Index: 1}},
+		Input:   &Scan{Table: &Table{Name: "items"}},
+	}
+	testutil.MustEqual(t, ids(collect(t, d, e)), []int64{1, 2, 4})
+
+	// (category, price): (book, 10.5), (food, 3), (book, NULL), (NULL, 7), (food, 3), (book, 10.5)
+	d = &Distinct{
+		Columns: []Expr{&Column{Name: "category", Index: 1}, &Column{Name: "price", Index: 2}},
+		Input:   &Scan{Table: &Table{Name: "items"}},
+	}
+	testutil.MustEqual(t, ids(collect(t, d, e)), []int64{1, 2, 3, 4})
+}
@@ -0,0 +1,226 @@
+package planner
+
+import (
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// joinTuples makes the joined tuple. When right is nil, the right columns are NULL.
+func joinTuples(left, right sdb.Tuple, rightWidth int) sdb.Tuple {
+	values := make([]interface{}, 0, left.Len()+rightWidth)
+	for i := 0; i < left.Len(); i++ {
+		values = append(values, left.Value(i))
+	}
+
+	for i := 0; i < rightWidth; i++ {
+		if right == nil {
+			values = append(values, nil)
+		} else {
+			values = append(values, right.Value(i))
+		}
+	}
+
+	return engine.NewTuple(values, -1)
+}
+
+// joinCondition joins the tuples and evaluates the condition. The joined tuple is returned
+// only when the condition is true.
+func joinCondition(cond Expr, left, right sdb.Tuple, rightWidth int) (sdb.Tuple, error) {
+	t := joinTuples(left, right, rightWidth)
+	if cond == nil {
+		return t, nil
+	}
+
+	ok, err := evalPredicate(cond, t)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// joinKeys evaluates the join keys. false is returned when any key is NULL because NULL never matches.
+func joinKeys(keys []Expr, t sdb.Tuple) ([]interface{}, bool, error) {
+	values, err := sortKeys(keys, t)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, v := range values {
+		if v == nil {
+			return nil, false, nil
+		}
+	}
+
+	return values, true, nil
+}
+
+// compareKeys compares the join keys in order. The keys must not be NULL.
+func compareKeys(a, b []interface{}) int {
+	for i := range a {
+		if cmp, _ := compareValues(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+
+	return 0
+}
+
+// buildHashTable reads all the right tuples and puts them to the hash table by the keys.
+func (hj *HashJoin) buildHashTable() error {
+	hj.table = map[string][]sdb.Tuple{}
+	for {
+		t, err := hj.Right.Next()
+		if err != nil {
+			return err
+		}
+
+		if t == nil {
+			return nil
+		}
+
+		keys, ok, err := joinKeys(hj.RightKeys, t)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		key := encodeKey(keys)
+		hj.table[key] = append(hj.table[key], t)
+	}
+}
+
+// nextLeft reads the next left tuple and finds the right tuples whose keys are the same.
+// false is returned when no more left tuple exists.
+func (hj *HashJoin) nextLeft() (bool, error) {
+	t, err := hj.Left.Next()
+	if err != nil || t == nil {
+		return false, err
+	}
+
+	hj.left = t
+	hj.candidates = nil
+	hj.idx = 0
+	hj.matched = false
+
+	keys, ok, err := joinKeys(hj.LeftKeys, t)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		hj.candidates = hj.table[encodeKey(keys)]
+	}
+
+	return true, nil
+}
+
+// readRight reads the next right tuple which has no NULL in the keys.
+func (mj *MergeJoin) readRight() error {
+	for {
+		t, err := mj.Right.Next()
+		if err != nil {
+			return err
+		}
+
+		if t == nil {
+			mj.right = nil
+			mj.rightKeys = nil
+			return nil
+		}
+
+		keys, ok, err := joinKeys(mj.RightKeys, t)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			mj.right = t
+			mj.rightKeys = keys
+			return nil
+		}
+	}
+}
+
+// nextLeft reads the next left tuple and positions the group of the right tuples whose keys
+// are the same as the left keys. Because both inputs are sorted, the right tuples whose keys are
+// smaller than the left keys are never matched again, so they are skipped.
+// false is returned when no more left tuple exists.
+func (mj *MergeJoin) nextLeft() (bool, error) {
+	t, err := mj.Left.Next()
+	if err != nil || t == nil {
+		return false, err
+	}
+
+	mj.left = t
+	mj.matched = false
+	mj.idx = 0
+
+	keys, ok, err := joinKeys(mj.LeftKeys, t)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		// NULL never matches
+		mj.idx = len(mj.group)
+		return true, nil
+	}
+
+	// the same keys as the previous left tuple
+	if mj.groupKeys != nil && compareKeys(keys, mj.groupKeys) == 0 {
+		return true, nil
+	}
+
+	for mj.right != nil && compareKeys(mj.rightKeys, keys) < 0 {
+		if err := mj.readRight(); err != nil {
+			return false, err
+		}
+	}
+
+	mj.group = mj.group[:0]
+	mj.groupKeys = keys
+	for mj.right != nil && compareKeys(mj.rightKeys, keys) == 0 {
+		mj.group = append(mj.group, mj.right)
+		if err := mj.readRight(); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// matchLeft returns the tuple produced when the left tuple matches the right tuple and they are joined to t.
+// done is true when the left tuple needs no more right tuples; semi join produces the left tuple on the first
+// match, and anti join drops the left tuple which matches.
+func matchLeft(typ parser.JoinType, left, t sdb.Tuple) (sdb.Tuple, bool) {
+	switch typ {
+	case parser.SemiJoin:
+		return left, true
+	case parser.AntiJoin:
+		return nil, true
+	}
+
+	return t, false
+}
+
+// padLeft returns the tuple produced for the left tuple which matches nothing; the left tuple with NULLs
+// on LEFT join, or the left tuple itself on anti join.
+func padLeft(typ parser.JoinType, left sdb.Tuple, matched bool, rightWidth int) sdb.Tuple {
+	if left == nil || matched {
+		return nil
+	}
+
+	switch typ {
+	case parser.LeftJoin:
+		return joinTuples(left, nil, rightWidth)
+	case parser.AntiJoin:
+		return left
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package planner
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+// newJoinEngine returns the engine which has users (id, name, dept_id) and depts (id, name).
+func newJoinEngine() *pagedEngine {
+	users := []sdb.Tuple{
+		engine.NewTuple([]interface{}{int64(1), "alice", int64(10)}, 0),
+		engine.NewTuple([]interface{}{int64(2), "bob", int64(20)}, 0),
+		engine.NewTuple([]interface{}{int64(3), "carol", nil}, 0),
+		engine.NewTuple([]interface{}{int64(4), "dave", int64(10)}, 0),
+		engine.NewTuple([]interface{}{int64(5), "eve", int64(30)}, 0),
+	}
+	depts := []sdb.Tuple{
+		engine.NewTuple([]interface{}{int64(20), "ops"}, 0),
+		engine.NewTuple([]interface{}{int64(10), "eng"}, 0),
+		engine.NewTuple([]interface{}{int64(40), "hr"}, 0),
+	}
+
+	e := newEngineWithTuples("users", users, 2)
+	e.pages["depts"] = newEngineWithTuples("depts", depts, 2).pages["depts"]
+	return e
+}
+
+func TestJoin(t *testing.T) {
+	int64Col := func(name string, index int) *Column {
+		return &Column{Name: name, Index: index, Type: schema.ColumnTypeInt64}
+	}
+	// users.dept_id = depts.id
+	equal := &ComparisonExpr{Left: int64Col("dept_id", 2), Operator: parser.Op_EQ, Right: int64Col("id", 3)}
+	// users.dept_id = depts.id and depts.name <> "ops"
+	equalAndNotOps := &AndExpr{
+		Left:  equal,
+		Right: &ComparisonExpr{Left: &Column{Name: "name", Index: 4, Type: schema.ColumnTypeString}, Operator: parser.Op_NEQ, Right: &StringExpr{Value: "ops"}},
+	}
+
+	users := func() List { return &Scan{Table: &Table{Name: "users"}} }
+	depts := func() List { return &Scan{Table: &Table{Name: "depts"}} }
+	leftKeys := []Expr{int64Col("dept_id", 2)}
+	rightKeys := []Expr{int64Col("id", 0)}
+
+	joins := map[string]func(typ parser.JoinType, cond Expr) List{
+		"nested loop": func(typ parser.JoinType, cond Expr) List {
+			return &NestedLoopJoin{Type: typ, Left: users(), Right: depts(), Condition: cond, RightWidth: 2}
+		},
+		"index nested loop": func(typ parser.JoinType, cond Expr) List {
+			return &IndexNestedLoopJoin{Type: typ, Left: users(), Table: &Table{Name: "depts"}, Index: "depts_pkey_id", LeftKey: leftKeys[0], Condition: cond, RightWidth: 2}
+		},
+		"hash": func(typ parser.JoinType, cond Expr) List {
+			return &HashJoin{Type: typ, Left: users(), Right: depts(), LeftKeys: leftKeys, RightKeys: rightKeys, Condition: cond, RightWidth: 2}
+		},
+		"merge": func(typ parser.JoinType, cond Expr) List {
+			return &MergeJoin{
+				Type:       typ,
+				Left:       &OrderBy{Columns: leftKeys, Directirons: []string{"asc"}, Input: users()},
+				Right:      &OrderBy{Columns: rightKeys, Directirons: []string{"asc"}, Input: depts()},
+				LeftKeys:   leftKeys,
+				RightKeys:  rightKeys,
+				Condition:  cond,
+				RightWidth: 2,
+			}
+		},
+	}
+
+	tests := []struct {
+		name     string
+		typ      parser.JoinType
+		cond     Expr
+		expected [][]interface{}
+	}{
+		{
+			name: "inner join",
+			typ:  parser.InnerJoin,
+			cond: equal,
+			expected: [][]interface{}{
+				{int64(1), "alice", int64(10), int64(10), "eng"},
+				{int64(2), "bob", int64(20), int64(20), "ops"},
+				{int64(4), "dave", int64(10), int64(10), "eng"},
+			},
+		},
+		{
+			name: "left join",
+			typ:  parser.LeftJoin,
+			cond: equal,
+			expected: [][]interface{}{
+				{int64(1), "alice", int64(10), int64(10), "eng"},
+				{int64(2), "bob", int64(20), int64(20), "ops"},
+				{int64(3), "carol", nil, nil, nil},
+				{int64(4), "dave", int64(10), int64(10), "eng"},
+				{int64(5), "eve", int64(30), nil, nil},
+			},
+		},
+		{
+			name: "inner join with additional condition",
+			typ:  parser.InnerJoin,
+			cond: equalAndNotOps,
+			expected: [][]interface{}{
+				{int64(1), "alice", int64(10), int64(10), "eng"},
+				{int64(4), "dave", int64(10), int64(10), "eng"},
+			},
+		},
+		{
+			name: "left join with additional condition",
+			typ:  parser.LeftJoin,
+			cond: equalAndNotOps,
+			expected: [][]interface{}{
+				{int64(1), "alice", int64(10), int64(10), "eng"},
+				{int64(2), "bob", int64(20), nil, nil},
+				{int64(3), "carol", nil, nil, nil},
+				{int64(4), "dave", int64(10), int64(10), "eng"},
+				{int64(5), "eve", int64(30), nil, nil},
+			},
+		},
+		{
+			name:     "semi join",
+			typ:      parser.SemiJoin,
+			cond:     equal,
+			expected: [][]interface{}{{int64(1), "alice", int64(10)}, {int64(2), "bob", int64(20)}, {int64(4), "dave", int64(10)}},
+		},
+		{
+			name:     "anti join",
+			typ:      parser.AntiJoin,
+			cond:     equal,
+			expected: [][]interface{}{{int64(3), "carol", nil}, {int64(5), "eve", int64(30)}},
+		},
+		{
+			name:     "anti join with additional condition",
+			typ:      parser.AntiJoin,
+			cond:     equalAndNotOps,
+			expected: [][]interface{}{{int64(2), "bob", int64(20)}, {int64(3), "carol", nil}, {int64(5), "eve", int64(30)}},
+		},
+	}
+
+	for _, test := range tests {
+		for name, join := range joins {
+			test, name, join := test, name, join
+			t.Run(test.name+" by "+name, func(t *testing.T) {
+				// semi and anti join produce only the left tuples
+				rows := values(collect(t, join(test.typ, test.cond), newJoinEngine()), len(test.expected[0]))
+				// the order of the joined tuples depends on the algorithm
+				sort.SliceStable(rows, func(i, j int) bool { return rows[i][0].(int64) < rows[j][0].(int64) })
+				testutil.MustEqual(t, rows, test.expected)
+			})
+		}
+	}
+}
+
+func TestJoin_DuplicatedKeys(t *testing.T) {
+	int64Col := func(name string, index int) *Column {
+		return &Column{Name: name, Index: index, Type: schema.ColumnTypeInt64}
+	}
+	// depts left join users on depts.id = users.dept_id
+	cond := &ComparisonExpr{Left: int64Col("id", 0), Operator: parser.Op_EQ, Right: int64Col("dept_id", 4)}
+	leftKeys := []Expr{int64Col("id", 0)}
+	rightKeys := []Expr{int64Col("dept_id", 2)}
+	depts := func() List { return &Scan{Table: &Table{Name: "depts"}} }
+	users := func() List { return &Scan{Table: &Table{Name: "users"}} }
+
+	expected := [][]interface{}{
+		{int64(10), int64(1)},
+		{int64(10), int64(4)},
+		{int64(20), int64(2)},
+		{int64(40), nil},
+	}
+
+	joins := map[string]List{
+		"nested loop": &NestedLoopJoin{Type: parser.LeftJoin, Left: depts(), Right: users(), Condition: cond, RightWidth: 3},
+		"hash":        &HashJoin{Type: parser.LeftJoin, Left: depts(), Right: users(), LeftKeys: leftKeys, RightKeys: rightKeys, Condition: cond, RightWidth: 3},
+		"merge": &MergeJoin{
+			Type:       parser.LeftJoin,
+			Left:       &OrderBy{Columns: leftKeys, Directirons: []string{"asc"}, Input: depts()},
+			Right:      &OrderBy{Columns: rightKeys, Directirons: []string{"asc"}, Input: users()},
+			LeftKeys:   leftKeys,
+			RightKeys:  rightKeys,
+			Condition:  cond,
+			RightWidth: 3,
+		},
+	}
+
+	for name, join := range joins {
+		name, join := name, join
+		t.Run(name, func(t *testing.T) {
+			rows := [][]interface{}{}
+			for _, t := range collect(t, join, newJoinEngine()) {
+				rows = append(rows, []interface{}{t.Value(0), t.Value(2)})
+			}
+			sort.SliceStable(rows, func(i, j int) bool {
+				if rows[i][0] != rows[j][0] {
+					return rows[i][0].(int64) < rows[j][0].(int64)
+				}
+				return rows[j][1] == nil || (rows[i][1] != nil && rows[i][1].(int64) < rows[j][1].(int64))
+			})
+			testutil.MustEqual(t, rows, expected)
+		})
+	}
+}
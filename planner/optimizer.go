@@ -0,0 +1,996 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+)
+
+// maxJoinReorder is the max number of the inner joined items whose order is optimized.
+// The order of more items is searched too long, so they are joined in the order in the query.
+const maxJoinReorder = 8
+
+// The optimizer makes the physical plan of FROM and WHERE clause. It chooses the cheapest plan based on
+// the cost estimated with the table statistics:
+//
+//   - The predicates in WHERE and ON are pushed down to the tables or the joins as deep as possible.
+//   - Only the columns used in the query are read from the tables (projection pushdown).
+//   - Each table is read by sequential scan or index scan. Index scan reads the tuples in the order of the key,
+//     so the sort for ORDER BY or merge join is skipped on it.
+//   - The inner joined tables are joined in any order, by nested loop, index nested loop, hash or merge join.
+//     The sides of a left join are kept, but its algorithm is chosen in the same way.
+//   - The simple subqueries of EXISTS and IN in WHERE are joined by the semi join or the anti join (decorrelation).
+type optimizer struct {
+	planner *Planner
+	// rels are the tables in FROM clause in order.
+	rels []*relation
+	root *joinTree
+	// order is the column in ORDER BY when the result can be produced in the order of the column
+	// without sorting. nil means no such order is needed.
+	order *parser.ColName
+}
+
+// relation is a table in FROM clause, or a derived relation which is produced by a plan.
+type relation struct {
+	// pos is the position in FROM clause.
+	pos int
+	// name is the alias of the table, or the table name if no alias is given.
+	name  string
+	table *schema.Table
+	tbl   *Table
+	// used is true for the columns used in the query.
+	used []bool
+	// plan produces the derived relation with the estimated rows and cost. It is nil for a table.
+	plan List
+	rows float64
+	cost float64
+}
+
+// columns returns the positions of the used columns in the table.
+func (r *relation) columns() []int {
+	columns := []int{}
+	for i, used := range r.used {
+		if used {
+			columns = append(columns, i)
+		}
+	}
+
+	return columns
+}
+
+// scanColumns returns the columns to be read. nil means every column.
+func (r *relation) scanColumns() []int {
+	columns := r.columns()
+	if len(columns) == len(r.table.Columns) {
+		return nil
+	}
+
+	return columns
+}
+
+func (r *relation) scope() *scope {
+	return &scope{tables: []*scopeTable{{name: r.name, table: r.table, columns: r.columns(), pos: r.pos}}}
+}
+
+// joinTree is FROM clause organized for the optimizer. A node is a table, inner joined items,
+// or a left, semi or anti join.
+type joinTree struct {
+	rel *relation
+	// items are the inner joined items. They can be joined in any order.
+	// preds are the predicates which refer to more than one item.
+	items []*joinTree
+	preds []parser.Expr
+	// left and right are the sides of the join of typ, and on is its condition.
+	typ         parser.JoinType
+	left, right *joinTree
+	on          []parser.Expr
+	// filters are the predicates evaluated on the output of the node.
+	filters []parser.Expr
+}
+
+// relations returns the tables in the node.
+func (jt *joinTree) relations() map[*relation]bool {
+	rels := map[*relation]bool{}
+	switch {
+	case jt.rel != nil:
+		rels[jt.rel] = true
+	case jt.items != nil:
+		for _, item := range jt.items {
+			for r := range item.relations() {
+				rels[r] = true
+			}
+		}
+	default:
+		for r := range jt.left.relations() {
+			rels[r] = true
+		}
+		for r := range jt.right.relations() {
+			rels[r] = true
+		}
+	}
+
+	return rels
+}
+
+// contains reports if all the tables are in the node.
+func (jt *joinTree) contains(refs map[*relation]bool) bool {
+	rels := jt.relations()
+	for r := range refs {
+		if !rels[r] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// path is a plan of a part of FROM clause with its estimation.
+type path struct {
+	list List
+	// sc is the layout of the tuple produced by list.
+	sc   *scope
+	rows float64
+	cost float64
+	// rel and filters are set when the path reads a table. Then the table can be looked up
+	// by the index in a join instead.
+	rel     *relation
+	filters []parser.Expr
+	// ordered is the column by which the output is sorted in ascending order. nil means unordered.
+	ordered *Column
+}
+
+func newOptimizer(p *Planner, stmt *parser.SelectStatement) *optimizer {
+	o := &optimizer{planner: p}
+	o.root = o.newJoinTree(stmt.From)
+	o.markUsedColumns(stmt)
+
+	if len(stmt.OrderBy) == 1 && stmt.OrderBy[0].Direction == parser.OrderDirection_ASC && !stmt.IsAggregated() {
+		if c, ok := stmt.OrderBy[0].Expr.(*parser.ColName); ok {
+			o.order = c
+		}
+	}
+
+	o.distribute(o.root)
+	if stmt.Where != nil {
+		for _, pred := range flattenAnd(stmt.Where.Expr) {
+			if jt := o.decorrelate(pred); jt != nil {
+				o.root = jt
+				continue
+			}
+			o.pushDown(o.root, pred)
+		}
+	}
+
+	return o
+}
+
+// optimize returns the cheapest plan.
+func (o *optimizer) optimize() *path {
+	return o.bestPath(o.root)
+}
+
+func (o *optimizer) newJoinTree(te parser.TableExpr) *joinTree {
+	switch t := te.(type) {
+	case *parser.AliasedTableExpr:
+		// the derived table and the common table expression are planned as a subquery in FROM clause
+		switch tbl := t.Expr.(type) {
+		case *parser.DerivedTable:
+			return &joinTree{rel: o.inlineRelation(t.As, tbl.Table, tbl.Select)}
+		case *parser.TableName:
+			if tbl.CTE != nil {
+				name := tbl.Name
+				if t.As != "" {
+					name = t.As
+				}
+				return &joinTree{rel: o.inlineRelation(name, tbl.CTE.Table, tbl.CTE.Select)}
+			}
+		}
+
+		tbl := t.Expr.(*parser.TableName)
+		table := o.planner.catalog.GetTable(tbl.Name)
+		name := tbl.Name
+		if t.As != "" {
+			name = t.As
+		}
+
+		rel := &relation{
+			pos:   len(o.rels),
+			name:  name,
+			table: table,
+			tbl:   &Table{Name: tbl.Name, Alias: t.As},
+			used:  make([]bool, len(table.Columns)),
+		}
+		o.rels = append(o.rels, rel)
+		return &joinTree{rel: rel}
+	case *parser.JoinTableExpr:
+		left := o.newJoinTree(t.LeftExpr)
+		right := o.newJoinTree(t.RightExpr)
+		if t.Join == parser.LeftJoin {
+			return &joinTree{typ: parser.LeftJoin, left: left, right: right, on: flattenAnd(t.Condition)}
+		}
+
+		// nested inner joins are flattened, so that all of them can be reordered
+		jt := &joinTree{items: []*joinTree{}, preds: []parser.Expr{}}
+		for _, side := range []*joinTree{left, right} {
+			if side.items != nil {
+				jt.items = append(jt.items, side.items...)
+				jt.preds = append(jt.preds, side.preds...)
+			} else {
+				jt.items = append(jt.items, side)
+			}
+		}
+		jt.preds = append(jt.preds, flattenAnd(t.Condition)...)
+		return jt
+	}
+
+	// must not come here because the statement is validated
+	panic(fmt.Sprintf("unexpected table expression %T", te))
+}
+
+// markUsedColumns finds the columns used in the query.
+func (o *optimizer) markUsedColumns(stmt *parser.SelectStatement) {
+	mark := func(c *parser.ColName) {
+		if rel, ci := o.resolve(c); rel != nil {
+			rel.used[ci] = true
+		}
+	}
+
+	for _, se := range stmt.SelectExprs {
+		switch s := se.(type) {
+		case *parser.StarExpr:
+			for _, rel := range o.rels {
+				if s.Table != "" && !strings.EqualFold(rel.name, s.Table) {
+					continue
+				}
+				for i := range rel.used {
+					rel.used[i] = true
+				}
+			}
+		case *parser.AliasedExpr:
+			walkColNames(s.Expr, mark)
+		}
+	}
+
+	if stmt.Where != nil {
+		walkColNames(stmt.Where.Expr, mark)
+	}
+	for _, g := range stmt.GroupBy {
+		walkColNames(g, mark)
+	}
+	if stmt.Having != nil {
+		walkColNames(stmt.Having.Expr, mark)
+	}
+	for _, ob := range stmt.OrderBy {
+		walkColNames(ob.Expr, mark)
+	}
+
+	var markTree func(jt *joinTree)
+	markTree = func(jt *joinTree) {
+		for _, pred := range jt.preds {
+			walkColNames(pred, mark)
+		}
+		for _, pred := range jt.on {
+			walkColNames(pred, mark)
+		}
+		for _, item := range jt.items {
+			markTree(item)
+		}
+		if jt.left != nil {
+			markTree(jt.left)
+			markTree(jt.right)
+		}
+	}
+	markTree(o.root)
+}
+
+// distribute pushes down the join conditions. The conditions of the inner joins can be evaluated
+// anywhere, while only the conditions referring only to the right side can be pushed down in a left join.
+func (o *optimizer) distribute(jt *joinTree) {
+	switch {
+	case jt.items != nil:
+		preds := jt.preds
+		jt.preds = []parser.Expr{}
+		for _, item := range jt.items {
+			o.distribute(item)
+		}
+		for _, pred := range preds {
+			o.pushDown(jt, pred)
+		}
+	case jt.left != nil:
+		o.distribute(jt.left)
+		o.distribute(jt.right)
+
+		on := jt.on
+		jt.on = []parser.Expr{}
+		for _, pred := range on {
+			refs := o.refs(pred)
+			if len(refs) > 0 && jt.right.contains(refs) {
+				o.pushDown(jt.right, pred)
+			} else {
+				jt.on = append(jt.on, pred)
+			}
+		}
+	}
+}
+
+// pushDown places the predicate on the deepest node which has all the tables the predicate refers to.
+func (o *optimizer) pushDown(jt *joinTree, pred parser.Expr) {
+	refs := o.refs(pred)
+	switch {
+	case jt.rel != nil:
+		jt.filters = append(jt.filters, pred)
+	case jt.items != nil:
+		for _, item := range jt.items {
+			if item.contains(refs) {
+				o.pushDown(item, pred)
+				return
+			}
+		}
+		jt.preds = append(jt.preds, pred)
+	default:
+		// The right side of a left join can be NULL, so the predicate on it must be evaluated after the join.
+		// The right side of a semi or anti join is not in the output.
+		if jt.left.contains(refs) {
+			o.pushDown(jt.left, pred)
+			return
+		}
+		jt.filters = append(jt.filters, pred)
+	}
+}
+
+// bestPath returns the cheapest plan of the node.
+func (o *optimizer) bestPath(jt *joinTree) *path {
+	switch {
+	case jt.rel != nil:
+		return o.accessPath(jt.rel, jt.filters)
+	case jt.items != nil:
+		return o.joinItems(jt)
+	}
+
+	best := o.joinPath(jt.typ, o.bestPath(jt.left), o.bestPath(jt.right), jt.on)
+	return o.filter(best, jt.filters)
+}
+
+// accessPath chooses how to read the table. The indexed column compared with the values is read by the index.
+func (o *optimizer) accessPath(rel *relation, filters []parser.Expr) *path {
+	if rel.plan != nil {
+		return o.filter(&path{list: rel.plan, sc: rel.scope(), rows: rel.rows, cost: rel.cost}, filters)
+	}
+
+	rows := tableRows(rel.table)
+	scan := &path{
+		list:    &Scan{Table: rel.tbl, Columns: rel.scanColumns()},
+		sc:      rel.scope(),
+		rows:    rows,
+		cost:    tablePages(rel.table)*seqPageCost + rows*cpuTupleCost,
+		rel:     rel,
+		filters: filters,
+	}
+	candidates := []*path{o.filter(scan, filters)}
+
+	// When the result is ordered by a column of the table, the index on it can save the sort.
+	ordered := -1
+	if o.order != nil && o.root.rel == rel {
+		_, ordered = o.resolve(o.order)
+	}
+
+	for ci := range rel.table.Columns {
+		index := primaryKeyIndex(rel.table, ci)
+		if index == nil {
+			continue
+		}
+
+		if ip := o.indexPath(rel, filters, index, ci, ci == ordered); ip != nil {
+			candidates = append(candidates, ip)
+		}
+	}
+
+	// the cost to sort is added to the paths which are not ordered as needed
+	cost := func(pt *path) float64 {
+		if ordered >= 0 && (pt.ordered == nil || pt.ordered.Name != rel.table.Columns[ordered].Name) {
+			return pt.cost + sortCost(pt.rows, 1)
+		}
+		return pt.cost
+	}
+
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if cost(candidate) < cost(best) {
+			best = candidate
+		}
+	}
+
+	if r := rows * o.selectivity(filters); r < best.rows {
+		best.rows = r
+	}
+
+	return best
+}
+
+// indexPath makes the path to read the table by the index on the column. The predicates which compare
+// the column with the values are used to find the keys or the range of the keys to read. IN with the values
+// is read as the keys, and LIKE with the pattern starting with a prefix is read as the range of the prefix.
+// nil is returned when no predicate can be used unless full is true; then every key is read in order.
+func (o *optimizer) indexPath(rel *relation, filters []parser.Expr, index *schema.Index, ci int, full bool) *path {
+	var keys []Expr
+	var low, high *IndexBound
+	eqs, ranges, rest := []parser.Expr{}, []parser.Expr{}, []parser.Expr{}
+	for _, pred := range filters {
+		op, val, ok := o.keyComparison(rel, ci, pred)
+		vals, in := o.keyValues(rel, ci, pred)
+		prefix, pure, like := o.keyPrefix(rel, ci, pred)
+		switch {
+		case ok && op == parser.Op_EQ && keys == nil:
+			keys = []Expr{val}
+			eqs = append(eqs, pred)
+		case in && keys == nil:
+			keys = vals
+			eqs = append(eqs, pred)
+		case ok && (op == parser.Op_GT || op == parser.Op_GTE):
+			bound := &IndexBound{Value: val, Inclusive: op == parser.Op_GTE}
+			if low == nil || tighterBound(bound, low, 1) {
+				low = bound
+			}
+			ranges = append(ranges, pred)
+		case ok && (op == parser.Op_LT || op == parser.Op_LTE):
+			bound := &IndexBound{Value: val, Inclusive: op == parser.Op_LTE}
+			if high == nil || tighterBound(bound, high, -1) {
+				high = bound
+			}
+			ranges = append(ranges, pred)
+		case like:
+			bound := &IndexBound{Value: &StringExpr{Value: prefix}, Inclusive: true}
+			if low == nil || tighterBound(bound, low, 1) {
+				low = bound
+			}
+			if succ := prefixSuccessor(prefix); succ != "" {
+				bound := &IndexBound{Value: &StringExpr{Value: succ}}
+				if high == nil || tighterBound(bound, high, -1) {
+					high = bound
+				}
+			}
+			// Only "prefix%" matches every key in the range. Otherwise, the keys are filtered by the pattern
+			// and the estimation of the range is left to the filter.
+			if pure {
+				ranges = append(ranges, pred)
+			} else {
+				rest = append(rest, pred)
+			}
+		default:
+			rest = append(rest, pred)
+		}
+	}
+
+	rows := tableRows(rel.table)
+	is := &IndexScan{Table: rel.tbl, Index: index.Name, KeyColumn: ci, Columns: rel.scanColumns()}
+	pt := &path{list: is, sc: rel.scope(), rel: rel, filters: filters}
+	switch {
+	case keys != nil:
+		// the range is evaluated on the looked up tuples
+		is.Keys = keys
+		rest = append(rest, ranges...)
+		pt.rows = math.Min(float64(len(keys)), rows)
+		pt.cost = indexLookupCost(rows) * float64(len(keys))
+	case low != nil || high != nil || full:
+		is.Low, is.High = low, high
+		pt.rows = rows * o.selectivity(ranges)
+		pt.cost = indexLookupCost(rows) + pt.rows*indexTupleCost
+	default:
+		return nil
+	}
+
+	// the output is sorted by the key when the key column is read
+	for i, c := range rel.columns() {
+		if c == ci {
+			colDef := rel.table.Columns[ci]
+			pt.ordered = &Column{Table: rel.name, Name: colDef.Name, Index: i, Type: colDef.Type}
+		}
+	}
+
+	return o.filter(pt, rest)
+}
+
+// keyComparison returns the operator and the value when the predicate compares the column of the table
+// with a value. The operator is the one when the column is on the left side.
+func (o *optimizer) keyComparison(rel *relation, ci int, pred parser.Expr) (parser.OperatorType, Expr, bool) {
+	cmp, ok := pred.(*parser.ComparisonExpr)
+	if !ok {
+		return 0, nil, false
+	}
+
+	if val, ok := o.outerKey(rel, ci, cmp); ok {
+		return parser.Op_EQ, val, true
+	}
+
+	op := cmp.Operator
+	c, ok := cmp.Left.(*parser.ColName)
+	val, vok := cmp.Right.(*parser.Value)
+	if !ok || !vok {
+		op = flipOperator(op)
+		c, ok = cmp.Right.(*parser.ColName)
+		val, vok = cmp.Left.(*parser.Value)
+	}
+	if !ok || !vok {
+		return 0, nil, false
+	}
+
+	if r, i := o.resolve(c); r != rel || i != ci {
+		return 0, nil, false
+	}
+
+	typ := rel.table.Columns[ci].Type
+	if _, err := schema.ConvertValue(val.Val, typ); err != nil {
+		return 0, nil, false
+	}
+
+	return op, planValue(val.Val, typ), true
+}
+
+// outerKey returns the column of the outer query when the predicate is "column = outer column" and the column
+// is the one of the table. Then the subquery looks up the table by the index for every outer tuple.
+func (o *optimizer) outerKey(rel *relation, ci int, cmp *parser.ComparisonExpr) (Expr, bool) {
+	if o.planner.outer == nil || cmp.Operator != parser.Op_EQ {
+		return nil, false
+	}
+
+	c, cok := cmp.Left.(*parser.ColName)
+	oc, ook := cmp.Right.(*parser.ColName)
+	if !cok || !ook {
+		return nil, false
+	}
+
+	if r, _ := o.resolve(c); r == nil {
+		c, oc = oc, c
+	}
+	if r, i := o.resolve(c); r != rel || i != ci {
+		return nil, false
+	}
+	if r, _ := o.resolve(oc); r != nil {
+		return nil, false
+	}
+
+	val := o.planner.outer.column(oc)
+	if val.Column.Type != rel.table.Columns[ci].Type {
+		return nil, false
+	}
+
+	return val, true
+}
+
+// keyValues returns the values when the predicate is IN of the column of the table with the values.
+func (o *optimizer) keyValues(rel *relation, ci int, pred parser.Expr) ([]Expr, bool) {
+	in, ok := pred.(*parser.InExpr)
+	if !ok || in.Not || in.Subquery != nil {
+		return nil, false
+	}
+
+	c, ok := in.Operand.(*parser.ColName)
+	if !ok {
+		return nil, false
+	}
+
+	if r, i := o.resolve(c); r != rel || i != ci {
+		return nil, false
+	}
+
+	typ := rel.table.Columns[ci].Type
+	vals := make([]Expr, len(in.Values))
+	for i, v := range in.Values {
+		switch val := v.(type) {
+		case *parser.NullVal:
+			vals[i] = &NullExpr{}
+		case *parser.Value:
+			if _, err := schema.ConvertValue(val.Val, typ); err != nil {
+				return nil, false
+			}
+			vals[i] = planValue(val.Val, typ)
+		default:
+			return nil, false
+		}
+	}
+
+	return vals, true
+}
+
+// keyPrefix returns the prefix of the pattern when the predicate is LIKE of the string column of the table
+// with the pattern starting with the prefix. pure is true when the pattern is the prefix followed by "%".
+func (o *optimizer) keyPrefix(rel *relation, ci int, pred parser.Expr) (prefix string, pure bool, ok bool) {
+	like, ok := pred.(*parser.LikeExpr)
+	if !ok || like.Not {
+		return "", false, false
+	}
+
+	c, ok := like.Operand.(*parser.ColName)
+	pattern, pok := like.Pattern.(*parser.Value)
+	if !ok || !pok {
+		return "", false, false
+	}
+
+	if r, i := o.resolve(c); r != rel || i != ci || rel.table.Columns[ci].Type != schema.ColumnTypeString {
+		return "", false, false
+	}
+
+	prefix, rest := likePrefix(pattern.Val)
+	if prefix == "" {
+		return "", false, false
+	}
+
+	return prefix, rest != "" && strings.Trim(rest, "%") == "", true
+}
+
+// prefixSuccessor returns the smallest string greater than every string starting with the prefix.
+// It is empty when there is no such string.
+func prefixSuccessor(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+
+	return ""
+}
+
+// tighterBound reports if the bound a narrows the range more than b. dir is 1 for the lower bound
+// and -1 for the upper bound.
+func tighterBound(a, b *IndexBound, dir int) bool {
+	av, _ := eval(a.Value, nil)
+	bv, _ := eval(b.Value, nil)
+	cmp, _ := compareValues(av, bv)
+	if cmp == 0 {
+		return !a.Inclusive && b.Inclusive
+	}
+
+	return cmp*dir > 0
+}
+
+// filter evaluates the predicates on the output of the path.
+func (o *optimizer) filter(pt *path, preds []parser.Expr) *path {
+	if len(preds) == 0 {
+		return pt
+	}
+
+	filtered := *pt
+	filtered.list = &Selection{Filter: o.planPredicate(pt.sc, preds), Input: pt.list}
+	filtered.cost += pt.rows * cpuOperatorCost * float64(len(preds))
+	filtered.rows = pt.rows * o.selectivity(preds)
+	return &filtered
+}
+
+// joinItems finds the cheapest order to join the items. The orders are searched by dynamic programming;
+// the cheapest plan to join every subset of the items is made by joining an item to the cheapest plan
+// of the smaller subset. The joins are always left-deep.
+func (o *optimizer) joinItems(jt *joinTree) *path {
+	n := len(jt.items)
+	paths := make([]*path, n)
+	for i, item := range jt.items {
+		paths[i] = o.bestPath(item)
+	}
+
+	// predItems is the set of the items each predicate refers to.
+	predItems := make([]int, len(jt.preds))
+	for k, pred := range jt.preds {
+		refs := o.refs(pred)
+		for i, item := range jt.items {
+			for r := range item.relations() {
+				if refs[r] {
+					predItems[k] |= 1 << i
+				}
+			}
+		}
+	}
+
+	// predsFor returns the predicates evaluated when the item is joined to the subset.
+	predsFor := func(subset, i int) []parser.Expr {
+		joined := subset | 1<<i
+		preds := []parser.Expr{}
+		for k, pred := range jt.preds {
+			if predItems[k]&^joined == 0 && predItems[k]&^subset != 0 {
+				preds = append(preds, pred)
+			}
+		}
+		return preds
+	}
+
+	if n > maxJoinReorder {
+		best := paths[0]
+		for i := 1; i < n; i++ {
+			best = o.joinPath(parser.InnerJoin, best, paths[i], predsFor(1<<i-1, i))
+		}
+		return best
+	}
+
+	best := make([]*path, 1<<n)
+	for i := range paths {
+		best[1<<i] = paths[i]
+	}
+
+	for set := 1; set < 1<<n; set++ {
+		if bits.OnesCount(uint(set)) < 2 {
+			continue
+		}
+
+		// The items are tried from the last one, so that the order in the query is kept when the costs are the same.
+		for i := n - 1; i >= 0; i-- {
+			if set&(1<<i) == 0 {
+				continue
+			}
+
+			subset := set &^ (1 << i)
+			candidate := o.joinPath(parser.InnerJoin, best[subset], paths[i], predsFor(subset, i))
+			if best[set] == nil || candidate.cost < best[set].cost {
+				best[set] = candidate
+			}
+		}
+	}
+
+	return best[1<<n-1]
+}
+
+// joinPath chooses the cheapest algorithm to join the paths.
+func (o *optimizer) joinPath(typ parser.JoinType, left, right *path, preds []parser.Expr) *path {
+	sc := left.sc.concat(right.sc)
+	var cond Expr
+	if len(preds) > 0 {
+		cond = o.planPredicate(sc, preds)
+	}
+
+	// semi and anti join produce each left tuple at most once
+	rows := left.rows * right.rows * o.selectivity(preds)
+	switch typ {
+	case parser.LeftJoin:
+		rows = math.Max(rows, left.rows)
+	case parser.SemiJoin:
+		rows = math.Min(rows, left.rows)
+	case parser.AntiJoin:
+		rows = left.rows - math.Min(rows, left.rows)
+	}
+
+	leftWidth := left.sc.width()
+	rightWidth := right.sc.width()
+
+	// Nested loop join reads the right input for every left tuple.
+	// The joins other than merge join produce the tuples in the order of the left input.
+	best := &path{
+		list:    &NestedLoopJoin{Type: typ, Left: left.list, Right: right.list, Condition: cond, RightWidth: rightWidth},
+		cost:    left.cost + left.rows*right.cost + left.rows*right.rows*cpuOperatorCost,
+		ordered: left.ordered,
+	}
+	choose := func(list List, cost float64, ordered *Column) {
+		if cost < best.cost {
+			best.list = list
+			best.cost = cost
+			best.ordered = ordered
+		}
+	}
+
+	leftKeys, rightKeys := equiJoinKeys(cond, leftWidth)
+	if len(leftKeys) > 0 {
+		keys := float64(len(leftKeys))
+
+		// Hash join holds the whole right input on memory, so it is not used when it exceeds work_mem.
+		if o.planner.workMem <= 0 || right.rows*tupleWidth(right.sc) <= float64(o.planner.workMem) {
+			choose(
+				&HashJoin{Type: typ, Left: left.list, Right: right.list, LeftKeys: leftKeys, RightKeys: rightKeys, Condition: cond, RightWidth: rightWidth},
+				left.cost+right.cost+right.rows*cpuTupleCost+(left.rows+right.rows)*keys*cpuOperatorCost,
+				left.ordered,
+			)
+		}
+
+		// Merge join needs both inputs sorted by the keys. They are sorted unless they are already
+		// in the order, and the sort can be spilled to disk. The output is in the order of the keys.
+		leftList, leftCost := o.sortedInput(left, leftKeys)
+		rightList, rightCost := o.sortedInput(right, rightKeys)
+		choose(
+			&MergeJoin{
+				Type:       typ,
+				Left:       leftList,
+				Right:      rightList,
+				LeftKeys:   leftKeys,
+				RightKeys:  rightKeys,
+				Condition:  cond,
+				RightWidth: rightWidth,
+			},
+			leftCost+rightCost+(left.rows+right.rows)*keys*cpuOperatorCost,
+			leftKeys[0].(*Column),
+		)
+
+		// When the right is a table whose primary key is compared, the table is looked up for every left tuple.
+		// The predicates on the table are evaluated on the joined tuple.
+		if rel := right.rel; rel != nil {
+			for i, rk := range rightKeys {
+				index := primaryKeyIndex(rel.table, rel.columns()[rk.(*Column).Index])
+				if index == nil {
+					continue
+				}
+
+				inlCond := cond
+				if len(right.filters) > 0 {
+					inlCond = o.planPredicate(sc, append(append([]parser.Expr{}, preds...), right.filters...))
+				}
+				choose(
+					&IndexNestedLoopJoin{
+						Type:       typ,
+						Left:       left.list,
+						Table:      rel.tbl,
+						Index:      index.Name,
+						LeftKey:    leftKeys[i],
+						Columns:    rel.scanColumns(),
+						Condition:  inlCond,
+						RightWidth: rightWidth,
+					},
+					left.cost+left.rows*indexLookupCost(tableRows(rel.table)),
+					left.ordered,
+				)
+				break
+			}
+		}
+	}
+
+	best.sc = sc
+	if typ == parser.SemiJoin || typ == parser.AntiJoin {
+		best.sc = left.sc
+	}
+	best.rows = rows
+	return best
+}
+
+// sortedInput returns the input of the path sorted by the keys and its cost. The path is used as it is when it is
+// already sorted, and the table is read by the index instead when the key is indexed.
+func (o *optimizer) sortedInput(pt *path, keys []Expr) (List, float64) {
+	if len(keys) == 1 && pt.ordered != nil && pt.ordered.Index == keys[0].(*Column).Index {
+		return pt.list, pt.cost
+	}
+
+	asc := make([]string, len(keys))
+	for i := range asc {
+		asc[i] = "asc"
+	}
+	list, cost := List(&OrderBy{Columns: keys, Directirons: asc, Input: pt.list}), pt.cost+sortCost(pt.rows, len(keys))
+
+	if rel := pt.rel; rel != nil && len(keys) == 1 {
+		ci := rel.columns()[keys[0].(*Column).Index]
+		if index := primaryKeyIndex(rel.table, ci); index != nil {
+			if ip := o.indexPath(rel, pt.filters, index, ci, true); ip.cost < cost {
+				return ip.list, ip.cost
+			}
+		}
+	}
+
+	return list, cost
+}
+
+// planPredicate plans the conjunction of the predicates.
+func (o *optimizer) planPredicate(sc *scope, preds []parser.Expr) Expr {
+	expr := o.planner.planExpr(sc, nil, preds[0])
+	for _, pred := range preds[1:] {
+		expr = &AndExpr{Left: expr, Right: o.planner.planExpr(sc, nil, pred)}
+	}
+
+	return expr
+}
+
+// resolve finds the table of the column and the position of the column in the table.
+// nil is returned for the column of the outer query when the query is a subquery.
+func (o *optimizer) resolve(c *parser.ColName) (*relation, int) {
+	for _, rel := range o.rels {
+		if c.Qualifier != "" && !strings.EqualFold(rel.name, c.Qualifier) {
+			continue
+		}
+
+		for i, colDef := range rel.table.Columns {
+			if colDef.Name == strings.ToLower(c.Name) {
+				return rel, i
+			}
+		}
+	}
+
+	// the column of the outer query
+	if o.planner.outer != nil {
+		return nil, -1
+	}
+
+	// must not come here because the statement is validated
+	panic(fmt.Sprintf("column %s is not found", c.Name))
+}
+
+// refs returns the tables the expression refers to. The tables of the outer query are not included.
+func (o *optimizer) refs(expr parser.Expr) map[*relation]bool {
+	refs := map[*relation]bool{}
+	walkColNames(expr, func(c *parser.ColName) {
+		if rel, _ := o.resolve(c); rel != nil {
+			refs[rel] = true
+		}
+	})
+
+	return refs
+}
+
+// walkColNames calls fn for every column in the expression. For the subquery, fn is called for
+// the columns of the outer queries referred in it.
+func walkColNames(expr parser.Expr, fn func(c *parser.ColName)) {
+	switch e := expr.(type) {
+	case *parser.ColName:
+		fn(e)
+	case *parser.Subquery:
+		for _, c := range e.Outer {
+			fn(c)
+		}
+	case *parser.ExistsExpr:
+		walkColNames(e.Subquery, fn)
+	case *parser.FuncExpr:
+		for _, arg := range e.Args {
+			walkColNames(arg, fn)
+		}
+		if e.Over != nil {
+			for _, p := range e.Over.PartitionBy {
+				walkColNames(p, fn)
+			}
+			for _, o := range e.Over.OrderBy {
+				walkColNames(o.Expr, fn)
+			}
+		}
+	case *parser.AndExpr:
+		walkColNames(e.Left, fn)
+		walkColNames(e.Right, fn)
+	case *parser.OrExpr:
+		walkColNames(e.Left, fn)
+		walkColNames(e.Right, fn)
+	case *parser.NotExpr:
+		walkColNames(e.Operand, fn)
+	case *parser.IsNullExpr:
+		walkColNames(e.Operand, fn)
+	case *parser.ComparisonExpr:
+		walkColNames(e.Left, fn)
+		walkColNames(e.Right, fn)
+	case *parser.BinaryExpr:
+		walkColNames(e.Left, fn)
+		walkColNames(e.Right, fn)
+	case *parser.UnaryMinusExpr:
+		walkColNames(e.Operand, fn)
+	case *parser.InExpr:
+		walkColNames(e.Operand, fn)
+		for _, val := range e.Values {
+			walkColNames(val, fn)
+		}
+		if e.Subquery != nil {
+			walkColNames(e.Subquery, fn)
+		}
+	case *parser.LikeExpr:
+		walkColNames(e.Operand, fn)
+		walkColNames(e.Pattern, fn)
+	case *parser.CaseExpr:
+		if e.Operand != nil {
+			walkColNames(e.Operand, fn)
+		}
+		for _, w := range e.Whens {
+			walkColNames(w.Cond, fn)
+			walkColNames(w.Result, fn)
+		}
+		if e.Else != nil {
+			walkColNames(e.Else, fn)
+		}
+	}
+}
+
+// flattenAnd splits the expression by AND.
+func flattenAnd(expr parser.Expr) []parser.Expr {
+	if and, ok := expr.(*parser.AndExpr); ok {
+		return append(flattenAnd(and.Left), flattenAnd(and.Right)...)
+	}
+
+	return []parser.Expr{expr}
+}
+
+// inFromOrder returns the tables in the order of FROM clause.
+func (sc *scope) inFromOrder() []*scopeTable {
+	tables := append([]*scopeTable{}, sc.tables...)
+	sort.Slice(tables, func(i, j int) bool { return tables[i].pos < tables[j].pos })
+	return tables
+}
@@ -0,0 +1,424 @@
+package planner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+// shape describes the operator tree to compare the structure of the plans.
+func shape(l List) string {
+	switch n := l.(type) {
+	case *Scan:
+		return "Scan(" + n.Table.Name + ")"
+	case *IndexScan:
+		return "IndexScan(" + n.Table.Name + ")"
+	case *Selection:
+		return "Selection(" + shape(n.Input) + ")"
+	case *OrderBy:
+		return "OrderBy(" + shape(n.Input) + ")"
+	case *Projection:
+		return "Projection(" + shape(n.Input) + ")"
+	case *NestedLoopJoin:
+		return fmt.Sprintf("NestedLoopJoin(%s, %s)", shape(n.Left), shape(n.Right))
+	case *IndexNestedLoopJoin:
+		return fmt.Sprintf("IndexNestedLoopJoin(%s, %s)", shape(n.Left), n.Table.Name)
+	case *HashJoin:
+		return fmt.Sprintf("HashJoin(%s, %s)", shape(n.Left), shape(n.Right))
+	case *MergeJoin:
+		return fmt.Sprintf("MergeJoin(%s, %s)", shape(n.Left), shape(n.Right))
+	}
+
+	return fmt.Sprintf("%T", l)
+}
+
+// newOptimizerCatalog returns the catalog which has users (id, name, dept_id, score) and depts (id, name, floor).
+// When analyzed is true, users has 10000 rows and depts has 10 rows.
+func newOptimizerCatalog(analyzed bool) *catalog.Catalog {
+	users := &schema.Table{
+		Name: "users",
+		Columns: []*schema.ColumnDef{
+			{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+			{Name: "name", Type: schema.ColumnTypeString},
+			{Name: "dept_id", Type: schema.ColumnTypeInt64},
+			{Name: "score", Type: schema.ColumnTypeInt64},
+		},
+		Indices: []*schema.Index{{Table: "users", Name: "users_pkey_id", ColumnIndex: 0}},
+	}
+	depts := &schema.Table{
+		Name: "depts",
+		Columns: []*schema.ColumnDef{
+			{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+			{Name: "name", Type: schema.ColumnTypeString},
+			{Name: "floor", Type: schema.ColumnTypeInt64},
+		},
+		Indices: []*schema.Index{{Table: "depts", Name: "depts_pkey_id", ColumnIndex: 0}},
+	}
+
+	if analyzed {
+		users.Statistics = &schema.TableStatistics{
+			RowCount:  10000,
+			PageCount: 100,
+			Columns: []*schema.ColumnStatistics{
+				{DistinctCount: 10000, Min: "1", Max: "10000"}, {DistinctCount: 9000}, {DistinctCount: 10, NullFraction: 0.1}, {DistinctCount: 100},
+			},
+		}
+		depts.Statistics = &schema.TableStatistics{
+			RowCount:  10,
+			PageCount: 1,
+			Columns: []*schema.ColumnStatistics{
+				{DistinctCount: 10}, {DistinctCount: 10}, {DistinctCount: 3},
+			},
+		}
+	}
+
+	return &catalog.Catalog{Tables: map[string]*schema.Table{"users": users, "depts": depts}}
+}
+
+func planQuery(t *testing.T, c *catalog.Catalog, query string, opts ...Option) *Projection {
+	t.Helper()
+
+	stmt, err := parser.New(c).Parse(query)
+	testutil.MustBeNil(t, err)
+
+	return New(c, opts...).PlanSelect(stmt.(parser.Query)).LogicalPlan.(*Projection)
+}
+
+func TestOptimizer_Plan(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		analyzed bool
+		workMem  int
+		expected string
+	}{
+		{
+			name:     "primary key is looked up by the index",
+			query:    `select name from users where id = 3 and score > 10`,
+			expected: "Selection(IndexScan(users))",
+		},
+		{
+			name:     "range of primary key is read by the index",
+			query:    `select name from users where id > 10 and id <= 20 and score > 10`,
+			analyzed: true,
+			expected: "Selection(IndexScan(users))",
+		},
+		{
+			name:     "wide range of primary key is read by scan",
+			query:    `select name from users where id > 10`,
+			analyzed: true,
+			expected: "Selection(Scan(users))",
+		},
+		{
+			name:     "order by primary key is satisfied by the index",
+			query:    `select * from users order by id`,
+			analyzed: true,
+			expected: "IndexScan(users)",
+		},
+		{
+			name:     "descending order is sorted",
+			query:    `select * from users order by id desc`,
+			analyzed: true,
+			expected: "OrderBy(Scan(users))",
+		},
+		{
+			name:     "other columns are filtered on scan",
+			query:    `select name from users where dept_id = 3`,
+			expected: "Selection(Scan(users))",
+		},
+		{
+			name:     "predicates are pushed down to the tables",
+			query:    `select u.name from users u join depts d on u.dept_id = d.floor where d.name = "eng" and u.score > 1`,
+			expected: "HashJoin(Selection(Scan(users)), Selection(Scan(depts)))",
+		},
+		{
+			name:     "primary key of the inner table is looked up for each tuple",
+			query:    `select u.name, d.name from users u join depts d on u.dept_id = d.id`,
+			expected: "IndexNestedLoopJoin(Scan(users), depts)",
+		},
+		{
+			name:     "hash table is built on the smaller table",
+			query:    `select u.name, d.name from depts d join users u on u.dept_id = d.floor`,
+			analyzed: true,
+			expected: "HashJoin(Scan(users), Scan(depts))",
+		},
+		{
+			name:     "the filtered table is joined first",
+			query:    `select * from users u join depts d on u.dept_id = d.id where u.id = 5`,
+			analyzed: true,
+			expected: "IndexNestedLoopJoin(IndexScan(users), depts)",
+		},
+		{
+			name:     "merge join is used when the hash table exceeds work_mem",
+			query:    `select u.name, d.name from depts d join users u on u.dept_id = d.floor`,
+			analyzed: true,
+			workMem:  100,
+			expected: "MergeJoin(OrderBy(Scan(depts)), OrderBy(Scan(users)))",
+		},
+		{
+			name:     "nested loop join is used for a single outer tuple",
+			query:    `select * from depts a join depts b on a.floor = b.floor where a.id = 3`,
+			analyzed: true,
+			expected: "NestedLoopJoin(IndexScan(depts), Scan(depts))",
+		},
+		{
+			name:     "sides of left join are kept",
+			query:    `select * from depts d left join users u on u.dept_id = d.floor`,
+			analyzed: true,
+			expected: "HashJoin(Scan(depts), Scan(users))",
+		},
+		{
+			name:     "predicate on the right side of left join is evaluated after the join",
+			query:    `select * from depts d left join users u on u.dept_id = d.floor and u.score > 1 where d.floor = 1 and u.name is null`,
+			expected: "Selection(HashJoin(Selection(Scan(depts)), Selection(Scan(users))))",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pj := planQuery(t, newOptimizerCatalog(test.analyzed), test.query, WithWorkMem(test.workMem))
+			testutil.MustEqual(t, shape(pj.Input), test.expected)
+		})
+	}
+}
+
+func TestOptimizer_LeftJoinCondition(t *testing.T) {
+	pj := planQuery(t, newOptimizerCatalog(false), `select * from depts d left join users u on u.dept_id = d.floor and d.id > 1 and u.score > 1`)
+
+	// the predicate on the left side is kept in the condition, and the one on the right side is pushed down
+	hj := pj.Input.(*HashJoin)
+	testutil.MustEqual(t, hj.Condition, &AndExpr{
+		Left:  &ComparisonExpr{Left: &Column{Table: "u", Name: "dept_id", Index: 5, Type: schema.ColumnTypeInt64}, Operator: parser.Op_EQ, Right: &Column{Table: "d", Name: "floor", Index: 2, Type: schema.ColumnTypeInt64}},
+		Right: &ComparisonExpr{Left: &Column{Table: "d", Name: "id", Type: schema.ColumnTypeInt64}, Operator: parser.Op_GT, Right: &Int64Expr{Value: 1}},
+	})
+	testutil.MustEqual(t, hj.Right, List(&Selection{
+		Filter: &ComparisonExpr{Left: &Column{Table: "u", Name: "score", Index: 3, Type: schema.ColumnTypeInt64}, Operator: parser.Op_GT, Right: &Int64Expr{Value: 1}},
+		Input:  &Scan{Table: &Table{Name: "users", Alias: "u"}},
+	}))
+}
+
+func TestOptimizer_IndexRange(t *testing.T) {
+	pj := planQuery(t, newOptimizerCatalog(true), `select name from users where id >= 3 and id > 3 and id < 10 and 20 > id and id <> 5`)
+
+	// the tightest bounds are used, and the other predicates are evaluated on the tuples
+	sel := pj.Input.(*Selection)
+	testutil.MustEqual(t, sel.Filter, Expr(&ComparisonExpr{Left: &Column{Table: "users", Name: "id", Type: schema.ColumnTypeInt64}, Operator: parser.Op_NEQ, Right: &Int64Expr{Value: 5}}))
+	testutil.MustEqual(t, sel.Input, List(&IndexScan{
+		Table:   &Table{Name: "users"},
+		Index:   "users_pkey_id",
+		Low:     &IndexBound{Value: &Int64Expr{Value: 3}},
+		High:    &IndexBound{Value: &Int64Expr{Value: 10}},
+		Columns: []int{0, 1},
+	}))
+
+	// the equality is looked up, and the range is evaluated on the found tuple
+	pj = planQuery(t, newOptimizerCatalog(true), `select name from users where id < 10 and id = 4`)
+	sel = pj.Input.(*Selection)
+	testutil.MustEqual(t, sel.Input.(*IndexScan).Keys, []Expr{&Int64Expr{Value: 4}})
+	testutil.MustEqual(t, sel.Input.(*IndexScan).Low, (*IndexBound)(nil))
+}
+
+func TestOptimizer_IndexKeys(t *testing.T) {
+	// IN is looked up, and BETWEEN is read as the range
+	pj := planQuery(t, newOptimizerCatalog(true), `select name from users where id in (3, 1, null);`)
+	testutil.MustEqual(t, pj.Input.(*IndexScan).Keys, []Expr{&Int64Expr{Value: 3}, &Int64Expr{Value: 1}, &NullExpr{}})
+
+	pj = planQuery(t, newOptimizerCatalog(true), `select name from users where id between 3 and 10;`)
+	testutil.MustEqual(t, pj.Input.(*IndexScan).Low, &IndexBound{Value: &Int64Expr{Value: 3}, Inclusive: true})
+	testutil.MustEqual(t, pj.Input.(*IndexScan).High, &IndexBound{Value: &Int64Expr{Value: 10}, Inclusive: true})
+
+	// NOT IN cannot be looked up
+	pj = planQuery(t, newOptimizerCatalog(true), `select name from users where id not in (3, 1);`)
+	_, ok := pj.Input.(*Selection).Input.(*Scan)
+	testutil.MustEqual(t, ok, true)
+
+	c := &catalog.Catalog{Tables: map[string]*schema.Table{"tags": {
+		Name:    "tags",
+		Columns: []*schema.ColumnDef{{Name: "name", Type: schema.ColumnTypeString, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}}},
+		Indices: []*schema.Index{{Table: "tags", Name: "tags_pkey_name", ColumnIndex: 0}},
+	}}}
+
+	// "prefix%" reads the range of the prefix
+	pj = planQuery(t, c, `select name from tags where name like "ab%";`)
+	testutil.MustEqual(t, pj.Input, List(&IndexScan{
+		Table: &Table{Name: "tags"},
+		Index: "tags_pkey_name",
+		Low:   &IndexBound{Value: &StringExpr{Value: "ab"}, Inclusive: true},
+		High:  &IndexBound{Value: &StringExpr{Value: "ac"}},
+	}))
+
+	// the other patterns are evaluated on the keys in the range
+	pj = planQuery(t, c, `select name from tags where name like "a\_%b" and name < "a_c";`)
+	sel := pj.Input.(*Selection)
+	testutil.MustEqual(t, sel.Filter.(*LikeExpr).Pattern, Expr(&StringExpr{Value: "a\\_%b"}))
+	testutil.MustEqual(t, sel.Input.(*IndexScan).Low, &IndexBound{Value: &StringExpr{Value: "a_"}, Inclusive: true})
+	testutil.MustEqual(t, sel.Input.(*IndexScan).High, &IndexBound{Value: &StringExpr{Value: "a_c"}})
+
+	// no prefix
+	pj = planQuery(t, c, `select name from tags where name like "%b";`)
+	_, ok = pj.Input.(*Selection).Input.(*Scan)
+	testutil.MustEqual(t, ok, true)
+}
+
+func TestOptimizer_Decorrelate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		typ      parser.JoinType
+		expected string
+	}{
+		{
+			name:     "exists",
+			query:    `select id from users u where exists (select * from depts d where d.id = u.dept_id and d.floor > 1)`,
+			typ:      parser.SemiJoin,
+			expected: "HashJoin(Scan(users), Projection(Selection(Scan(depts))))",
+		},
+		{
+			name:     "not exists",
+			query:    `select id from users u where not exists (select * from depts d where u.dept_id = d.id)`,
+			typ:      parser.AntiJoin,
+			expected: "HashJoin(Scan(users), Projection(Scan(depts)))",
+		},
+		{
+			name:     "in",
+			query:    `select id from users where score > 1 and dept_id in (select id from depts)`,
+			typ:      parser.SemiJoin,
+			expected: "HashJoin(Selection(Scan(users)), Projection(Scan(depts)))",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pj := planQuery(t, newOptimizerCatalog(true), test.query)
+			testutil.MustEqual(t, shape(pj.Input), test.expected)
+			testutil.MustEqual(t, pj.Input.(*HashJoin).Type, test.typ)
+		})
+	}
+
+	// the subqueries which cannot be joined are evaluated for every tuple
+	for _, query := range []string{
+		`select id from users where dept_id not in (select id from depts)`,
+		`select id from users u where exists (select * from depts d where d.id > u.dept_id)`,
+		`select id from users u where exists (select u.name from depts d where d.id = u.dept_id)`,
+		`select id from users u where exists (select count(*) from depts d where d.id = u.dept_id)`,
+		`select id from users where exists (select * from depts)`,
+	} {
+		pj := planQuery(t, newOptimizerCatalog(true), query)
+		testutil.MustEqual(t, shape(pj.Input), "Selection(Scan(users))")
+	}
+
+	// the correlated subquery looks up the table by the column of the outer query
+	pj := planQuery(t, newOptimizerCatalog(true), `select id, (select name from depts d where d.id = u.dept_id) from users u`)
+	sq := pj.Columns[1].(*NamedExpr).Operand.(*SubqueryExpr)
+	testutil.MustEqual(t, sq.Correlated, true)
+	testutil.MustEqual(t, sq.Plan.(*Projection).Input.(*IndexScan).Keys, []Expr{
+		&OuterColumn{Column: &Column{Table: "u", Name: "dept_id", Index: 1, Type: schema.ColumnTypeInt64}, Outer: sq.Outer},
+	})
+}
+
+func TestOptimizer_SortedInput(t *testing.T) {
+	c := newOptimizerCatalog(true)
+	stmt, err := parser.New(c).Parse(`select * from users u join depts d on u.id = d.floor where u.id > 9990;`)
+	testutil.MustBeNil(t, err)
+	o := newOptimizer(New(c), stmt.(*parser.SelectStatement))
+	users, depts := o.rels[0], o.rels[1]
+
+	key := func(name string, index int) []Expr {
+		return []Expr{&Column{Name: name, Index: index, Type: schema.ColumnTypeInt64}}
+	}
+
+	// the path read by the index is already sorted
+	pt := o.accessPath(users, []parser.Expr{stmt.(*parser.SelectStatement).Where.Expr})
+	list, _ := o.sortedInput(pt, key("id", 0))
+	testutil.MustEqual(t, shape(list), "IndexScan(users)")
+
+	// the table is read by the index instead of sorting
+	pt = o.accessPath(users, nil)
+	list, _ = o.sortedInput(pt, key("id", 0))
+	testutil.MustEqual(t, shape(list), "IndexScan(users)")
+
+	// the column which is not indexed is sorted
+	pt = o.accessPath(depts, nil)
+	list, _ = o.sortedInput(pt, key("floor", 2))
+	testutil.MustEqual(t, shape(list), "OrderBy(Scan(depts))")
+}
+
+func TestOptimizer_ProjectionPushdown(t *testing.T) {
+	pj := planQuery(t, newOptimizerCatalog(true), `select d.name from depts d join users u on u.dept_id = d.floor where u.score > 1`)
+
+	hj := pj.Input.(*HashJoin)
+	testutil.MustEqual(t, hj.Left.(*Selection).Input.(*Scan).Columns, []int{2, 3})
+	testutil.MustEqual(t, hj.Right.(*Scan).Columns, []int{1, 2})
+	// the tuple is (u.dept_id, u.score, d.name, d.floor)
+	testutil.MustEqual(t, pj.Columns, []Expr{&Column{Table: "d", Name: "name", Index: 2, Type: schema.ColumnTypeString}})
+}
+
+// TestOptimizer_SameResult checks the plans chosen with and without the statistics produce the same result.
+func TestOptimizer_SameResult(t *testing.T) {
+	users := []sdb.Tuple{}
+	for i := 1; i <= 30; i++ {
+		var dept interface{} = int64(i % 4)
+		if i%7 == 0 {
+			dept = nil
+		}
+		users = append(users, engine.NewTuple([]interface{}{int64(i), fmt.Sprintf("user%d", i), dept, int64(i * 10 % 70)}, 0))
+	}
+	depts := []sdb.Tuple{
+		engine.NewTuple([]interface{}{int64(0), "eng", int64(1)}, 0),
+		engine.NewTuple([]interface{}{int64(1), "ops", int64(1)}, 0),
+		engine.NewTuple([]interface{}{int64(2), "hr", int64(2)}, 0),
+		engine.NewTuple([]interface{}{int64(5), "pr", nil}, 0),
+	}
+	e := newEngineWithTuples("users", users, 4)
+	e.pages["depts"] = newEngineWithTuples("depts", depts, 4).pages["depts"]
+
+	queries := []string{
+		`select u.id, d.name from users u join depts d on u.dept_id = d.id`,
+		`select u.id, d.name from depts d join users u on u.dept_id = d.id where u.score > 20`,
+		`select u.id, d.name from depts d left join users u on u.dept_id = d.id and u.score >= 30`,
+		`select u.id, d.name from users u left join depts d on u.dept_id = d.id where d.id is null or d.floor = 1`,
+		`select a.id, b.id, d.name from users a join users b on a.score = b.id join depts d on d.floor = a.dept_id`,
+		`select * from depts a join depts b on a.floor = b.floor join users u on u.id = b.id where a.id <> 2`,
+		`select d.name, count(*) from users u join depts d on u.dept_id = d.id group by d.name`,
+		`select id, name from users where id > 3 and id <= 20 and 25 > id order by id`,
+		`select id from users where id = 4 and id > 2`,
+		`select a.id, b.id from users a join users b on a.id = b.id where a.id < 10 and b.id >= 5`,
+		`select id from users u where exists (select * from depts d where d.id = u.dept_id and d.floor = 1)`,
+		`select id from users u where not exists (select * from depts d where d.floor = u.dept_id)`,
+		`select id from users where score in (select id * 10 from depts)`,
+		`select d.name, (select count(*) from users u where u.dept_id = d.id) from depts d`,
+	}
+
+	run := func(c *catalog.Catalog, query string, opts ...Option) []string {
+		pj := planQuery(t, c, query, opts...)
+		rows := []string{}
+		for _, tuple := range collectIn(t, pj, &Env{Engine: e}) {
+			values := make([]string, tuple.Len())
+			for i := range values {
+				values[i] = fmt.Sprint(tuple.Value(i))
+			}
+			rows = append(rows, strings.Join(values, ","))
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	for _, query := range queries {
+		query := query
+		t.Run(query, func(t *testing.T) {
+			expected := run(newOptimizerCatalog(false), query)
+			testutil.MustEqual(t, run(newOptimizerCatalog(true), query), expected)
+			testutil.MustEqual(t, run(newOptimizerCatalog(true), query, WithWorkMem(1)), expected)
+		})
+	}
+}
@@ -11,10 +11,30 @@ import (
 // query execution plan based on the catalog.
 type Planner struct {
 	catalog sdb.Catalog
+	// workMem is the memory in bytes which an operator can use. 0 means no limit.
+	workMem int
+	// outer is the outer query when the planner plans a subquery.
+	outer *outerQuery
+	// windows is the results of the window functions in the SELECT statement being planned.
+	windows []*windowColumn
 }
 
-func New(catalog sdb.Catalog) *Planner {
-	return &Planner{catalog: catalog}
+type Option func(p *Planner)
+
+// WithWorkMem lets the planner avoid the operators which hold more than work_mem on memory.
+func WithWorkMem(workMem int) Option {
+	return func(p *Planner) {
+		p.workMem = workMem
+	}
+}
+
+func New(catalog sdb.Catalog, opts ...Option) *Planner {
+	p := &Planner{catalog: catalog}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
 }
 
 func (p *Planner) Plan(stmt sdb.Statement) (sdb.Plan, error) {
@@ -23,8 +43,12 @@ func (p *Planner) Plan(stmt sdb.Statement) (sdb.Plan, error) {
 		return p.PlanCreateTable(s), nil
 	case *parser.InsertStatement:
 		return p.PlanInsert(s), nil
-	case *parser.SelectStatement:
+	case parser.Query:
 		return p.PlanSelect(s), nil
+	case *parser.AnalyzeStatement:
+		return p.PlanAnalyze(s), nil
+	case *parser.ExplainStatement:
+		return p.PlanExplain(s), nil
 	}
 
 	return nil, fmt.Errorf("unknown statement")
@@ -3,6 +3,8 @@ package planner
 import (
 	"time"
 
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
 	"github.com/dty1er/sdb/sdb"
 )
 
@@ -50,28 +52,248 @@ type TimestampExpr struct {
 	Value time.Time
 }
 
+// NullExpr is NULL literal.
+type NullExpr struct {
+	Expr
+}
+
+// ComparisonExpr compares Left and Right by Operator.
+type ComparisonExpr struct {
+	Expr
+
+	Left     Expr
+	Operator parser.OperatorType
+	Right    Expr
+}
+
+type AndExpr struct {
+	Expr
+
+	Left, Right Expr
+}
+
+type OrExpr struct {
+	Expr
+
+	Left, Right Expr
+}
+
+type NotExpr struct {
+	Expr
+
+	Operand Expr
+}
+
+// IsNullExpr is "IS NULL" predicate. When Not is true, it is "IS NOT NULL".
+type IsNullExpr struct {
+	Expr
+
+	Operand Expr
+	Not     bool
+}
+
+// InExpr is "IN" predicate. When Not is true, it is "NOT IN".
+// The operand is compared with Values, or with the result of Subquery when it is not nil.
+type InExpr struct {
+	Expr
+
+	Operand  Expr
+	Values   []Expr
+	Subquery *SubqueryExpr
+	Not      bool
+}
+
+// LikeExpr is "LIKE" predicate. When Not is true, it is "NOT LIKE".
+type LikeExpr struct {
+	Expr
+
+	Operand Expr
+	Pattern Expr
+	Not     bool
+}
+
+// CaseExpr is CASE expression. When Operand is nil, each When is a condition. Otherwise, each When is
+// compared with Operand. Else is nil when it is omitted. Type is the type of the result.
+type CaseExpr struct {
+	Expr
+
+	Operand Expr
+	Whens   []*When
+	Else    Expr
+	Type    schema.ColumnType
+}
+
+// When is "WHEN Cond THEN Result" in CASE expression.
+type When struct {
+	Cond   Expr
+	Result Expr
+}
+
+// SubqueryExpr is the result of the subquery. Plan is executed when the expression is evaluated.
+// When the subquery refers to the columns of the outer query (Correlated), it is executed for every
+// outer tuple, which is set to Outer before the execution. Otherwise, the result is computed once and reused.
+// Type is the type of the first column of the result.
+type SubqueryExpr struct {
+	Expr
+
+	Plan       List
+	Outer      *OuterTuple
+	Correlated bool
+	Type       schema.ColumnType
+
+	env *Env
+	// rows is the result of the uncorrelated subquery, and done is true when it is computed.
+	rows []sdb.Tuple
+	done bool
+}
+
+// OuterTuple is the tuple of the outer query for which the subquery is executed.
+type OuterTuple struct {
+	tuple sdb.Tuple
+}
+
+// OuterColumn is the column of the outer query referred in the subquery. It is read from the outer tuple.
+type OuterColumn struct {
+	Expr
+
+	Column *Column
+	Outer  *OuterTuple
+}
+
+// ExistsExpr is "EXISTS" predicate.
+type ExistsExpr struct {
+	Expr
+
+	Subquery *SubqueryExpr
+}
+
+// BinaryExpr is an arithmetic operation or string concatenation. Type is the type of the result.
+type BinaryExpr struct {
+	Expr
+
+	Left     Expr
+	Operator parser.OperatorType
+	Right    Expr
+	Type     schema.ColumnType
+}
+
+// UnaryMinusExpr negates the number.
+type UnaryMinusExpr struct {
+	Expr
+
+	Operand Expr
+}
+
+// FuncExpr is a scalar function call such as LOWER(name). Type is the type of the result.
+type FuncExpr struct {
+	Expr
+
+	Name string
+	Args []Expr
+	Type schema.ColumnType
+}
+
+// NamedExpr is the expression in the select list which is not a column. Name is the name of the
+// column in the result set, and Type is the type of the result.
+type NamedExpr struct {
+	Expr
+
+	Operand Expr
+	Name    string
+	Type    schema.ColumnType
+}
+
+// Scan reads the table one page at a time.
 type Scan struct {
 	List
 
 	Table *Table
+	// Columns are the positions of the columns to be read. nil means every column.
+	Columns []int
 
+	engine sdb.Engine
+	page   int // the page to be read next
 	tuples []sdb.Tuple
 	idx    int
 }
 
+// IndexScan reads the table by the index in the order of the key.
+// When Keys is not nil, the tuples whose key is one of Keys are looked up. Otherwise, the tuples whose key
+// is between Low and High are read.
+type IndexScan struct {
+	List
+
+	Table *Table
+	Index string
+	// KeyColumn is the position of the indexed column in the table.
+	KeyColumn int
+	Keys      []Expr
+	// Low and High are the bounds of the key. nil means unbounded.
+	Low, High *IndexBound
+	// Columns are the positions of the columns to be read. nil means every column.
+	Columns []int
+
+	engine sdb.Engine
+	// keys are the evaluated Keys in ascending order, and idx is the next one to look up.
+	keys []interface{}
+	idx  int
+	// iter, low and high are used to read the range.
+	iter      sdb.IndexIterator
+	low, high interface{}
+}
+
+// IndexBound is the bound of the key range. The key equal to Value is included when Inclusive is true.
+type IndexBound struct {
+	Value     Expr
+	Inclusive bool
+}
+
 type Column struct {
 	Expr
 
 	Table string
-	Name  string // TODO: This should be Expr because it can be function, operation, etc.
+	Name  string
 	Alias string
+	// Index is the position of the column in the tuple.
+	Index int
+	// Type is the type of the column value.
+	Type schema.ColumnType
+}
+
+// AggregateExpr is an aggregate function call such as SUM(score). Arg is nil for COUNT(*).
+// It is not evaluated against a tuple; Aggregate operator computes it for each group.
+type AggregateExpr struct {
+	Expr
+
+	Func string
+	Arg  Expr
+}
+
+// Aggregate groups the tuples by GroupBy and computes Aggregates for each group.
+// The output tuple consists of the group by values followed by the aggregate results.
+// Without GroupBy, all the tuples make one group, so exactly one tuple is produced even if there is no input.
+type Aggregate struct {
+	List
+
+	GroupBy    []Expr
+	Aggregates []*AggregateExpr
+	Input      List
+
+	env *Env
+	// groups are the aggregated groups to be produced.
+	groups []*group
+	idx    int
+	// partitions are the spilled tuples which are not aggregated yet.
+	partitions []*aggPartition
 }
 
 // Projection is a Projection relational algebra operator.
+// It is the root of the operator tree.
 type Projection struct {
 	LogicalPlan
+	List
 
-	// Columns is a set of column to be picked up.
+	// Columns is a set of column to be picked up. Each of them is *Column or *NamedExpr.
 	Columns []Expr
 	// Input is a source of data from which this Projection picks data.
 	Input List
@@ -82,20 +304,219 @@ type Limit struct {
 
 	Limit Expr
 	Input List
+
+	count int64
 }
 
+// OrderBy sorts the tuples by Columns. Directirons is "asc" or "desc" for each column.
+// NULL is smaller than any other value.
 type OrderBy struct {
 	List
 
 	Columns     []Expr
 	Directirons []string
+	// TopN is the number of the tuples needed from the head. When it is positive, only the first TopN
+	// tuples are kept while sorting. 0 means every tuple is sorted.
+	TopN  int
+	Input List
+
+	env    *Env
+	sorted []*sortRow
+	idx    int
+	// runs and merger are used only when the tuples are spilled.
+	runs   []*spillFile
+	merger *mergeHeap
+}
+
+// Values produces a tuple for each of Rows by evaluating its expressions, e.g. VALUES of INSERT.
+type Values struct {
+	List
+
+	Rows [][]Expr
+
+	idx int
+}
+
+// Distinct drops the duplicated tuples. Tuples are compared by Columns.
+// NULLs are considered equal to each other.
+type Distinct struct {
+	List
+
+	Columns []Expr
+	Input   List
+
+	seen map[string]struct{}
+}
+
+// Append produces the tuples of Left, then the ones of Right. It is UNION ALL.
+// Types is the types of the columns; int64 value is converted to float64 when the type is float64.
+type Append struct {
+	List
+
+	Left  List
+	Right List
+	Types []schema.ColumnType
+
+	right bool
+}
+
+// HashSetOp counts the right tuples in the hash table, then produces the left tuples which are (INTERSECT)
+// or are not (EXCEPT) in it. Without All, the same tuples are produced only once. With All, the tuple
+// which appears m times in Left and n times in Right is produced min(m, n) times by INTERSECT and
+// max(m - n, 0) times by EXCEPT. NULLs are considered equal to each other.
+type HashSetOp struct {
+	List
+
+	Type  parser.SetOperationType
+	All   bool
+	Left  List
+	Right List
+	Types []schema.ColumnType
+
+	counts map[string]int
+}
+
+// WindowFunc is a window function call computed by Window. For LAG and LEAD, Args are the value, the offset
+// and the default. For the aggregate functions, Args is empty for COUNT(*). Type is the type of the result.
+// It is not evaluated against a tuple; Window operator computes it for each tuple.
+type WindowFunc struct {
+	Expr
+
+	Func string
+	Args []Expr
+	Type schema.ColumnType
+}
+
+// Window computes Funcs for each tuple over its partition, which is the tuples of the same PartitionBy values.
+// Input is sorted by PartitionBy and OrderBy, and the tuples of the same OrderBy values in the partition are
+// peers. The output tuple is the input tuple followed by the results of Funcs.
+// The aggregate functions are computed on Frame. When it is nil, the frame is from the start of the partition
+// to the last peer of the tuple, which is the whole partition without OrderBy.
+// A partition is held on memory while it is computed.
+type Window struct {
+	List
+
+	PartitionBy []Expr
+	OrderBy     []Expr
+	Frame       *parser.WindowFrame
+	Funcs       []*WindowFunc
 	Input       List
+
+	// tuples and results are the current partition and the results of Funcs for each tuple.
+	tuples  []sdb.Tuple
+	results [][]interface{}
+	idx     int
+	// next is the first tuple of the next partition, which is read to find the end of the current one.
+	next sdb.Tuple
+	done bool
 }
 
+// NestedLoopJoin evaluates Condition for every pair of the left and right tuples.
+// The right input is re-opened for every left tuple, so it works for any condition.
+// The joined tuple is the left tuple followed by the right tuple. On LEFT join, the left tuple which
+// matches no right tuple is produced with NULLs.
+type NestedLoopJoin struct {
+	List
+
+	Type      parser.JoinType
+	Left      List
+	Right     List
+	Condition Expr
+	// RightWidth is the number of the columns of the right input. It is used to fill NULLs.
+	RightWidth int
+
+	env       *Env
+	left      sdb.Tuple
+	matched   bool
+	rightOpen bool
+}
+
+// IndexNestedLoopJoin looks up the right table by its primary key index for every left tuple.
+// LeftKey is evaluated against the left tuple to get the key. Condition is evaluated for the found tuple.
+type IndexNestedLoopJoin struct {
+	List
+
+	Type    parser.JoinType
+	Left    List
+	Table   *Table
+	Index   string
+	LeftKey Expr
+	// Columns are the positions of the columns of the found tuple to be joined. nil means every column.
+	Columns    []int
+	Condition  Expr
+	RightWidth int
+
+	engine sdb.Engine
+}
+
+// HashJoin builds a hash table of the right tuples by RightKeys, then probes it with the left tuples
+// by LeftKeys. Condition is evaluated for the pairs whose keys are the same.
+// The tuples whose keys contain NULL never match.
+type HashJoin struct {
+	List
+
+	Type       parser.JoinType
+	Left       List
+	Right      List
+	LeftKeys   []Expr
+	RightKeys  []Expr
+	Condition  Expr
+	RightWidth int
+
+	table      map[string][]sdb.Tuple
+	left       sdb.Tuple
+	candidates []sdb.Tuple
+	idx        int
+	matched    bool
+}
+
+// MergeJoin merges the left and right tuples sorted by LeftKeys and RightKeys in ascending order.
+// The inputs must be sorted by the keys. Condition is evaluated for the pairs whose keys are the same.
+type MergeJoin struct {
+	List
+
+	Type       parser.JoinType
+	Left       List
+	Right      List
+	LeftKeys   []Expr
+	RightKeys  []Expr
+	Condition  Expr
+	RightWidth int
+
+	left    sdb.Tuple
+	matched bool
+	// group is the right tuples whose keys are groupKeys.
+	group     []sdb.Tuple
+	groupKeys []interface{}
+	idx       int
+	// right is the next right tuple which is not in the group yet.
+	right     sdb.Tuple
+	rightKeys []interface{}
+}
+
+// List is an operator which produces the tuples. Operators form a tree, and the tuples are pulled
+// from the root one by one; each operator pulls the tuples from its input only when it needs
+// (so called Volcano model). The operator must be opened before Next, and closed after use.
 type List interface {
 	isList()
-	Next(engine sdb.Engine) sdb.Tuple
-	Process(t sdb.Tuple) sdb.Tuple
+	// Open initializes the operator and its inputs.
+	Open(env *Env) error
+	// Next returns the next tuple. nil is returned when no more tuples are produced.
+	Next() (sdb.Tuple, error)
+	// Close releases the resources the operator and its inputs hold.
+	Close() error
+}
+
+// Env is the environment where the operators are executed.
+type Env struct {
+	Engine sdb.Engine
+	// DiskManager is used to spill the data which does not fit in WorkMem to the temporary files.
+	DiskManager sdb.DiskManager
+	// WorkMem is the memory in bytes which an operator can use. 0 means no limit.
+	WorkMem int
+	// PageSize is the page size of the database. The spill files are written in blocks of the page size.
+	// When it is 0, the largest page size is used.
+	PageSize int
 }
 
 type Table struct {
@@ -110,43 +531,15 @@ type Offset struct {
 
 	Offset Expr
 	Input  List
-}
 
-type Filter interface {
-	isFilter()
-}
-
-type EqualityFilter struct {
-	Filter
-
-	Column Expr
-	Value  Expr
+	skipped bool
 }
 
+// Selection selects the tuples for which Filter is evaluated to true.
+// The tuples for which Filter is false or unknown (NULL) are dropped.
 type Selection struct {
 	List
 
-	Filter Filter
+	Filter Expr
 	Input  List
 }
-
-func (s *Scan) Next(engine sdb.Engine) sdb.Tuple {
-	if len(s.tuples) == 0 {
-		ts, err := engine.ReadTable(s.Table.Name)
-		if err != nil {
-			panic(err)
-		}
-
-		s.tuples = ts
-	}
-	if s.idx >= len(s.tuples) {
-		return nil
-	}
-	t := s.tuples[s.idx]
-	s.idx++
-	return t
-}
-
-func (s *Scan) Process(t sdb.Tuple) sdb.Tuple {
-	return t
-}
@@ -1,6 +1,10 @@
 package planner
 
 import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dty1er/sdb/parser"
@@ -14,74 +18,53 @@ type SelectPlan struct {
 	LogicalPlan LogicalPlan
 }
 
-// PlanSelect makes a plan to query data by given SELECT statement.
-func (p *Planner) PlanSelect(stmt *parser.SelectStatement) *SelectPlan {
-	// PlanSelect consists of 2 parts.
-	// In first phase, it makes logical plan. Logical plan shows the sequence of processes how to
-	// create the desired result set.
-	// In second phase, some optimizations are applied to the logical plan to get better performance.
-	// For example, it can convert a logical plan "scan `mytable`" to use index.
-	// We call optimizations-applied plan as "physical plan".
-
-	var list List
-
-	// plan from
-	ate := stmt.From.(*parser.AliasedTableExpr)
-	tbl := ate.Expr.(*parser.TableName)
-	sc := &Scan{
-		Table: &Table{Name: tbl.Name, Alias: ate.As},
-	}
-
-	list = sc
-
-	// plan where
-	if stmt.Where != nil {
-		ce := stmt.Where.Expr.(*parser.ComparisonExpr)
-		if ce.Operator != parser.Op_EQ {
-			// TODO: fix
-			panic("where expr must be equality")
-		}
-		col := ce.Left.(*parser.ColName)
-		val := ce.Right.(*parser.Value)
-		f := &EqualityFilter{
-			Column: &Column{Name: col.Name},
-		}
-
-		colDef, _ := p.catalog.GetColumnDef(tbl.Name, col.Name)
-		switch colDef.Type {
-		case schema.ColumnTypeBool:
-			v, _ := schema.ConvertValue(val.Val, schema.ColumnTypeBool)
-			f.Value = &BoolExpr{Value: v.(bool)}
-		case schema.ColumnTypeInt64:
-			v, _ := schema.ConvertValue(val.Val, schema.ColumnTypeInt64)
-			f.Value = &Int64Expr{Value: v.(int64)}
-		case schema.ColumnTypeFloat64:
-			v, _ := schema.ConvertValue(val.Val, schema.ColumnTypeFloat64)
-			f.Value = &Float64Expr{Value: v.(float64)}
-		case schema.ColumnTypeBytes:
-			v, _ := schema.ConvertValue(val.Val, schema.ColumnTypeBytes)
-			f.Value = &BytesExpr{Value: v.([]byte)}
-		case schema.ColumnTypeString:
-			v, _ := schema.ConvertValue(val.Val, schema.ColumnTypeString)
-			f.Value = &StringExpr{Value: v.(string)}
-		case schema.ColumnTypeTimestamp:
-			v, _ := schema.ConvertValue(val.Val, schema.ColumnTypeTimestamp)
-			f.Value = &TimestampExpr{Value: v.(time.Time)}
-		}
-
-		s := &Selection{Filter: f, Input: sc}
-		list = s
+// PlanSelect makes a plan to query data by given SELECT statement or set operation.
+func (p *Planner) PlanSelect(stmt parser.Query) *SelectPlan {
+	pj, _ := p.planQuery(stmt)
+	return &SelectPlan{LogicalPlan: pj}
+}
+
+// planSelect makes the plan of the SELECT statement. The best path of FROM and WHERE clause is also returned
+// for its estimation.
+func (p *Planner) planSelect(stmt *parser.SelectStatement) (*Projection, *path) {
+	// The plan shows the sequence of processes how to create the desired result set.
+	// FROM and WHERE clause is optimized by the cost; the optimizer chooses how to read each table,
+	// the order and the algorithms of the joins, and where to evaluate the predicates.
+	// The other clauses are processed on top of it in the fixed order.
+
+	// plan from and where
+	best := newOptimizer(p, stmt).optimize()
+	list, sc := best.list, best.sc
+
+	// plan group by
+	// After the aggregation, the expressions refer to the output of Aggregate instead of the table.
+	var agg *Aggregate
+	if stmt.IsAggregated() {
+		agg = &Aggregate{GroupBy: []Expr{}, Aggregates: []*AggregateExpr{}, Input: list}
+		for _, g := range stmt.GroupBy {
+			agg.GroupBy = append(agg.GroupBy, p.planExpr(sc, nil, g))
+		}
+		list = agg
+
+		// plan having
+		if stmt.Having != nil {
+			list = &Selection{Filter: p.planExpr(sc, agg, stmt.Having.Expr), Input: list}
+		}
 	}
 
+	// plan window functions
+	// Their results are appended to the tuple, so they are computed after the grouping and before the sort.
+	list = p.planWindows(sc, agg, stmt, list)
+
 	// plan order by
-	if stmt.OrderBy != nil {
+	// The sort is not needed when the tuples are already in the order, e.g. read by the index.
+	if stmt.OrderBy != nil && !sortedBy(best, stmt, sc, agg, p) {
 		ob := &OrderBy{
 			Columns:     make([]Expr, len(stmt.OrderBy)),
 			Directirons: make([]string, len(stmt.OrderBy)),
 		}
 		for i, o := range stmt.OrderBy {
-			column := o.Expr.(*parser.ColName)
-			ob.Columns[i] = &Column{Name: column.Name}
+			ob.Columns[i] = p.planExpr(sc, agg, o.Expr)
 			ob.Directirons[i] = o.Direction.String()
 		}
 
@@ -89,35 +72,612 @@ func (p *Planner) PlanSelect(stmt *parser.SelectStatement) *SelectPlan {
 		list = ob
 	}
 
+	// plan columns (projection)
+	pj := p.planProjection(sc, agg, stmt.SelectExprs)
+
+	// plan distinct
+	// Distinct is placed before the projection, but it compares only the projected columns.
+	if stmt.Distinct {
+		list = &Distinct{Columns: pj.Columns, Input: list}
+	}
+
 	// plan limit
 	if stmt.Limit != nil {
 		l := &Limit{Limit: &Int64Expr{Value: int64(stmt.Limit.Count)}}
 		o := &Offset{Offset: &Int64Expr{Value: int64(stmt.Limit.Offset)}}
 
+		// When the sorted tuples are limited, only the first limit+offset tuples need to be sorted.
+		if ob, ok := list.(*OrderBy); ok && stmt.Limit.Count > 0 {
+			ob.TopN = stmt.Limit.Count + stmt.Limit.Offset
+		}
+
 		o.Input = list
 		l.Input = o
 		list = l
 	}
 
-	// plan columns (projection)
+	pj.Input = list
+
+	return pj, best
+}
+
+// sortedBy reports if the output of the path is sorted as ORDER BY requires.
+func sortedBy(best *path, stmt *parser.SelectStatement, sc *scope, agg *Aggregate, p *Planner) bool {
+	if best.ordered == nil || agg != nil || stmt.HasWindow() || len(stmt.OrderBy) != 1 || stmt.OrderBy[0].Direction != parser.OrderDirection_ASC {
+		return false
+	}
+
+	c, ok := p.planExpr(sc, nil, stmt.OrderBy[0].Expr).(*Column)
+	return ok && c.Index == best.ordered.Index
+}
+
+// equiJoinKeys extracts "left column = right column" from the conjunctions in the condition.
+// The right keys are resolved in the right tuple, not in the joined tuple.
+// The columns of the different types are not used as the keys because their values are not encoded
+// to the same hash key.
+func equiJoinKeys(cond Expr, leftWidth int) ([]Expr, []Expr) {
+	leftKeys, rightKeys := []Expr{}, []Expr{}
+	for _, c := range conjunctions(cond) {
+		cmp, ok := c.(*ComparisonExpr)
+		if !ok || cmp.Operator != parser.Op_EQ {
+			continue
+		}
+
+		l, lok := cmp.Left.(*Column)
+		r, rok := cmp.Right.(*Column)
+		if !lok || !rok || l.Type != r.Type {
+			continue
+		}
+
+		if l.Index >= leftWidth {
+			l, r = r, l
+		}
+
+		if l.Index >= leftWidth || r.Index < leftWidth {
+			continue
+		}
+
+		rk := *r
+		rk.Index -= leftWidth
+		leftKeys = append(leftKeys, l)
+		rightKeys = append(rightKeys, &rk)
+	}
+
+	return leftKeys, rightKeys
+}
+
+// conjunctions splits the expression by AND.
+func conjunctions(expr Expr) []Expr {
+	if and, ok := expr.(*AndExpr); ok {
+		return append(conjunctions(and.Left), conjunctions(and.Right)...)
+	}
+
+	return []Expr{expr}
+}
+
+// planProjection plans the columns of the select list. The columns are the ones of the tuple in sc,
+// or of the output of agg when it is not nil.
+func (p *Planner) planProjection(sc *scope, agg *Aggregate, exprs []parser.SelectExpr) *Projection {
 	pj := &Projection{Columns: []Expr{}}
-	for _, se := range stmt.SelectExprs {
+	for _, se := range exprs {
 		switch s := se.(type) {
 		case *parser.StarExpr:
-			for _, colDef := range p.catalog.GetTable(tbl.Name).Columns {
-				pj.Columns = append(pj.Columns, &Column{Table: tbl.Name, Name: colDef.Name, Alias: colDef.Name})
+			// "*" is every column of every table, and "mytable.*" is every column of the table
+			for _, st := range sc.inFromOrder() {
+				if s.Table != "" && !strings.EqualFold(st.name, s.Table) {
+					continue
+				}
+
+				// every column is read because the star uses them
+				for i, colDef := range st.table.Columns {
+					pj.Columns = append(pj.Columns, &Column{Table: st.name, Name: colDef.Name, Alias: colDef.Name, Index: st.offset + i, Type: colDef.Type})
+				}
 			}
-			// when * is specified, no other column should be placed
-			break
 		case *parser.AliasedExpr:
-			c := s.Expr.(*parser.ColName)
-			pj.Columns = append(pj.Columns, &Column{Table: tbl.Name, Name: c.Name, Alias: s.As})
+			// the column (including the result of the aggregate function) is picked up from the tuple,
+			// and the other expressions are computed
+			expr := p.planExpr(sc, agg, s.Expr)
+			if col, ok := expr.(*Column); ok {
+				col.Alias = s.As
+				pj.Columns = append(pj.Columns, col)
+			} else {
+				name := s.As
+				if name == "" {
+					name = exprName(s.Expr)
+				}
+				pj.Columns = append(pj.Columns, &NamedExpr{Operand: expr, Name: name, Type: exprType(expr)})
+			}
 		}
 	}
 
-	pj.Input = list
+	return pj
+}
 
-	// TODO: apply optimizations
+// primaryKeyIndex returns the index of the column when the column is the primary key and indexed.
+func primaryKeyIndex(table *schema.Table, column int) *schema.Index {
+	if !table.Columns[column].HasOption(schema.ColumnOptionPrimaryKey) {
+		return nil
+	}
 
-	return &SelectPlan{LogicalPlan: pj}
+	for _, index := range table.Indices {
+		if index.ColumnIndex == column {
+			return index
+		}
+	}
+
+	return nil
+}
+
+// scope is the tables in FROM clause. The tuple produced by FROM clause is the concatenation of
+// the tuples of the tables in order.
+type scope struct {
+	tables []*scopeTable
+}
+
+type scopeTable struct {
+	// name is the alias of the table, or the table name if no alias is given.
+	name  string
+	table *schema.Table
+	// columns are the columns of the table in the tuple. The columns not used in the query are not read.
+	columns []int
+	// offset is the position of the first column of the table in the tuple.
+	offset int
+	// pos is the position of the table in FROM clause.
+	pos int
+}
+
+// concat returns the scope of the tuple which joins the tuples of sc and other.
+func (sc *scope) concat(other *scope) *scope {
+	w := sc.width()
+	joined := &scope{tables: append([]*scopeTable{}, sc.tables...)}
+	for _, st := range other.tables {
+		shifted := *st
+		shifted.offset += w
+		joined.tables = append(joined.tables, &shifted)
+	}
+
+	return joined
+}
+
+// width returns the number of the columns in the tuple.
+func (sc *scope) width() int {
+	w := 0
+	for _, st := range sc.tables {
+		w += len(st.columns)
+	}
+
+	return w
+}
+
+// column resolves the position of the column in the tuple.
+func (sc *scope) column(qualifier, name string) *Column {
+	for _, st := range sc.tables {
+		if qualifier != "" && !strings.EqualFold(st.name, qualifier) {
+			continue
+		}
+
+		for i, ci := range st.columns {
+			if colDef := st.table.Columns[ci]; colDef.Name == strings.ToLower(name) {
+				return &Column{Table: st.name, Name: name, Index: st.offset + i, Type: colDef.Type}
+			}
+		}
+	}
+
+	// must not come here because the statement is validated
+	panic(fmt.Sprintf("column %s is not found", name))
+}
+
+// planGroupedColumn resolves the position of the column in the output of the aggregation.
+func planGroupedColumn(sc *scope, agg *Aggregate, c *parser.ColName) *Column {
+	col := sc.column(c.Qualifier, c.Name)
+	for i, g := range agg.GroupBy {
+		gc := g.(*Column)
+		if gc.Table == col.Table && gc.Index == col.Index {
+			return &Column{Table: col.Table, Name: c.Name, Index: i, Type: col.Type}
+		}
+	}
+
+	// must not come here because the statement is validated
+	panic(fmt.Sprintf("column %s is not grouped", c.Name))
+}
+
+// planAggregate adds the aggregate function to the aggregation, then returns the column
+// which refers to its result. The same function call is computed only once.
+func (p *Planner) planAggregate(sc *scope, agg *Aggregate, f *parser.FuncExpr) *Column {
+	ae := &AggregateExpr{Func: f.Name}
+	col := &Column{Name: exprName(f), Type: schema.ColumnTypeInt64}
+	if !f.Star {
+		arg := p.planExpr(sc, nil, f.Args[0]).(*Column)
+		ae.Arg = arg
+		col.Type = aggregateType(f.Name, arg.Type)
+	}
+
+	idx := -1
+	for i, a := range agg.Aggregates {
+		if reflect.DeepEqual(a, ae) {
+			idx = i
+			break
+		}
+	}
+
+	if idx < 0 {
+		agg.Aggregates = append(agg.Aggregates, ae)
+		idx = len(agg.Aggregates) - 1
+	}
+
+	col.Index = len(agg.GroupBy) + idx
+	return col
+}
+
+// aggregateType returns the result type of the aggregate function.
+func aggregateType(fn string, argType schema.ColumnType) schema.ColumnType {
+	switch fn {
+	case "count":
+		return schema.ColumnTypeInt64
+	case "avg":
+		return schema.ColumnTypeFloat64
+	}
+
+	// sum, min and max
+	return argType
+}
+
+// planFunc plans the scalar function call.
+func (p *Planner) planFunc(sc *scope, agg *Aggregate, f *parser.FuncExpr) *FuncExpr {
+	fn := &FuncExpr{Name: f.Name, Args: make([]Expr, len(f.Args))}
+	for i, arg := range f.Args {
+		fn.Args[i] = p.planExpr(sc, agg, arg)
+	}
+	fn.Type = funcType(fn)
+
+	return fn
+}
+
+// funcType returns the result type of the scalar function.
+func funcType(f *FuncExpr) schema.ColumnType {
+	switch f.Name {
+	case "lower", "upper", "substr":
+		return schema.ColumnTypeString
+	case "length", "extract":
+		return schema.ColumnTypeInt64
+	case "now", "date_trunc":
+		return schema.ColumnTypeTimestamp
+	case "coalesce":
+		return commonType(f.Args)
+	}
+
+	// abs and round
+	return exprType(f.Args[0])
+}
+
+// commonType returns the type of coalesce or CASE which is one of the exprs.
+// int64 and float64 are mixed into float64.
+func commonType(exprs []Expr) schema.ColumnType {
+	result := schema.ColumnType(0)
+	for _, expr := range exprs {
+		if typ := exprType(expr); result == 0 || typ == schema.ColumnTypeFloat64 {
+			result = typ
+		}
+	}
+
+	return result
+}
+
+// binaryType returns the result type of the operation. Concatenation is string. Arithmetic is int64
+// when both operands are int64, otherwise float64.
+func binaryType(op parser.OperatorType, left, right schema.ColumnType) schema.ColumnType {
+	switch {
+	case op == parser.Op_CONCAT:
+		return schema.ColumnTypeString
+	case left == schema.ColumnTypeFloat64 || right == schema.ColumnTypeFloat64:
+		return schema.ColumnTypeFloat64
+	case left == 0 && right == 0:
+		return 0
+	}
+
+	return schema.ColumnTypeInt64
+}
+
+// exprType returns the type of the expression. The type of NULL is 0.
+func exprType(expr Expr) schema.ColumnType {
+	switch e := expr.(type) {
+	case *Column:
+		return e.Type
+	case *BoolExpr, *ComparisonExpr, *AndExpr, *OrExpr, *NotExpr, *IsNullExpr, *InExpr, *LikeExpr, *ExistsExpr:
+		return schema.ColumnTypeBool
+	case *Int64Expr:
+		return schema.ColumnTypeInt64
+	case *Float64Expr:
+		return schema.ColumnTypeFloat64
+	case *BytesExpr:
+		return schema.ColumnTypeBytes
+	case *StringExpr:
+		return schema.ColumnTypeString
+	case *TimestampExpr:
+		return schema.ColumnTypeTimestamp
+	case *BinaryExpr:
+		return e.Type
+	case *UnaryMinusExpr:
+		return exprType(e.Operand)
+	case *FuncExpr:
+		return e.Type
+	case *CaseExpr:
+		return e.Type
+	case *SubqueryExpr:
+		return e.Type
+	case *OuterColumn:
+		return e.Column.Type
+	case *NamedExpr:
+		return e.Type
+	}
+
+	return 0
+}
+
+// exprName returns the expression as it is written in the statement. It is used as the name of
+// the column in the result set.
+func exprName(expr parser.Expr) string {
+	// operand is parenthesized when its operator binds weaker than the one of expr.
+	// The right operand of the same precedence is also parenthesized because the operators are left-associative.
+	operand := func(e parser.Expr, right bool) string {
+		if p := precedence(e); p < precedence(expr) || right && p == precedence(expr) {
+			return "(" + exprName(e) + ")"
+		}
+		return exprName(e)
+	}
+
+	switch e := expr.(type) {
+	case *parser.ColName:
+		if e.Qualifier != "" {
+			return e.Qualifier + "." + e.Name
+		}
+		return e.Name
+	case *parser.Value:
+		return e.Val
+	case *parser.NullVal:
+		return "null"
+	case *parser.FuncExpr:
+		if e.Star {
+			return e.Name + "(*)"
+		}
+		if e.Name == "extract" {
+			return fmt.Sprintf("extract(%s from %s)", exprName(e.Args[0]), exprName(e.Args[1]))
+		}
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = exprName(arg)
+		}
+		return e.Name + "(" + strings.Join(args, ", ") + ")"
+	case *parser.BinaryExpr:
+		return operand(e.Left, false) + " " + operators[e.Operator] + " " + operand(e.Right, true)
+	case *parser.UnaryMinusExpr:
+		return "-" + operand(e.Operand, false)
+	case *parser.ComparisonExpr:
+		return operand(e.Left, false) + " " + operators[e.Operator] + " " + operand(e.Right, true)
+	case *parser.AndExpr:
+		return operand(e.Left, false) + " and " + operand(e.Right, true)
+	case *parser.OrExpr:
+		return operand(e.Left, false) + " or " + operand(e.Right, true)
+	case *parser.NotExpr:
+		return "not " + operand(e.Operand, false)
+	case *parser.IsNullExpr:
+		if e.Not {
+			return operand(e.Operand, false) + " is not null"
+		}
+		return operand(e.Operand, false) + " is null"
+	case *parser.InExpr:
+		values := "subquery"
+		if e.Subquery == nil {
+			names := make([]string, len(e.Values))
+			for i, val := range e.Values {
+				names[i] = exprName(val)
+			}
+			values = strings.Join(names, ", ")
+		}
+		if e.Not {
+			return operand(e.Operand, false) + " not in (" + values + ")"
+		}
+		return operand(e.Operand, false) + " in (" + values + ")"
+	case *parser.Subquery:
+		return "(subquery)"
+	case *parser.ExistsExpr:
+		return "exists (subquery)"
+	case *parser.LikeExpr:
+		if e.Not {
+			return operand(e.Operand, false) + " not like " + operand(e.Pattern, true)
+		}
+		return operand(e.Operand, false) + " like " + operand(e.Pattern, true)
+	case *parser.CaseExpr:
+		name := "case"
+		if e.Operand != nil {
+			name += " " + exprName(e.Operand)
+		}
+		for _, w := range e.Whens {
+			name += " when " + exprName(w.Cond) + " then " + exprName(w.Result)
+		}
+		if e.Else != nil {
+			name += " else " + exprName(e.Else)
+		}
+		return name + " end"
+	}
+
+	return fmt.Sprintf("%T", expr)
+}
+
+// precedence returns how strongly the operator of the expression binds. It follows the parser.
+func precedence(expr parser.Expr) int {
+	switch e := expr.(type) {
+	case *parser.OrExpr:
+		return 1
+	case *parser.AndExpr:
+		return 2
+	case *parser.NotExpr:
+		return 3
+	case *parser.ComparisonExpr, *parser.IsNullExpr, *parser.InExpr, *parser.LikeExpr:
+		return 4
+	case *parser.BinaryExpr:
+		switch e.Operator {
+		case parser.Op_CONCAT:
+			return 5
+		case parser.Op_ADD, parser.Op_SUB:
+			return 6
+		}
+		return 7
+	case *parser.UnaryMinusExpr:
+		return 8
+	}
+
+	return 9
+}
+
+// planExpr converts the expression in the statement to the expression evaluated against the tuple.
+// When agg is not nil, the expression is evaluated against the output of the aggregation.
+func (p *Planner) planExpr(sc *scope, agg *Aggregate, expr parser.Expr) Expr {
+	switch e := expr.(type) {
+	case *parser.ColName:
+		// the column not in FROM clause is the one of the outer query
+		if p.outer != nil && !sc.has(e) {
+			return p.outer.column(e)
+		}
+		if agg != nil {
+			return planGroupedColumn(sc, agg, e)
+		}
+		return sc.column(e.Qualifier, e.Name)
+	case *parser.FuncExpr:
+		if e.Over != nil {
+			return p.windowColumn(e)
+		}
+		if !e.IsAggregate() {
+			return p.planFunc(sc, agg, e)
+		}
+		if agg != nil {
+			return p.planAggregate(sc, agg, e)
+		}
+	case *parser.Value:
+		return planLiteral(e.Val)
+	case *parser.NullVal:
+		return &NullExpr{}
+	case *parser.AndExpr:
+		return &AndExpr{Left: p.planExpr(sc, agg, e.Left), Right: p.planExpr(sc, agg, e.Right)}
+	case *parser.OrExpr:
+		return &OrExpr{Left: p.planExpr(sc, agg, e.Left), Right: p.planExpr(sc, agg, e.Right)}
+	case *parser.NotExpr:
+		return &NotExpr{Operand: p.planExpr(sc, agg, e.Operand)}
+	case *parser.IsNullExpr:
+		return &IsNullExpr{Operand: p.planExpr(sc, agg, e.Operand), Not: e.Not}
+	case *parser.ComparisonExpr:
+		left, right := p.planComparison(sc, agg, e.Left, e.Right)
+		return &ComparisonExpr{Left: left, Operator: e.Operator, Right: right}
+	case *parser.InExpr:
+		in := &InExpr{Operand: p.planExpr(sc, agg, e.Operand), Values: make([]Expr, len(e.Values)), Not: e.Not}
+		if e.Subquery != nil {
+			in.Subquery = p.planSubquery(sc, agg, e.Subquery)
+			in.Operand = convertLiteral(in.Operand, e.Operand, in.Subquery, e.Subquery)
+			return in
+		}
+		for i, val := range e.Values {
+			in.Values[i] = convertLiteral(p.planExpr(sc, agg, val), val, in.Operand, e.Operand)
+		}
+		return in
+	case *parser.LikeExpr:
+		return &LikeExpr{Operand: p.planExpr(sc, agg, e.Operand), Pattern: p.planExpr(sc, agg, e.Pattern), Not: e.Not}
+	case *parser.Subquery:
+		return p.planSubquery(sc, agg, e)
+	case *parser.ExistsExpr:
+		return &ExistsExpr{Subquery: p.planSubquery(sc, agg, e.Subquery)}
+	case *parser.CaseExpr:
+		c := &CaseExpr{Whens: make([]*When, len(e.Whens))}
+		if e.Operand != nil {
+			c.Operand = p.planExpr(sc, agg, e.Operand)
+		}
+		results := []Expr{}
+		for i, w := range e.Whens {
+			c.Whens[i] = &When{Result: p.planExpr(sc, agg, w.Result)}
+			c.Whens[i].Cond = p.planExpr(sc, agg, w.Cond)
+			if e.Operand != nil {
+				c.Whens[i].Cond = convertLiteral(c.Whens[i].Cond, w.Cond, c.Operand, e.Operand)
+			}
+			results = append(results, c.Whens[i].Result)
+		}
+		if e.Else != nil {
+			c.Else = p.planExpr(sc, agg, e.Else)
+			results = append(results, c.Else)
+		}
+		c.Type = commonType(results)
+		return c
+	case *parser.BinaryExpr:
+		left := p.planExpr(sc, agg, e.Left)
+		right := p.planExpr(sc, agg, e.Right)
+		return &BinaryExpr{Left: left, Operator: e.Operator, Right: right, Type: binaryType(e.Operator, exprType(left), exprType(right))}
+	case *parser.UnaryMinusExpr:
+		return &UnaryMinusExpr{Operand: p.planExpr(sc, agg, e.Operand)}
+	}
+
+	// must not come here because the statement is validated
+	panic(fmt.Sprintf("unexpected expression %T", expr))
+}
+
+// planComparison plans the operands of the comparison.
+func (p *Planner) planComparison(sc *scope, agg *Aggregate, l, r parser.Expr) (Expr, Expr) {
+	left := p.planExpr(sc, agg, l)
+	right := p.planExpr(sc, agg, r)
+	return convertLiteral(left, l, right, r), convertLiteral(right, r, left, l)
+}
+
+// convertLiteral converts the literal compared with a column or an expression to its type.
+// e.g. in `registered = "2021-05-01"`, "2021-05-01" is a timestamp.
+// expr is planned from e, and other is planned from o which is the other side of the comparison.
+func convertLiteral(expr Expr, e parser.Expr, other Expr, o parser.Expr) Expr {
+	val, ok := e.(*parser.Value)
+	if _, lit := o.(*parser.Value); !ok || lit {
+		return expr
+	}
+
+	if typ := exprType(other); typ != 0 {
+		return planValue(val.Val, typ)
+	}
+
+	return expr
+}
+
+// planLiteral converts the literal whose type is not known from the context.
+// It is an int64, float64, bool, or string in this order.
+func planLiteral(val string) Expr {
+	if v, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return &Int64Expr{Value: v}
+	}
+
+	if v, err := strconv.ParseFloat(val, 64); err == nil {
+		return &Float64Expr{Value: v}
+	}
+
+	switch strings.ToLower(val) {
+	case "true":
+		return &BoolExpr{Value: true}
+	case "false":
+		return &BoolExpr{Value: false}
+	}
+
+	return &StringExpr{Value: val}
+}
+
+// planValue converts the literal to the expression of the column type.
+func planValue(val string, typ schema.ColumnType) Expr {
+	v, _ := schema.ConvertValue(val, typ)
+	switch typ {
+	case schema.ColumnTypeBool:
+		return &BoolExpr{Value: v.(bool)}
+	case schema.ColumnTypeInt64:
+		return &Int64Expr{Value: v.(int64)}
+	case schema.ColumnTypeFloat64:
+		return &Float64Expr{Value: v.(float64)}
+	case schema.ColumnTypeBytes:
+		return &BytesExpr{Value: v.([]byte)}
+	case schema.ColumnTypeString:
+		return &StringExpr{Value: v.(string)}
+	case schema.ColumnTypeTimestamp:
+		return &TimestampExpr{Value: v.(time.Time)}
+	}
+
+	return nil
 }
@@ -63,10 +63,10 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "id"},
-						&Column{Table: "users", Name: "name", Alias: "name"},
-						&Column{Table: "users", Name: "nickname", Alias: "nickname"},
-						&Column{Table: "users", Name: "age", Alias: "age"},
+						&Column{Table: "users", Name: "id", Alias: "id", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "name", Index: 1, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "nickname", Alias: "nickname", Index: 2, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "age", Alias: "age", Index: 3, Type: schema.ColumnTypeInt64},
 					},
 					Input: &Scan{
 						Table: &Table{Name: "users"},
@@ -90,11 +90,12 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "i"},
-						&Column{Table: "users", Name: "name", Alias: "n"},
+						&Column{Table: "users", Name: "id", Alias: "i", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "n", Index: 1, Type: schema.ColumnTypeString},
 					},
 					Input: &Scan{
-						Table: &Table{Name: "users"},
+						Table:   &Table{Name: "users"},
+						Columns: []int{0, 1},
 					},
 				},
 			},
@@ -121,19 +122,15 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "id"},
-						&Column{Table: "users", Name: "name", Alias: "name"},
-						&Column{Table: "users", Name: "nickname", Alias: "nickname"},
-						&Column{Table: "users", Name: "age", Alias: "age"},
+						&Column{Table: "users", Name: "id", Alias: "id", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "name", Index: 1, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "nickname", Alias: "nickname", Index: 2, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "age", Alias: "age", Index: 3, Type: schema.ColumnTypeInt64},
 					},
-					Input: &Selection{
-						Filter: &EqualityFilter{
-							Column: &Column{Name: "id"},
-							Value:  &Int64Expr{Value: int64(5)},
-						},
-						Input: &Scan{
-							Table: &Table{Name: "users"},
-						},
+					Input: &IndexScan{
+						Table: &Table{Name: "users"},
+						Index: "users_pkey_id",
+						Keys:  []Expr{&Int64Expr{Value: int64(5)}},
 					},
 				},
 			},
@@ -160,15 +157,16 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "id"},
-						&Column{Table: "users", Name: "name", Alias: "name"},
-						&Column{Table: "users", Name: "nickname", Alias: "nickname"},
-						&Column{Table: "users", Name: "age", Alias: "age"},
+						&Column{Table: "users", Name: "id", Alias: "id", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "name", Index: 1, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "nickname", Alias: "nickname", Index: 2, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "age", Alias: "age", Index: 3, Type: schema.ColumnTypeInt64},
 					},
 					Input: &Selection{
-						Filter: &EqualityFilter{
-							Column: &Column{Name: "name"},
-							Value:  &StringExpr{Value: "aaa"},
+						Filter: &ComparisonExpr{
+							Left:     &Column{Table: "users", Name: "name", Index: 1, Type: schema.ColumnTypeString},
+							Operator: parser.Op_EQ,
+							Right:    &StringExpr{Value: "aaa"},
 						},
 						Input: &Scan{
 							Table: &Table{Name: "users"},
@@ -202,15 +200,15 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "id"},
-						&Column{Table: "users", Name: "name", Alias: "name"},
-						&Column{Table: "users", Name: "nickname", Alias: "nickname"},
-						&Column{Table: "users", Name: "age", Alias: "age"},
+						&Column{Table: "users", Name: "id", Alias: "id", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "name", Index: 1, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "nickname", Alias: "nickname", Index: 2, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "age", Alias: "age", Index: 3, Type: schema.ColumnTypeInt64},
 					},
 					Input: &OrderBy{
 						Columns: []Expr{
-							&Column{Name: "id"},
-							&Column{Name: "name"},
+							&Column{Table: "users", Name: "id", Type: schema.ColumnTypeInt64},
+							&Column{Table: "users", Name: "name", Index: 1, Type: schema.ColumnTypeString},
 						},
 						Directirons: []string{"asc", "asc"},
 						Input: &Scan{
@@ -239,10 +237,10 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "id"},
-						&Column{Table: "users", Name: "name", Alias: "name"},
-						&Column{Table: "users", Name: "nickname", Alias: "nickname"},
-						&Column{Table: "users", Name: "age", Alias: "age"},
+						&Column{Table: "users", Name: "id", Alias: "id", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "name", Index: 1, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "nickname", Alias: "nickname", Index: 2, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "age", Alias: "age", Index: 3, Type: schema.ColumnTypeInt64},
 					},
 					Input: &Limit{
 						Limit: &Int64Expr{Value: 5},
@@ -256,6 +254,185 @@ func TestPlanner_PlanSelect(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: `select id from users where (age >= 20 and name <> nickname) or not age is null`,
+			stmt: &parser.SelectStatement{
+				SelectExprs: []parser.SelectExpr{
+					&parser.AliasedExpr{Expr: &parser.ColName{Name: "id"}},
+				},
+				From: &parser.AliasedTableExpr{
+					Expr: &parser.TableName{
+						Name: "users",
+					},
+				},
+				Where: &parser.Where{
+					Expr: &parser.OrExpr{
+						Left: &parser.AndExpr{
+							Left: &parser.ComparisonExpr{
+								Left:     &parser.ColName{Name: "age"},
+								Operator: parser.Op_GTE,
+								Right:    &parser.Value{Val: "20"},
+							},
+							Right: &parser.ComparisonExpr{
+								Left:     &parser.ColName{Name: "name"},
+								Operator: parser.Op_NEQ,
+								Right:    &parser.ColName{Name: "nickname"},
+							},
+						},
+						Right: &parser.NotExpr{
+							Operand: &parser.IsNullExpr{Operand: &parser.ColName{Name: "age"}},
+						},
+					},
+				},
+			},
+			expected: &SelectPlan{
+				LogicalPlan: &Projection{
+					Columns: []Expr{
+						&Column{Table: "users", Name: "id", Type: schema.ColumnTypeInt64},
+					},
+					Input: &Selection{
+						Filter: &OrExpr{
+							Left: &AndExpr{
+								Left: &ComparisonExpr{
+									Left:     &Column{Table: "users", Name: "age", Index: 3, Type: schema.ColumnTypeInt64},
+									Operator: parser.Op_GTE,
+									Right:    &Int64Expr{Value: 20},
+								},
+								Right: &ComparisonExpr{
+									Left:     &Column{Table: "users", Name: "name", Index: 1, Type: schema.ColumnTypeString},
+									Operator: parser.Op_NEQ,
+									Right:    &Column{Table: "users", Name: "nickname", Index: 2, Type: schema.ColumnTypeString},
+								},
+							},
+							Right: &NotExpr{
+								Operand: &IsNullExpr{Operand: &Column{Table: "users", Name: "age", Index: 3, Type: schema.ColumnTypeInt64}},
+							},
+						},
+						Input: &Scan{
+							Table: &Table{Name: "users"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: `select distinct name from users order by name desc limit 3`,
+			stmt: &parser.SelectStatement{
+				Distinct: true,
+				SelectExprs: []parser.SelectExpr{
+					&parser.AliasedExpr{Expr: &parser.ColName{Name: "name"}},
+				},
+				From: &parser.AliasedTableExpr{
+					Expr: &parser.TableName{
+						Name: "users",
+					},
+				},
+				OrderBy: []*parser.Order{
+					{
+						Expr:      &parser.ColName{Name: "name"},
+						Direction: parser.OrderDirection_DESC,
+					},
+				},
+				Limit: &parser.Limit{
+					Count: 3,
+				},
+			},
+			expected: &SelectPlan{
+				LogicalPlan: &Projection{
+					Columns: []Expr{
+						&Column{Table: "users", Name: "name", Type: schema.ColumnTypeString},
+					},
+					Input: &Limit{
+						Limit: &Int64Expr{Value: 3},
+						Input: &Offset{
+							Offset: &Int64Expr{Value: 0},
+							// top-n is not applied because distinct drops tuples after sort
+							Input: &Distinct{
+								Columns: []Expr{
+									&Column{Table: "users", Name: "name", Type: schema.ColumnTypeString},
+								},
+								Input: &OrderBy{
+									Columns: []Expr{
+										&Column{Table: "users", Name: "name", Type: schema.ColumnTypeString},
+									},
+									Directirons: []string{"desc"},
+									// only the used column is read
+									Input: &Scan{
+										Table:   &Table{Name: "users"},
+										Columns: []int{1},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: `select name, count(*) as c, avg(age) from users group by name having max(age) > 20 order by count(*) desc`,
+			stmt: &parser.SelectStatement{
+				SelectExprs: []parser.SelectExpr{
+					&parser.AliasedExpr{Expr: &parser.ColName{Name: "name"}},
+					&parser.AliasedExpr{Expr: &parser.FuncExpr{Name: "count", Args: []parser.Expr{}, Star: true}, As: "c"},
+					&parser.AliasedExpr{Expr: &parser.FuncExpr{Name: "avg", Args: []parser.Expr{&parser.ColName{Name: "age"}}}},
+				},
+				From: &parser.AliasedTableExpr{
+					Expr: &parser.TableName{
+						Name: "users",
+					},
+				},
+				GroupBy: []parser.Expr{&parser.ColName{Name: "name"}},
+				Having: &parser.Where{
+					Expr: &parser.ComparisonExpr{
+						Left:     &parser.FuncExpr{Name: "max", Args: []parser.Expr{&parser.ColName{Name: "age"}}},
+						Operator: parser.Op_GT,
+						Right:    &parser.Value{Val: "20"},
+					},
+				},
+				OrderBy: []*parser.Order{
+					{
+						Expr:      &parser.FuncExpr{Name: "count", Args: []parser.Expr{}, Star: true},
+						Direction: parser.OrderDirection_DESC,
+					},
+				},
+			},
+			expected: &SelectPlan{
+				LogicalPlan: &Projection{
+					// the aggregate results follow the group by columns
+					Columns: []Expr{
+						&Column{Table: "users", Name: "name", Type: schema.ColumnTypeString},
+						&Column{Name: "count(*)", Alias: "c", Index: 2, Type: schema.ColumnTypeInt64},
+						&Column{Name: "avg(age)", Index: 3, Type: schema.ColumnTypeFloat64},
+					},
+					Input: &OrderBy{
+						Columns:     []Expr{&Column{Name: "count(*)", Index: 2, Type: schema.ColumnTypeInt64}},
+						Directirons: []string{"desc"},
+						Input: &Selection{
+							Filter: &ComparisonExpr{
+								Left:     &Column{Name: "max(age)", Index: 1, Type: schema.ColumnTypeInt64},
+								Operator: parser.Op_GT,
+								Right:    &Int64Expr{Value: 20},
+							},
+							Input: &Aggregate{
+								GroupBy: []Expr{
+									&Column{Table: "users", Name: "name", Type: schema.ColumnTypeString},
+								},
+								// count(*) is computed once even though it appears twice
+								Aggregates: []*AggregateExpr{
+									{Func: "max", Arg: &Column{Table: "users", Name: "age", Index: 1, Type: schema.ColumnTypeInt64}},
+									{Func: "count"},
+									{Func: "avg", Arg: &Column{Table: "users", Name: "age", Index: 1, Type: schema.ColumnTypeInt64}},
+								},
+								Input: &Scan{
+									Table:   &Table{Name: "users"},
+									Columns: []int{1, 3},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: `select * from users where id = 5 order by id, name limit 5 offset 10`,
 			stmt: &parser.SelectStatement{
@@ -292,10 +469,10 @@ func TestPlanner_PlanSelect(t *testing.T) {
 			expected: &SelectPlan{
 				LogicalPlan: &Projection{
 					Columns: []Expr{
-						&Column{Table: "users", Name: "id", Alias: "id"},
-						&Column{Table: "users", Name: "name", Alias: "name"},
-						&Column{Table: "users", Name: "nickname", Alias: "nickname"},
-						&Column{Table: "users", Name: "age", Alias: "age"},
+						&Column{Table: "users", Name: "id", Alias: "id", Type: schema.ColumnTypeInt64},
+						&Column{Table: "users", Name: "name", Alias: "name", Index: 1, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "nickname", Alias: "nickname", Index: 2, Type: schema.ColumnTypeString},
+						&Column{Table: "users", Name: "age", Alias: "age", Index: 3, Type: schema.ColumnTypeInt64},
 					},
 					Input: &Limit{
 						Limit: &Int64Expr{Value: 5},
@@ -303,18 +480,15 @@ func TestPlanner_PlanSelect(t *testing.T) {
 							Offset: &Int64Expr{Value: 10},
 							Input: &OrderBy{
 								Columns: []Expr{
-									&Column{Name: "id"},
-									&Column{Name: "name"},
+									&Column{Table: "users", Name: "id", Type: schema.ColumnTypeInt64},
+									&Column{Table: "users", Name: "name", Index: 1, Type: schema.ColumnTypeString},
 								},
 								Directirons: []string{"asc", "asc"},
-								Input: &Selection{
-									Filter: &EqualityFilter{
-										Column: &Column{Name: "id"},
-										Value:  &Int64Expr{Value: int64(5)},
-									},
-									Input: &Scan{
-										Table: &Table{Name: "users"},
-									},
+								TopN:        15,
+								Input: &IndexScan{
+									Table: &Table{Name: "users"},
+									Index: "users_pkey_id",
+									Keys:  []Expr{&Int64Expr{Value: int64(5)}},
 								},
 							},
 						},
@@ -332,3 +506,168 @@ func TestPlanner_PlanSelect(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanner_PlanSelect_Join(t *testing.T) {
+	c := &catalog.Catalog{
+		Tables: map[string]*schema.Table{
+			"users": {
+				Name: "users",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString},
+					{Name: "dept_id", Type: schema.ColumnTypeInt64},
+				},
+				PrimaryKeyIndex: 0,
+				Indices:         []*schema.Index{{Table: "users", Name: "users_pkey_id", ColumnIndex: 0}},
+			},
+			"depts": {
+				Name: "depts",
+				Columns: []*schema.ColumnDef{
+					{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+					{Name: "name", Type: schema.ColumnTypeString},
+				},
+				PrimaryKeyIndex: 0,
+				Indices:         []*schema.Index{{Table: "depts", Name: "depts_pkey_id", ColumnIndex: 0}},
+			},
+		},
+	}
+
+	users := &Scan{Table: &Table{Name: "users", Alias: "u"}}
+	depts := &Scan{Table: &Table{Name: "depts", Alias: "d"}}
+	deptID := &Column{Table: "u", Name: "dept_id", Index: 2, Type: schema.ColumnTypeInt64}
+	dID := &Column{Table: "d", Name: "id", Index: 3, Type: schema.ColumnTypeInt64}
+	uName := &Column{Table: "u", Name: "name", Index: 1, Type: schema.ColumnTypeString}
+	dName := &Column{Table: "d", Name: "name", Index: 4, Type: schema.ColumnTypeString}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected List
+	}{
+		{
+			name:  "primary key of the right table is looked up by the index",
+			query: `select * from users u join depts d on u.dept_id = d.id`,
+			expected: &IndexNestedLoopJoin{
+				Type:       parser.InnerJoin,
+				Left:       users,
+				Table:      depts.Table,
+				Index:      "depts_pkey_id",
+				LeftKey:    deptID,
+				Condition:  &ComparisonExpr{Left: deptID, Operator: parser.Op_EQ, Right: dID},
+				RightWidth: 2,
+			},
+		},
+		{
+			name:  "hash join on non indexed columns",
+			query: `select * from users u left join depts d on d.name = u.name`,
+			expected: &HashJoin{
+				Type:       parser.LeftJoin,
+				Left:       users,
+				Right:      depts,
+				LeftKeys:   []Expr{uName},
+				RightKeys:  []Expr{&Column{Table: "d", Name: "name", Index: 1, Type: schema.ColumnTypeString}},
+				Condition:  &ComparisonExpr{Left: dName, Operator: parser.Op_EQ, Right: uName},
+				RightWidth: 2,
+			},
+		},
+		{
+			name:  "nested loop join without equality",
+			query: `select * from users u join depts d on u.dept_id < d.id`,
+			expected: &NestedLoopJoin{
+				Type:       parser.InnerJoin,
+				Left:       users,
+				Right:      depts,
+				Condition:  &ComparisonExpr{Left: deptID, Operator: parser.Op_LT, Right: dID},
+				RightWidth: 2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			stmt, err := parser.New(c).Parse(test.query)
+			testutil.MustBeNil(t, err)
+
+			plan := New(c).PlanSelect(stmt.(*parser.SelectStatement))
+			testutil.MustEqual(t, plan.LogicalPlan.(*Projection).Input, test.expected)
+		})
+	}
+}
+
+func TestPlanner_PlanSelect_Expression(t *testing.T) {
+	c := newOptimizerCatalog(false)
+	id := &Column{Table: "users", Name: "id", Index: 0, Type: schema.ColumnTypeInt64}
+	name := &Column{Table: "users", Name: "name", Index: 1, Type: schema.ColumnTypeString}
+	score := &Column{Table: "users", Name: "score", Index: 2, Type: schema.ColumnTypeInt64}
+
+	pj := planQuery(t, c, `select id, id * 2 + 1, lower(name) as lowered, score / 2.0, (id + 1) * -score from users`)
+	testutil.MustEqual(t, pj.Columns, []Expr{
+		id,
+		&NamedExpr{
+			Operand: &BinaryExpr{
+				Left:     &BinaryExpr{Left: id, Operator: parser.Op_MUL, Right: &Int64Expr{Value: 2}, Type: schema.ColumnTypeInt64},
+				Operator: parser.Op_ADD,
+				Right:    &Int64Expr{Value: 1},
+				Type:     schema.ColumnTypeInt64,
+			},
+			Name: "id * 2 + 1",
+			Type: schema.ColumnTypeInt64,
+		},
+		&NamedExpr{Operand: &FuncExpr{Name: "lower", Args: []Expr{name}, Type: schema.ColumnTypeString}, Name: "lowered", Type: schema.ColumnTypeString},
+		&NamedExpr{
+			Operand: &BinaryExpr{Left: score, Operator: parser.Op_DIV, Right: &Float64Expr{Value: 2}, Type: schema.ColumnTypeFloat64},
+			Name:    "score / 2.0",
+			Type:    schema.ColumnTypeFloat64,
+		},
+		&NamedExpr{
+			Operand: &BinaryExpr{
+				Left:     &BinaryExpr{Left: id, Operator: parser.Op_ADD, Right: &Int64Expr{Value: 1}, Type: schema.ColumnTypeInt64},
+				Operator: parser.Op_MUL,
+				Right:    &UnaryMinusExpr{Operand: score},
+				Type:     schema.ColumnTypeInt64,
+			},
+			Name: "(id + 1) * -score",
+			Type: schema.ColumnTypeInt64,
+		},
+	})
+
+	// the literal compared with the expression is converted to the type of the expression
+	pj = planQuery(t, c, `select id from users where substr(name, 1, 3) = "123"`)
+	filter := pj.Input.(*Selection).Filter.(*ComparisonExpr)
+	testutil.MustEqual(t, filter.Right, Expr(&StringExpr{Value: "123"}))
+
+	// the aggregate function in the expression refers to the output of the aggregation
+	pj = planQuery(t, c, `select dept_id, sum(score) * 2 from users group by dept_id`)
+	testutil.MustEqual(t, pj.Columns[1], Expr(&NamedExpr{
+		Operand: &BinaryExpr{
+			Left:     &Column{Name: "sum(score)", Index: 1, Type: schema.ColumnTypeInt64},
+			Operator: parser.Op_MUL,
+			Right:    &Int64Expr{Value: 2},
+			Type:     schema.ColumnTypeInt64,
+		},
+		Name: "sum(score) * 2",
+		Type: schema.ColumnTypeInt64,
+	}))
+
+	// the literals compared in IN and CASE are converted to the type of the operand
+	pj = planQuery(t, c, `select case name when "1" then 1 else 0.5 end, name in ("2", "3") from users`)
+	name = &Column{Table: "users", Name: "name", Index: 0, Type: schema.ColumnTypeString}
+	testutil.MustEqual(t, pj.Columns, []Expr{
+		&NamedExpr{
+			Operand: &CaseExpr{
+				Operand: name,
+				Whens:   []*When{{Cond: &StringExpr{Value: "1"}, Result: &Int64Expr{Value: 1}}},
+				Else:    &Float64Expr{Value: 0.5},
+				Type:    schema.ColumnTypeFloat64,
+			},
+			Name: "case name when 1 then 1 else 0.5 end",
+			Type: schema.ColumnTypeFloat64,
+		},
+		&NamedExpr{
+			Operand: &InExpr{Operand: name, Values: []Expr{&StringExpr{Value: "2"}, &StringExpr{Value: "3"}}},
+			Name:    "name in (2, 3)",
+			Type:    schema.ColumnTypeBool,
+		},
+	})
+}
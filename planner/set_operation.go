@@ -0,0 +1,197 @@
+package planner
+
+import (
+	"math"
+	"strings"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// planQuery makes the plan of the query.
+func (p *Planner) planQuery(q parser.Query) (*Projection, *path) {
+	if s, ok := q.(*parser.SetOperationStatement); ok {
+		return p.planSetOperation(s)
+	}
+
+	return p.planSelect(q.(*parser.SelectStatement))
+}
+
+// planSetOperation makes the plan of the set operation. Both sides are planned as queries, and combined by
+// Append (UNION ALL), Distinct on Append (UNION), or HashSetOp (INTERSECT and EXCEPT).
+// The returned path has the estimation of the combined result.
+func (p *Planner) planSetOperation(stmt *parser.SetOperationStatement) (*Projection, *path) {
+	left, lbest := p.planQuery(stmt.Left)
+	right, rbest := p.planQuery(stmt.Right)
+
+	// the result columns are named after the left ones, and int64 is converted when the other side is float64
+	types := make([]schema.ColumnType, len(left.Columns))
+	columns := make([]Expr, len(left.Columns))
+	for i, c := range left.Columns {
+		types[i] = setOperationType(exprType(c), exprType(right.Columns[i]))
+		columns[i] = &Column{Name: columnName(c), Index: i, Type: types[i]}
+	}
+
+	var list List
+	var rows float64
+	switch {
+	case stmt.Type == parser.Union:
+		list = &Append{Left: left, Right: right, Types: types}
+		rows = lbest.rows + rbest.rows
+		if !stmt.All {
+			list = &Distinct{Columns: columns, Input: list}
+		}
+	default:
+		list = &HashSetOp{Type: stmt.Type, All: stmt.All, Left: left, Right: right, Types: types}
+		rows = lbest.rows
+		if stmt.Type == parser.Intersect {
+			rows = math.Min(lbest.rows, rbest.rows)
+		}
+	}
+	cost := lbest.cost + rbest.cost + (lbest.rows+rbest.rows)*cpuTupleCost
+
+	if stmt.OrderBy != nil {
+		ob := &OrderBy{
+			Columns:     make([]Expr, len(stmt.OrderBy)),
+			Directirons: make([]string, len(stmt.OrderBy)),
+			Input:       list,
+		}
+		for i, o := range stmt.OrderBy {
+			ob.Columns[i] = resultColumn(columns, o.Expr.(*parser.ColName).Name)
+			ob.Directirons[i] = o.Direction.String()
+		}
+		list = ob
+	}
+
+	if stmt.Limit != nil {
+		if ob, ok := list.(*OrderBy); ok && stmt.Limit.Count > 0 {
+			ob.TopN = stmt.Limit.Count + stmt.Limit.Offset
+		}
+
+		list = &Limit{
+			Limit: &Int64Expr{Value: int64(stmt.Limit.Count)},
+			Input: &Offset{Offset: &Int64Expr{Value: int64(stmt.Limit.Offset)}, Input: list},
+		}
+		rows = math.Min(rows, float64(stmt.Limit.Count))
+	}
+
+	return &Projection{Columns: columns, Input: list}, &path{list: list, rows: rows, cost: cost}
+}
+
+// setOperationType returns the type of the column combining the values of the types.
+// The type of NULL is decided by the other side. The types are already validated.
+func setOperationType(left, right schema.ColumnType) schema.ColumnType {
+	switch {
+	case left == 0:
+		return right
+	case right == 0 || left == right:
+		return left
+	}
+
+	return schema.ColumnTypeFloat64
+}
+
+// columnName returns the name of the projected column shown in the result.
+func columnName(e Expr) string {
+	switch c := e.(type) {
+	case *Column:
+		if c.Alias != "" {
+			return c.Alias
+		}
+		return c.Name
+	case *NamedExpr:
+		return c.Name
+	}
+
+	return ""
+}
+
+// resultColumn returns the column of the name in the result of the set operation.
+func resultColumn(columns []Expr, name string) *Column {
+	for _, c := range columns {
+		if col := c.(*Column); strings.EqualFold(col.Name, name) {
+			return col
+		}
+	}
+
+	// must not come here because the statement is validated
+	panic("column " + name + " does not exist in the result")
+}
+
+// coerce converts the int64 values in the tuple to float64 when the column type is float64.
+func coerce(t sdb.Tuple, types []schema.ColumnType) sdb.Tuple {
+	var values []interface{}
+	for i, typ := range types {
+		if v, ok := t.Value(i).(int64); ok && typ == schema.ColumnTypeFloat64 {
+			if values == nil {
+				values = make([]interface{}, len(types))
+				for j := range types {
+					values[j] = t.Value(j)
+				}
+			}
+			values[i] = float64(v)
+		}
+	}
+
+	if values == nil {
+		return t
+	}
+
+	return engine.NewTuple(values, -1)
+}
+
+// key returns the key of the tuple in the hash table of HashSetOp. NULLs are equal to each other.
+func (op *HashSetOp) key(t sdb.Tuple) string {
+	values := make([]interface{}, len(op.Types))
+	for i := range values {
+		values[i] = t.Value(i)
+	}
+
+	return encodeKey(values)
+}
+
+// buildCounts reads all the right tuples and counts them by the key.
+func (op *HashSetOp) buildCounts() error {
+	op.counts = map[string]int{}
+	for {
+		t, err := op.Right.Next()
+		if err != nil || t == nil {
+			return err
+		}
+
+		op.counts[op.key(coerce(t, op.Types))]++
+	}
+}
+
+// produce reports if the left tuple of the key is produced, and updates the count of the key.
+// For INTERSECT, the count is the right tuples not matched yet. For EXCEPT, the count is the right tuples
+// which cancel the left ones, and -1 means the tuple is already produced.
+func (op *HashSetOp) produce(key string) bool {
+	n := op.counts[key]
+	if op.Type == parser.Intersect {
+		if n <= 0 {
+			return false
+		}
+		if op.All {
+			op.counts[key]--
+		} else {
+			op.counts[key] = 0
+		}
+		return true
+	}
+
+	switch {
+	case n > 0 && op.All:
+		op.counts[key]--
+		return false
+	case n != 0:
+		return false
+	}
+
+	if !op.All {
+		op.counts[key] = -1
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestSetOperation(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected [][]interface{}
+	}{
+		{
+			name:     "union",
+			query:    `select dept_id from users union select id from depts order by dept_id`,
+			expected: [][]interface{}{{nil}, {int64(10)}, {int64(20)}, {int64(30)}, {int64(40)}},
+		},
+		{
+			name:     "union all",
+			query:    `select dept_id from users where dept_id = 10 union all select id from depts where id = 10`,
+			expected: [][]interface{}{{int64(10)}, {int64(10)}, {int64(10)}},
+		},
+		{
+			name:     "intersect",
+			query:    `select dept_id from users intersect select id from depts order by dept_id`,
+			expected: [][]interface{}{{int64(10)}, {int64(20)}},
+		},
+		{
+			name:     "intersect all",
+			query:    `select dept_id from users intersect all select dept_id from users where id > 3 order by dept_id`,
+			expected: [][]interface{}{{int64(10)}, {int64(30)}},
+		},
+		{
+			name:     "except",
+			query:    `select dept_id from users except select id from depts order by dept_id`,
+			expected: [][]interface{}{{nil}, {int64(30)}},
+		},
+		{
+			name:     "except all",
+			query:    `select dept_id from users except all select id from depts order by dept_id`,
+			expected: [][]interface{}{{nil}, {int64(10)}, {int64(30)}},
+		},
+		{
+			name:     "intersect first",
+			query:    `select id from depts except select dept_id from users intersect select id from depts where id > 10 order by id`,
+			expected: [][]interface{}{{int64(10)}, {int64(40)}},
+		},
+		{
+			name:     "int64 and float64",
+			query:    `select id from users where id < 3 union select 1.5 from depts order by id`,
+			expected: [][]interface{}{{float64(1)}, {1.5}, {float64(2)}},
+		},
+		{
+			name:     "order by and limit",
+			query:    `select name from users union all select name from depts order by name desc limit 2`,
+			expected: [][]interface{}{{"ops"}, {"hr"}},
+		},
+		{
+			name:     "parenthesized",
+			query:    `(select id from users order by id desc limit 1) union all (select id from depts order by id limit 1)`,
+			expected: [][]interface{}{{int64(5)}, {int64(10)}},
+		},
+		{
+			name:     "in subquery",
+			query:    `select id from users where dept_id in (select id from depts where id = 20 union select 30 from depts) order by id`,
+			expected: [][]interface{}{{int64(2)}, {int64(5)}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pj := planQuery(t, newJoinCatalog(), test.query)
+			rows := values(collect(t, pj, newJoinEngine()), len(test.expected[0]))
+			testutil.MustEqual(t, rows, test.expected)
+		})
+	}
+}
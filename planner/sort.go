@@ -0,0 +1,464 @@
+package planner
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/dty1er/sdb/sdb"
+)
+
+// sortRow is a tuple with its sort keys. The keys are evaluated only once before sorting.
+type sortRow struct {
+	tuple sdb.Tuple
+	keys  []interface{}
+	// seq is the order the tuple is read. It makes the sort stable.
+	seq int
+}
+
+// sortKeys evaluates the sort keys of the tuple.
+func sortKeys(columns []Expr, t sdb.Tuple) ([]interface{}, error) {
+	keys := make([]interface{}, len(columns))
+	for i, col := range columns {
+		v, err := eval(col, t)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = v
+	}
+
+	return keys, nil
+}
+
+// compareForSort compares the values for sorting. Unlike comparison in the expression,
+// NULL is comparable; it is smaller than any other value.
+func compareForSort(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	// the types are validated, so they are always comparable
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
+
+// less reports if row a must be placed before row b.
+func (ob *OrderBy) less(a, b *sortRow) bool {
+	for i := range ob.Columns {
+		cmp := compareForSort(a.keys[i], b.keys[i])
+		if cmp == 0 {
+			continue
+		}
+
+		if ob.Directirons[i] == "desc" {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+
+	return a.seq < b.seq
+}
+
+// sort reads all the tuples from the input and sorts them. While the tuples fit in work_mem,
+// they are sorted on memory. Once they exceed work_mem, the sorted tuples are written to a spill file
+// (called run) and the memory is released. In that case, the runs are merged on Next (external merge sort).
+func (ob *OrderBy) sort() error {
+	return ob.sortFrom([]*sortRow{}, 0, 0)
+}
+
+// sortFrom continues sort with the rows already read. size is the serialized size of them,
+// and seq is the order of the next tuple.
+func (ob *OrderBy) sortFrom(rows []*sortRow, size, seq int) error {
+	for ; ; seq++ {
+		t, err := ob.Input.Next()
+		if err != nil {
+			return err
+		}
+
+		if t == nil {
+			break
+		}
+
+		keys, err := sortKeys(ob.Columns, t)
+		if err != nil {
+			return err
+		}
+
+		rows = append(rows, &sortRow{tuple: t, keys: keys, seq: seq})
+
+		if ob.env.WorkMem <= 0 {
+			continue
+		}
+
+		serialized, err := t.Serialize()
+		if err != nil {
+			return err
+		}
+
+		size += len(serialized)
+		if size > ob.env.WorkMem {
+			if err := ob.spill(rows); err != nil {
+				return err
+			}
+			rows = []*sortRow{}
+			size = 0
+		}
+	}
+
+	if len(ob.runs) == 0 {
+		ob.sortRows(rows)
+		ob.sorted = rows
+		return nil
+	}
+
+	if len(rows) > 0 {
+		if err := ob.spill(rows); err != nil {
+			return err
+		}
+	}
+
+	return ob.startMerge()
+}
+
+func (ob *OrderBy) sortRows(rows []*sortRow) {
+	sort.Slice(rows, func(i, j int) bool { return ob.less(rows[i], rows[j]) })
+}
+
+// spill sorts the rows then writes them to a new run.
+func (ob *OrderBy) spill(rows []*sortRow) error {
+	ob.sortRows(rows)
+
+	w := newSpillWriter(ob.env.DiskManager, ob.env.spillBlockSize())
+	for _, row := range rows {
+		serialized, err := row.tuple.Serialize()
+		if err != nil {
+			return err
+		}
+
+		if err := w.write(serialized); err != nil {
+			return err
+		}
+	}
+
+	run, err := w.close()
+	if err != nil {
+		return err
+	}
+
+	ob.runs = append(ob.runs, run)
+	return nil
+}
+
+// mergeFanIn returns how many runs are merged at once. A block of each run being merged and
+// a block of the run being written must fit in work_mem.
+func (ob *OrderBy) mergeFanIn() int {
+	if ob.env.WorkMem <= 0 {
+		return len(ob.runs)
+	}
+
+	fanIn := ob.env.WorkMem/ob.env.spillBlockSize() - 1
+	if fanIn < 2 {
+		return 2
+	}
+	return fanIn
+}
+
+// startMerge prepares merging the runs. While there are more runs than the fan-in, every fan-in runs
+// are merged into a new run. Then the remaining runs are merged by a heap which holds the current tuple
+// of each run on Next, so only one block per run is on memory while merging.
+func (ob *OrderBy) startMerge() error {
+	fanIn := ob.mergeFanIn()
+	for len(ob.runs) > fanIn {
+		if err := ob.mergePass(fanIn); err != nil {
+			return err
+		}
+	}
+
+	merger, err := ob.openRuns(ob.runs)
+	if err != nil {
+		return err
+	}
+
+	ob.merger = merger
+	return nil
+}
+
+// mergePass merges every fanIn runs into a run. The runs are merged in order, so the sort is kept stable.
+func (ob *OrderBy) mergePass(fanIn int) error {
+	merged := []*spillFile{}
+	for i := 0; i < len(ob.runs); i += fanIn {
+		end := i + fanIn
+		if end > len(ob.runs) {
+			end = len(ob.runs)
+		}
+
+		if end-i == 1 {
+			merged = append(merged, ob.runs[i])
+			continue
+		}
+
+		run, err := ob.mergeRuns(ob.runs[i:end])
+		if err != nil {
+			// the runs are removed on Close
+			ob.runs = append(merged, ob.runs[i:]...)
+			return err
+		}
+
+		merged = append(merged, run)
+		if err := removeFiles(ob.env.DiskManager, ob.runs[i:end]); err != nil {
+			ob.runs = append(merged, ob.runs[end:]...)
+			return err
+		}
+	}
+
+	ob.runs = merged
+	return nil
+}
+
+// mergeRuns merges the runs into a new run.
+func (ob *OrderBy) mergeRuns(runs []*spillFile) (*spillFile, error) {
+	merger, err := ob.openRuns(runs)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newSpillWriter(ob.env.DiskManager, ob.env.spillBlockSize())
+	if err := ob.writeMerged(w, merger); err != nil {
+		ob.env.DiskManager.Remove(w.file.name)
+		return nil, err
+	}
+
+	return w.close()
+}
+
+func (ob *OrderBy) writeMerged(w *spillWriter, merger *mergeHeap) error {
+	for {
+		t, err := ob.popMerged(merger)
+		if err != nil {
+			return err
+		}
+
+		if t == nil {
+			return nil
+		}
+
+		serialized, err := t.Serialize()
+		if err != nil {
+			return err
+		}
+
+		if err := w.write(serialized); err != nil {
+			return err
+		}
+	}
+}
+
+// openRuns reads the first tuple of every run and returns the heap to merge them.
+func (ob *OrderBy) openRuns(runs []*spillFile) (*mergeHeap, error) {
+	merger := &mergeHeap{less: ob.less}
+	for i, run := range runs {
+		c := &runCursor{reader: newSpillReader(ob.env.DiskManager, run), run: i}
+		ok, err := c.advance(ob.Columns)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			merger.cursors = append(merger.cursors, c)
+		}
+	}
+
+	heap.Init(merger)
+	return merger, nil
+}
+
+// nextMerged returns the smallest tuple among the current tuples of the runs.
+func (ob *OrderBy) nextMerged() (sdb.Tuple, error) {
+	return ob.popMerged(ob.merger)
+}
+
+// popMerged returns the smallest tuple among the current tuples of the runs in the heap.
+func (ob *OrderBy) popMerged(merger *mergeHeap) (sdb.Tuple, error) {
+	if merger.Len() == 0 {
+		return nil, nil
+	}
+
+	c := merger.cursors[0]
+	t := c.row.tuple
+
+	ok, err := c.advance(ob.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		heap.Fix(merger, 0)
+	} else {
+		heap.Pop(merger)
+	}
+
+	return t, nil
+}
+
+// removeRuns removes the spill files.
+func (ob *OrderBy) removeRuns() error {
+	err := removeFiles(ob.env.DiskManager, ob.runs)
+	ob.runs = nil
+	ob.merger = nil
+	return err
+}
+
+func removeFiles(dm sdb.DiskManager, files []*spillFile) error {
+	var firstErr error
+	for _, f := range files {
+		if err := f.remove(dm); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// runCursor points the current tuple of the run while merging.
+type runCursor struct {
+	reader *spillReader
+	row    *sortRow
+	run    int
+}
+
+// advance reads the next tuple of the run. false is returned when the run has no more tuples.
+func (c *runCursor) advance(columns []Expr) (bool, error) {
+	t, err := c.reader.read()
+	if err != nil || t == nil {
+		return false, err
+	}
+
+	keys, err := sortKeys(columns, t)
+	if err != nil {
+		return false, err
+	}
+
+	// The runs are made from the input in order, so the run number keeps the sort stable.
+	c.row = &sortRow{tuple: t, keys: keys, seq: c.run}
+	return true, nil
+}
+
+// mergeHeap is a min heap of the runs by their current tuples.
+type mergeHeap struct {
+	cursors []*runCursor
+	less    func(a, b *sortRow) bool
+}
+
+func (h *mergeHeap) Len() int           { return len(h.cursors) }
+func (h *mergeHeap) Less(i, j int) bool { return h.less(h.cursors[i].row, h.cursors[j].row) }
+func (h *mergeHeap) Swap(i, j int)      { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x interface{}) {
+	h.cursors = append(h.cursors, x.(*runCursor))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
+
+// topN keeps only the first n tuples in the sorted order by a heap, so that it needs memory only for n tuples.
+// When the n tuples do not fit in work_mem, it falls back to sort, which spills them.
+func (ob *OrderBy) topN(n int) error {
+	h := &sortHeap{less: ob.less}
+	size := 0
+	for seq := 0; ; seq++ {
+		t, err := ob.Input.Next()
+		if err != nil {
+			return err
+		}
+
+		if t == nil {
+			break
+		}
+
+		keys, err := sortKeys(ob.Columns, t)
+		if err != nil {
+			return err
+		}
+
+		row := &sortRow{tuple: t, keys: keys, seq: seq}
+		if h.Len() < n {
+			heap.Push(h, row)
+		} else if ob.less(row, h.rows[0]) {
+			// The root of the heap is the last one of the current top n.
+			// When the new row comes before it, the root is replaced.
+			old, err := serializedSize(h.rows[0].tuple, ob.env.WorkMem)
+			if err != nil {
+				return err
+			}
+
+			size -= old
+			h.rows[0] = row
+			heap.Fix(h, 0)
+		} else {
+			continue
+		}
+
+		added, err := serializedSize(t, ob.env.WorkMem)
+		if err != nil {
+			return err
+		}
+
+		size += added
+		if ob.env.WorkMem > 0 && size > ob.env.WorkMem {
+			// The rows dropped from the heap are never in the top n, so sort continues from the rows in the heap.
+			if err := ob.spill(h.rows); err != nil {
+				return err
+			}
+			return ob.sortFrom([]*sortRow{}, 0, seq+1)
+		}
+	}
+
+	rows := make([]*sortRow, h.Len())
+	for i := len(rows) - 1; i >= 0; i-- {
+		rows[i] = heap.Pop(h).(*sortRow)
+	}
+
+	ob.sorted = rows
+	return nil
+}
+
+// serializedSize returns the size of the serialized tuple. It is needed only when work_mem is applied,
+// so 0 is returned without serializing when workMem is not positive.
+func serializedSize(t sdb.Tuple, workMem int) (int, error) {
+	if workMem <= 0 {
+		return 0, nil
+	}
+
+	serialized, err := t.Serialize()
+	if err != nil {
+		return 0, err
+	}
+	return len(serialized), nil
+}
+
+// sortHeap is a max heap in the sort order; the root is the row to be placed at the last.
+type sortHeap struct {
+	rows []*sortRow
+	less func(a, b *sortRow) bool
+}
+
+func (h *sortHeap) Len() int           { return len(h.rows) }
+func (h *sortHeap) Less(i, j int) bool { return h.less(h.rows[j], h.rows[i]) }
+func (h *sortHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+
+func (h *sortHeap) Push(x interface{}) {
+	h.rows = append(h.rows, x.(*sortRow))
+}
+
+func (h *sortHeap) Pop() interface{} {
+	last := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return last
+}
@@ -0,0 +1,156 @@
+package planner
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dty1er/sdb/diskmanager"
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/sdb"
+	"github.com/dty1er/sdb/testutil"
+)
+
+func spillFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	testutil.MustBeNil(t, err)
+
+	files := []string{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), SpillFilePrefix) {
+			files = append(files, e.Name())
+		}
+	}
+	return files
+}
+
+func TestOrderBy_Spill(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tuples := []sdb.Tuple{}
+	for i := 0; i < 1000; i++ {
+		var score interface{} = int64(r.Intn(50))
+		if i%97 == 0 {
+			score = nil
+		}
+		tuples = append(tuples, engine.NewTuple([]interface{}{int64(i), score}, 0))
+	}
+	e := newEngineWithTuples("users", tuples, 16)
+	columns := []Expr{&Column{Name: "score", Index: 1}}
+
+	newOrderBy := func() *OrderBy {
+		return &OrderBy{Columns: columns, Directirons: []string{"desc"}, Input: &Scan{Table: &Table{Name: "users"}}}
+	}
+	expected := ids(collect(t, newOrderBy(), e))
+
+	tests := []struct {
+		name     string
+		workMem  int
+		pageSize int
+		topN     int
+		encrypt  bool
+		spilled  bool
+	}{
+		{name: "in memory", workMem: 1024 * 1024, spilled: false},
+		{name: "a few runs", workMem: 4 * 1024, spilled: true},
+		{name: "a run per tuple", workMem: 1, spilled: true},
+		{name: "merged in several passes", workMem: 4 * 1024, pageSize: 1024, spilled: true},
+		{name: "top n in memory", workMem: 4 * 1024, topN: 10, spilled: false},
+		{name: "top n larger than work_mem", workMem: 4 * 1024, pageSize: 1024, topN: 900, spilled: true},
+		{name: "encrypted", workMem: 4 * 1024, pageSize: 1024, encrypt: true, spilled: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			opts := []diskmanager.Option{}
+			if test.encrypt {
+				opts = append(opts, diskmanager.WithEncryptionKey(bytes.Repeat([]byte{1}, 32)))
+			}
+			dir := t.TempDir()
+			dm, err := diskmanager.New(dir, opts...)
+			testutil.MustBeNil(t, err)
+
+			env := &Env{Engine: e, DiskManager: dm, WorkMem: test.workMem, PageSize: test.pageSize}
+			ob := newOrderBy()
+			ob.TopN = test.topN
+			testutil.MustBeNil(t, ob.Open(env))
+			testutil.MustEqual(t, len(ob.runs) > 0, test.spilled)
+			// the runs are merged until a block of each run fits in work_mem
+			testutil.MustEqual(t, len(ob.runs) <= ob.mergeFanIn(), true)
+
+			got := []sdb.Tuple{}
+			for {
+				tp, err := ob.Next()
+				testutil.MustBeNil(t, err)
+				if tp == nil {
+					break
+				}
+				got = append(got, tp)
+			}
+			testutil.MustEqual(t, len(spillFiles(t, dir)), len(ob.runs))
+
+			testutil.MustBeNil(t, ob.Close())
+			// sort is stable even when the tuples are spilled
+			if test.topN > 0 {
+				testutil.MustEqual(t, ids(got)[:test.topN], expected[:test.topN])
+			} else {
+				testutil.MustEqual(t, ids(got), expected)
+			}
+			testutil.MustEqual(t, spillFiles(t, dir), []string{})
+		})
+	}
+}
+
+func TestSpillFile(t *testing.T) {
+	// 3000 tuples don't fit in a block, and a tuple is larger than a block
+	large := strings.Repeat("x", 2000)
+	value := func(i int) string {
+		if i == 1500 {
+			return large
+		}
+		return "abcdefghij"
+	}
+
+	tests := []struct {
+		name string
+		opts []diskmanager.Option
+	}{
+		{name: "plain", opts: nil},
+		{name: "encrypted", opts: []diskmanager.Option{diskmanager.WithEncryptionKey(bytes.Repeat([]byte{1}, 32))}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			dm, err := diskmanager.New(t.TempDir(), test.opts...)
+			testutil.MustBeNil(t, err)
+
+			w := newSpillWriter(dm, 1024)
+			for i := 0; i < 3000; i++ {
+				serialized, err := engine.NewTuple([]interface{}{int64(i), value(i), nil}, 0).Serialize()
+				testutil.MustBeNil(t, err)
+				testutil.MustBeNil(t, w.write(serialized))
+			}
+			f, err := w.close()
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, f.blocks > 1, true)
+
+			rd := newSpillReader(dm, f)
+			for i := 0; i < 3000; i++ {
+				tp, err := rd.read()
+				testutil.MustBeNil(t, err)
+				testutil.MustEqual(t, tp.Value(0), int64(i))
+				testutil.MustEqual(t, tp.Value(1), value(i))
+				testutil.MustEqual(t, tp.Value(2), nil)
+			}
+			tp, err := rd.read()
+			testutil.MustBeNil(t, err)
+			testutil.MustEqual(t, tp, nil)
+
+			testutil.MustBeNil(t, f.remove(dm))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package planner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/dty1er/sdb/engine"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// When an operator needs more memory than work_mem, it writes the tuples to a temporary file
+// (spill file) through the disk manager, then reads them back later.
+//
+// The tuples are written as a sequence like below:
+// |length(4byte)|tuple(N byte)|length(4byte)|tuple(N byte)|...|
+// The sequence is split into the blocks of the same size (usually the page size), which are persisted
+// one by one. A tuple can span the blocks, so a tuple larger than the block (e.g. a joined tuple) is
+// also spilled. Every block of a file has the same size because the disk manager locates the blocks
+// (and the encrypted frames of them) by the size.
+
+// SpillFilePrefix is the prefix of the spill file name. Spill files are removed after the query,
+// so the files with the prefix are left only when sdb stops during the query. They are removed on start.
+const SpillFilePrefix = "__tmp_spill_"
+
+var spillFileSeq uint64
+
+// spillBlockSize returns the size of the block which is written to the spill files at once.
+func (env *Env) spillBlockSize() int {
+	if env.PageSize > 0 {
+		return env.PageSize
+	}
+	return engine.MaxPageSize
+}
+
+type spillBlock struct {
+	bs []byte
+}
+
+func newSpillBlock(size int) *spillBlock {
+	return &spillBlock{bs: make([]byte, size)}
+}
+
+func (b *spillBlock) Size() int {
+	return len(b.bs)
+}
+
+func (b *spillBlock) Serialize() ([]byte, error) {
+	return b.bs, nil
+}
+
+func (b *spillBlock) Deserialize(r io.Reader) error {
+	_, err := io.ReadFull(r, b.bs)
+	return err
+}
+
+// spillFile is a temporary file which holds the tuples.
+type spillFile struct {
+	name      string
+	blockSize int
+	blocks    int
+	// size is the length of the sequence written to the file.
+	size int
+}
+
+func newSpillFile(blockSize int) *spillFile {
+	seq := atomic.AddUint64(&spillFileSeq, 1)
+	return &spillFile{name: fmt.Sprintf("%s%d", SpillFilePrefix, seq), blockSize: blockSize}
+}
+
+func (f *spillFile) remove(dm sdb.DiskManager) error {
+	return dm.Remove(f.name)
+}
+
+// spillWriter appends the tuples to the spill file.
+type spillWriter struct {
+	dm    sdb.DiskManager
+	file  *spillFile
+	block *spillBlock
+	pos   int
+}
+
+func newSpillWriter(dm sdb.DiskManager, blockSize int) *spillWriter {
+	return &spillWriter{dm: dm, file: newSpillFile(blockSize), block: newSpillBlock(blockSize)}
+}
+
+// write appends the serialized tuple.
+func (w *spillWriter) write(serialized []byte) error {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(serialized)))
+	if err := w.append(length); err != nil {
+		return err
+	}
+
+	return w.append(serialized)
+}
+
+// append copies bs to the block. The block is flushed whenever it gets full, so bs can span the blocks.
+func (w *spillWriter) append(bs []byte) error {
+	for len(bs) > 0 {
+		n := copy(w.block.bs[w.pos:], bs)
+		w.pos += n
+		w.file.size += n
+		bs = bs[n:]
+
+		if w.pos == len(w.block.bs) {
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *spillWriter) flush() error {
+	if err := w.dm.Persist(w.file.name, w.file.blocks*w.file.blockSize, w.block); err != nil {
+		return fmt.Errorf("spill tuples: %w", err)
+	}
+
+	w.file.blocks++
+	w.pos = 0
+	return nil
+}
+
+// close writes the remaining tuples then returns the file.
+func (w *spillWriter) close() (*spillFile, error) {
+	if w.pos > 0 {
+		if err := w.flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	w.block = nil
+	return w.file, nil
+}
+
+// spillReader reads the tuples in the spill file from the head.
+type spillReader struct {
+	dm       sdb.DiskManager
+	file     *spillFile
+	block    *spillBlock
+	next     int // the block to be read next
+	pos      int
+	consumed int // the length of the sequence read so far
+}
+
+func newSpillReader(dm sdb.DiskManager, file *spillFile) *spillReader {
+	// pos at the end of the block makes the first block loaded
+	return &spillReader{dm: dm, file: file, block: newSpillBlock(file.blockSize), pos: file.blockSize}
+}
+
+// read returns the next tuple. nil is returned when all the tuples are read.
+func (r *spillReader) read() (sdb.Tuple, error) {
+	if r.consumed >= r.file.size {
+		return nil, nil
+	}
+
+	length := make([]byte, 4)
+	if err := r.readFull(length); err != nil {
+		return nil, err
+	}
+
+	serialized := make([]byte, binary.BigEndian.Uint32(length))
+	if err := r.readFull(serialized); err != nil {
+		return nil, err
+	}
+
+	var t engine.Tuple
+	if err := t.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, fmt.Errorf("read spilled tuples: %w", err)
+	}
+
+	return &t, nil
+}
+
+// readFull fills bs from the sequence, loading the next blocks as needed.
+func (r *spillReader) readFull(bs []byte) error {
+	for len(bs) > 0 {
+		if r.pos == len(r.block.bs) {
+			if err := r.dm.Load(r.file.name, r.next*r.file.blockSize, r.block); err != nil {
+				return fmt.Errorf("read spilled tuples: %w", err)
+			}
+			r.next++
+			r.pos = 0
+		}
+
+		n := copy(bs, r.block.bs[r.pos:])
+		r.pos += n
+		r.consumed += n
+		bs = bs[n:]
+	}
+
+	return nil
+}
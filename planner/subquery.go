@@ -0,0 +1,445 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/sdb"
+)
+
+// outerQuery is the query which has the subquery being planned. The columns of the outer query referred
+// in the subquery are read from tuple, whose layout is sc, or the output of agg when it is not nil.
+type outerQuery struct {
+	sc    *scope
+	agg   *Aggregate
+	tuple *OuterTuple
+	outer *outerQuery
+}
+
+// column plans the column of the outer query. The column is searched from the nearest outer query.
+func (oq *outerQuery) column(c *parser.ColName) *OuterColumn {
+	if !oq.sc.has(c) && oq.outer != nil {
+		return oq.outer.column(c)
+	}
+
+	col := oq.sc.column(c.Qualifier, c.Name)
+	if oq.agg != nil {
+		col = planGroupedColumn(oq.sc, oq.agg, c)
+	}
+
+	return &OuterColumn{Column: col, Outer: oq.tuple}
+}
+
+// has reports if the column is of a table in the scope, even when the column is not read.
+func (sc *scope) has(c *parser.ColName) bool {
+	for _, st := range sc.tables {
+		if c.Qualifier != "" && !strings.EqualFold(st.name, c.Qualifier) {
+			continue
+		}
+
+		for _, colDef := range st.table.Columns {
+			if colDef.Name == strings.ToLower(c.Name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// planSubquery plans the subquery in the expression evaluated against the tuple of sc (or agg).
+// The subquery is planned by a copy of the planner which knows the outer query.
+func (p *Planner) planSubquery(sc *scope, agg *Aggregate, sq *parser.Subquery) *SubqueryExpr {
+	outer := &OuterTuple{}
+	sub := *p
+	sub.outer = &outerQuery{sc: sc, agg: agg, tuple: outer, outer: p.outer}
+
+	pj, _ := sub.planQuery(sq.Select)
+	return &SubqueryExpr{Plan: pj, Outer: outer, Correlated: len(sq.Outer) > 0, Type: exprType(pj.Columns[0])}
+}
+
+// run executes the subquery for the outer tuple t and returns at most max rows. Negative max means every row.
+func (sq *SubqueryExpr) run(t sdb.Tuple, max int) ([]sdb.Tuple, error) {
+	if sq.done {
+		return sq.rows, nil
+	}
+
+	if sq.env == nil {
+		return nil, errors.New("subquery is executed before it is opened")
+	}
+
+	sq.Outer.tuple = t
+	if err := sq.Plan.Open(sq.env); err != nil {
+		return nil, err
+	}
+
+	rows := []sdb.Tuple{}
+	for max < 0 || len(rows) < max {
+		r, err := sq.Plan.Next()
+		if err != nil {
+			sq.Plan.Close()
+			return nil, err
+		}
+		if r == nil {
+			break
+		}
+		rows = append(rows, r)
+	}
+
+	if err := sq.Plan.Close(); err != nil {
+		return nil, err
+	}
+
+	if !sq.Correlated {
+		sq.rows, sq.done = rows, true
+	}
+
+	return rows, nil
+}
+
+// evalSubquery evaluates the scalar subquery. It is NULL when the subquery returns no row.
+func evalSubquery(e *SubqueryExpr, t sdb.Tuple) (interface{}, error) {
+	rows, err := e.run(t, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(rows) {
+	case 0:
+		return nil, nil
+	case 1:
+		return rows[0].Value(0), nil
+	}
+
+	return nil, errors.New("more than one row returned by a subquery used as an expression")
+}
+
+// bindSubqueries lets the subqueries in the expressions be executed in env. It is called when the operator
+// evaluating the expressions is opened. The result of the uncorrelated subquery is kept while env is the same.
+func bindSubqueries(env *Env, exprs ...Expr) {
+	for _, sq := range subqueries(exprs...) {
+		if sq.env != env {
+			sq.env, sq.rows, sq.done = env, nil, false
+		}
+	}
+}
+
+// subqueries returns the subqueries in the expressions. The ones in the subqueries are not included.
+func subqueries(exprs ...Expr) []*SubqueryExpr {
+	sqs := []*SubqueryExpr{}
+	for _, expr := range exprs {
+		walkExpr(expr, func(e Expr) {
+			if sq, ok := e.(*SubqueryExpr); ok {
+				sqs = append(sqs, sq)
+			}
+		})
+	}
+
+	return sqs
+}
+
+// expressions returns the expressions the operator evaluates. The columns of Distinct are not included
+// because they are the ones of the projection above it.
+func expressions(l List) []Expr {
+	switch n := l.(type) {
+	case *Projection:
+		return n.Columns
+	case *Selection:
+		return []Expr{n.Filter}
+	case *OrderBy:
+		return n.Columns
+	case *Values:
+		exprs := []Expr{}
+		for _, row := range n.Rows {
+			exprs = append(exprs, row...)
+		}
+		return exprs
+	case *Window:
+		exprs := append(append([]Expr{}, n.PartitionBy...), n.OrderBy...)
+		for _, f := range n.Funcs {
+			exprs = append(exprs, f.Args...)
+		}
+		return exprs
+	case *NestedLoopJoin:
+		return []Expr{n.Condition}
+	case *IndexNestedLoopJoin:
+		return []Expr{n.Condition}
+	case *HashJoin:
+		return []Expr{n.Condition}
+	case *MergeJoin:
+		return []Expr{n.Condition}
+	}
+
+	return nil
+}
+
+// walkExpr calls fn for the expression and every expression in it.
+func walkExpr(expr Expr, fn func(e Expr)) {
+	if expr == nil {
+		return
+	}
+
+	fn(expr)
+	switch e := expr.(type) {
+	case *ComparisonExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case *AndExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case *OrExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case *NotExpr:
+		walkExpr(e.Operand, fn)
+	case *IsNullExpr:
+		walkExpr(e.Operand, fn)
+	case *InExpr:
+		walkExpr(e.Operand, fn)
+		for _, val := range e.Values {
+			walkExpr(val, fn)
+		}
+		if e.Subquery != nil {
+			walkExpr(e.Subquery, fn)
+		}
+	case *LikeExpr:
+		walkExpr(e.Operand, fn)
+		walkExpr(e.Pattern, fn)
+	case *CaseExpr:
+		walkExpr(e.Operand, fn)
+		for _, w := range e.Whens {
+			walkExpr(w.Cond, fn)
+			walkExpr(w.Result, fn)
+		}
+		walkExpr(e.Else, fn)
+	case *ExistsExpr:
+		walkExpr(e.Subquery, fn)
+	case *BinaryExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case *UnaryMinusExpr:
+		walkExpr(e.Operand, fn)
+	case *FuncExpr:
+		for _, arg := range e.Args {
+			walkExpr(arg, fn)
+		}
+	case *NamedExpr:
+		walkExpr(e.Operand, fn)
+	}
+}
+
+// decorrelate converts "EXISTS (subquery)" and "x IN (subquery)" in WHERE into the semi join with the subquery,
+// and "NOT EXISTS (subquery)" into the anti join, so that the subquery is not executed for every tuple.
+// The subquery is joined as a derived relation which produces the IN column and the inner columns of the
+// correlated predicates. The conversion is done only when every correlated predicate is "inner column =
+// outer column" in WHERE of the subquery, and the subquery has no aggregation, window functions or LIMIT.
+// nil is returned otherwise.
+// NOT IN is not converted because it is unknown rather than true when the subquery returns NULL.
+func (o *optimizer) decorrelate(pred parser.Expr) *joinTree {
+	typ := parser.SemiJoin
+	if not, ok := pred.(*parser.NotExpr); ok {
+		typ = parser.AntiJoin
+		pred = not.Operand
+	}
+
+	var sq *parser.Subquery
+	var operand parser.Expr
+	switch e := pred.(type) {
+	case *parser.ExistsExpr:
+		// uncorrelated EXISTS is executed only once
+		if len(e.Subquery.Outer) == 0 {
+			return nil
+		}
+		sq = e.Subquery
+	case *parser.InExpr:
+		if e.Subquery == nil || e.Not || typ == parser.AntiJoin {
+			return nil
+		}
+		sq, operand = e.Subquery, e.Operand
+	default:
+		return nil
+	}
+
+	stmt, ok := sq.Select.(*parser.SelectStatement)
+	if !ok || stmt.IsAggregated() || stmt.HasWindow() || stmt.Limit != nil {
+		return nil
+	}
+
+	isOuter := func(c *parser.ColName) bool {
+		for _, oc := range sq.Outer {
+			if oc == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	// split WHERE of the subquery into the correlated predicates and the others
+	var where parser.Expr
+	inner, outer := []*parser.ColName{}, []*parser.ColName{}
+	consumed := map[*parser.ColName]bool{}
+	if stmt.Where != nil {
+		for _, p := range flattenAnd(stmt.Where.Expr) {
+			correlated := false
+			walkColNames(p, func(c *parser.ColName) { correlated = correlated || isOuter(c) })
+			if !correlated {
+				if where == nil {
+					where = p
+				} else {
+					where = &parser.AndExpr{Left: where, Right: p}
+				}
+				continue
+			}
+
+			in, out, ok := o.correlation(p, isOuter)
+			if !ok {
+				return nil
+			}
+			inner, outer = append(inner, in), append(outer, out)
+			consumed[out] = true
+		}
+	}
+
+	// the outer columns used elsewhere, e.g. in the select list, cannot be removed
+	for _, c := range sq.Outer {
+		if !consumed[c] {
+			return nil
+		}
+	}
+
+	derived := &parser.SelectStatement{Distinct: stmt.Distinct, SelectExprs: []parser.SelectExpr{}, From: stmt.From}
+	if where != nil {
+		derived.Where = &parser.Where{Expr: where}
+	}
+	if operand != nil {
+		derived.SelectExprs = append(derived.SelectExprs, stmt.SelectExprs[0])
+	}
+	for _, c := range inner {
+		derived.SelectExprs = append(derived.SelectExprs, &parser.AliasedExpr{Expr: c})
+	}
+	if len(derived.SelectExprs) == 0 {
+		return nil
+	}
+
+	sub := *o.planner
+	sub.outer = nil
+	pj, best := sub.planSelect(derived)
+	rel := o.derivedRelation(pj, best)
+
+	// the operand and the outer columns are compared with the columns of the derived relation in order
+	on := []parser.Expr{}
+	if operand != nil {
+		on = append(on, &parser.ComparisonExpr{Left: operand, Operator: parser.Op_EQ, Right: rel.column(0)})
+	}
+	for _, c := range outer {
+		on = append(on, &parser.ComparisonExpr{Left: c, Operator: parser.Op_EQ, Right: rel.column(len(on))})
+	}
+
+	return &joinTree{typ: typ, left: o.root, right: &joinTree{rel: rel}, on: on}
+}
+
+// correlation returns the columns of the predicate when it is "inner column = outer column".
+// The outer column must be of this query, not of the queries outside of it.
+func (o *optimizer) correlation(pred parser.Expr, isOuter func(c *parser.ColName) bool) (*parser.ColName, *parser.ColName, bool) {
+	cmp, ok := pred.(*parser.ComparisonExpr)
+	if !ok || cmp.Operator != parser.Op_EQ {
+		return nil, nil, false
+	}
+
+	in, iok := cmp.Left.(*parser.ColName)
+	out, ook := cmp.Right.(*parser.ColName)
+	if !iok || !ook {
+		return nil, nil, false
+	}
+
+	if isOuter(in) {
+		in, out = out, in
+	}
+	if isOuter(in) || !isOuter(out) {
+		return nil, nil, false
+	}
+
+	if rel, _ := o.resolve(out); rel == nil {
+		return nil, nil, false
+	}
+
+	return in, out, true
+}
+
+// derivedRelation adds the relation which is produced by the plan. Its columns are named c1, c2, ...
+func (o *optimizer) derivedRelation(pj *Projection, best *path) *relation {
+	name := ""
+	for n := 1; name == ""; n++ {
+		name = fmt.Sprintf("subquery%d", n)
+		for _, rel := range o.rels {
+			if strings.EqualFold(rel.name, name) {
+				name = ""
+				break
+			}
+		}
+	}
+
+	table := &schema.Table{Name: name, Columns: make([]*schema.ColumnDef, len(pj.Columns))}
+	for i, c := range pj.Columns {
+		table.Columns[i] = &schema.ColumnDef{Name: fmt.Sprintf("c%d", i+1), Type: exprType(c)}
+	}
+
+	return o.addDerived(table, pj, best.rows, best.cost)
+}
+
+// inlineRelation plans the select statement of the derived table or the common table expression, and adds
+// the relation produced by it. The columns are named as the validator resolved in def, and typed by the plan.
+// The statement cannot refer to the outer query.
+func (o *optimizer) inlineRelation(name string, def *schema.Table, q parser.Query) *relation {
+	sub := *o.planner
+	sub.outer = nil
+	pj, best := sub.planQuery(q)
+
+	table := &schema.Table{Name: name, Columns: make([]*schema.ColumnDef, len(pj.Columns))}
+	for i, c := range pj.Columns {
+		table.Columns[i] = &schema.ColumnDef{Name: def.Columns[i].Name, Type: exprType(c)}
+	}
+
+	// the aggregation without GROUP BY produces a row, and LIMIT caps the rows
+	// The estimation of the set operation already includes them.
+	rows := best.rows
+	if stmt, ok := q.(*parser.SelectStatement); ok {
+		if stmt.IsAggregated() && len(stmt.GroupBy) == 0 {
+			rows = 1
+		}
+		if stmt.Limit != nil && float64(stmt.Limit.Count) < rows {
+			rows = float64(stmt.Limit.Count)
+		}
+	}
+
+	return o.addDerived(table, pj, rows, best.cost)
+}
+
+// addDerived adds the relation of the table produced by the plan. Every column of it is used.
+func (o *optimizer) addDerived(table *schema.Table, pj *Projection, rows, cost float64) *relation {
+	used := make([]bool, len(table.Columns))
+	for i := range used {
+		used[i] = true
+	}
+
+	rel := &relation{
+		pos:   len(o.rels),
+		name:  table.Name,
+		table: table,
+		tbl:   &Table{Name: table.Name},
+		used:  used,
+		plan:  pj,
+		rows:  rows,
+		cost:  cost,
+	}
+	o.rels = append(o.rels, rel)
+	return rel
+}
+
+// column returns the i-th column of the relation.
+func (r *relation) column(i int) *parser.ColName {
+	return &parser.ColName{Qualifier: r.name, Name: r.table.Columns[i].Name}
+}
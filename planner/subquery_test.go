@@ -0,0 +1,172 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/dty1er/sdb/catalog"
+	"github.com/dty1er/sdb/schema"
+	"github.com/dty1er/sdb/testutil"
+)
+
+// newJoinCatalog returns the catalog of the tables in newJoinEngine.
+func newJoinCatalog() *catalog.Catalog {
+	return &catalog.Catalog{Tables: map[string]*schema.Table{
+		"users": {
+			Name: "users",
+			Columns: []*schema.ColumnDef{
+				{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+				{Name: "name", Type: schema.ColumnTypeString},
+				{Name: "dept_id", Type: schema.ColumnTypeInt64},
+			},
+			Indices: []*schema.Index{{Table: "users", Name: "users_pkey_id", ColumnIndex: 0}},
+		},
+		"depts": {
+			Name: "depts",
+			Columns: []*schema.ColumnDef{
+				{Name: "id", Type: schema.ColumnTypeInt64, Options: []schema.ColumnOption{schema.ColumnOptionPrimaryKey}},
+				{Name: "name", Type: schema.ColumnTypeString},
+			},
+			Indices: []*schema.Index{{Table: "depts", Name: "depts_pkey_id", ColumnIndex: 0}},
+		},
+	}}
+}
+
+func TestSubquery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected [][]interface{}
+	}{
+		{
+			name:     "in",
+			query:    `select id from users where dept_id in (select id from depts where name <> "hr") order by id`,
+			expected: [][]interface{}{{int64(1)}, {int64(2)}, {int64(4)}},
+		},
+		{
+			name:     "exists",
+			query:    `select id from users u where exists (select * from depts d where d.id = u.dept_id) order by id`,
+			expected: [][]interface{}{{int64(1)}, {int64(2)}, {int64(4)}},
+		},
+		{
+			name:     "not exists",
+			query:    `select id from users u where not exists (select * from depts d where d.id = u.dept_id) order by id`,
+			expected: [][]interface{}{{int64(3)}, {int64(5)}},
+		},
+		{
+			name:     "not in is unknown for NULL",
+			query:    `select id from users where dept_id not in (select id from depts) order by id`,
+			expected: [][]interface{}{{int64(5)}},
+		},
+		{
+			name:     "not in empty result",
+			query:    `select id from users where dept_id not in (select id from depts where id > 100) order by id`,
+			expected: [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}},
+		},
+		{
+			name:     "correlated scalar",
+			query:    `select id, (select name from depts where id = dept_id) from users order by id`,
+			expected: [][]interface{}{{int64(1), "eng"}, {int64(2), "ops"}, {int64(3), nil}, {int64(4), "eng"}, {int64(5), nil}},
+		},
+		{
+			name:     "correlated aggregate",
+			query:    `select name, (select count(*) from users u where u.dept_id = d.id) from depts d order by name`,
+			expected: [][]interface{}{{"eng", int64(2)}, {"hr", int64(0)}, {"ops", int64(1)}},
+		},
+		{
+			name:     "correlated to grouped column",
+			query:    `select dept_id from users where dept_id is not null group by dept_id having count(*) > (select count(*) from depts where id = dept_id) order by dept_id`,
+			expected: [][]interface{}{{int64(10)}, {int64(30)}},
+		},
+		{
+			name:     "nested",
+			query:    `select id from users u where exists (select * from users v where v.dept_id = u.dept_id and v.id <> u.id and exists (select * from depts d where d.id = v.dept_id)) order by id`,
+			expected: [][]interface{}{{int64(1)}, {int64(4)}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pj := planQuery(t, newJoinCatalog(), test.query)
+			rows := values(collect(t, pj, newJoinEngine()), len(test.expected[0]))
+			testutil.MustEqual(t, rows, test.expected)
+		})
+	}
+}
+
+func TestSubquery_MoreThanOneRow(t *testing.T) {
+	pj := planQuery(t, newJoinCatalog(), `select (select id from depts) from users`)
+
+	testutil.MustBeNil(t, pj.Open(&Env{Engine: newJoinEngine()}))
+	_, err := pj.Next()
+	testutil.MustEqual(t, err.Error(), "more than one row returned by a subquery used as an expression")
+	testutil.MustBeNil(t, pj.Close())
+}
+
+func TestSubquery_Uncorrelated(t *testing.T) {
+	pj := planQuery(t, newJoinCatalog(), `select id from users where dept_id = (select max(id) from depts where name = "eng")`)
+	e := newJoinEngine()
+	rows := values(collect(t, pj, e), 1)
+	testutil.MustEqual(t, rows, [][]interface{}{{int64(1)}, {int64(4)}})
+
+	// the subquery is executed only once; users and depts have 3 and 2 pages
+	testutil.MustEqual(t, e.pagesRead, 5)
+}
+
+func TestDerivedTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected [][]interface{}
+	}{
+		{
+			name:     "aggregated",
+			query:    `select d.name, t.n from (select dept_id, count(*) as n from users group by dept_id) t join depts d on t.dept_id = d.id order by d.name`,
+			expected: [][]interface{}{{"eng", int64(2)}, {"ops", int64(1)}},
+		},
+		{
+			name:     "renamed",
+			query:    `select x from (select id from users where id > 3) t (x) order by x`,
+			expected: [][]interface{}{{int64(4)}, {int64(5)}},
+		},
+		{
+			name:     "star",
+			query:    `select * from (select id, name from users where id = 2) t`,
+			expected: [][]interface{}{{int64(2), "bob"}},
+		},
+		{
+			name:     "left join",
+			query:    `select u.id, t.name from users u left join (select id, name from depts where id > 10) t on u.dept_id = t.id order by u.id`,
+			expected: [][]interface{}{{int64(1), nil}, {int64(2), "ops"}, {int64(3), nil}, {int64(4), nil}, {int64(5), nil}},
+		},
+		{
+			name:     "limit",
+			query:    `select count(*) from (select id from users order by id desc limit 2) t`,
+			expected: [][]interface{}{{int64(2)}},
+		},
+		{
+			name:     "with",
+			query:    `with a as (select id, dept_id from users where dept_id is not null), b as (select id from a where dept_id = 10) select id from b order by id`,
+			expected: [][]interface{}{{int64(1)}, {int64(4)}},
+		},
+		{
+			name:     "with referred twice",
+			query:    `with a as (select id, dept_id from users) select x.id, y.id from a x join a y on x.dept_id = y.dept_id and x.id < y.id`,
+			expected: [][]interface{}{{int64(1), int64(4)}},
+		},
+		{
+			name:     "with in subquery",
+			query:    `with e as (select id from depts where name = "eng") select id from users where dept_id in (select id from e) order by id`,
+			expected: [][]interface{}{{int64(1)}, {int64(4)}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pj := planQuery(t, newJoinCatalog(), test.query)
+			rows := values(collect(t, pj, newJoinEngine()), len(test.expected[0]))
+			testutil.MustEqual(t, rows, test.expected)
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package planner
+
+import (
+	"reflect"
+
+	"github.com/dty1er/sdb/parser"
+	"github.com/dty1er/sdb/schema"
+)
+
+// windowColumn is the column of the tuple in which Window produces the result of the window function call.
+type windowColumn struct {
+	f   *parser.FuncExpr
+	col *Column
+}
+
+// planWindows plans the window functions in the select list and ORDER BY. The calls of the same window are
+// computed by a Window, which reads the tuples sorted by the partition and order keys. The results are
+// appended to the tuple, and planExpr refers to them by windowColumn.
+// The aggregate functions in the arguments and the windows are added to the aggregation beforehand,
+// because the results of the window functions are placed after the ones of the aggregation.
+func (p *Planner) planWindows(sc *scope, agg *Aggregate, stmt *parser.SelectStatement, list List) List {
+	p.windows = nil
+
+	exprs := []parser.Expr{}
+	for _, se := range stmt.SelectExprs {
+		if ae, ok := se.(*parser.AliasedExpr); ok {
+			exprs = append(exprs, ae.Expr)
+		}
+	}
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+
+	funcs := []*parser.FuncExpr{}
+	for _, expr := range exprs {
+		walkFuncs(expr, func(f *parser.FuncExpr) {
+			switch {
+			case f.Over != nil:
+				funcs = append(funcs, f)
+			case f.IsAggregate() && agg != nil:
+				p.planAggregate(sc, agg, f)
+			}
+		})
+	}
+
+	if len(funcs) == 0 {
+		return list
+	}
+
+	// the same window function call is computed only once, and the calls of the same window share a Window
+	specs := []*parser.WindowSpec{}
+	windows := []*Window{}
+	columns := [][]*Column{}
+	for _, f := range funcs {
+		if p.windowColumn(f) != nil {
+			continue
+		}
+
+		i := 0
+		for i < len(specs) && !reflect.DeepEqual(specs[i], f.Over) {
+			i++
+		}
+		if i == len(specs) {
+			specs = append(specs, f.Over)
+			windows = append(windows, p.planWindow(sc, agg, f.Over))
+			columns = append(columns, []*Column{})
+		}
+
+		wf := p.planWindowFunc(sc, agg, f)
+		col := &Column{Name: exprName(f), Type: wf.Type}
+		windows[i].Funcs = append(windows[i].Funcs, wf)
+		columns[i] = append(columns[i], col)
+		p.windows = append(p.windows, &windowColumn{f: f, col: col})
+	}
+
+	width := sc.width()
+	if agg != nil {
+		width = len(agg.GroupBy) + len(agg.Aggregates)
+	}
+
+	for i, w := range windows {
+		for j, col := range columns[i] {
+			col.Index = width + j
+		}
+		width += len(w.Funcs)
+
+		// the tuples are sorted by the partition keys then the order keys; no sort is needed for "OVER ()"
+		w.Input = list
+		if len(w.PartitionBy)+len(w.OrderBy) > 0 {
+			ob := &OrderBy{Columns: []Expr{}, Directirons: []string{}, Input: list}
+			for _, e := range w.PartitionBy {
+				ob.Columns = append(ob.Columns, e)
+				ob.Directirons = append(ob.Directirons, parser.OrderDirection_ASC.String())
+			}
+			for j, o := range specs[i].OrderBy {
+				ob.Columns = append(ob.Columns, w.OrderBy[j])
+				ob.Directirons = append(ob.Directirons, o.Direction.String())
+			}
+			w.Input = ob
+		}
+		list = w
+	}
+
+	return list
+}
+
+// planWindow makes the Window of the window specification. Its functions are added by the caller.
+func (p *Planner) planWindow(sc *scope, agg *Aggregate, spec *parser.WindowSpec) *Window {
+	w := &Window{PartitionBy: []Expr{}, OrderBy: []Expr{}, Frame: spec.Frame, Funcs: []*WindowFunc{}}
+	for _, e := range spec.PartitionBy {
+		w.PartitionBy = append(w.PartitionBy, p.planExpr(sc, agg, e))
+	}
+	for _, o := range spec.OrderBy {
+		w.OrderBy = append(w.OrderBy, p.planExpr(sc, agg, o.Expr))
+	}
+
+	return w
+}
+
+// planWindowFunc plans the arguments of the window function call and decides its result type.
+func (p *Planner) planWindowFunc(sc *scope, agg *Aggregate, f *parser.FuncExpr) *WindowFunc {
+	wf := &WindowFunc{Func: f.Name, Args: make([]Expr, len(f.Args)), Type: schema.ColumnTypeInt64}
+	for i, arg := range f.Args {
+		wf.Args[i] = p.planExpr(sc, agg, arg)
+	}
+
+	switch f.Name {
+	case "lag", "lead":
+		// the default is the same type as the value
+		if len(f.Args) > 2 {
+			wf.Args[2] = convertLiteral(wf.Args[2], f.Args[2], wf.Args[0], f.Args[0])
+		}
+		wf.Type = exprType(wf.Args[0])
+	case "sum", "avg", "min", "max":
+		wf.Type = aggregateType(f.Name, exprType(wf.Args[0]))
+	}
+
+	return wf
+}
+
+// windowColumn returns the column of the result of the window function call, or nil when it is not planned yet.
+func (p *Planner) windowColumn(f *parser.FuncExpr) *Column {
+	for _, wc := range p.windows {
+		if reflect.DeepEqual(wc.f, f) {
+			return wc.col
+		}
+	}
+
+	return nil
+}
+
+// walkFuncs calls fn for every function call in the expression, including the ones in the arguments
+// and the windows. The function calls in the subqueries are not included.
+func walkFuncs(expr parser.Expr, fn func(f *parser.FuncExpr)) {
+	switch e := expr.(type) {
+	case *parser.FuncExpr:
+		fn(e)
+		for _, arg := range e.Args {
+			walkFuncs(arg, fn)
+		}
+		if e.Over != nil {
+			for _, p := range e.Over.PartitionBy {
+				walkFuncs(p, fn)
+			}
+			for _, o := range e.Over.OrderBy {
+				walkFuncs(o.Expr, fn)
+			}
+		}
+	case *parser.AndExpr:
+		walkFuncs(e.Left, fn)
+		walkFuncs(e.Right, fn)
+	case *parser.OrExpr:
+		walkFuncs(e.Left, fn)
+		walkFuncs(e.Right, fn)
+	case *parser.NotExpr:
+		walkFuncs(e.Operand, fn)
+	case *parser.IsNullExpr:
+		walkFuncs(e.Operand, fn)
+	case *parser.ComparisonExpr:
+		walkFuncs(e.Left, fn)
+		walkFuncs(e.Right, fn)
+	case *parser.BinaryExpr:
+		walkFuncs(e.Left, fn)
+		walkFuncs(e.Right, fn)
+	case *parser.UnaryMinusExpr:
+		walkFuncs(e.Operand, fn)
+	case *parser.InExpr:
+		walkFuncs(e.Operand, fn)
+		for _, val := range e.Values {
+			walkFuncs(val, fn)
+		}
+	case *parser.LikeExpr:
+		walkFuncs(e.Operand, fn)
+		walkFuncs(e.Pattern, fn)
+	case *parser.CaseExpr:
+		if e.Operand != nil {
+			walkFuncs(e.Operand, fn)
+		}
+		for _, w := range e.Whens {
+			walkFuncs(w.Cond, fn)
+			walkFuncs(w.Result, fn)
+		}
+		if e.Else != nil {
+			walkFuncs(e.Else, fn)
+		}
+	}
+}
+
+// readPartition reads the tuples of the next partition from the input and computes the window functions
+// for them. No tuple is read when the input is exhausted.
+func (w *Window) readPartition() error {
+	w.tuples, w.results, w.idx = nil, nil, 0
+	if w.next == nil && !w.done {
+		if err := w.advance(); err != nil {
+			return err
+		}
+	}
+	if w.next == nil {
+		return nil
+	}
+
+	first, err := sortKeys(w.PartitionBy, w.next)
+	if err != nil {
+		return err
+	}
+
+	for w.next != nil {
+		keys, err := sortKeys(w.PartitionBy, w.next)
+		if err != nil {
+			return err
+		}
+		if !sameKeys(first, keys) {
+			break
+		}
+
+		w.tuples = append(w.tuples, w.next)
+		if err := w.advance(); err != nil {
+			return err
+		}
+	}
+
+	return w.compute()
+}
+
+// advance reads the next tuple from the input into w.next.
+func (w *Window) advance() error {
+	t, err := w.Input.Next()
+	if err != nil {
+		return err
+	}
+
+	w.next = t
+	w.done = t == nil
+	return nil
+}
+
+// sameKeys reports if the keys are equal. NULLs are equal to each other.
+func sameKeys(a, b []interface{}) bool {
+	for i := range a {
+		if compareForSort(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compute computes the window functions for each tuple in the current partition.
+func (w *Window) compute() error {
+	n := len(w.tuples)
+
+	// the peers of the i-th tuple are from start[i] to end[i] (exclusive)
+	start, end := make([]int, n), make([]int, n)
+	keys := make([][]interface{}, n)
+	for i, t := range w.tuples {
+		k, err := sortKeys(w.OrderBy, t)
+		if err != nil {
+			return err
+		}
+		keys[i] = k
+	}
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && sameKeys(keys[i], keys[j]) {
+			j++
+		}
+		for k := i; k < j; k++ {
+			start[k], end[k] = i, j
+		}
+		i = j
+	}
+
+	w.results = make([][]interface{}, n)
+	for i := range w.results {
+		w.results[i] = make([]interface{}, len(w.Funcs))
+	}
+
+	for j, f := range w.Funcs {
+		values, err := w.computeFunc(f, start, end)
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			w.results[i][j] = v
+		}
+	}
+
+	return nil
+}
+
+// computeFunc computes the window function for each tuple in the current partition.
+func (w *Window) computeFunc(f *WindowFunc, start, end []int) ([]interface{}, error) {
+	values := make([]interface{}, len(w.tuples))
+	switch f.Func {
+	case "row_number":
+		for i := range values {
+			values[i] = int64(i + 1)
+		}
+	case "rank":
+		for i := range values {
+			values[i] = int64(start[i] + 1)
+		}
+	case "dense_rank":
+		rank := int64(0)
+		for i := range values {
+			if start[i] == i {
+				rank++
+			}
+			values[i] = rank
+		}
+	case "lag", "lead":
+		return w.shift(f)
+	default:
+		return w.aggregate(f, end)
+	}
+
+	return values, nil
+}
+
+// shift computes LAG or LEAD; the value of the tuple offset rows before or after the tuple in the partition.
+// The default, or NULL when it is omitted, is used when there is no such tuple.
+func (w *Window) shift(f *WindowFunc) ([]interface{}, error) {
+	values := make([]interface{}, len(w.tuples))
+	for i, t := range w.tuples {
+		offset := int64(1)
+		if len(f.Args) > 1 {
+			v, err := eval(f.Args[1], t)
+			if err != nil {
+				return nil, err
+			}
+			offset = v.(int64)
+		}
+		if f.Func == "lag" {
+			offset = -offset
+		}
+
+		var err error
+		switch j := int64(i) + offset; {
+		case 0 <= j && j < int64(len(w.tuples)):
+			values[i], err = eval(f.Args[0], w.tuples[j])
+		case len(f.Args) > 2:
+			values[i], err = eval(f.Args[2], t)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// aggregate computes the aggregate function on the frame of each tuple. When the frame starts at the start
+// of the partition, the frame only grows as the tuple proceeds, so the accumulator is shared among the tuples.
+// Otherwise, it is computed from scratch for each tuple.
+func (w *Window) aggregate(f *WindowFunc, end []int) ([]interface{}, error) {
+	ae := &AggregateExpr{Func: f.Func}
+	if len(f.Args) > 0 {
+		ae.Arg = f.Args[0]
+	}
+
+	args := make([]interface{}, len(w.tuples))
+	if ae.Arg != nil {
+		for i, t := range w.tuples {
+			v, err := eval(ae.Arg, t)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+	}
+
+	values := make([]interface{}, len(w.tuples))
+	if w.Frame == nil || w.Frame.Start.Type == parser.FrameUnboundedPreceding {
+		acc := newAccumulator(ae)
+		added := 0
+		for i := range values {
+			_, hi := w.frame(i, end)
+			for ; added < hi; added++ {
+				if err := acc.add(args[added]); err != nil {
+					return nil, err
+				}
+			}
+			values[i] = acc.result()
+		}
+		return values, nil
+	}
+
+	for i := range values {
+		acc := newAccumulator(ae)
+		lo, hi := w.frame(i, end)
+		for k := lo; k < hi; k++ {
+			if err := acc.add(args[k]); err != nil {
+				return nil, err
+			}
+		}
+		values[i] = acc.result()
+	}
+
+	return values, nil
+}
+
+// frame returns the range of the frame of the i-th tuple in the partition, from lo to hi (exclusive).
+// end is the end of the peers of each tuple. The frame can be empty.
+func (w *Window) frame(i int, end []int) (int, int) {
+	n := len(w.tuples)
+	if w.Frame == nil {
+		return 0, end[i]
+	}
+
+	lo := frameRow(w.Frame.Start, i, n)
+	hi := frameRow(w.Frame.End, i, n) + 1
+	if lo < 0 {
+		lo = 0
+	}
+	if lo > n {
+		lo = n
+	}
+	if hi > n {
+		hi = n
+	}
+	if hi < lo {
+		hi = lo
+	}
+
+	return lo, hi
+}
+
+// frameRow returns the position of the frame bound for the i-th tuple in the partition of n tuples.
+// It can be out of the partition.
+func frameRow(b *parser.FrameBound, i, n int) int {
+	switch b.Type {
+	case parser.FrameUnboundedPreceding:
+		return 0
+	case parser.FramePreceding:
+		return i - b.Offset
+	case parser.FrameFollowing:
+		return i + b.Offset
+	case parser.FrameUnboundedFollowing:
+		return n - 1
+	}
+
+	// current row
+	return i
+}
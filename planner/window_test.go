@@ -0,0 +1,85 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/dty1er/sdb/testutil"
+)
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected [][]interface{}
+	}{
+		{
+			name:     "row_number",
+			query:    `select id, row_number() over (order by id desc) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(5)}, {int64(2), int64(4)}, {int64(3), int64(3)}, {int64(4), int64(2)}, {int64(5), int64(1)}},
+		},
+		{
+			name:     "partition by",
+			query:    `select id, row_number() over (partition by dept_id order by id) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(1)}, {int64(2), int64(1)}, {int64(3), int64(1)}, {int64(4), int64(2)}, {int64(5), int64(1)}},
+		},
+		{
+			name:     "rank and dense_rank",
+			query:    `select id, rank() over (order by dept_id), dense_rank() over (order by dept_id) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(2), int64(2)}, {int64(2), int64(4), int64(3)}, {int64(3), int64(1), int64(1)}, {int64(4), int64(2), int64(2)}, {int64(5), int64(5), int64(4)}},
+		},
+		{
+			name:     "lag and lead",
+			query:    `select id, lag(name) over (order by id), lead(id, 2, 0) over (order by id) from users order by id`,
+			expected: [][]interface{}{{int64(1), nil, int64(3)}, {int64(2), "alice", int64(4)}, {int64(3), "bob", int64(5)}, {int64(4), "carol", int64(0)}, {int64(5), "dave", int64(0)}},
+		},
+		{
+			name:     "running sum",
+			query:    `select id, sum(id) over (order by id) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(1)}, {int64(2), int64(3)}, {int64(3), int64(6)}, {int64(4), int64(10)}, {int64(5), int64(15)}},
+		},
+		{
+			name:     "peers are in the frame",
+			query:    `select id, count(*) over (order by dept_id) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(3)}, {int64(2), int64(4)}, {int64(3), int64(1)}, {int64(4), int64(3)}, {int64(5), int64(5)}},
+		},
+		{
+			name:     "whole partition",
+			query:    `select id, avg(id) over (partition by dept_id) from users where dept_id is not null order by id`,
+			expected: [][]interface{}{{int64(1), 2.5}, {int64(2), float64(2)}, {int64(4), 2.5}, {int64(5), float64(5)}},
+		},
+		{
+			name:     "rows between",
+			query:    `select id, sum(id) over (order by id rows between 1 preceding and 1 following) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(3)}, {int64(2), int64(6)}, {int64(3), int64(9)}, {int64(4), int64(12)}, {int64(5), int64(9)}},
+		},
+		{
+			name:     "empty frame",
+			query:    `select id, max(id) over (order by id rows between 2 following and unbounded following) from users order by id`,
+			expected: [][]interface{}{{int64(1), int64(5)}, {int64(2), int64(5)}, {int64(3), int64(5)}, {int64(4), nil}, {int64(5), nil}},
+		},
+		{
+			name:     "aggregated",
+			query:    `select dept_id, count(*), sum(count(*)) over (order by dept_id) from users group by dept_id order by dept_id`,
+			expected: [][]interface{}{{nil, int64(1), int64(1)}, {int64(10), int64(2), int64(3)}, {int64(20), int64(1), int64(4)}, {int64(30), int64(1), int64(5)}},
+		},
+		{
+			name:     "order by window function",
+			query:    `select name from users order by row_number() over (order by name desc) limit 2`,
+			expected: [][]interface{}{{"eve"}, {"dave"}},
+		},
+		{
+			name:     "in derived table",
+			query:    `select id from (select id, rank() over (partition by dept_id order by id desc) as r from users) t where r = 1 order by id`,
+			expected: [][]interface{}{{int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pj := planQuery(t, newJoinCatalog(), test.query)
+			rows := values(collect(t, pj, newJoinEngine()), len(test.expected[0]))
+			testutil.MustEqual(t, rows, test.expected)
+		})
+	}
+}
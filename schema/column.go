@@ -69,12 +69,33 @@ func ConvertValue(v string, t ColumnType) (interface{}, error) {
 	return nil, fmt.Errorf("unknown type")
 }
 
+// FormatValue formats the value to the literal which ConvertValue converts back to the value.
+// Bytes value is not supported.
+func FormatValue(v interface{}) string {
+	switch x := v.(type) {
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case string:
+		return x
+	case time.Time:
+		return x.UTC().Format("2006-01-02 15:04:05")
+	}
+	return ""
+}
+
 type ColumnOption uint8
 
 const (
 	ColumnOptionNoOption ColumnOption = iota
 	ColumnOptionPrimaryKey
 	ColumnOptionDefaultValue
+	ColumnOptionNotNull
+	// ColumnOptionDefaultCurrentTimestamp makes the current time the default value.
+	ColumnOptionDefaultCurrentTimestamp
 	// FUTURE WORK: support more types
 	// https://github.com/blastrain/vitess-sqlparser/blob/develop/sqlparser/ast.go#L966-L977
 )
@@ -83,31 +104,46 @@ type ColumnDef struct {
 	Name       string
 	Type       ColumnType
 	Options    []ColumnOption
-	DefaultVal interface{}
+	// DefaultVal is the literal of the default value. It is converted to the column type on use
+	// so that it is persisted in the catalog without losing the type.
+	DefaultVal string
 	// FUTURE WORK: support table options (e.g. encryption, max_rows, charset...)
 	// https://dev.mysql.com/doc/refman/8.0/en/create-table.html
 }
 
+// HasOption returns if the column has the given option.
+func (cd *ColumnDef) HasOption(opt ColumnOption) bool {
+	for _, o := range cd.Options {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDefault returns if the column has the default value other than NULL.
+func (cd *ColumnDef) HasDefault() bool {
+	return cd.HasOption(ColumnOptionDefaultValue) || cd.HasOption(ColumnOptionDefaultCurrentTimestamp)
+}
+
+// Nullable returns if the column accepts NULL. Primary key never accepts NULL.
+func (cd *ColumnDef) Nullable() bool {
+	return !cd.HasOption(ColumnOptionPrimaryKey) && !cd.HasOption(ColumnOptionNotNull)
+}
+
+// DefaultValue returns the value used when the column value is omitted on insert.
+// When no default value is defined, nil (NULL) is returned.
 func (cd *ColumnDef) DefaultValue() interface{} {
 	for _, opt := range cd.Options {
-		if opt == ColumnOptionDefaultValue {
-			return cd.DefaultValue
+		switch opt {
+		case ColumnOptionDefaultValue:
+			// The literal is validated when the table is created, so ignore error
+			v, _ := ConvertValue(cd.DefaultVal, cd.Type)
+			return v
+		case ColumnOptionDefaultCurrentTimestamp:
+			return time.Now()
 		}
 	}
-	switch cd.Type {
-	case ColumnTypeBool:
-		return false
-	case ColumnTypeInt64:
-		return int64(0)
-	case ColumnTypeFloat64:
-		return float64(0)
-	case ColumnTypeBytes:
-		return []byte{}
-	case ColumnTypeString:
-		return ""
-	case ColumnTypeTimestamp:
-		return time.Time{}
-	}
 	return nil
 }
 
@@ -140,4 +176,6 @@ type Table struct {
 	Columns         []*ColumnDef	// 字段(列)
 	Indices         []*Index		// 索引
 	PrimaryKeyIndex int				// 主键
+	// Statistics is collected by ANALYZE. nil when the table is never analyzed.
+	Statistics *TableStatistics
 }
@@ -0,0 +1,30 @@
+package schema
+
+// TableStatistics is the statistics of the table collected by ANALYZE.
+// The planner uses it to estimate how many rows each part of the query produces.
+type TableStatistics struct {
+	// RowCount is estimated from the sampled pages when not every page is read.
+	RowCount     int64
+	PageCount    int
+	SampledPages int
+	// Columns is the statistics of each column in the order of the table columns.
+	Columns []*ColumnStatistics
+}
+
+// ColumnStatistics is the statistics of the column values.
+// The values are kept as the literals (see FormatValue) so that they are persisted without losing the type.
+// Min, Max, MostCommonValues and Histogram are not collected for bytes column.
+type ColumnStatistics struct {
+	// NullFraction is the fraction of the rows whose value is NULL.
+	NullFraction float64
+	// DistinctCount is the estimated number of the distinct values except NULL.
+	DistinctCount float64
+	// Min and Max are the smallest and the largest values. They are empty when no value is found.
+	Min, Max string
+	// MostCommonValues are the most frequent values, and MostCommonFreqs are their fractions of the rows.
+	MostCommonValues []string
+	MostCommonFreqs  []float64
+	// Histogram is the bounds of the buckets which have the same number of the values (equi-depth histogram).
+	// The most common values are not counted in the histogram.
+	Histogram []string
+}
@@ -34,6 +34,10 @@ type Catalog interface {
 	GetColumnDef(table string, column string) (*schema.ColumnDef, error)
 	FindTable(table string) bool
 	ListIndices() []*schema.Index
+	// ListTables returns all the tables sorted by the name.
+	ListTables() []*schema.Table
+	// SetStatistics replaces the statistics of the table collected by ANALYZE.
+	SetStatistics(table string, stats *schema.TableStatistics) error
 	Persist() error
 }
 
@@ -49,6 +53,10 @@ type Tuple interface {
 	Deserializer
 	Less(than Tuple) bool
 	Projection(colIndices []int) Tuple
+	// Value returns the column value at the index. nil means NULL.
+	Value(i int) interface{}
+	// Len returns the number of the columns.
+	Len() int
 }
 
 type IndexKey interface {
@@ -87,12 +95,35 @@ func (k *Int64IndexKey) Less(than IndexKey) bool {
 	return k.val < thanV.val
 }
 
+// IndexIterator iterates the tuples in the index.
+type IndexIterator interface {
+	// Next returns the next tuple. nil is returned when no more tuples are found.
+	Next() Tuple
+}
+
 // Engine is a storage engine of sdb.
 type Engine interface {
 	CreateIndex(table, idxName string)
-	InsertTuple(table string, t Tuple) error
-	InsertIndex(table, idxName string, key IndexKey, t Tuple) error
-	ReadTable(table string) ([]Tuple, error)
+	// InsertTuple inserts the tuple to the table and returns the page number of the tuple.
+	InsertTuple(table string, t Tuple) (int, error)
+	// UpdateTuple replaces the tuple which has the same key as t with t. The old tuple is found by the index.
+	// It returns the page number of t.
+	UpdateTuple(table, idxName string, t Tuple) (int, error)
+	// InsertIndex puts the tuple on the page to the index. The entry of the same key is replaced.
+	InsertIndex(table, idxName string, key IndexKey, t Tuple, page int) error
+	// LookupIndex returns the tuple whose key is the given value in the index. nil is returned when not found.
+	LookupIndex(table, idxName string, key interface{}) (Tuple, error)
+	// SeekIndex returns the iterator of the tuples in the index in the order of the key, starting from
+	// the smallest key which is not less than the given key. When the key is nil, it starts from the smallest key.
+	SeekIndex(table, idxName string, key interface{}) (IndexIterator, error)
+	// PageSize returns the page size of the database.
+	PageSize() int
+	// PageCount returns the number of the pages of the table.
+	PageCount(table string) int
+	// ReadPage returns the tuples in the n-th page of the table. n starts from 0.
+	ReadPage(table string, n int) ([]Tuple, error)
+	// PageCached reports whether the n-th page of the table is on the buffer pool, so that it is read without disk access.
+	PageCached(table string, n int) bool
 	Shutdown() error
 }
 
@@ -110,4 +141,6 @@ type Deserializer interface {
 type DiskManager interface {
 	Load(name string, offset int, d Deserializer) error
 	Persist(name string, offset int, s Serializer) error
+	// Remove deletes the file. It is used to clean up the temporary files.
+	Remove(name string) error
 }
@@ -34,10 +34,11 @@ type Error struct {
 }
 
 type ResultSet struct {
-	Message string
-	Columns []string // empty when insert, update, delete
-	Values  []Tuple  // empty when insert, update, delete
-	Count   int      // empty when insert
+	Message     string
+	Columns     []string // empty when insert, update, delete
+	ColumnTypes []string // type of each column. empty when insert, update, delete
+	Values      []Tuple  // empty when insert, update, delete
+	Count       int      // empty when insert
 }
 
 func New(parser Parser, planner Planner, catalog Catalog, executor Executor, engine Engine, diskManager DiskManager) *SDB {
@@ -52,10 +52,11 @@ type Error struct {
 }
 
 type ResultSet struct {
-	Message string
-	Columns []string        // empty when insert, update, delete
-	Values  []*engine.Tuple // empty when insert, update, delete
-	Count   int             // empty when insert
+	Message     string
+	Columns     []string        // empty when insert, update, delete
+	ColumnTypes []string        // type of each column. empty when insert, update, delete
+	Values      []*engine.Tuple // empty when insert, update, delete
+	Count       int             // empty when insert
 }
 
 func (s *Server) sdbHandler() http.Handler {
@@ -95,10 +96,11 @@ func (s *Server) sdbHandler() http.Handler {
 		res := &Response{
 			Code: "OK",
 			RS: &ResultSet{
-				Message: resp.RS.Message,
-				Columns: resp.RS.Columns,
-				Values:  vals,
-				Count:   resp.RS.Count,
+				Message:     resp.RS.Message,
+				Columns:     resp.RS.Columns,
+				ColumnTypes: resp.RS.ColumnTypes,
+				Values:      vals,
+				Count:       resp.RS.Count,
 			},
 		}
 		w.WriteHeader(http.StatusOK)